@@ -23,12 +23,18 @@ import (
 	"runtime"
 	"time"
 
-	"github.com/go-logr/glogr"
 	flag "github.com/spf13/pflag"
 	"github.com/wave-k8s/wave/pkg/apis"
 	"github.com/wave-k8s/wave/pkg/controller"
+	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/pkg/hashquery"
+	"github.com/wave-k8s/wave/pkg/readiness"
 	"github.com/wave-k8s/wave/pkg/webhook"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -39,7 +45,62 @@ var (
 	leaderElection          = flag.Bool("leader-election", false, "Should the controller use leader election")
 	leaderElectionID        = flag.String("leader-election-id", "", "Name of the configmap used by the leader election system")
 	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace for the configmap used by the leader election system")
+	kubeAPIQPS              = flag.Float32("kube-api-qps", 0, "Maximum queries per second to the Kubernetes API server (0 uses the client default)")
+	kubeAPIBurst            = flag.Int("kube-api-burst", 0, "Maximum burst of queries to the Kubernetes API server (0 uses the client default)")
+	readinessBindAddress    = flag.String("readiness-bind-address", ":9440", "Address the readiness endpoint binds to (0 disables the endpoint)")
+	hashBindAddress         = flag.String("hash-bind-address", "0", "Address the read-only endpoint serving the configuration hash of workloads binds to (0 disables the endpoint)")
 	syncPeriod              = flag.Duration("sync-period", 5*time.Minute, "Reconcile sync period")
+	includeOwnNamespace     = flag.Bool("include-own-namespace", false, "Should the controller reconcile workloads in the namespace it is running in")
+	namespaceAllowlist      = flag.StringSlice("namespace-allowlist", nil, "Comma separated list of the only namespaces to reconcile workloads in (empty allows all namespaces)")
+	namespaceDenylist       = flag.StringSlice("namespace-denylist", nil, "Comma separated list of namespaces not to reconcile workloads in, taking precedence over --namespace-allowlist")
+	debounceInterval        = flag.Duration("debounce-interval", 0, "Period to wait after a change to a ConfigMap or Secret before reconciling the workloads using it, so that changes within the period trigger a single rollout (0 disables debouncing)")
+	missingChildGrace       = flag.Duration("missing-child-grace", 0, "Period to wait for a missing required ConfigMap or Secret to reappear before reporting an error")
+	reverseWatchCoalesce    = flag.Duration("reverse-watch-coalesce", 0, "Window within which repeated updates to a ConfigMap or Secret enqueue its owners only once (0 disables coalescing)")
+	merkleHash              = flag.Bool("merkle-hash", false, "Should the controller hash each ConfigMap and Secret separately and cache the results (changes all configuration hashes)")
+	hashAlgorithm           = flag.String("hash-algorithm", core.HashAlgorithmSHA256, "Algorithm the configuration hash is computed with: sha256 or fnv (changes all configuration hashes, cannot be used with --merkle-hash)")
+	hashVersionPrefix       = flag.Bool("hash-version-prefix", false, "Should the controller prefix configuration hashes with their format, keeping hashes of another format until the configuration changes")
+	extraChildGVKs          = flag.StringSlice("extra-child-gvks", nil, "Comma separated list of the kinds, in the form <group>/<version>/<kind>, of children other than ConfigMaps and Secrets to track, holding their configuration in a data map (cannot be used with --index-children or --disable-owner-references)")
+	enableKruise            = flag.Bool("enable-kruise", false, "Should the controller reconcile OpenKruise CloneSets and Advanced StatefulSets")
+	enableArgoRollouts      = flag.Bool("enable-argo-rollouts", false, "Should the controller reconcile Argo Rollouts")
+	enableDeploymentConfigs = flag.Bool("enable-deploymentconfigs", false, "Should the controller reconcile OpenShift DeploymentConfigs")
+	enableReplicaSets       = flag.Bool("enable-replicasets", false, "Should the controller reconcile ReplicaSets that are not controlled by a Deployment")
+	hashAnnotation          = flag.String("hash-annotation", core.ConfigHashAnnotation, "Key of the PodTemplate annotation that the configuration hash is written to")
+	fieldManager            = flag.String("field-manager", core.DefaultFieldManager, "Name of the field manager that the controller's writes are attributed to")
+	preRollValidateTimeout  = flag.Duration("pre-roll-validate-timeout", 10*time.Second, "Timeout of requests to pre-roll validation endpoints")
+	preRollValidateFailOpen = flag.Bool("pre-roll-validate-fail-open", false, "Should the controller roll out configuration when its pre-roll validation endpoint cannot be reached")
+	preRollAllowlist        = flag.StringSlice("pre-roll-validate-allowlist", nil, "Comma separated list of the hosts, or URL prefixes such as https://validator.example.com/, of the only endpoints pre-roll validation may call (empty allows no endpoints)")
+	pdbAware                = flag.Bool("pdb-aware", false, "Should the controller report rollouts blocked by a PodDisruptionBudget that allows no disruptions")
+	pdbDefer                = flag.Bool("pdb-defer", false, "Should the controller defer rollouts blocked by a PodDisruptionBudget until it allows disruptions (requires --pdb-aware)")
+	watchLabelSelector      = flag.String("watch-label-selector", "", "Label selector of the workloads to enable Wave for, in place of the update-on-config-change annotation (empty uses the annotation)")
+	defaultEnabled          = flag.Bool("default-enabled", false, "Should the controller manage every workload without an annotation, unless it opts out with wave.pusher.com/enabled set to \"false\" (cannot be used with --watch-label-selector)")
+	partialHashPolicy       = flag.String("partial-hash-policy", core.PartialHashPolicyRawFallback, "How keys that cannot be normalized are hashed: fail, skip-key or raw-fallback")
+	childBundlesConfigMap   = flag.String("child-bundles-configmap", "", "Name of the ConfigMap, in the namespace the controller is running in, that defines child bundles (empty disables child bundles)")
+	sharedConfigNamespace   = flag.String("shared-config-namespace", "", "Namespace whose ConfigMaps and Secrets the extra children annotations of workloads in any namespace may reference (empty only allows children in the workload's own namespace)")
+	finalizerName           = flag.String("finalizer-name", core.FinalizerString, "Name of the finalizer added to the workloads managed by the controller")
+	indexChildren           = flag.Bool("index-children", false, "Should the controller find the workloads referencing a ConfigMap or Secret through an index, rather than adding OwnerReferences to every child")
+	disableOwnerReferences  = flag.Bool("disable-owner-references", false, "Should the controller never update ConfigMaps and Secrets, watching them through an index as with --index-children and leaving any existing OwnerReferences in place")
+	ownerController         = flag.Bool("owner-controller", false, "Should the OwnerReferences added to ConfigMaps and Secrets be their controlling references, unless another owner already controls them")
+	secretTypeAllowlist     = flag.StringSlice("secret-type-allowlist", core.DefaultSecretTypeAllowlist, "Comma separated list of the types of Secrets whose changes trigger rollouts (empty allows all types)")
+	secretTypeKeys          = flag.StringSlice("secret-type-keys", nil, "Comma separated list of the only keys, in the form <type>=<key>[:<key>...], of Secrets of each type that trigger rollouts, replacing the built-in list (empty hashes every key)")
+	concurrentReconciles    = flag.Int("concurrent-reconciles", 1, "Number of workloads of each kind that may be reconciled at once")
+	rateLimiterBaseDelay    = flag.Duration("rate-limiter-base-delay", 0, "Delay before first requeueing a workload whose reconciliation failed, doubling with each consecutive failure (0 uses the default of 5ms)")
+	rateLimiterMaxDelay     = flag.Duration("rate-limiter-max-delay", 0, "Maximum delay before requeueing a workload whose reconciliation failed (0 uses the default of 1000s)")
+	requeueJitter           = flag.Float64("requeue-jitter", 0, "Maximum fraction by which the delays of requeued, debounced and backed off reconciles are extended at random, such as 0.1 for up to 10% (0 disables jitter)")
+	maxRolloutsPerNamespace = flag.Int("max-rollouts-per-namespace", 0, "Number of Deployments in each namespace that may have a rollout triggered by the controller in progress at once (0 disables the limit)")
+	skipPaused              = flag.Bool("skip-paused", true, "Should the controller defer the rollouts of paused Deployments until they are resumed")
+	reconcileTimeout        = flag.Duration("reconcile-timeout", 0, "Maximum time each reconcile may spend on requests to the API server before they are cancelled and the workload is requeued (0 disables the timeout)")
+	maxReconcileInterval    = flag.Duration("max-reconcile-interval", 0, "Maximum time before each managed workload is reconciled again, correcting any drift of its hash (0 only reconciles on events and resyncs)")
+	rolloutWindow           = flag.String("rollout-window", "", "Daily window, in the form HH:MM-HH:MM [<days>] such as '22:00-06:00 Mon-Fri', outside of which rollouts are deferred until it opens (empty rolls out immediately)")
+	shutdownTimeout         = flag.Duration("shutdown-timeout", 20*time.Second, "Maximum time to wait for reconciles in progress to complete when shutting down")
+	configSummary           = flag.Bool("config-summary", false, "Should the controller record a summary of the number of ConfigMaps and Secrets of each workload on it when rolling it out")
+	maxDetailsSize          = flag.Int("max-details-size", core.DefaultMaxDetailsSize, "Size in bytes that each annotation listing the ConfigMaps and Secrets of a workload, such as its last changed children, is truncated to")
+	dryRun                  = flag.Bool("dry-run", false, "Should the controller only log the rollouts it would perform, without updating workloads or their children")
+	logFormat               = flag.String("log-format", core.LogFormatText, "Format of the controller's logs: text or json")
+	annotationWebhook       = flag.Bool("annotation-webhook", false, "Should the controller serve a validating webhook rejecting invalid values of the update-on-config-change annotation")
+	hashWebhook             = flag.Bool("hash-webhook", false, "Should the controller serve a mutating webhook injecting the configuration hash into workloads as they are created or updated")
+	webhookPort             = flag.Int("webhook-port", 9876, "Port the webhook server listens on (requires --annotation-webhook or --hash-webhook)")
+	webhookCertDir          = flag.String("webhook-cert-dir", "/tmp/cert", "Directory containing the webhook server's tls.crt and tls.key (requires --annotation-webhook or --hash-webhook)")
+	configFile              = flag.String("config", "", "Path to a YAML file setting the controller's options, keyed by flag name, that flags given on the command line override (the leader-election, leader-election-id, leader-election-namespace, sync-period, kube-api-qps, kube-api-burst, readiness-bind-address, hash-bind-address, webhook-port, webhook-cert-dir, log-format and shutdown-timeout flags cannot be set in the file)")
 	showVersion             = flag.Bool("version", false, "Show version and exit")
 )
 
@@ -54,7 +115,12 @@ func main() {
 		return
 	}
 
-	logf.SetLogger(glogr.New())
+	logger, err := core.NewLogger(*logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --log-format: %v\n", err)
+		os.Exit(1)
+	}
+	logf.SetLogger(logger)
 	log := logf.Log.WithName("entrypoint")
 
 	// Get a config to talk to the apiserver
@@ -64,6 +130,173 @@ func main() {
 		log.Error(err, "unable to set up client config")
 		os.Exit(1)
 	}
+	if *kubeAPIQPS > 0 {
+		cfg.QPS = *kubeAPIQPS
+	}
+	if *kubeAPIBurst > 0 {
+		cfg.Burst = *kubeAPIBurst
+	}
+
+	// Configure the Handler shared by all Controllers
+	opts := core.Options{
+		OwnNamespace:            os.Getenv("POD_NAMESPACE"),
+		IncludeOwnNamespace:     *includeOwnNamespace,
+		NamespaceAllowlist:      *namespaceAllowlist,
+		NamespaceDenylist:       *namespaceDenylist,
+		ReverseWatchCoalesce:    *reverseWatchCoalesce,
+		DebounceInterval:        *debounceInterval,
+		MissingChildGrace:       *missingChildGrace,
+		EnableKruise:            *enableKruise,
+		EnableArgoRollouts:      *enableArgoRollouts,
+		EnableDeploymentConfigs: *enableDeploymentConfigs,
+		EnableReplicaSets:       *enableReplicaSets,
+		MerkleHash:              *merkleHash,
+		HashAlgorithm:           *hashAlgorithm,
+		HashVersionPrefix:       *hashVersionPrefix,
+		HashAnnotation:          *hashAnnotation,
+		FieldManager:            *fieldManager,
+		AnnotationWebhook:       *annotationWebhook,
+		HashWebhook:             *hashWebhook,
+		PreRollValidateTimeout:  *preRollValidateTimeout,
+		PreRollValidateFailOpen: *preRollValidateFailOpen,
+		PreRollAllowlist:        *preRollAllowlist,
+		PDBAware:                *pdbAware,
+		PDBDefer:                *pdbDefer,
+		DefaultEnabled:          *defaultEnabled,
+		PartialHashPolicy:       *partialHashPolicy,
+		SharedConfigNamespace:   *sharedConfigNamespace,
+		FinalizerName:           *finalizerName,
+		IndexChildren:           *indexChildren,
+		DisableOwnerReferences:  *disableOwnerReferences,
+		OwnerController:         *ownerController,
+		SecretTypeAllowlist:     *secretTypeAllowlist,
+		ConcurrentReconciles:    *concurrentReconciles,
+		RateLimiterBaseDelay:    *rateLimiterBaseDelay,
+		RateLimiterMaxDelay:     *rateLimiterMaxDelay,
+		RequeueJitter:           *requeueJitter,
+		ReconcileTimeout:        *reconcileTimeout,
+		MaxReconcileInterval:    *maxReconcileInterval,
+		MaxRolloutsPerNamespace: *maxRolloutsPerNamespace,
+		SkipPaused:              *skipPaused,
+		ConfigSummary:           *configSummary,
+		MaxDetailsSize:          *maxDetailsSize,
+		DryRun:                  *dryRun,
+		Shutdown:                &core.Shutdown{},
+		HashCache:               &core.HashCache{},
+		WorkloadKinds:           &core.WorkloadKinds{},
+		Version:                 VERSION,
+	}
+	if *watchLabelSelector != "" {
+		selector, err := labels.Parse(*watchLabelSelector)
+		if err != nil {
+			log.Error(err, "invalid --watch-label-selector")
+			os.Exit(1)
+		}
+		opts.WatchLabelSelector = selector
+	}
+	if *childBundlesConfigMap != "" {
+		opts.ChildBundles = types.NamespacedName{Namespace: opts.OwnNamespace, Name: *childBundlesConfigMap}
+	}
+	if flag.CommandLine.Changed("secret-type-keys") {
+		typeKeys, err := core.ParseSecretTypeKeys(*secretTypeKeys)
+		if err != nil {
+			log.Error(err, "invalid --secret-type-keys")
+			os.Exit(1)
+		}
+		opts.SecretTypeKeys = typeKeys
+	}
+	if *rolloutWindow != "" {
+		window, err := core.ParseRolloutWindow(*rolloutWindow)
+		if err != nil {
+			log.Error(err, "invalid --rollout-window")
+			os.Exit(1)
+		}
+		opts.RolloutWindow = window
+	}
+	if len(*extraChildGVKs) > 0 {
+		kinds, err := core.ParseExtraChildGVKs(*extraChildGVKs)
+		if err != nil {
+			log.Error(err, "invalid --extra-child-gvks")
+			os.Exit(1)
+		}
+		opts.ExtraChildKinds = kinds
+	}
+
+	// Options set in the config file only apply if their flag was not given
+	if *configFile != "" {
+		fileConfig, err := core.LoadConfig(*configFile)
+		if err != nil {
+			log.Error(err, "invalid --config")
+			os.Exit(1)
+		}
+		if err := fileConfig.ApplyTo(&opts, flag.CommandLine.Changed); err != nil {
+			log.Error(err, "invalid --config")
+			os.Exit(1)
+		}
+	}
+
+	if err := core.ValidatePartialHashPolicy(opts.PartialHashPolicy); err != nil {
+		log.Error(err, "invalid --partial-hash-policy")
+		os.Exit(1)
+	}
+	if err := core.ValidateHashAlgorithm(opts.HashAlgorithm); err != nil {
+		log.Error(err, "invalid --hash-algorithm")
+		os.Exit(1)
+	}
+	if opts.MerkleHash && opts.HashAlgorithm != core.HashAlgorithmSHA256 {
+		log.Error(fmt.Errorf("--merkle-hash always uses %s", core.HashAlgorithmSHA256), "invalid --hash-algorithm")
+		os.Exit(1)
+	}
+	if opts.DefaultEnabled && opts.WatchLabelSelector != nil {
+		log.Error(fmt.Errorf("--watch-label-selector enables workloads by their labels"), "invalid --default-enabled")
+		os.Exit(1)
+	}
+	if len(opts.ExtraChildKinds) > 0 && opts.UsesChildIndex() {
+		log.Error(fmt.Errorf("children of extra kinds are watched through their OwnerReferences"), "invalid --extra-child-gvks")
+		os.Exit(1)
+	}
+	if err := core.ValidateRateLimiter(opts); err != nil {
+		log.Error(err, "invalid --rate-limiter-base-delay")
+		os.Exit(1)
+	}
+	if opts.RequeueJitter < 0 {
+		log.Error(fmt.Errorf("jitter %v is negative", opts.RequeueJitter), "invalid --requeue-jitter")
+		os.Exit(1)
+	}
+
+	// List the workloads Wave is enabled for instead of running the manager
+	if flag.Arg(0) == "list" {
+		c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		if err != nil {
+			log.Error(err, "unable to set up client")
+			os.Exit(1)
+		}
+		if err := core.NewHandler(c, nil, opts).ListWorkloads(os.Stdout); err != nil {
+			log.Error(err, "unable to list workloads")
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Dump the workloads and the children they own instead of running the
+	// manager
+	if flag.Arg(0) == "dump" {
+		c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		if err != nil {
+			log.Error(err, "unable to set up client")
+			os.Exit(1)
+		}
+		if err := core.NewHandler(c, nil, opts).Dump(os.Stdout); err != nil {
+			log.Error(err, "unable to dump workloads")
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A sync period of zero leaves the default of controller-runtime in place
+	if *syncPeriod == 0 {
+		syncPeriod = nil
+	}
 
 	// Create a new Cmd to provide shared dependencies and start components
 	log.Info("setting up manager")
@@ -72,6 +305,8 @@ func main() {
 		LeaderElectionID:        *leaderElectionID,
 		LeaderElectionNamespace: *leaderElectionNamespace,
 		SyncPeriod:              syncPeriod,
+		Port:                    *webhookPort,
+		CertDir:                 *webhookCertDir,
 	})
 	if err != nil {
 		log.Error(err, "unable to set up overall controller manager")
@@ -89,21 +324,57 @@ func main() {
 
 	// Setup all Controllers
 	log.Info("Setting up controller")
-	if err := controller.AddToManager(mgr); err != nil {
+	opts.RESTMapper = mgr.GetRESTMapper()
+	if err := controller.AddToManager(mgr, opts); err != nil {
 		log.Error(err, "unable to register controllers to the manager")
 		os.Exit(1)
 	}
 
-	log.Info("setting up webhooks")
-	if err := webhook.AddToManager(mgr); err != nil {
-		log.Error(err, "unable to register webhooks to the manager")
-		os.Exit(1)
+	// The webhook server is only started once a webhook is registered
+	if opts.AnnotationWebhook || opts.HashWebhook {
+		log.Info("setting up webhooks")
+		if err := webhook.AddToManager(mgr, opts); err != nil {
+			log.Error(err, "unable to register webhooks to the manager")
+			os.Exit(1)
+		}
+	}
+
+	// Serve the readiness endpoint while the manager's caches sync
+	stop := signals.SetupSignalHandler()
+	if *readinessBindAddress != "0" {
+		probe := &readiness.Probe{}
+		if err := mgr.Add(probe); err != nil {
+			log.Error(err, "unable to register the readiness probe to the manager")
+			os.Exit(1)
+		}
+		go func() {
+			if err := readiness.ListenAndServe(*readinessBindAddress, probe, stop); err != nil {
+				log.Error(err, "unable to serve the readiness endpoint")
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Serve the configuration hash of workloads once the caches have synced
+	if *hashBindAddress != "0" {
+		if err := mgr.Add(hashquery.NewServer(*hashBindAddress, mgr.GetClient(), opts)); err != nil {
+			log.Error(err, "unable to register the hash endpoint to the manager")
+			os.Exit(1)
+		}
 	}
 
 	// Start the Cmd
 	log.Info("Starting the Cmd.")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		log.Error(err, "unable to run the manager")
 		os.Exit(1)
 	}
+
+	// The manager returns as soon as it is stopped, so wait for the
+	// reconciles in progress to complete before exiting
+	log.Info("waiting for reconciles in progress to complete", "timeout", shutdownTimeout.String())
+	if !opts.Shutdown.Wait(*shutdownTimeout) {
+		log.Info("timed out waiting for reconciles in progress to complete")
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coalesce
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// eventHandler wraps a handler.EventHandler and coalesces Update events for
+// the same object that occur within the configured window, so that the
+// wrapped handler is only called once per object per window
+type eventHandler struct {
+	handler.EventHandler
+	window time.Duration
+
+	mutex   sync.Mutex
+	pending map[types.NamespacedName]event.UpdateEvent
+}
+
+// NewEventHandler returns a handler.EventHandler that coalesces Update events
+// for each object into at most one call to the given handler per window.
+// Create, Delete and Generic events are passed straight through.
+// If the window is not positive, the given handler is returned unchanged.
+func NewEventHandler(h handler.EventHandler, window time.Duration) handler.EventHandler {
+	if window <= 0 {
+		return h
+	}
+	return &eventHandler{
+		EventHandler: h,
+		window:       window,
+		pending:      make(map[types.NamespacedName]event.UpdateEvent),
+	}
+}
+
+// Update records the event and, if no event is pending for the object, starts
+// a timer to pass the most recent event to the wrapped handler once the window
+// has elapsed
+func (e *eventHandler) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	if evt.MetaNew == nil {
+		e.EventHandler.Update(evt, q)
+		return
+	}
+	key := types.NamespacedName{Namespace: evt.MetaNew.GetNamespace(), Name: evt.MetaNew.GetName()}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, isPending := e.pending[key]
+	e.pending[key] = evt
+	if !isPending {
+		time.AfterFunc(e.window, func() {
+			e.flush(key, q)
+		})
+	}
+}
+
+// flush passes the pending event for the object to the wrapped handler
+func (e *eventHandler) flush(key types.NamespacedName, q workqueue.RateLimitingInterface) {
+	e.mutex.Lock()
+	evt, ok := e.pending[key]
+	delete(e.pending, key)
+	e.mutex.Unlock()
+
+	if ok {
+		e.EventHandler.Update(evt, q)
+	}
+}
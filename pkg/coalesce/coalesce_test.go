@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coalesce
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// countingHandler counts the Update events it receives
+type countingHandler struct {
+	handler.Funcs
+	mutex   sync.Mutex
+	updates int
+	last    event.UpdateEvent
+}
+
+func (c *countingHandler) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.updates++
+	c.last = evt
+}
+
+func (c *countingHandler) getUpdates() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.updates
+}
+
+var _ = Describe("Wave coalesce Suite", func() {
+	const window = 100 * time.Millisecond
+
+	var inner *countingHandler
+	var h handler.EventHandler
+	var q workqueue.RateLimitingInterface
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+
+	var updateEvent = func(cm *corev1.ConfigMap) event.UpdateEvent {
+		return event.UpdateEvent{MetaOld: cm, ObjectOld: cm, MetaNew: cm, ObjectNew: cm}
+	}
+
+	BeforeEach(func() {
+		inner = &countingHandler{}
+		h = NewEventHandler(inner, window)
+		q = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+	})
+
+	AfterEach(func() {
+		q.ShutDown()
+	})
+
+	It("passes a single update on once the window has elapsed", func() {
+		h.Update(updateEvent(cm1), q)
+		Expect(inner.getUpdates()).To(Equal(0))
+		Eventually(inner.getUpdates, 5*window).Should(Equal(1))
+	})
+
+	It("coalesces rapid updates to the same object", func() {
+		for i := 0; i < 20; i++ {
+			h.Update(updateEvent(cm1), q)
+		}
+		Eventually(inner.getUpdates, 5*window).Should(Equal(1))
+		Consistently(inner.getUpdates, 3*window).Should(Equal(1))
+	})
+
+	It("passes on the most recent event", func() {
+		stale := cm1.DeepCopy()
+		stale.Data["key1"] = "stale"
+		h.Update(updateEvent(stale), q)
+		h.Update(updateEvent(cm1), q)
+
+		Eventually(inner.getUpdates, 5*window).Should(Equal(1))
+		inner.mutex.Lock()
+		defer inner.mutex.Unlock()
+		Expect(inner.last.MetaNew).To(BeIdenticalTo(cm1))
+	})
+
+	It("does not coalesce updates to different objects", func() {
+		h.Update(updateEvent(cm1), q)
+		h.Update(updateEvent(cm2), q)
+		Eventually(inner.getUpdates, 5*window).Should(Equal(2))
+	})
+
+	It("passes updates in separate windows on separately", func() {
+		h.Update(updateEvent(cm1), q)
+		Eventually(inner.getUpdates, 5*window).Should(Equal(1))
+		h.Update(updateEvent(cm1), q)
+		Eventually(inner.getUpdates, 5*window).Should(Equal(2))
+	})
+
+	It("returns the wrapped handler when the window is not positive", func() {
+		Expect(NewEventHandler(inner, 0)).To(BeIdenticalTo(inner))
+	})
+})
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coalesce
+
+import (
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// debouncedEventHandler wraps a handler.EventHandler and delays the requests
+// it enqueues by the configured interval
+type debouncedEventHandler struct {
+	handler.EventHandler
+	interval time.Duration
+}
+
+// NewDebouncedEventHandler returns a handler.EventHandler that delays each
+// request enqueued by the given handler by the interval.
+// As the workqueue only holds one delayed entry for each request, every
+// request enqueued for a workload within the interval of the first is
+// reconciled only once, when the interval has elapsed.
+// If the interval is not positive, the given handler is returned unchanged.
+func NewDebouncedEventHandler(h handler.EventHandler, interval time.Duration) handler.EventHandler {
+	if interval <= 0 {
+		return h
+	}
+	return &debouncedEventHandler{EventHandler: h, interval: interval}
+}
+
+// Create implements handler.EventHandler
+func (e *debouncedEventHandler) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	e.EventHandler.Create(evt, e.wrap(q))
+}
+
+// Update implements handler.EventHandler
+func (e *debouncedEventHandler) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	e.EventHandler.Update(evt, e.wrap(q))
+}
+
+// Delete implements handler.EventHandler
+func (e *debouncedEventHandler) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	e.EventHandler.Delete(evt, e.wrap(q))
+}
+
+// Generic implements handler.EventHandler
+func (e *debouncedEventHandler) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	e.EventHandler.Generic(evt, e.wrap(q))
+}
+
+// wrap returns a view of the workqueue that delays added requests
+func (e *debouncedEventHandler) wrap(q workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	return &debouncedQueue{RateLimitingInterface: q, interval: e.interval}
+}
+
+// debouncedQueue wraps a workqueue.RateLimitingInterface and delays each
+// added item by the interval
+type debouncedQueue struct {
+	workqueue.RateLimitingInterface
+	interval time.Duration
+}
+
+// Add adds the item to the workqueue once the interval has elapsed
+func (q *debouncedQueue) Add(item interface{}) {
+	q.RateLimitingInterface.AddAfter(item, q.interval)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coalesce
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave debounce Suite", func() {
+	const interval = 100 * time.Millisecond
+
+	var h handler.EventHandler
+	var q workqueue.RateLimitingInterface
+	var request reconcile.Request
+
+	// updateEvent returns an Update event for the ConfigMap
+	var updateEvent = func(cm *corev1.ConfigMap) event.UpdateEvent {
+		return event.UpdateEvent{MetaOld: cm, ObjectOld: cm, MetaNew: cm, ObjectNew: cm}
+	}
+
+	BeforeEach(func() {
+		deployment := utils.ExampleDeployment
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}}
+
+		// Enqueue the Deployment for every child event, as an owner would
+		inner := handler.Funcs{
+			UpdateFunc: func(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+				q.Add(request)
+			},
+		}
+		h = NewDebouncedEventHandler(inner, interval)
+		q = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	})
+
+	AfterEach(func() {
+		q.ShutDown()
+	})
+
+	It("enqueues the Deployment once for several child updates within the interval", func() {
+		for _, cm := range []*corev1.ConfigMap{utils.ExampleConfigMap1, utils.ExampleConfigMap2, utils.ExampleConfigMap3} {
+			h.Update(updateEvent(cm.DeepCopy()), q)
+		}
+		Expect(q.Len()).To(Equal(0))
+
+		Eventually(q.Len, 5*interval).Should(Equal(1))
+		Consistently(q.Len, 2*interval).Should(Equal(1))
+		item, _ := q.Get()
+		Expect(item).To(Equal(request))
+		q.Done(item)
+	})
+
+	It("enqueues the Deployment again for updates after the interval", func() {
+		h.Update(updateEvent(utils.ExampleConfigMap1.DeepCopy()), q)
+		Eventually(q.Len, 5*interval).Should(Equal(1))
+		item, _ := q.Get()
+		q.Done(item)
+
+		h.Update(updateEvent(utils.ExampleConfigMap1.DeepCopy()), q)
+		Expect(q.Len()).To(Equal(0))
+		Eventually(q.Len, 5*interval).Should(Equal(1))
+	})
+
+	It("returns the wrapped handler when the interval is not positive", func() {
+		inner := handler.Funcs{}
+		Expect(NewDebouncedEventHandler(inner, 0)).To(Equal(inner))
+	})
+})
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package argo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wave-k8s/wave/pkg/core"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// RolloutKind is the Argo Rollouts workload that Wave can manage.
+// Rollouts keep their PodTemplate at spec.template.
+var RolloutKind = schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}
+
+// Add creates a new Rollout Controller and adds it to the Manager. The
+// Controller is skipped if the Rollout CRD is not installed.
+// No Controller is added unless Argo Rollouts support is enabled in the
+// options.
+func Add(mgr manager.Manager, opts core.Options) error {
+	if !opts.EnableArgoRollouts {
+		return nil
+	}
+
+	mapping, err := mgr.GetRESTMapper().RESTMapping(RolloutKind)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			logf.Log.WithName("argo").V(0).Info("Argo Rollouts kind not installed, skipping", "group", RolloutKind.Group, "kind", RolloutKind.Kind)
+			return nil
+		}
+		return fmt.Errorf("error looking up Argo Rollouts kind %s: %v", RolloutKind.String(), err)
+	}
+	opts.WorkloadKinds.Add(mapping.GroupVersionKind)
+	return add(mgr, newReconciler(mgr, mapping.GroupVersionKind, opts), mapping.GroupVersionKind, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, gvk schema.GroupVersionKind, opts core.Options) reconcile.Reconciler {
+	return &ReconcileRollout{
+		scheme:  mgr.GetScheme(),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), opts),
+		gvk:     gvk,
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler, gvk schema.GroupVersionKind, opts core.Options) error {
+	// Create a new controller
+	c, err := controller.New("rollout-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.ConcurrentReconciles})
+	if err != nil {
+		return err
+	}
+
+	// Requeue failed reconciliations with the configured backoff
+	err = core.ApplyRateLimiter(c, opts)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Rollouts
+	err = c.Watch(&source.Kind{Type: newObject(gvk)}, &handler.EnqueueRequestForObject{}, core.WorkloadPredicates(opts)...)
+	if err != nil {
+		return err
+	}
+
+	// Watch the children referenced by a Rollout
+	return core.WatchChildren(c, mgr, newObject(gvk), newList(gvk), opts)
+}
+
+// newObject returns an empty Rollout of the given version
+func newObject(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// newList returns an empty list of Rollouts of the given version
+func newList(gvk schema.GroupVersionKind) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	return list
+}
+
+// hasPodTemplate returns true if the Rollout embeds its PodTemplate, rather
+// than referencing the PodTemplate of another workload with spec.workloadRef
+func hasPodTemplate(instance *unstructured.Unstructured) bool {
+	_, found, err := unstructured.NestedMap(instance.Object, "spec", "template")
+	return found && err == nil
+}
+
+var _ reconcile.Reconciler = &ReconcileRollout{}
+
+// ReconcileRollout reconciles an Argo Rollout object
+type ReconcileRollout struct {
+	scheme  *runtime.Scheme
+	handler *core.Handler
+	gvk     schema.GroupVersionKind
+}
+
+// Reconcile reads that state of the cluster for a Rollout and updates its
+// PodSpec based on mounted configuration
+// +kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+func (r *ReconcileRollout) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Fetch the Rollout instance
+	instance := newObject(r.gvk)
+	err := r.handler.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found, return.  Created objects are automatically garbage collected.
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	// Rollouts referencing the PodTemplate of another workload have no
+	// PodTemplate of their own to write the hash to
+	if !hasPodTemplate(instance) {
+		return reconcile.Result{}, nil
+	}
+
+	return r.handler.HandleUnstructured(instance)
+}
@@ -21,7 +21,6 @@ import (
 
 	"github.com/wave-k8s/wave/pkg/core"
 	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -33,51 +32,40 @@ import (
 
 // Add creates a new DaemonSet Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+func Add(mgr manager.Manager, opts core.Options) error {
+	return add(mgr, newReconciler(mgr, opts), opts)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newReconciler(mgr manager.Manager, opts core.Options) reconcile.Reconciler {
 	return &ReconcileDaemonSet{
 		scheme:  mgr.GetScheme(),
-		handler: core.NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave")),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), opts),
 	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+func add(mgr manager.Manager, r reconcile.Reconciler, opts core.Options) error {
 	// Create a new controller
-	c, err := controller.New("daemonset-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("daemonset-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.ConcurrentReconciles})
 	if err != nil {
 		return err
 	}
 
-	// Watch for changes to DaemonSet
-	err = c.Watch(&source.Kind{Type: &appsv1.DaemonSet{}}, &handler.EnqueueRequestForObject{})
-	if err != nil {
-		return err
-	}
-
-	// Watch ConfigMaps owned by a DaemonSet
-	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
-		IsController: false,
-		OwnerType:    &appsv1.DaemonSet{},
-	})
+	// Requeue failed reconciliations with the configured backoff
+	err = core.ApplyRateLimiter(c, opts)
 	if err != nil {
 		return err
 	}
 
-	// Watch Secrets owned by a DaemonSet
-	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
-		IsController: false,
-		OwnerType:    &appsv1.DaemonSet{},
-	})
+	// Watch for changes to DaemonSet
+	err = c.Watch(&source.Kind{Type: &appsv1.DaemonSet{}}, &handler.EnqueueRequestForObject{}, core.WorkloadPredicates(opts)...)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Watch the children referenced by a DaemonSet
+	return core.WatchChildren(c, mgr, &appsv1.DaemonSet{}, &appsv1.DaemonSetList{}, opts)
 }
 
 var _ reconcile.Reconciler = &ReconcileDaemonSet{}
@@ -94,6 +82,7 @@ type ReconcileDaemonSet struct {
 // +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=,resources=pods,verbs=list;watch;delete
 func (r *ReconcileDaemonSet) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	// Fetch the DaemonSet instance
 	instance := &appsv1.DaemonSet{}
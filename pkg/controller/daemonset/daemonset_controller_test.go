@@ -86,8 +86,8 @@ var _ = Describe("DaemonSet controller Suite", func() {
 		m = utils.Matcher{Client: c}
 
 		var recFn reconcile.Reconciler
-		recFn, requests = SetupTestReconcile(newReconciler(mgr))
-		Expect(add(mgr, recFn)).NotTo(HaveOccurred())
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
 
 		stopMgr, mgrStopped = StartTestManager(mgr)
 
@@ -244,6 +244,32 @@ var _ = Describe("DaemonSet controller Suite", func() {
 				})
 			})
 
+			Context("And a child is deleted and recreated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(daemonset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = daemonset.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+					m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+
+					m.Delete(cm2).Should(Succeed())
+					m.Get(cm2, timeout).ShouldNot(Succeed())
+
+					cm2 = utils.ExampleConfigMap2.DeepCopy()
+					cm2.Data["key1"] = modified
+					m.Create(cm2).Should(Succeed())
+					waitForDaemonSetReconciled(daemonset)
+				})
+
+				It("Adds an OwnerReference to the recreated ConfigMap", func() {
+					m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(daemonset, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+				})
+			})
+
 			Context("And a child is updated", func() {
 				var originalHash string
 
@@ -19,13 +19,17 @@ package deployment
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/pkg/readiness"
 	"github.com/wave-k8s/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -86,8 +90,8 @@ var _ = Describe("Deployment controller Suite", func() {
 		m = utils.Matcher{Client: c}
 
 		var recFn reconcile.Reconciler
-		recFn, requests = SetupTestReconcile(newReconciler(mgr))
-		Expect(add(mgr, recFn)).NotTo(HaveOccurred())
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
 
 		stopMgr, mgrStopped = StartTestManager(mgr)
 
@@ -245,6 +249,32 @@ var _ = Describe("Deployment controller Suite", func() {
 				})
 			})
 
+			Context("And a child is deleted and recreated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+					m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+
+					m.Delete(cm2).Should(Succeed())
+					m.Get(cm2, timeout).ShouldNot(Succeed())
+
+					cm2 = utils.ExampleConfigMap2.DeepCopy()
+					cm2.Data["key1"] = modified
+					m.Create(cm2).Should(Succeed())
+					waitForDeploymentReconciled(deployment)
+				})
+
+				It("Adds an OwnerReference to the recreated ConfigMap", func() {
+					m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+				})
+			})
+
 			Context("And a child is updated", func() {
 				var originalHash string
 
@@ -409,4 +439,216 @@ var _ = Describe("Deployment controller Suite", func() {
 		})
 	})
 
+	Context("When the controller restarts", func() {
+		It("reconciles a Deployment whose child changed while it was stopped", func() {
+			m.Update(deployment, func(obj utils.Object) utils.Object {
+				obj.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+				return obj
+			}).Should(Succeed())
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+			originalHash := deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			m.Update(cm1, func(obj utils.Object) utils.Object {
+				cm := obj.(*corev1.ConfigMap)
+				cm.Data["key1"] = modified
+				return cm
+			}).Should(Succeed())
+
+			// The informers list every Deployment once the caches of the new
+			// manager have synced, so the Deployment is reconciled without
+			// any further events
+			metrics.Registry = prometheus.NewRegistry()
+			mgr, err := manager.New(cfg, manager.Options{
+				MetricsBindAddress: "0",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			var recFn reconcile.Reconciler
+			recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+			Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			waitForDeploymentReconciled(deployment)
+			m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+		})
+	})
+})
+
+var _ = Describe("Deployment controller concurrency Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+	var deployments []*appsv1.Deployment
+	var release chan struct{}
+	var inFlight, maxInFlight int64
+
+	const timeout = time.Second * 5
+
+	BeforeEach(func() {
+		// Reset the Prometheus Registry before each test to avoid errors
+		metrics.Registry = prometheus.NewRegistry()
+
+		mgr, err := manager.New(cfg, manager.Options{
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var cerr error
+		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(cerr).NotTo(HaveOccurred())
+		m = utils.Matcher{Client: c}
+
+		// Hold each reconcile until released, recording how many run at once
+		inFlight, maxInFlight = 0, 0
+		release = make(chan struct{})
+		recFn := reconcile.Func(func(req reconcile.Request) (reconcile.Result, error) {
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+			for {
+				peak := atomic.LoadInt64(&maxInFlight)
+				if n <= peak || atomic.CompareAndSwapInt64(&maxInFlight, peak, n) {
+					break
+				}
+			}
+			select {
+			case <-release:
+			case <-time.After(timeout):
+			}
+			return reconcile.Result{}, nil
+		})
+		Expect(add(mgr, recFn, core.Options{ConcurrentReconciles: 2})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		deployments = nil
+		for i := 0; i < 2; i++ {
+			d := utils.ExampleDeployment.DeepCopy()
+			d.SetName(fmt.Sprintf("concurrent-%d", i))
+			m.Create(d).Should(Succeed())
+			deployments = append(deployments, d)
+		}
+	})
+
+	AfterEach(func() {
+		close(release)
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		for _, d := range deployments {
+			m.Delete(d).Should(Succeed())
+		}
+	})
+
+	It("reconciles Deployments in parallel", func() {
+		Eventually(func() int64 { return atomic.LoadInt64(&maxInFlight) }, timeout).Should(BeEquivalentTo(2))
+	})
+})
+
+var _ = Describe("Deployment controller leader election Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 30
+
+	BeforeEach(func() {
+		// Reset the Prometheus Registry before each test to avoid errors
+		metrics.Registry = prometheus.NewRegistry()
+
+		mgr, err := manager.New(cfg, manager.Options{
+			MetricsBindAddress:      "0",
+			LeaderElection:          true,
+			LeaderElectionID:        "wave-leader-election-test",
+			LeaderElectionNamespace: "default",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var cerr error
+		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(cerr).NotTo(HaveOccurred())
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetName("leader-election")
+		m.Create(deployment).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		m.Delete(deployment).Should(Succeed())
+	})
+
+	It("reconciles Deployments once it has been elected leader", func() {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      deployment.GetName(),
+				Namespace: deployment.GetNamespace(),
+			},
+		}
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	})
+
+})
+
+var _ = Describe("Deployment controller readiness Suite", func() {
+	var probe *readiness.Probe
+	var server *httptest.Server
+	var mgr manager.Manager
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 30
+
+	// status returns the status code of a request to the readiness endpoint
+	var status = func() (int, error) {
+		resp, err := http.Get(server.URL + readiness.Path)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	BeforeEach(func() {
+		// Reset the Prometheus Registry before each test to avoid errors
+		metrics.Registry = prometheus.NewRegistry()
+
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		recFn, _ := SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		probe = &readiness.Probe{}
+		Expect(mgr.Add(probe)).To(Succeed())
+		server = httptest.NewServer(probe)
+	})
+
+	AfterEach(func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+		server.Close()
+	})
+
+	It("is not ready until the manager has synced its caches", func() {
+		Expect(status()).To(Equal(http.StatusServiceUnavailable))
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+		Eventually(status, timeout).Should(Equal(http.StatusOK))
+	})
 })
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kruise
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/wave-k8s/wave/pkg/core"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// kruiseKinds are the OpenKruise workloads that Wave can manage.
+// Each keeps its PodTemplate at spec.template.
+var kruiseKinds = []schema.GroupKind{
+	{Group: "apps.kruise.io", Kind: "CloneSet"},
+	{Group: "apps.kruise.io", Kind: "StatefulSet"},
+}
+
+// Add creates a new Controller for each installed OpenKruise workload kind and
+// adds them to the Manager. Kinds whose CRDs are not installed are skipped.
+// No Controllers are added unless Kruise support is enabled in the options.
+func Add(mgr manager.Manager, opts core.Options) error {
+	if !opts.EnableKruise {
+		return nil
+	}
+
+	log := logf.Log.WithName("kruise")
+	for _, gk := range kruiseKinds {
+		mapping, err := mgr.GetRESTMapper().RESTMapping(gk)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				log.V(0).Info("OpenKruise kind not installed, skipping", "group", gk.Group, "kind", gk.Kind)
+				continue
+			}
+			return fmt.Errorf("error looking up OpenKruise kind %s: %v", gk.String(), err)
+		}
+
+		opts.WorkloadKinds.Add(mapping.GroupVersionKind)
+		err = add(mgr, newReconciler(mgr, mapping.GroupVersionKind, opts), mapping.GroupVersionKind, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, gvk schema.GroupVersionKind, opts core.Options) reconcile.Reconciler {
+	return &ReconcileKruise{
+		scheme:  mgr.GetScheme(),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), opts),
+		gvk:     gvk,
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler, gvk schema.GroupVersionKind, opts core.Options) error {
+	// Create a new controller
+	name := fmt.Sprintf("kruise-%s-controller", strings.ToLower(gvk.Kind))
+	c, err := controller.New(name, mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.ConcurrentReconciles})
+	if err != nil {
+		return err
+	}
+
+	// Requeue failed reconciliations with the configured backoff
+	err = core.ApplyRateLimiter(c, opts)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the workload
+	err = c.Watch(&source.Kind{Type: newObject(gvk)}, &handler.EnqueueRequestForObject{}, core.WorkloadPredicates(opts)...)
+	if err != nil {
+		return err
+	}
+
+	// Watch the children referenced by the workload
+	return core.WatchChildren(c, mgr, newObject(gvk), newList(gvk), opts)
+}
+
+// newObject returns an empty workload of the given kind
+func newObject(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// newList returns an empty list of workloads of the given kind
+func newList(gvk schema.GroupVersionKind) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	return list
+}
+
+var _ reconcile.Reconciler = &ReconcileKruise{}
+
+// ReconcileKruise reconciles an OpenKruise workload object
+type ReconcileKruise struct {
+	scheme  *runtime.Scheme
+	handler *core.Handler
+	gvk     schema.GroupVersionKind
+}
+
+// Reconcile reads that state of the cluster for an OpenKruise workload and
+// updates its PodSpec based on mounted configuration
+// +kubebuilder:rbac:groups=apps.kruise.io,resources=clonesets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apps.kruise.io,resources=statefulsets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+func (r *ReconcileKruise) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Fetch the workload instance
+	instance := newObject(r.gvk)
+	err := r.handler.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found, return.  Created objects are automatically garbage collected.
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	return r.handler.HandleUnstructured(instance)
+}
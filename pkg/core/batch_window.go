@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getBatchWindow returns the batch window configured on the given
+// podController, or zero if rollouts should not be batched.
+// A rollout delay sets the batch window if no batch window is set.
+func getBatchWindow(obj podController) time.Duration {
+	value, ok := obj.GetAnnotations()[BatchWindowAnnotation]
+	if !ok {
+		value, ok = obj.GetAnnotations()[RolloutDelayAnnotation]
+	}
+	if !ok {
+		return 0
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		return 0
+	}
+	return window
+}
+
+// batchWindowRemaining records that the instance has a pending rollout and
+// returns how long remains of its batch window before it should be rolled
+// out.
+// The window opens with the first pending change and is not extended by
+// further changes within it, so that a rollout is delayed by at most one
+// window. A remaining time of zero means the window has closed.
+func (h *Handler) batchWindowRemaining(obj podController, hash string) time.Duration {
+	window := getBatchWindow(obj)
+	if window <= 0 {
+		return 0
+	}
+
+	h.batchMutex.Lock()
+	defer h.batchMutex.Unlock()
+
+	if h.batchSince == nil {
+		h.batchSince = make(map[string]time.Time)
+	}
+	key := missingChildKey(obj)
+	since, ok := h.batchSince[key]
+	if !ok {
+		since = h.now()
+		h.batchSince[key] = since
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeNormal, "RolloutBatched", "Holding rollout of configuration hash %s for batch window of %s", hash, window)
+	}
+
+	remaining := window - h.now().Sub(since)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// clearBatchWindow forgets the pending rollout of the instance so that the
+// next change opens a new batch window
+func (h *Handler) clearBatchWindow(obj podController) {
+	h.batchMutex.Lock()
+	defer h.batchMutex.Unlock()
+	delete(h.batchSince, missingChildKey(obj))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave batch window Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var recorder *record.FakeRecorder
+	var now time.Time
+
+	// handle advances the fake clock, reconciles the Deployment and returns
+	// the requested requeue delay
+	var handle = func(advance time.Duration) time.Duration {
+		now = now.Add(advance)
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return result.RequeueAfter
+	}
+
+	// updateConfigMap changes the data of the ConfigMap
+	var updateConfigMap = func(value string) {
+		cm.Data["key1"] = value
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	// rollouts returns the number of rollouts recorded so far
+	var rollouts = func() int {
+		count := 0
+		for len(recorder.Events) > 0 {
+			if strings.Contains(<-recorder.Events, "ConfigChanged") {
+				count++
+			}
+		}
+		return count
+	}
+
+	// expectedHash returns the configuration hash of the current state of the
+	// Deployment's children
+	var expectedHash = func() string {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(current)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:    requiredAnnotationValue,
+			BatchWindowAnnotation: "5m",
+		})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{})
+		now = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		h.now = func() time.Time { return now }
+	})
+
+	It("rolls out once to the final state after several changes within the window", func() {
+		Expect(handle(0)).To(Equal(5 * time.Minute))
+
+		updateConfigMap("first")
+		Expect(handle(time.Minute)).To(Equal(4 * time.Minute))
+
+		updateConfigMap("second")
+		Expect(handle(2 * time.Minute)).To(Equal(2 * time.Minute))
+
+		updateConfigMap("final")
+		Expect(handle(time.Minute)).To(Equal(time.Minute))
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+
+		Expect(handle(time.Minute)).To(BeZero())
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+		Expect(rollouts()).To(Equal(1))
+	})
+
+	It("opens a new window for changes after the rollout", func() {
+		handle(0)
+		Expect(handle(5 * time.Minute)).To(BeZero())
+		Expect(handle(0)).To(BeZero())
+
+		updateConfigMap("modified")
+		Expect(handle(time.Minute)).To(Equal(5 * time.Minute))
+		Expect(handle(5 * time.Minute)).To(BeZero())
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+		Expect(rollouts()).To(Equal(2))
+	})
+
+	It("delays the rollout by the rollout delay", func() {
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:     requiredAnnotationValue,
+			RolloutDelayAnnotation: "30s",
+		})
+		Expect(handle(0)).To(Equal(30 * time.Second))
+
+		updateConfigMap("rotated")
+		Expect(handle(10 * time.Second)).To(Equal(20 * time.Second))
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+
+		Expect(handle(20 * time.Second)).To(BeZero())
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+		Expect(rollouts()).To(Equal(1))
+	})
+
+	It("prefers the batch window to the rollout delay", func() {
+		d.GetAnnotations()[RolloutDelayAnnotation] = "30s"
+		Expect(handle(0)).To(Equal(5 * time.Minute))
+	})
+
+	It("rolls out immediately without a batch window", func() {
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		Expect(handle(0)).To(BeZero())
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave binary data Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	// update writes the child to the client
+	var update = func(obj runtime.Object) {
+		Expect(c.Update(context.TODO(), obj)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret1.DeepCopy()
+		s.StringData = nil
+		s.Data = map[string][]byte{"key1": []byte("example1:key1")}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("triggers a rollout when the binary data of a ConfigMap is added or changed", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		cm.BinaryData = map[string][]byte{"payload.gz": {0x1f, 0x8b, 0x00}}
+		update(cm)
+		added := reconcileHash(c, h, d)
+		Expect(added).NotTo(Equal(original))
+
+		cm.BinaryData["payload.gz"] = []byte{0x1f, 0x8b, 0x01}
+		update(cm)
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(added))
+	})
+
+	It("does not trigger a rollout when a ConfigMap's binary data is unchanged", func() {
+		cm.BinaryData = map[string][]byte{"payload.gz": {0x1f, 0x8b, 0x00}}
+		update(cm)
+		original := reconcileHash(c, h, d)
+
+		cm.SetLabels(map[string]string{"new": "label"})
+		update(cm)
+		Expect(reconcileHash(c, h, d)).To(Equal(original))
+	})
+
+	It("triggers a rollout when the string data of a Secret is changed", func() {
+		original := reconcileHash(c, h, d)
+
+		s.StringData = map[string]string{"key2": "example1:key2"}
+		update(s)
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("hashes string data over data with the same key", func() {
+		s.StringData = map[string]string{"key1": "modified"}
+		update(s)
+		merged := reconcileHash(c, h, d)
+
+		s.StringData = nil
+		s.Data = map[string][]byte{"key1": []byte("modified")}
+		update(s)
+		Expect(reconcileHash(c, h, d)).To(Equal(merged))
+	})
+})
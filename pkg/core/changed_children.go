@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// getChildHashes returns the leaf hash of each child, keyed on the kind and
+// name of the child, reusing the leaves cached while hashing the children
+func (h *Handler) getChildHashes(children []configObject) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, child := range children {
+		if child.object == nil {
+			continue
+		}
+		hash, err := h.getHashCache().leaves.getLeafHash(child, nil)
+		if err != nil {
+			return nil, err
+		}
+		hashes[kindOf(child.object)+"/"+child.object.GetName()] = hash
+	}
+	return hashes, nil
+}
+
+// getChangedChildren returns the sorted kinds and names of the children whose
+// leaf hash differs from when the instance's configuration was last applied,
+// including children that have been added or removed since.
+// Nothing is returned if the configuration has not been applied since Wave
+// started, as the changed children cannot be determined.
+func (h *Handler) getChangedChildren(obj podController, hashes map[string]string) []string {
+	h.childMutex.Lock()
+	previous, ok := h.childHashes[missingChildKey(obj)]
+	h.childMutex.Unlock()
+	if !ok {
+		return nil
+	}
+
+	changed := []string{}
+	for name, hash := range hashes {
+		if previous[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, exists := hashes[name]; !exists {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// setChildHashes records the leaf hashes of the children of the instance
+// once its configuration has been applied
+func (h *Handler) setChildHashes(obj podController, hashes map[string]string) {
+	h.childMutex.Lock()
+	defer h.childMutex.Unlock()
+	if h.childHashes == nil {
+		h.childHashes = make(map[string]map[string]string)
+	}
+	h.childHashes[missingChildKey(obj)] = hashes
+}
+
+// clearChildHashes forgets the leaf hashes recorded for the instance once Wave
+// no longer manages it
+func (h *Handler) clearChildHashes(obj podController) {
+	h.childMutex.Lock()
+	defer h.childMutex.Unlock()
+	delete(h.childHashes, missingChildKey(obj))
+}
+
+// setLastChangedChildren records the changed children that caused the
+// rollout of the instance on the metadata of the given podController. If the
+// instance had no configuration hash, the rollout is recorded as the initial
+// sync. The record is removed if the changed children are not known, and
+// truncated to the Handler's details size.
+func (h *Handler) setLastChangedChildren(obj podController, instance podController, changed []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	switch {
+	case !hasConfigHash(instance, h.getHashAnnotation()):
+		annotations[LastChangedChildrenAnnotation] = initialSyncChanges
+	case len(changed) > 0:
+		annotations[LastChangedChildrenAnnotation] = truncateDetails(changed, ",", h.getMaxDetailsSize())
+	default:
+		delete(annotations, LastChangedChildrenAnnotation)
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// hasConfigHash returns true if a configuration hash has been written to the
+// PodTemplate of the given podController, under the given annotation key or
+// to any environment variable
+func hasConfigHash(obj podController, key string) bool {
+	if _, ok := obj.GetPodTemplate().GetAnnotations()[key]; ok {
+		return true
+	}
+	return len(getAppliedHashEnv(obj)) > 0
+}
+
+// describeChangedChildren returns a suffix for the ConfigChanged event naming
+// the changed children, or an empty string if they are not known
+func describeChangedChildren(changed []string) string {
+	if len(changed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (changed: %s)", strings.Join(changed, ", "))
+}
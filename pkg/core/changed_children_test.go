@@ -0,0 +1,213 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave rollout events Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+	var recorder *record.FakeRecorder
+
+	// handle reconciles the Deployment and returns the error, if any
+	var handle = func() error {
+		_, err := h.HandleDeployment(d)
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return err
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret2.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{})
+	})
+
+	It("records a ConfigChanged event when the hash is first set", func() {
+		Expect(handle()).To(Succeed())
+		Expect(events()).To(ContainElement(HavePrefix("Normal ConfigChanged Configuration hash updated to " + d.Spec.Template.GetAnnotations()[ConfigHashAnnotation])))
+	})
+
+	It("names the children that changed", func() {
+		Expect(handle()).To(Succeed())
+		events()
+
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		s.StringData = nil
+		s.Data = map[string][]byte{"key1": []byte("modified")}
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+
+		Expect(handle()).To(Succeed())
+		Expect(events()).To(ContainElement(SatisfyAll(
+			HavePrefix("Normal ConfigChanged"),
+			HaveSuffix("(changed: ConfigMap/example1, Secret/example2)"),
+		)))
+	})
+
+	It("does not record a ConfigChanged event when nothing changed", func() {
+		Expect(handle()).To(Succeed())
+		events()
+
+		Expect(handle()).To(Succeed())
+		Expect(events()).NotTo(ContainElement(ContainSubstring("ConfigChanged")))
+	})
+
+	It("records a Warning event when a referenced child is missing", func() {
+		Expect(c.Delete(context.TODO(), cm)).To(Succeed())
+
+		Expect(handle()).NotTo(Succeed())
+		Expect(events()).To(ContainElement(HavePrefix("Warning MissingChild")))
+	})
+})
+
+var _ = Describe("Wave last changed children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+
+	// handle reconciles the Deployment and refreshes it from the client
+	var handle = func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("records the initial sync when the hash is first set", func() {
+		handle()
+		Expect(d.GetAnnotations()).To(HaveKeyWithValue(LastChangedChildrenAnnotation, initialSyncChanges))
+	})
+
+	It("lists only the child that changed", func() {
+		handle()
+
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		handle()
+		Expect(d.GetAnnotations()).To(HaveKeyWithValue(LastChangedChildrenAnnotation, "ConfigMap/example1"))
+	})
+
+	It("keeps the record when nothing has changed", func() {
+		handle()
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		handle()
+
+		handle()
+		Expect(d.GetAnnotations()).To(HaveKeyWithValue(LastChangedChildrenAnnotation, "ConfigMap/example1"))
+	})
+
+	It("removes the record when the changed children are not known", func() {
+		handle()
+
+		// A new Handler has not seen the children applied, as after a restart
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		handle()
+		Expect(d.GetAnnotations()).NotTo(HaveKey(LastChangedChildrenAnnotation))
+	})
+
+	It("forgets the recorded hashes once Wave is disabled for the instance", func() {
+		handle()
+		Expect(h.childHashes).To(HaveKey(missingChildKey(&deployment{d})))
+
+		d.SetAnnotations(map[string]string{})
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		handle()
+		Expect(h.childHashes).NotTo(HaveKey(missingChildKey(&deployment{d})))
+	})
+
+	It("forgets the recorded hashes once the instance is deleted", func() {
+		handle()
+		Expect(h.childHashes).To(HaveKey(missingChildKey(&deployment{d})))
+
+		_, err := h.handleDelete(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.childHashes).NotTo(HaveKey(missingChildKey(&deployment{d})))
+	})
+
+	It("reuses the leaves cached while hashing the children", func() {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		// The fake client does not set resourceVersions, without which
+		// children are never cached
+		for _, child := range current {
+			child.object.SetResourceVersion("1")
+		}
+		_, err = h.getHashCache().leaves.calculateMerkleConfigHash(current, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cached := len(h.getHashCache().leaves.entries)
+		Expect(cached).NotTo(BeZero())
+
+		hashes, err := h.getChildHashes(current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hashes).To(HaveLen(len(current)))
+		Expect(h.getHashCache().leaves.entries).To(HaveLen(cached))
+	})
+})
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// getChildBundles returns the names of the child bundles referenced by the
+// given podController
+func getChildBundles(obj podController) []string {
+	var bundles []string
+	for _, bundle := range strings.Split(obj.GetAnnotations()[ChildBundlesAnnotation], ",") {
+		if bundle = strings.TrimSpace(bundle); bundle != "" {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+// addBundleChildren expands the child bundles referenced by the given
+// podController, as defined in the child bundles ConfigMap, and adds each of
+// their members to the ConfigMaps or Secrets referenced by the podController.
+// Bundle members are always required and hashed in full.
+//
+// Each bundle is defined by a key of the child bundles ConfigMap holding a
+// list of members, separated by commas or new lines, in the form
+// `configmap/<name>` or `secret/<name>`.
+func (h *Handler) addBundleChildren(obj podController, configMaps, secrets map[string]configMetadata) error {
+	bundles := getChildBundles(obj)
+	if len(bundles) == 0 {
+		return nil
+	}
+	if h.opts.ChildBundles.Name == "" {
+		return fmt.Errorf("no child bundles ConfigMap configured")
+	}
+
+	definitions := &corev1.ConfigMap{}
+	err := h.Get(context.TODO(), h.opts.ChildBundles, definitions)
+	if err != nil {
+		return fmt.Errorf("error getting child bundles ConfigMap %s: %v", h.opts.ChildBundles, err)
+	}
+
+	for _, bundle := range bundles {
+		definition, ok := definitions.Data[bundle]
+		if !ok {
+			return fmt.Errorf("child bundle %s is not defined", bundle)
+		}
+		for _, member := range strings.FieldsFunc(definition, func(r rune) bool { return r == ',' || r == '\n' }) {
+			parts := strings.SplitN(strings.TrimSpace(member), "/", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return fmt.Errorf("invalid member %q of child bundle %s", member, bundle)
+			}
+			switch strings.ToLower(parts[0]) {
+			case "configmap":
+				configMaps[parts[1]] = addBundleMember(configMaps[parts[1]])
+			case "secret":
+				secrets[parts[1]] = addBundleMember(secrets[parts[1]])
+			default:
+				return fmt.Errorf("invalid member %q of child bundle %s", member, bundle)
+			}
+		}
+	}
+	return nil
+}
+
+// addBundleMember updates the metadata of a ConfigMap or Secret to track all
+// of its keys as a required child
+func addBundleMember(metadata configMetadata) configMetadata {
+	return configMetadata{required: true, allKeys: true, prefixes: metadata.prefixes}
+}
+
+// NewChildBundleHandler returns an EventHandler for ConfigMaps that, when the
+// child bundles ConfigMap changes, enqueues every workload of the given list
+// type that references a child bundle, so that changes to the definition of
+// a bundle are rolled out to the workloads referencing it.
+// Workloads are enabled as described by isEnabled with the given selector and
+// default.
+func NewChildBundleHandler(c client.Reader, list runtime.Object, bundles types.NamespacedName, selector labels.Selector, defaultEnabled bool) handler.EventHandler {
+	enqueue := func(obj metav1.Object, q workqueue.RateLimitingInterface) {
+		for _, req := range getChildBundleRequests(c, list.DeepCopyObject(), bundles, selector, defaultEnabled, obj) {
+			q.Add(req)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Meta, q)
+		},
+		UpdateFunc: func(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.MetaNew, q)
+		},
+		DeleteFunc: func(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Meta, q)
+		},
+	}
+}
+
+// getChildBundleRequests returns a request for each workload referencing a
+// child bundle if the given object is the child bundles ConfigMap
+func getChildBundleRequests(c client.Reader, list runtime.Object, bundles types.NamespacedName, selector labels.Selector, defaultEnabled bool, obj metav1.Object) []reconcile.Request {
+	if obj == nil || bundles.Name == "" || obj.GetNamespace() != bundles.Namespace || obj.GetName() != bundles.Name {
+		return nil
+	}
+
+	err := c.List(context.TODO(), list)
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "error listing workloads for child bundles", "namespace", bundles.Namespace, "name", bundles.Name)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, instance := range podControllersFromList(list) {
+		if !isEnabled(instance, selector, defaultEnabled) || toBeDeleted(instance) || len(getChildBundles(instance)) == 0 {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()},
+		})
+	}
+	return requests
+}
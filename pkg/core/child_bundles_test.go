@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave child bundles Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var bundles *corev1.ConfigMap
+	var member *corev1.ConfigMap
+
+	var bundlesKey = types.NamespacedName{Namespace: "wave", Name: "wave-child-bundles"}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:     requiredAnnotationValue,
+			ChildBundlesAnnotation: "observability",
+		})
+
+		bundles = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: bundlesKey.Namespace, Name: bundlesKey.Name},
+			Data: map[string]string{
+				"observability": "configmap/fluentd-config\nsecret/example1",
+			},
+		}
+		member = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: d.GetNamespace(), Name: "fluentd-config"},
+			Data:       map[string]string{"fluent.conf": "original"},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, bundles, member,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{ChildBundles: bundlesKey})
+	})
+
+	It("expands the referenced bundle into the workload's children", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).NotTo(HaveKey("fluentd-config"))
+
+		Expect(h.addBundleChildren(&deployment{d}, configMaps, secrets)).To(Succeed())
+		Expect(configMaps).To(HaveKeyWithValue("fluentd-config", configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKeyWithValue("example1", configMetadata{required: true, allKeys: true}))
+	})
+
+	It("rolls the workload when a bundle member changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		member.Data["fluent.conf"] = "modified"
+		Expect(c.Update(context.TODO(), member)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("rolls the workload when the bundle definition changes", func() {
+		original := reconcileHash(c, h, d)
+
+		bundles.Data["observability"] = "secret/example1"
+		Expect(c.Update(context.TODO(), bundles)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("returns an error for an undefined bundle", func() {
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:     requiredAnnotationValue,
+			ChildBundlesAnnotation: "unknown",
+		})
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(h.addBundleChildren(&deployment{d}, configMaps, secrets)).NotTo(Succeed())
+	})
+
+	It("enqueues the workloads referencing a bundle when the bundles ConfigMap changes", func() {
+		requests := getChildBundleRequests(c, &appsv1.DeploymentList{}, bundlesKey, nil, false, bundles)
+		Expect(requests).To(ConsistOf(reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: d.GetNamespace(), Name: d.GetName()},
+		}))
+
+		Expect(getChildBundleRequests(c, &appsv1.DeploymentList{}, bundlesKey, nil, false, member)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// ChildIndexField is the name of the field index that maps each workload to
+// the ConfigMaps and Secrets it references
+const ChildIndexField = "wave.pusher.com/children"
+
+// IndexChildren adds the child index for workloads of the given type to the
+// indexer, so that NewIndexedChildHandler can look up the workloads
+// referencing a child
+func IndexChildren(indexer client.FieldIndexer, obj runtime.Object) error {
+	return indexer.IndexField(obj, ChildIndexField, getChildIndexValues)
+}
+
+// getChildIndexValues returns the child index values of a workload, one for
+// each ConfigMap and Secret referenced by its PodTemplate or its extra
+// children annotations and one for its hash group, if it belongs to one.
+// Invalid extra children references are left out, as the error is reported
+// when the workload is reconciled, as are references to the shared config
+// namespace, whose children are watched by NewSharedChildHandler, and the
+// references of Pods rendered for workloads that scan their Pods, which
+// cannot be listed while indexing.
+// The cache prefixes each value with the workload's namespace.
+func getChildIndexValues(obj runtime.Object) []string {
+	instance := toPodController(obj)
+	if instance == nil {
+		return nil
+	}
+
+	configMaps, secrets := getChildNamesByType(instance)
+	_ = addExtraChildren(instance, "", configMaps, secrets)
+	values := make([]string, 0, len(configMaps)+len(secrets)+1)
+	for name := range configMaps {
+		values = append(values, childIndexValue("ConfigMap", name))
+	}
+	for name := range secrets {
+		values = append(values, childIndexValue("Secret", name))
+	}
+	if group := getHashGroup(instance); group != "" {
+		values = append(values, childIndexValue("HashGroup", group))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// childIndexValue returns the child index value for the kind and name of a
+// child
+func childIndexValue(kind, name string) string {
+	return kind + "/" + name
+}
+
+// toPodController wraps a workload in a podController, returning nil if the
+// object is not a workload
+func toPodController(obj runtime.Object) podController {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &deployment{o}
+	case *appsv1.StatefulSet:
+		return &statefulset{o}
+	case *appsv1.DaemonSet:
+		return &daemonset{o}
+	case *appsv1.ReplicaSet:
+		return &replicaset{o}
+	case *batchv1beta1.CronJob:
+		return &cronjob{o}
+	case *unstructured.Unstructured:
+		return &unstructuredPodController{o}
+	default:
+		return nil
+	}
+}
+
+// NewIndexedChildHandler returns an EventHandler for ConfigMaps and Secrets
+// that enqueues every workload of the given list type that references the
+// child, looking them up through the child index rather than the
+// OwnerReferences of the child. Workloads in the same hash group as any
+// workload referencing the child are enqueued too.
+//
+// The child index for the list type, and for Deployments, StatefulSets,
+// DaemonSets and CronJobs, must have been added with IndexChildren.
+//
+// Workloads are enabled as described by isEnabled with the given selector and
+// default.
+func NewIndexedChildHandler(c client.Reader, list runtime.Object, selector labels.Selector, defaultEnabled bool) handler.EventHandler {
+	enqueue := func(obj runtime.Object, child metav1.Object, q workqueue.RateLimitingInterface) {
+		for _, req := range getIndexedChildRequests(c, list.DeepCopyObject(), selector, defaultEnabled, obj, child) {
+			q.Add(req)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+		UpdateFunc: func(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.ObjectNew, evt.MetaNew, q)
+		},
+		DeleteFunc: func(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+		GenericFunc: func(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+	}
+}
+
+// getIndexedChildRequests returns a request for each enabled workload of the
+// list type that references the child, or that shares a hash group with a
+// workload of any kind that references the child
+func getIndexedChildRequests(c client.Reader, list runtime.Object, selector labels.Selector, defaultEnabled bool, obj runtime.Object, child metav1.Object) []reconcile.Request {
+	if child == nil {
+		return nil
+	}
+
+	var kind string
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		kind = "ConfigMap"
+	case *corev1.Secret:
+		kind = "Secret"
+	default:
+		return nil
+	}
+	value := childIndexValue(kind, child.GetName())
+
+	// Keep an empty copy of the list to list the members of hash groups into
+	empty := list.DeepCopyObject()
+	instances, err := listIndexedWorkloads(c, list, child.GetNamespace(), value, selector, defaultEnabled)
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "error listing workloads for child", "namespace", child.GetNamespace(), "name", child.GetName())
+		return nil
+	}
+
+	// Find the hash groups of the workloads of every kind referencing the
+	// child, as each member tracks the children of the whole group
+	referencing := instances
+	for _, other := range []runtime.Object{&appsv1.DeploymentList{}, &appsv1.StatefulSetList{}, &appsv1.DaemonSetList{}, &batchv1beta1.CronJobList{}} {
+		if reflect.TypeOf(other) == reflect.TypeOf(list) {
+			continue
+		}
+		others, err := listIndexedWorkloads(c, other, child.GetNamespace(), value, selector, defaultEnabled)
+		if err != nil {
+			logf.Log.WithName("wave").Error(err, "error listing workloads for child", "namespace", child.GetNamespace(), "name", child.GetName())
+			return nil
+		}
+		referencing = append(referencing, others...)
+	}
+	groups := make(map[string]struct{})
+	for _, instance := range referencing {
+		if group := getHashGroup(instance); group != "" {
+			groups[group] = struct{}{}
+		}
+	}
+	for group := range groups {
+		members, err := listIndexedWorkloads(c, empty.DeepCopyObject(), child.GetNamespace(), childIndexValue("HashGroup", group), selector, defaultEnabled)
+		if err != nil {
+			logf.Log.WithName("wave").Error(err, "error listing members of hash group", "namespace", child.GetNamespace(), "group", group)
+			return nil
+		}
+		instances = append(instances, members...)
+	}
+
+	seen := make(map[types.NamespacedName]struct{})
+	requests := []reconcile.Request{}
+	for _, instance := range instances {
+		name := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		requests = append(requests, reconcile.Request{NamespacedName: name})
+	}
+	return requests
+}
+
+// listIndexedWorkloads lists the enabled workloads of the list type in the
+// namespace with the given child index value
+func listIndexedWorkloads(c client.Reader, list runtime.Object, namespace, value string, selector labels.Selector, defaultEnabled bool) ([]podController, error) {
+	err := c.List(context.TODO(), list, client.InNamespace(namespace), client.MatchingField(ChildIndexField, value))
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []podController{}
+	for _, instance := range podControllersFromList(list) {
+		if isEnabled(instance, selector, defaultEnabled) && !toBeDeleted(instance) {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// indexedClient filters List calls selecting the child index the way a cache
+// with the child index added would, as the fake client ignores field
+// selectors
+type indexedClient struct {
+	client.Client
+}
+
+func (c *indexedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	err := c.Client.List(ctx, list, opts...)
+	if err != nil {
+		return err
+	}
+
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	if listOpts.FieldSelector == nil {
+		return nil
+	}
+	value, ok := listOpts.FieldSelector.RequiresExactMatch(ChildIndexField)
+	if !ok {
+		return nil
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	filtered := []runtime.Object{}
+	for _, item := range items {
+		for _, v := range getChildIndexValues(item) {
+			if v == value {
+				filtered = append(filtered, item)
+				break
+			}
+		}
+	}
+	return meta.SetList(list, filtered)
+}
+
+// childUpdateClient counts the Updates made to ConfigMaps and Secrets
+type childUpdateClient struct {
+	client.Client
+	updates int
+}
+
+func (c *childUpdateClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	switch obj.(type) {
+	case *corev1.ConfigMap, *corev1.Secret:
+		c.updates++
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("Wave child index Suite", func() {
+	var c client.Client
+	var shared *corev1.ConfigMap
+
+	// mountingDeployment returns an enabled Deployment with the given name
+	// that mounts the named ConfigMap
+	var mountingDeployment = func(name, configMap string) *appsv1.Deployment {
+		d := newDeployment(name, nil)
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+					},
+				},
+			},
+		}
+		return d
+	}
+
+	// requestFor returns the request for the Deployment with the given name
+	var requestFor = func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: shared.GetNamespace(), Name: name}}
+	}
+
+	BeforeEach(func() {
+		shared = utils.ExampleConfigMap1.DeepCopy()
+	})
+
+	Context("getChildIndexValues", func() {
+		It("returns a value for each referenced ConfigMap and Secret", func() {
+			values := getChildIndexValues(utils.ExampleDeployment.DeepCopy())
+			Expect(values).To(ContainElement("ConfigMap/example1"))
+			Expect(values).To(ContainElement("ConfigMap/example2"))
+			Expect(values).To(ContainElement("Secret/example1"))
+			Expect(values).To(ContainElement("Secret/example3"))
+		})
+
+		It("returns a value for the hash group", func() {
+			d := mountingDeployment("grouped", shared.GetName())
+			d.GetAnnotations()[HashGroupAnnotation] = "frontend"
+			Expect(getChildIndexValues(d)).To(ConsistOf("ConfigMap/"+shared.GetName(), "HashGroup/frontend"))
+		})
+
+		It("returns no values for objects that are not workloads", func() {
+			Expect(getChildIndexValues(shared)).To(BeEmpty())
+		})
+	})
+
+	Context("getIndexedChildRequests", func() {
+		BeforeEach(func() {
+			disabled := mountingDeployment("disabled", shared.GetName())
+			disabled.SetAnnotations(map[string]string{})
+
+			grouped := mountingDeployment("grouped", shared.GetName())
+			grouped.GetAnnotations()[HashGroupAnnotation] = "frontend"
+			member := mountingDeployment("member", "other")
+			member.GetAnnotations()[HashGroupAnnotation] = "frontend"
+
+			c = &indexedClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, shared,
+				mountingDeployment("first", shared.GetName()),
+				mountingDeployment("second", shared.GetName()),
+				mountingDeployment("unrelated", "other"),
+				disabled, grouped, member,
+			)}
+		})
+
+		It("returns the enabled Deployments referencing a shared ConfigMap and the members of their hash groups", func() {
+			requests := getIndexedChildRequests(c, &appsv1.DeploymentList{}, nil, false, shared, shared)
+			Expect(requests).To(ConsistOf(
+				requestFor("first"),
+				requestFor("second"),
+				requestFor("grouped"),
+				requestFor("member"),
+			))
+		})
+
+		It("returns no requests for a Secret sharing the ConfigMap's name", func() {
+			s := utils.ExampleSecret2.DeepCopy()
+			s.SetName(shared.GetName())
+			Expect(getIndexedChildRequests(c, &appsv1.DeploymentList{}, nil, false, s, s)).To(BeEmpty())
+		})
+	})
+
+	Context("with the child index enabled", func() {
+		It("does not add OwnerReferences to children", func() {
+			d := mountingDeployment("first", shared.GetName())
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, shared)
+			h := NewHandler(c, record.NewFakeRecorder(100), Options{IndexChildren: true})
+
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+
+			child := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, child)).To(Succeed())
+			Expect(child.GetOwnerReferences()).To(BeEmpty())
+		})
+	})
+
+	Context("with OwnerReferences disabled", func() {
+		var updates *childUpdateClient
+		var h *Handler
+		var d *appsv1.Deployment
+
+		BeforeEach(func() {
+			d = mountingDeployment("first", shared.GetName())
+			updates = &childUpdateClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d, shared)}
+			c = updates
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{DisableOwnerReferences: true})
+		})
+
+		It("watches children through the child index", func() {
+			Expect(Options{DisableOwnerReferences: true}.UsesChildIndex()).To(BeTrue())
+		})
+
+		It("rolls out changes without updating children", func() {
+			original := reconcileHash(c, h, d)
+			Expect(original).NotTo(BeEmpty())
+
+			shared.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), shared)).To(Succeed())
+			updates.updates = 0
+
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+			Expect(updates.updates).To(BeZero())
+
+			child := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, child)).To(Succeed())
+			Expect(child.GetOwnerReferences()).To(BeEmpty())
+		})
+
+		It("leaves existing OwnerReferences in place when cleaning up", func() {
+			reconcileHash(c, h, d)
+			child := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, child)).To(Succeed())
+			child.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(&deployment{d})})
+			Expect(c.Update(context.TODO(), child)).To(Succeed())
+			updates.updates = 0
+
+			d.SetAnnotations(map[string]string{})
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+			reconcileHash(c, h, d)
+			Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(d.GetFinalizers()).To(BeEmpty())
+			Expect(updates.updates).To(BeZero())
+
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, child)).To(Succeed())
+			Expect(child.GetOwnerReferences()).To(HaveLen(1))
+		})
+	})
+})
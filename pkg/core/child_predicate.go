@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// waveAnnotationPrefix is the prefix shared by the annotations Wave reads
+// from children
+const waveAnnotationPrefix = "wave.pusher.com/"
+
+// ChildPredicates returns the Predicates to apply to the watches on the
+// ConfigMaps and Secrets referenced by workloads
+func ChildPredicates() []predicate.Predicate {
+	return []predicate.Predicate{NewChildDataPredicate()}
+}
+
+// NewChildDataPredicate returns a Predicate for child watches that drops
+// updates which cannot change the configuration hash of any workload, such as
+// label changes or resyncs that only bump the resourceVersion.
+// Updates are admitted if the data, the Wave annotations, the OwnerReferences
+// or the deletion timestamp of the child changed.
+func NewChildDataPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(evt event.UpdateEvent) bool {
+			return childChanged(evt.ObjectOld, evt.MetaOld, evt.ObjectNew, evt.MetaNew)
+		},
+	}
+}
+
+// childChanged returns true if the update from the old to the new object may
+// affect the workloads referencing it. Objects that are not ConfigMaps or
+// Secrets are always considered changed.
+func childChanged(oldObj interface{}, oldMeta metav1.Object, newObj interface{}, newMeta metav1.Object) bool {
+	if oldMeta == nil || newMeta == nil {
+		return true
+	}
+
+	switch o := oldObj.(type) {
+	case *corev1.ConfigMap:
+		n, ok := newObj.(*corev1.ConfigMap)
+		if !ok || !reflect.DeepEqual(o.Data, n.Data) || !reflect.DeepEqual(o.BinaryData, n.BinaryData) {
+			return true
+		}
+	case *corev1.Secret:
+		n, ok := newObj.(*corev1.Secret)
+		if !ok || o.Type != n.Type || !reflect.DeepEqual(o.Data, n.Data) || !reflect.DeepEqual(o.StringData, n.StringData) {
+			return true
+		}
+	default:
+		return true
+	}
+
+	return !reflect.DeepEqual(waveAnnotations(oldMeta), waveAnnotations(newMeta)) ||
+		!reflect.DeepEqual(oldMeta.GetOwnerReferences(), newMeta.GetOwnerReferences()) ||
+		!reflect.DeepEqual(oldMeta.GetDeletionTimestamp(), newMeta.GetDeletionTimestamp())
+}
+
+// waveAnnotations returns the Wave annotations of the object
+func waveAnnotations(obj metav1.Object) map[string]string {
+	annotations := make(map[string]string)
+	for key, value := range obj.GetAnnotations() {
+		if strings.HasPrefix(key, waveAnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Wave child data Suite", func() {
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	// update returns whether the child data predicate admits the update from
+	// the old to the new object
+	var update = func(oldObj, newObj runtime.Object) bool {
+		return NewChildDataPredicate().Update(event.UpdateEvent{
+			ObjectOld: oldObj,
+			MetaOld:   oldObj.(metav1.Object),
+			ObjectNew: newObj,
+			MetaNew:   newObj.(metav1.Object),
+		})
+	}
+
+	// hashOf returns the configuration hash of the ConfigMap as a whole
+	var hashOf = func(obj *corev1.ConfigMap) string {
+		hash, err := calculateConfigHash([]configObject{{object: obj, allKeys: true}})
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret1.DeepCopy()
+		s.Data = map[string][]byte{"key1": []byte("value1")}
+	})
+
+	Context("calculateConfigHash", func() {
+		It("returns the same hash when only the labels of a ConfigMap change", func() {
+			updated := cm.DeepCopy()
+			updated.SetLabels(map[string]string{"new": "label"})
+			updated.SetResourceVersion("2")
+			Expect(hashOf(updated)).To(Equal(hashOf(cm)))
+		})
+
+		It("returns a different hash when the binary data of a ConfigMap changes", func() {
+			updated := cm.DeepCopy()
+			updated.BinaryData = map[string][]byte{"binary": {0x00, 0x01}}
+			Expect(hashOf(updated)).NotTo(Equal(hashOf(cm)))
+
+			modified := updated.DeepCopy()
+			modified.BinaryData["binary"] = []byte{0x02}
+			Expect(hashOf(modified)).NotTo(Equal(hashOf(updated)))
+		})
+
+		It("leaves binary data out of the hash source when there is none", func() {
+			source, err := getHashSource([]configObject{{object: cm, allKeys: true}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(source)).NotTo(ContainSubstring("configMapBinaryData"))
+		})
+
+		It("only hashes the selected binary keys", func() {
+			cm.BinaryData = map[string][]byte{"binary": {0x00}, "other": {0x01}}
+			child := configObject{object: cm, keys: map[string]struct{}{"binary": {}}}
+			Expect(getConfigMapBinaryData(child)).To(Equal(map[string][]byte{"binary": {0x00}}))
+		})
+	})
+
+	Context("NewChildDataPredicate", func() {
+		It("drops updates that only change the labels of a ConfigMap", func() {
+			updated := cm.DeepCopy()
+			updated.SetLabels(map[string]string{"new": "label"})
+			updated.SetResourceVersion("2")
+			Expect(update(cm, updated)).To(BeFalse())
+		})
+
+		It("drops updates that only change annotations not read by Wave", func() {
+			updated := s.DeepCopy()
+			updated.SetAnnotations(map[string]string{"example.com/note": "changed"})
+			Expect(update(s, updated)).To(BeFalse())
+		})
+
+		It("admits updates to the data of a ConfigMap", func() {
+			updated := cm.DeepCopy()
+			updated.Data["key1"] = "modified"
+			Expect(update(cm, updated)).To(BeTrue())
+		})
+
+		It("admits updates to the binary data of a ConfigMap", func() {
+			updated := cm.DeepCopy()
+			updated.BinaryData = map[string][]byte{"binary": {0x00}}
+			Expect(update(cm, updated)).To(BeTrue())
+		})
+
+		It("admits updates to the data or string data of a Secret", func() {
+			updated := s.DeepCopy()
+			updated.Data["key1"] = []byte("modified")
+			Expect(update(s, updated)).To(BeTrue())
+
+			updated = s.DeepCopy()
+			updated.StringData = map[string]string{"key1": "modified"}
+			Expect(update(s, updated)).To(BeTrue())
+		})
+
+		It("admits updates to the Wave annotations of a child", func() {
+			updated := cm.DeepCopy()
+			updated.SetAnnotations(map[string]string{IgnoreKeysAnnotation: "key1"})
+			Expect(update(cm, updated)).To(BeTrue())
+		})
+
+		It("admits updates to the OwnerReferences of a child", func() {
+			updated := cm.DeepCopy()
+			updated.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "example", UID: "uid"}})
+			Expect(update(cm, updated)).To(BeTrue())
+		})
+
+		It("admits updates to objects that are not children", func() {
+			d := utils.ExampleDeployment.DeepCopy()
+			Expect(update(d, d.DeepCopy())).To(BeTrue())
+		})
+	})
+})
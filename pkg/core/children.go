@@ -19,10 +19,15 @@ package core
 import (
 	"context"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -36,6 +41,7 @@ type configMetadata struct {
 	required bool
 	allKeys  bool
 	keys     map[string]struct{}
+	prefixes map[string]struct{}
 }
 
 // getResult is returned from the getObject method as a helper struct to be
@@ -44,6 +50,10 @@ type getResult struct {
 	err      error
 	obj      Object
 	metadata configMetadata
+
+	// missing names the kind and name of the Object if it is required but
+	// does not exist
+	missing string
 }
 
 // getCurrentChildren returns a list of all Secrets and ConfigMaps that are
@@ -51,45 +61,106 @@ type getResult struct {
 // (i.e. via an EnvFrom or a Volume) will result in one entry in the list, irrespective of
 // whether individual elements are also references (i.e. via an Env entry).
 func (h *Handler) getCurrentChildren(obj podController) ([]configObject, error) {
-	configMaps, secrets := getChildNamesByType(obj)
+	rendered, err := h.getRenderedPodController(obj)
+	if err != nil {
+		return []configObject{}, fmt.Errorf("error scanning pods: %v", err)
+	}
+	configMaps, secrets := getChildNamesByType(rendered)
+	err = h.addBundleChildren(obj, configMaps, secrets)
+	if err != nil {
+		return []configObject{}, fmt.Errorf("error expanding child bundles: %v", err)
+	}
+	err = addExtraChildren(obj, h.opts.SharedConfigNamespace, configMaps, secrets)
+	if err != nil {
+		return []configObject{}, fmt.Errorf("error adding extra children: %v", err)
+	}
+	err = removeExcludedChildren(obj, configMaps, secrets)
+	if err != nil {
+		return []configObject{}, fmt.Errorf("error excluding children: %v", err)
+	}
+	if requiresAllChildren(obj) {
+		requireAll(configMaps)
+		requireAll(secrets)
+	}
+	extraKinds := h.getExtraKindChildNames(rendered)
 
-	// get all of ConfigMaps and Secrets
+	// get all of ConfigMaps and Secrets, from the shared config namespace for
+	// those listed there as extra children
 	resultsChan := make(chan getResult)
-	for name, metadata := range configMaps {
-		go func(name string, metadata configMetadata) {
-			resultsChan <- h.getConfigMap(obj.GetNamespace(), name, metadata)
-		}(name, metadata)
+	for key, metadata := range configMaps {
+		go func(key string, metadata configMetadata) {
+			namespace, name := splitChildKey(obj, key)
+			resultsChan <- h.getConfigMap(namespace, name, metadata)
+		}(key, metadata)
+	}
+	for key, metadata := range secrets {
+		go func(key string, metadata configMetadata) {
+			namespace, name := splitChildKey(obj, key)
+			resultsChan <- h.getSecret(namespace, name, metadata)
+		}(key, metadata)
 	}
-	for name, metadata := range secrets {
-		go func(name string, metadata configMetadata) {
-			resultsChan <- h.getSecret(obj.GetNamespace(), name, metadata)
-		}(name, metadata)
+	expected := len(configMaps) + len(secrets)
+	for gvk, names := range extraKinds {
+		for name, metadata := range names {
+			go func(gvk schema.GroupVersionKind, name string, metadata configMetadata) {
+				resultsChan <- h.getObject(obj.GetNamespace(), name, metadata, newUnstructured(gvk))
+			}(gvk, name, metadata)
+		}
+		expected += len(names)
 	}
 
 	// Range over and collect results from the gets
 	var errs []string
+	var missing []string
 	var children []configObject
-	for i := 0; i < len(configMaps)+len(secrets); i++ {
+	allMissing := true
+	for i := 0; i < expected; i++ {
 		result := <-resultsChan
 		if result.err != nil {
 			errs = append(errs, result.err.Error())
+			allMissing = allMissing && errors.IsNotFound(result.err)
 		}
-		if result.obj != nil {
-			children = append(children, configObject{
+		if result.missing != "" {
+			missing = append(missing, result.missing)
+		}
+		// Skip Secrets of types that are not tracked
+		if result.obj != nil && h.isTrackedChild(result.obj) {
+			child := configObject{
 				object:   result.obj,
 				required: result.metadata.required,
 				allKeys:  result.metadata.allKeys,
 				keys:     result.metadata.keys,
-			})
+				prefixes: result.metadata.prefixes,
+				typeKeys: h.getSecretTypeKeys(result.obj),
+			}
+			if u, ok := result.obj.(*unstructured.Unstructured); ok {
+				data, err := h.getExtraKindData(u)
+				if err != nil {
+					errs = append(errs, err.Error())
+					allMissing = false
+					continue
+				}
+				child.extracted = data
+			}
+			children = append(children, child)
 		}
 	}
 
 	// If there were any errors, don't return any children
 	if len(errs) > 0 {
-		return []configObject{}, fmt.Errorf("error(s) encountered when geting children: %s", strings.Join(errs, ", "))
+		err := fmt.Errorf("error(s) encountered when geting children: %s", strings.Join(errs, ", "))
+		if allMissing {
+			sort.Strings(missing)
+			setJSONPaths(obj, children)
+			setThresholds(obj, children)
+			return []configObject{}, &missingChildError{err: err, missing: missing, children: children}
+		}
+		return []configObject{}, err
 	}
 
 	// No errors, return the list of children
+	setJSONPaths(obj, children)
+	setThresholds(obj, children)
 	return children, nil
 }
 
@@ -101,32 +172,120 @@ func getChildNamesByType(obj podController) (map[string]configMetadata, map[stri
 	configMaps := make(map[string]configMetadata)
 	secrets := make(map[string]configMetadata)
 
+	// Init containers are considered alongside the main containers so
+	// that configuration consumed during initialisation is also tracked
+	containers := getAllContainers(obj)
+
 	// Range through all Volumes and check the VolumeSources for ConfigMaps
-	// and Secrets
+	// and Secrets. Volumes are matched to their ConfigMap or Secret by the
+	// name in the VolumeSource, which may differ from the name of the Volume.
+	// A child is required if any of its references is not optional.
+	// Volumes projecting only some items of a child track only their keys,
+	// as do Volumes that are only mounted through a subPath selecting them.
+	mounted := getMountedVolumes(containers)
+	subPaths := getVolumeSubPaths(containers)
+	mountedOnly := isMountedOnly(obj)
 	for _, vol := range obj.GetPodTemplate().Spec.Volumes {
-		if cm := vol.VolumeSource.ConfigMap; cm != nil {
-			configMaps[cm.Name] = configMetadata{required: isRequired(cm.Optional), allKeys: true}
+		if _, ok := mounted[vol.Name]; mountedOnly && !ok {
+			continue
+		}
+		addVolumeChildNames(vol, subPaths[vol.Name], configMaps, secrets)
+	}
+
+	// Volumes are pod scoped, but only the EnvFrom and Env of the containers
+	// listed by the containers annotation are considered
+	addContainerChildNames(getScopedContainers(obj, containers), configMaps, secrets)
+
+	// Range through all ImagePullSecrets. As Kubernetes creates Pods whose
+	// ImagePullSecrets do not exist, these are tracked as optional.
+	for _, s := range obj.GetPodTemplate().Spec.ImagePullSecrets {
+		secrets[s.Name] = configMetadata{required: secrets[s.Name].required, allKeys: true, prefixes: secrets[s.Name].prefixes}
+	}
+	return configMaps, secrets
+}
+
+// addVolumeChildNames adds the ConfigMaps and Secrets referenced by the
+// VolumeSource of the given Volume to the configMaps and secrets. If the
+// Volume is only mounted through the given subPaths, only the items they
+// select are tracked.
+func addVolumeChildNames(vol corev1.Volume, subPaths []string, configMaps, secrets map[string]configMetadata) {
+	if cm := vol.VolumeSource.ConfigMap; cm != nil {
+		configMaps[cm.Name] = parseVolumeSource(configMaps[cm.Name], selectSubPathItems(cm.Items, subPaths), cm.Optional)
+	}
+	if s := vol.VolumeSource.Secret; s != nil {
+		secrets[s.SecretName] = parseVolumeSource(secrets[s.SecretName], selectSubPathItems(s.Items, subPaths), s.Optional)
+	}
+	if projected := vol.VolumeSource.Projected; projected != nil {
+		for _, source := range projected.Sources {
+			if cm := source.ConfigMap; cm != nil {
+				configMaps[cm.Name] = parseVolumeSource(configMaps[cm.Name], selectSubPathItems(cm.Items, subPaths), cm.Optional)
+			}
+			if s := source.Secret; s != nil {
+				secrets[s.Name] = parseVolumeSource(secrets[s.Name], selectSubPathItems(s.Items, subPaths), s.Optional)
+			}
+		}
+	}
+}
+
+// selectSubPathItems returns the items of a VolumeSource that are visible
+// through the given subPaths, or all of the items if there are no subPaths.
+// A source without items projects each key to a file of the same name, so a
+// subPath naming a file selects the key of that name.
+// If the subPaths cannot be mapped to keys every item is returned, so that a
+// key is never wrongly left out of the hash.
+func selectSubPathItems(items []corev1.KeyToPath, subPaths []string) []corev1.KeyToPath {
+	if len(subPaths) == 0 {
+		return items
+	}
+
+	if len(items) == 0 {
+		selected := []corev1.KeyToPath{}
+		for _, subPath := range subPaths {
+			if strings.Contains(subPath, "/") || strings.HasPrefix(subPath, "..") {
+				return items
+			}
+			selected = append(selected, corev1.KeyToPath{Key: subPath, Path: subPath})
 		}
-		if s := vol.VolumeSource.Secret; s != nil {
-			secrets[s.SecretName] = configMetadata{required: isRequired(s.Optional), allKeys: true}
+		return selected
+	}
+
+	selected := []corev1.KeyToPath{}
+	for _, item := range items {
+		itemPath := path.Clean(item.Path)
+		for _, subPath := range subPaths {
+			if itemPath == subPath || strings.HasPrefix(itemPath, subPath+"/") {
+				selected = append(selected, item)
+				break
+			}
 		}
 	}
+	if len(selected) == 0 {
+		return items
+	}
+	return selected
+}
 
+// addContainerChildNames adds the ConfigMaps and Secrets referenced by the
+// EnvFrom and Env of the given containers to the configMaps and secrets.
+// EnvFrom sources are processed across all containers before any Env, so
+// that a child consumed whole by one container is never narrowed to the keys
+// referenced by another.
+func addContainerChildNames(containers []corev1.Container, configMaps, secrets map[string]configMetadata) {
 	// Range through all Containers and their respective EnvFrom,
 	// then check the EnvFromSources for ConfigMaps and Secrets
-	for _, container := range obj.GetPodTemplate().Spec.Containers {
+	for _, container := range containers {
 		for _, env := range container.EnvFrom {
 			if cm := env.ConfigMapRef; cm != nil {
-				configMaps[cm.Name] = configMetadata{required: isRequired(cm.Optional), allKeys: true}
+				configMaps[cm.Name] = parseEnvFromSource(configMaps[cm.Name], cm.Optional, container.Name, env.Prefix)
 			}
 			if s := env.SecretRef; s != nil {
-				secrets[s.Name] = configMetadata{required: isRequired(s.Optional), allKeys: true}
+				secrets[s.Name] = parseEnvFromSource(secrets[s.Name], s.Optional, container.Name, env.Prefix)
 			}
 		}
 	}
 
 	// Range through all Containers and their respective Env
-	for _, container := range obj.GetPodTemplate().Spec.Containers {
+	for _, container := range containers {
 		for _, env := range container.Env {
 			if valFrom := env.ValueFrom; valFrom != nil {
 				if cm := valFrom.ConfigMapKeyRef; cm != nil {
@@ -138,38 +297,129 @@ func getChildNamesByType(obj podController) (map[string]configMetadata, map[stri
 			}
 		}
 	}
+}
 
-	return configMaps, secrets
+// getAllContainers returns the init containers followed by the containers of
+// the podController's PodTemplate
+func getAllContainers(obj podController) []corev1.Container {
+	spec := obj.GetPodTemplate().Spec
+	containers := make([]corev1.Container, 0, len(spec.InitContainers)+len(spec.Containers))
+	containers = append(containers, spec.InitContainers...)
+	return append(containers, spec.Containers...)
 }
 
-func isRequired(b *bool) bool {
-	return b == nil || !*b
+// getScopedContainers returns the containers listed by the containers
+// annotation of the podController, or all of the given containers if it is
+// not set
+func getScopedContainers(obj podController, containers []corev1.Container) []corev1.Container {
+	names := parseKeyList(obj.GetAnnotations()[ContainersAnnotation])
+	if len(names) == 0 {
+		return containers
+	}
+	scoped := []corev1.Container{}
+	for _, container := range containers {
+		if _, ok := names[container.Name]; ok {
+			scoped = append(scoped, container)
+		}
+	}
+	return scoped
 }
 
-// parseConfigMapKeyRef updates the metadata for a ConfigMap to include the keys specified in this ConfigMapKeySelector
-func parseConfigMapKeyRef(metadata configMetadata, cm *corev1.ConfigMapKeySelector) configMetadata {
-	if !metadata.allKeys {
-		if metadata.keys == nil {
-			metadata.keys = make(map[string]struct{})
+// getMountedVolumes returns the names of the Volumes mounted by any of the
+// containers
+func getMountedVolumes(containers []corev1.Container) map[string]struct{} {
+	mounted := make(map[string]struct{})
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			mounted[mount.Name] = struct{}{}
 		}
-		if cm.Optional == nil || !*cm.Optional {
-			metadata.required = true
+	}
+	return mounted
+}
+
+// getVolumeSubPaths returns the subPaths through which the containers mount
+// each Volume, for the Volumes that are only ever mounted through a subPath.
+// Volumes mounted whole by any container, or through a subPathExpr that is
+// only expanded in the Pod, are not included.
+func getVolumeSubPaths(containers []corev1.Container) map[string][]string {
+	subPaths := make(map[string][]string)
+	whole := make(map[string]struct{})
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			subPath := path.Clean(mount.SubPath)
+			if mount.SubPath == "" || mount.SubPathExpr != "" || subPath == "." {
+				whole[mount.Name] = struct{}{}
+				continue
+			}
+			subPaths[mount.Name] = append(subPaths[mount.Name], subPath)
 		}
-		metadata.keys[cm.Key] = struct{}{}
+	}
+	for name := range whole {
+		delete(subPaths, name)
+	}
+	return subPaths
+}
+
+// isMountedOnly returns true if the given podController has the
+// mounted-only annotation set to true
+func isMountedOnly(obj podController) bool {
+	return obj.GetAnnotations()[MountedOnlyAnnotation] == requiredAnnotationValue
+}
+
+func isRequired(b *bool) bool {
+	return b == nil || !*b
+}
+
+// parseVolumeSource updates the metadata for a ConfigMap or Secret referenced
+// by a Volume. A Volume projecting all keys of the child tracks all of them,
+// while a Volume projecting only the given items tracks only their keys.
+func parseVolumeSource(metadata configMetadata, items []corev1.KeyToPath, optional *bool) configMetadata {
+	if len(items) == 0 {
+		return configMetadata{required: metadata.required || isRequired(optional), allKeys: true}
+	}
+	for _, item := range items {
+		metadata = parseKeyRef(metadata, item.Key, optional)
 	}
 	return metadata
 }
 
+// parseEnvFromSource updates the metadata for a ConfigMap or Secret referenced
+// by an EnvFromSource. Any prefix is recorded against the name of the
+// container using it, so that each container's prefix contributes to the hash
+// even when several containers share the same ConfigMap or Secret.
+func parseEnvFromSource(metadata configMetadata, optional *bool, container, prefix string) configMetadata {
+	prefixes := metadata.prefixes
+	if prefix != "" {
+		if prefixes == nil {
+			prefixes = make(map[string]struct{})
+		}
+		prefixes[container+"="+prefix] = struct{}{}
+	}
+	return configMetadata{required: metadata.required || isRequired(optional), allKeys: true, prefixes: prefixes}
+}
+
+// parseConfigMapKeyRef updates the metadata for a ConfigMap to include the keys specified in this ConfigMapKeySelector
+func parseConfigMapKeyRef(metadata configMetadata, cm *corev1.ConfigMapKeySelector) configMetadata {
+	return parseKeyRef(metadata, cm.Key, cm.Optional)
+}
+
 // parseSecretKeyRef updates the metadata for a Secret to include the keys specified in this SecretKeySelector
 func parseSecretKeyRef(metadata configMetadata, s *corev1.SecretKeySelector) configMetadata {
+	return parseKeyRef(metadata, s.Key, s.Optional)
+}
+
+// parseKeyRef updates the metadata for a ConfigMap or Secret referenced by a
+// single key. The child becomes required if the reference is not optional,
+// even when all of its keys are already tracked by another reference.
+func parseKeyRef(metadata configMetadata, key string, optional *bool) configMetadata {
+	if isRequired(optional) {
+		metadata.required = true
+	}
 	if !metadata.allKeys {
 		if metadata.keys == nil {
 			metadata.keys = make(map[string]struct{})
 		}
-		if s.Optional == nil || !*s.Optional {
-			metadata.required = true
-		}
-		metadata.keys[s.Key] = struct{}{}
+		metadata.keys[key] = struct{}{}
 	}
 	return metadata
 }
@@ -187,34 +437,66 @@ func (h *Handler) getSecret(namespace, name string, metadata configMetadata) get
 }
 
 // getObject gets the Object with the given name and namespace from the API
-// server
+// server.
+// A missing Object that is only referenced optionally is skipped, as it is by
+// Kubernetes, while any other error is returned.
+// Objects are only ever looked up in the namespace of the workload, or the
+// shared config namespace, and an Object resolving to any other namespace is
+// rejected.
 func (h *Handler) getObject(namespace, name string, metadata configMetadata, obj Object) getResult {
 	objectName := types.NamespacedName{Namespace: namespace, Name: name}
 	err := h.Get(context.TODO(), objectName, obj)
 	if err != nil {
-		if metadata.required {
+		if metadata.required && errors.IsNotFound(err) {
+			return getResult{err: err, missing: kindOf(obj) + "/" + name}
+		}
+		if metadata.required || !errors.IsNotFound(err) {
 			return getResult{err: err}
 		}
 		return getResult{metadata: metadata}
 	}
+	if obj.GetNamespace() != namespace {
+		return getResult{err: fmt.Errorf("%s %s resolved to namespace %s outside namespace %s", kindOf(obj), name, obj.GetNamespace(), namespace)}
+	}
 	return getResult{obj: obj, metadata: metadata}
 }
 
 // getExistingChildren returns a list of all Secrets and ConfigMaps that are
-// owned by the Deployment instance
+// owned by the Deployment instance.
+// Only children carrying the owned-by label of the instance are listed once
+// its OwnerReferences have been updated since the Handler started. Until then
+// every child is listed, so that children owned before Wave labelled them are
+// found too, and are labelled or released as the instance's references
+// require.
 func (h *Handler) getExistingChildren(obj podController) ([]Object, error) {
-	inNamespace := client.InNamespace(obj.GetNamespace())
+	if !h.isOwnedByLabelled(obj) {
+		return h.getAllExistingChildren(obj)
+	}
+	return h.listOwnedChildren(obj, client.MatchingLabels{ownedByLabel(obj): ownedByLabelValue})
+}
+
+// getAllExistingChildren returns a list of all Secrets and ConfigMaps that
+// are owned by the Deployment instance, whether or not they carry its
+// owned-by label
+func (h *Handler) getAllExistingChildren(obj podController) ([]Object, error) {
+	return h.listOwnedChildren(obj)
+}
+
+// listOwnedChildren lists the children in the namespace of the instance
+// matching the given options and returns those owned by the instance
+func (h *Handler) listOwnedChildren(obj podController, opts ...client.ListOption) ([]Object, error) {
+	opts = append([]client.ListOption{client.InNamespace(obj.GetNamespace())}, opts...)
 
 	// List all ConfigMaps in the Deployment's namespace
 	configMaps := &corev1.ConfigMapList{}
-	err := h.List(context.TODO(), configMaps, inNamespace)
+	err := h.List(context.TODO(), configMaps, opts...)
 	if err != nil {
 		return []Object{}, fmt.Errorf("error listing ConfigMaps: %v", err)
 	}
 
 	// List all Secrets in the Deployment's namespcae
 	secrets := &corev1.SecretList{}
-	err = h.List(context.TODO(), secrets, inNamespace)
+	err = h.List(context.TODO(), secrets, opts...)
 	if err != nil {
 		return []Object{}, fmt.Errorf("error listing Secrets: %v", err)
 	}
@@ -233,16 +515,41 @@ func (h *Handler) getExistingChildren(obj podController) ([]Object, error) {
 		}
 	}
 
+	// List the children of each extra child kind in the namespace too
+	for _, gvk := range getExtraChildGVKs(h.opts) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err = h.List(context.TODO(), list, opts...)
+		if err != nil {
+			return []Object{}, fmt.Errorf("error listing %s: %v", gvk.Kind, err)
+		}
+		for i := range list.Items {
+			if isOwnedBy(&list.Items[i], obj) {
+				children = append(children, list.Items[i].DeepCopy())
+			}
+		}
+	}
+
 	return children, nil
 }
 
 // isOwnedBy returns true if the child has an owner reference that points to
-// the owner object
+// the owner object.
+// An owner without a UID, or a reference from the child to itself, never
+// counts, so that a malformed reference cannot make the child its own owner.
 func isOwnedBy(child, owner metav1.Object) bool {
+	if owner.GetUID() == "" || owner.GetUID() == child.GetUID() {
+		return false
+	}
 	for _, ref := range child.GetOwnerReferences() {
-		if ref.UID == owner.GetUID() {
+		if refersTo(ref, owner) {
 			return true
 		}
 	}
 	return false
 }
+
+// refersTo returns true if the owner reference points to the owner object
+func refersTo(ref metav1.OwnerReference, owner metav1.Object) bool {
+	return ref.UID == owner.GetUID()
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChildrenFor returns the ConfigMaps and Secrets in the namespace that are
+// referenced by the PodTemplateSpec, sorted by kind and name, as the Handler
+// finds the children of a workload with the default Options. It needs no
+// manager, so that other controllers can reuse Wave's child discovery.
+//
+// The annotations of the PodTemplateSpec are read in place of those of a
+// workload, so annotations such as wave.pusher.com/exclude-children can be
+// set on it. Every request is made with the given context.
+// An error is returned if any referenced child that is not optional does
+// not exist.
+func ChildrenFor(ctx context.Context, c client.Client, template *corev1.PodTemplateSpec, namespace string) ([]metav1.Object, error) {
+	h := NewHandler(&contextClient{Client: c, ctx: ctx}, nil, Options{})
+	instance := &podtemplate{&corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Annotations: template.GetAnnotations(),
+		},
+		Template: *template.DeepCopy(),
+	}}
+
+	children, err := h.getCurrentChildren(instance)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]metav1.Object, 0, len(children))
+	for _, child := range sortChildren(children) {
+		objects = append(objects, child.object)
+	}
+	return objects, nil
+}
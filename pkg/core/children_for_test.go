@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave ChildrenFor Suite", func() {
+	var c client.Client
+	var template *corev1.PodTemplateSpec
+	var optional = true
+
+	// names returns the kind and name of each of the objects
+	var names = func(objects []metav1.Object) []string {
+		out := []string{}
+		for _, obj := range objects {
+			out = append(out, kindOf(obj.(Object))+"/"+obj.GetName())
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		c = fake.NewFakeClientWithScheme(scheme.Scheme,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(),
+		)
+
+		template = &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "app",
+					Image: "app",
+					EnvFrom: []corev1.EnvFromSource{{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleSecret1.GetName()},
+						},
+					}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name: "config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap1.GetName()},
+						},
+					},
+				}},
+			},
+		}
+	})
+
+	It("returns the children referenced by the PodTemplateSpec", func() {
+		children, err := ChildrenFor(context.TODO(), c, template, utils.ExampleDeployment.GetNamespace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(children)).To(Equal([]string{
+			"ConfigMap/" + utils.ExampleConfigMap1.GetName(),
+			"Secret/" + utils.ExampleSecret1.GetName(),
+		}))
+	})
+
+	It("does not modify the PodTemplateSpec", func() {
+		original := template.DeepCopy()
+		_, err := ChildrenFor(context.TODO(), c, template, utils.ExampleDeployment.GetNamespace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(template).To(Equal(original))
+	})
+
+	It("only looks children up in the given namespace", func() {
+		children, err := ChildrenFor(context.TODO(), c, template, "other")
+		Expect(err).To(HaveOccurred())
+		Expect(children).To(BeEmpty())
+	})
+
+	It("skips optional children that do not exist", func() {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: "missing",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+					Optional:             &optional,
+				},
+			},
+		})
+		children, err := ChildrenFor(context.TODO(), c, template, utils.ExampleDeployment.GetNamespace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(2))
+	})
+
+	It("returns an error when a required child does not exist", func() {
+		template.Spec.Volumes[0].ConfigMap.Name = "missing"
+		_, err := ChildrenFor(context.TODO(), c, template, utils.ExampleDeployment.GetNamespace())
+		Expect(isMissingChildError(err)).To(BeTrue())
+	})
+
+	It("reads the annotations of the PodTemplateSpec", func() {
+		template.SetAnnotations(map[string]string{
+			ExcludeChildrenAnnotation: "secret/" + utils.ExampleSecret1.GetName(),
+		})
+		children, err := ChildrenFor(context.TODO(), c, template, utils.ExampleDeployment.GetNamespace())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(children)).To(Equal([]string{"ConfigMap/" + utils.ExampleConfigMap1.GetName()}))
+	})
+})
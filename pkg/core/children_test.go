@@ -17,6 +17,8 @@ limitations under the License.
 package core
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -24,10 +26,15 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -63,7 +70,7 @@ var _ = Describe("Wave children Suite", func() {
 		Expect(cerr).NotTo(HaveOccurred())
 		c = mgr.GetClient()
 		//		h = NewHandler(c, mgr.GetEventRecorderFor("wave"))
-		h = NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"))
+		h = NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), Options{})
 
 		m = utils.Matcher{Client: c}
 
@@ -296,10 +303,132 @@ var _ = Describe("Wave children Suite", func() {
 			}))
 		})
 
+		It("tracks a ConfigMap and a Secret sharing a name in EnvFrom independently", func() {
+			// container2 references both ConfigMap example2 and Secret example2 via EnvFrom
+			Expect(configMaps).To(HaveKeyWithValue(cm2.GetName(), configMetadata{required: true, allKeys: true}))
+			Expect(secrets).To(HaveKeyWithValue(s2.GetName(), configMetadata{required: true, allKeys: true}))
+		})
+
 		It("does not return extra children", func() {
 			Expect(configMaps).To(HaveLen(7))
 			Expect(secrets).To(HaveLen(7))
 		})
+
+		Context("with a Volume whose name differs from its ConfigMap's name", func() {
+			var d *appsv1.Deployment
+
+			BeforeEach(func() {
+				d = deploymentObject.DeepCopy()
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: cm1.GetName(),
+								},
+							},
+						},
+					},
+					{
+						Name: "unmounted",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "unmounted-configmap",
+								},
+							},
+						},
+					},
+				}
+				d.Spec.Template.Spec.Containers = []corev1.Container{
+					{
+						Name:  "container",
+						Image: "container",
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "config",
+								MountPath: "/etc/config",
+							},
+						},
+					},
+				}
+				configMaps, secrets = getChildNamesByType(&deployment{d})
+			})
+
+			It("returns the ConfigMap by the name in the VolumeSource", func() {
+				Expect(configMaps).To(HaveKeyWithValue(cm1.GetName(), configMetadata{required: true, allKeys: true}))
+				Expect(configMaps).NotTo(HaveKey("config"))
+				Expect(configMaps).To(HaveKey("unmounted-configmap"))
+			})
+
+			Context("and the mounted-only annotation", func() {
+				BeforeEach(func() {
+					d.SetAnnotations(map[string]string{MountedOnlyAnnotation: requiredAnnotationValue})
+					configMaps, secrets = getChildNamesByType(&deployment{d})
+				})
+
+				It("only returns ConfigMaps whose Volume is mounted", func() {
+					Expect(configMaps).To(HaveKeyWithValue(cm1.GetName(), configMetadata{required: true, allKeys: true}))
+					Expect(configMaps).NotTo(HaveKey("unmounted-configmap"))
+					Expect(configMaps).To(HaveLen(1))
+					Expect(secrets).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("with an init container sharing an EnvFrom source with a prefix", func() {
+			BeforeEach(func() {
+				d := deploymentObject.DeepCopy()
+				d.Spec.Template.Spec.InitContainers = []corev1.Container{
+					{
+						Name:  "init",
+						Image: "init",
+						EnvFrom: []corev1.EnvFromSource{
+							{
+								Prefix: "INIT_",
+								ConfigMapRef: &corev1.ConfigMapEnvSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: cm2.GetName(),
+									},
+								},
+							},
+							{
+								Prefix: "INIT_",
+								SecretRef: &corev1.SecretEnvSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: s2.GetName(),
+									},
+								},
+							},
+						},
+					},
+				}
+				configMaps, secrets = getChildNamesByType(&deployment{d})
+			})
+
+			It("records the prefix against the init container", func() {
+				Expect(configMaps).To(HaveKeyWithValue(cm2.GetName(), configMetadata{
+					required: true,
+					allKeys:  true,
+					prefixes: map[string]struct{}{
+						"init=INIT_": {},
+					},
+				}))
+				Expect(secrets).To(HaveKeyWithValue(s2.GetName(), configMetadata{
+					required: true,
+					allKeys:  true,
+					prefixes: map[string]struct{}{
+						"init=INIT_": {},
+					},
+				}))
+			})
+
+			It("does not return extra children", func() {
+				Expect(configMaps).To(HaveLen(7))
+				Expect(secrets).To(HaveLen(7))
+			})
+		})
 	})
 
 	Context("getExistingChildren", func() {
@@ -310,6 +439,7 @@ var _ = Describe("Wave children Suite", func() {
 			for _, obj := range []Object{cm1, s1} {
 				m.Update(obj, func(obj utils.Object) utils.Object {
 					obj.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+					setOwnedByLabel(obj, deploymentObject)
 					return obj
 				}, timeout).Should(Succeed())
 				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
@@ -372,3 +502,1455 @@ var _ = Describe("Wave children Suite", func() {
 	})
 
 })
+
+var _ = Describe("Wave mounted-only Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var mounted *corev1.ConfigMap
+	var unmounted *corev1.ConfigMap
+
+	// getHash calculates the config hash of the Deployment
+	var getHash = func() string {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(current)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		mounted = utils.ExampleConfigMap1.DeepCopy()
+		unmounted = utils.ExampleConfigMap2.DeepCopy()
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:    requiredAnnotationValue,
+			MountedOnlyAnnotation: requiredAnnotationValue,
+		})
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "mounted",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: mounted.GetName(),
+						},
+					},
+				},
+			},
+			{
+				Name: "unmounted",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: unmounted.GetName(),
+						},
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.InitContainers = []corev1.Container{
+			{
+				Name:  "init",
+				Image: "init",
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      "mounted",
+						MountPath: "/etc/config",
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "container",
+				Image: "container",
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, mounted, unmounted)
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	It("tracks a Volume mounted by any container", func() {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(HaveLen(1))
+		Expect(current[0].object.GetName()).To(Equal(mounted.GetName()))
+	})
+
+	It("does not change the hash when an unmounted Volume's ConfigMap changes", func() {
+		original := getHash()
+
+		unmounted.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), unmounted)).To(Succeed())
+
+		Expect(getHash()).To(Equal(original))
+	})
+
+	It("does not add an OwnerReference to an unmounted Volume's ConfigMap", func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: unmounted.GetNamespace(), Name: unmounted.GetName()}, unmounted)).To(Succeed())
+		Expect(unmounted.GetOwnerReferences()).To(BeEmpty())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: mounted.GetNamespace(), Name: mounted.GetName()}, mounted)).To(Succeed())
+		Expect(mounted.GetOwnerReferences()).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Wave lifecycle hook Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var hooks *corev1.ConfigMap
+
+	BeforeEach(func() {
+		hooks = utils.ExampleConfigMap1.DeepCopy()
+
+		// The ConfigMap is only consumed by the lifecycle hooks, which exec
+		// scripts from the Volume it is mounted at
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "hooks",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: hooks.GetName(),
+						},
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "container",
+				Image: "container",
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      "hooks",
+						MountPath: "/hooks",
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PostStart: &corev1.Handler{
+						Exec: &corev1.ExecAction{Command: []string{"/hooks/key1"}},
+					},
+					PreStop: &corev1.Handler{
+						Exec: &corev1.ExecAction{Command: []string{"/hooks/key2"}},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, hooks)
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	It("updates the config hash when a ConfigMap used only by lifecycle hooks changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		hooks.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), hooks)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("updates the config hash in mounted-only mode", func() {
+		annotations := d.GetAnnotations()
+		annotations[MountedOnlyAnnotation] = requiredAnnotationValue
+		d.SetAnnotations(annotations)
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		hooks.Data["key2"] = "modified"
+		Expect(c.Update(context.TODO(), hooks)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+})
+
+var _ = Describe("Wave StatefulSet children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var statefulSetObject *appsv1.StatefulSet
+	var podControllerStatefulSet podController
+	var existingChildren []Object
+	var currentChildren []configObject
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var cm3 *corev1.ConfigMap
+	var cm4 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+	var s3 *corev1.Secret
+	var s4 *corev1.Secret
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		h = NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), Options{})
+
+		m = utils.Matcher{Client: c}
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		cm3 = utils.ExampleConfigMap3.DeepCopy()
+		cm4 = utils.ExampleConfigMap4.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+		s3 = utils.ExampleSecret3.DeepCopy()
+		s4 = utils.ExampleSecret4.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(cm3).Should(Succeed())
+		m.Create(cm4).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Create(s3).Should(Succeed())
+		m.Create(s4).Should(Succeed())
+
+		statefulSetObject = utils.ExampleStatefulSet.DeepCopy()
+		podControllerStatefulSet = &statefulset{statefulSetObject}
+
+		m.Create(statefulSetObject).Should(Succeed())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Ensure the caches have synced
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(cm3, timeout).Should(Succeed())
+		m.Get(cm4, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+		m.Get(s3, timeout).Should(Succeed())
+		m.Get(s4, timeout).Should(Succeed())
+		m.Get(statefulSetObject, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.StatefulSetList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+		)
+	})
+
+	Context("getCurrentChildren", func() {
+		BeforeEach(func() {
+			var err error
+			currentChildren, err = h.getCurrentChildren(podControllerStatefulSet)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns ConfigMaps referenced in Volumes", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   cm1,
+				required: true,
+				allKeys:  true,
+			}))
+		})
+
+		It("returns ConfigMaps referenced in EnvFrom", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   cm2,
+				required: true,
+				allKeys:  true,
+			}))
+		})
+
+		It("returns ConfigMaps referenced in Env", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   cm3,
+				required: true,
+				allKeys:  false,
+				keys: map[string]struct{}{
+					"key1": {},
+					"key2": {},
+					"key4": {},
+				},
+			}))
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   cm4,
+				required: false,
+				allKeys:  false,
+				keys: map[string]struct{}{
+					"key1": {},
+				},
+			}))
+		})
+
+		It("returns Secrets referenced in Volumes", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   s1,
+				required: true,
+				allKeys:  true,
+			}))
+		})
+
+		It("returns Secrets referenced in EnvFrom", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   s2,
+				required: true,
+				allKeys:  true,
+			}))
+		})
+
+		It("returns Secrets referenced in Env", func() {
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   s3,
+				required: true,
+				allKeys:  false,
+				keys: map[string]struct{}{
+					"key1": {},
+					"key2": {},
+					"key4": {},
+				},
+			}))
+			Expect(currentChildren).To(ContainElement(configObject{
+				object:   s4,
+				required: false,
+				allKeys:  false,
+				keys: map[string]struct{}{
+					"key1": {},
+				},
+			}))
+		})
+
+		It("does not return duplicate children", func() {
+			Expect(currentChildren).To(HaveLen(8))
+		})
+	})
+
+	Context("getExistingChildren", func() {
+		BeforeEach(func() {
+			m.Get(statefulSetObject, timeout).Should(Succeed())
+			ownerRef := utils.GetOwnerRefStatefulSet(statefulSetObject)
+
+			for _, obj := range []Object{cm1, s1} {
+				m.Update(obj, func(obj utils.Object) utils.Object {
+					obj.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+					setOwnedByLabel(obj, statefulSetObject)
+					return obj
+				}, timeout).Should(Succeed())
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+
+			var err error
+			existingChildren, err = h.getExistingChildren(podControllerStatefulSet)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns ConfigMaps with the correct OwnerReference", func() {
+			Expect(existingChildren).To(ContainElement(cm1))
+		})
+
+		It("doesn't return ConfigMaps without OwnerReferences", func() {
+			Expect(existingChildren).NotTo(ContainElement(cm2))
+			Expect(existingChildren).NotTo(ContainElement(cm3))
+			Expect(existingChildren).NotTo(ContainElement(cm4))
+		})
+
+		It("returns Secrets with the correct OwnerReference", func() {
+			Expect(existingChildren).To(ContainElement(s1))
+		})
+
+		It("doesn't return Secrets without OwnerReferences", func() {
+			Expect(existingChildren).NotTo(ContainElement(s2))
+			Expect(existingChildren).NotTo(ContainElement(s3))
+			Expect(existingChildren).NotTo(ContainElement(s4))
+		})
+
+		It("does not return duplicate children", func() {
+			Expect(existingChildren).To(HaveLen(2))
+		})
+	})
+
+	Context("isOwnedBy", func() {
+		var ownerRef metav1.OwnerReference
+		BeforeEach(func() {
+			m.Get(statefulSetObject, timeout).Should(Succeed())
+			ownerRef = utils.GetOwnerRefStatefulSet(statefulSetObject)
+		})
+
+		It("returns true when the child has a single owner reference pointing to the owner", func() {
+			cm1.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+			Expect(isOwnedBy(cm1, statefulSetObject)).To(BeTrue())
+		})
+
+		It("returns false when the child has no owner reference pointing to the owner", func() {
+			ownerRef.UID = cm1.GetUID()
+			cm1.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+			Expect(isOwnedBy(cm1, statefulSetObject)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Wave DaemonSet children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.DaemonSet
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetUID("example-configmap1")
+		s = utils.ExampleSecret2.DeepCopy()
+		s.SetUID("example-secret2")
+
+		d = utils.ExampleDaemonSet.DeepCopy()
+		d.SetUID("example-daemonset")
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "fluentd-config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: cm.GetName(),
+						},
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "fluentd",
+				Image: "fluentd",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: s.GetName(),
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("returns the ConfigMap in the Volume and the Secret in EnvFrom", func() {
+		children, err := h.getCurrentChildren(&daemonset{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(2))
+		Expect(children).To(ContainElement(configObject{object: cm, required: true, allKeys: true}))
+		Expect(children).To(ContainElement(configObject{object: s, required: true, allKeys: true}))
+	})
+
+	It("builds OwnerReferences of Kind DaemonSet", func() {
+		ownerRef := getOwnerReference(&daemonset{d})
+		Expect(ownerRef.Kind).To(Equal("DaemonSet"))
+		Expect(ownerRef.APIVersion).To(Equal("apps/v1"))
+		Expect(ownerRef.UID).To(Equal(d.GetUID()))
+	})
+
+	Context("when the DaemonSet is reconciled", func() {
+		BeforeEach(func() {
+			_, err := h.HandleDaemonSet(d)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("sets the config hash on the PodTemplate", func() {
+			updated := &appsv1.DaemonSet{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("adds DaemonSet OwnerReferences that are detected as existing children", func() {
+			updated := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, updated)).To(Succeed())
+			Expect(updated.GetOwnerReferences()).To(ContainElement(getOwnerReference(&daemonset{d})))
+
+			existing, err := h.getExistingChildren(&daemonset{d})
+			Expect(err).NotTo(HaveOccurred())
+			names := []string{}
+			for _, child := range existing {
+				names = append(names, kindOf(child)+"/"+child.GetName())
+			}
+			Expect(names).To(ConsistOf("ConfigMap/"+cm.GetName(), "Secret/"+s.GetName()))
+		})
+	})
+})
+
+var _ = Describe("Wave CronJob children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var cj *batchv1beta1.CronJob
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetUID("example-configmap1")
+		s = utils.ExampleSecret2.DeepCopy()
+		s.SetUID("example-secret2")
+
+		cj = utils.ExampleCronJob.DeepCopy()
+		cj.SetUID("example-cronjob")
+		cj.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		template := &cj.Spec.JobTemplate.Spec.Template
+		template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "report-config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: cm.GetName(),
+						},
+					},
+				},
+			},
+		}
+		template.Spec.InitContainers = nil
+		template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "report",
+				Image: "report",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: s.GetName(),
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, cj, cm, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("returns the children referenced by the jobTemplate", func() {
+		children, err := h.getCurrentChildren(&cronjob{cj})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(2))
+		Expect(children).To(ContainElement(configObject{object: cm, required: true, allKeys: true}))
+		Expect(children).To(ContainElement(configObject{object: s, required: true, allKeys: true}))
+	})
+
+	It("builds OwnerReferences of Kind CronJob", func() {
+		ownerRef := getOwnerReference(&cronjob{cj})
+		Expect(ownerRef.Kind).To(Equal("CronJob"))
+		Expect(ownerRef.APIVersion).To(Equal("batch/v1beta1"))
+		Expect(ownerRef.UID).To(Equal(cj.GetUID()))
+	})
+
+	Context("when the CronJob is reconciled", func() {
+		BeforeEach(func() {
+			_, err := h.HandleCronJob(cj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("sets the config hash on the jobTemplate's PodTemplate", func() {
+			updated := &batchv1beta1.CronJob{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cj.GetNamespace(), Name: cj.GetName()}, updated)).To(Succeed())
+			Expect(updated.Spec.JobTemplate.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("adds CronJob OwnerReferences to the children", func() {
+			updated := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, updated)).To(Succeed())
+			Expect(updated.GetOwnerReferences()).To(ContainElement(getOwnerReference(&cronjob{cj})))
+		})
+	})
+})
+
+// getErroringClient returns the configured error from Get calls for the
+// objects with the given names
+type getErroringClient struct {
+	client.Client
+	errs map[string]error
+}
+
+func (c *getErroringClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if err, ok := c.errs[key.Name]; ok {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+var _ = Describe("Wave optional children Suite", func() {
+	var c *getErroringClient
+	var h *Handler
+	var d *appsv1.Deployment
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = &getErroringClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		), errs: map[string]error{}}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("skips optional children that are missing", func() {
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, child := range children {
+			names = append(names, child.object.GetName())
+		}
+		Expect(names).NotTo(ContainElement("volume-optional"))
+		Expect(names).NotTo(ContainElement("envfrom-optional"))
+		Expect(names).NotTo(ContainElement("env-optional"))
+	})
+
+	It("computes the hash from the children that are present", func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		Expect(updated.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hash))
+	})
+
+	It("returns an error when a required child is missing", func() {
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(isMissingChildError(err)).To(BeTrue())
+	})
+
+	It("returns an error when an optional child cannot be fetched", func() {
+		c.errs["volume-optional"] = errors.NewInternalError(fmt.Errorf("etcd unavailable"))
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(isMissingChildError(err)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Wave Env children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var s *corev1.Secret
+	var trueValue = true
+
+	BeforeEach(func() {
+		s = utils.ExampleSecret3.DeepCopy()
+		s.Data = map[string][]byte{
+			"password": []byte("hunter2"),
+			"username": []byte("wave"),
+		}
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = nil
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+				Env: []corev1.EnvVar{
+					{
+						Name: "PASSWORD",
+						ValueFrom: &corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: s.GetName(),
+								},
+								Key: "password",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("returns a Secret referenced only by a secretKeyRef", func() {
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(1))
+		Expect(children[0].object.GetName()).To(Equal(s.GetName()))
+		Expect(children[0].keys).To(Equal(map[string]struct{}{"password": {}}))
+	})
+
+	It("updates the hash when the referenced key changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		s.Data["password"] = []byte("modified")
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("does not update the hash when another key changes", func() {
+		original := reconcileHash(c, h, d)
+
+		s.Data["username"] = []byte("modified")
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).To(Equal(original))
+	})
+
+	It("requires a child referenced optionally elsewhere when a secretKeyRef is not optional", func() {
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "credentials",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: s.GetName(),
+						Optional:   &trueValue,
+					},
+				},
+			},
+		}
+
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(BeEmpty())
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, allKeys: true}))
+	})
+})
+
+var _ = Describe("Wave init container children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap2.DeepCopy()
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+			},
+		}
+		d.Spec.Template.Spec.InitContainers = []corev1.Container{
+			{
+				Name:  "migrate",
+				Image: "migrate",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: cm.GetName(),
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("returns a ConfigMap referenced only by an init container", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(BeEmpty())
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(1))
+		Expect(children[0].object.GetName()).To(Equal(cm.GetName()))
+	})
+
+	It("updates the hash when the ConfigMap changes", func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		original := d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		Expect(original).NotTo(BeEmpty())
+
+		cm.Data = map[string]string{"key1": "modified"}
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		_, err = h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(Equal(original))
+	})
+})
+
+var _ = Describe("Wave imagePullSecrets children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var s *corev1.Secret
+
+	BeforeEach(func() {
+		s = utils.ExampleSecret1.DeepCopy()
+		s.SetUID("example-secret1")
+		s.Type = corev1.SecretTypeDockerConfigJson
+		s.Data = map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.example.com":{"auth":"d2F2ZTpodW50ZXIy"}}}`),
+		}
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID("example-deployment")
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = nil
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "registry.example.com/app",
+			},
+		}
+		d.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
+			{Name: s.GetName()},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{SecretTypeAllowlist: DefaultSecretTypeAllowlist})
+	})
+
+	It("returns Secrets referenced in ImagePullSecrets as optional", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(BeEmpty())
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: false, allKeys: true}))
+	})
+
+	It("requires a Secret that is also referenced by EnvFrom", func() {
+		d.Spec.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: s.GetName(),
+					},
+				},
+			},
+		}
+
+		_, secrets := getChildNamesByType(&deployment{d})
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, allKeys: true}))
+	})
+
+	It("updates the hash when an ImagePullSecret changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		s.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{"registry.example.com":{"auth":"d2F2ZTpyb3RhdGVk"}}}`)
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("adds an OwnerReference to the ImagePullSecret", func() {
+		reconcileHash(c, h, d)
+
+		existing, err := h.getExistingChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).To(HaveLen(1))
+		Expect(existing[0].GetName()).To(Equal(s.GetName()))
+	})
+
+	It("does not return an error when the ImagePullSecret is missing", func() {
+		Expect(c.Delete(context.TODO(), s)).To(Succeed())
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Wave projected volume children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+	var trueValue = true
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret2.DeepCopy()
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+			},
+		}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{
+							{
+								ConfigMap: &corev1.ConfigMapProjection{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: cm.GetName(),
+									},
+								},
+							},
+							{
+								Secret: &corev1.SecretProjection{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: s.GetName(),
+									},
+								},
+							},
+							{
+								Secret: &corev1.SecretProjection{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: "projected-optional",
+									},
+									Optional: &trueValue,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("returns the ConfigMaps and Secrets in projected volumes", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKeyWithValue("projected-optional", configMetadata{required: false, allKeys: true}))
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(2))
+		Expect(children).To(ContainElement(configObject{object: cm, required: true, allKeys: true}))
+		Expect(children).To(ContainElement(configObject{object: s, required: true, allKeys: true}))
+	})
+
+	It("returns an error when a required projected source is missing", func() {
+		Expect(c.Delete(context.TODO(), s)).To(Succeed())
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Wave volume items Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	const modified = "modified"
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret1.DeepCopy()
+		s.StringData = nil
+		s.Data = map[string][]byte{"key1": []byte("example1:key1"), "key2": []byte("example1:key2")}
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()},
+						Items:                []corev1.KeyToPath{{Key: "key1", Path: "key1.conf"}},
+					},
+				},
+			},
+			{
+				Name: "credentials",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: s.GetName(),
+						Items:      []corev1.KeyToPath{{Key: "key1", Path: "key1.conf"}},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("tracks only the keys of the selected items", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key1": {}}}))
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key1": {}}}))
+	})
+
+	It("tracks all keys if another Volume projects the whole child", func() {
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "all-config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()},
+				},
+			},
+		})
+		configMaps, _ := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+	})
+
+	It("updates the hash when a selected key changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		cm.Data["key1"] = modified
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+
+		updated := reconcileHash(c, h, d)
+		s.Data["key1"] = []byte(modified)
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(updated))
+	})
+
+	It("does not update the hash when a key that is not selected changes", func() {
+		original := reconcileHash(c, h, d)
+
+		cm.Data["key2"] = modified
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		s.Data["key2"] = []byte(modified)
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).To(Equal(original))
+	})
+})
+
+var _ = Describe("Wave volume subPath Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	const modified = "modified"
+
+	// setMounts sets the VolumeMounts of the app container
+	var setMounts = func(mounts ...corev1.VolumeMount) {
+		d.Spec.Template.Spec.Containers[0].VolumeMounts = mounts
+	}
+
+	key1Only := configMetadata{required: true, keys: map[string]struct{}{"key1": {}}}
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret1.DeepCopy()
+		s.StringData = nil
+		s.Data = map[string][]byte{"key1": []byte("example1:key1"), "key2": []byte("example1:key2")}
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()},
+					},
+				},
+			},
+			{
+				Name: "credentials",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: s.GetName(),
+						Items: []corev1.KeyToPath{
+							{Key: "key1", Path: "conf/key1.conf"},
+							{Key: "key2", Path: "key2.conf"},
+						},
+					},
+				},
+			},
+		}
+		setMounts(
+			corev1.VolumeMount{Name: "config", MountPath: "/etc/app/key1", SubPath: "key1"},
+			corev1.VolumeMount{Name: "credentials", MountPath: "/etc/app/key1.conf", SubPath: "conf/key1.conf"},
+		)
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm, s)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("tracks only the keys selected by the subPath", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), key1Only))
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), key1Only))
+	})
+
+	It("tracks the items within a directory selected by the subPath", func() {
+		setMounts(
+			corev1.VolumeMount{Name: "config", MountPath: "/etc/app/key1", SubPath: "key1"},
+			corev1.VolumeMount{Name: "credentials", MountPath: "/etc/app/conf", SubPath: "conf/"},
+		)
+		_, secrets := getChildNamesByType(&deployment{d})
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), key1Only))
+	})
+
+	It("tracks the keys selected by every subPath of a Volume", func() {
+		setMounts(
+			corev1.VolumeMount{Name: "config", MountPath: "/etc/app/key1", SubPath: "key1"},
+			corev1.VolumeMount{Name: "config", MountPath: "/etc/app/key2", SubPath: "key2"},
+		)
+		configMaps, _ := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key1": {}, "key2": {}}}))
+	})
+
+	It("tracks all keys if another container mounts the whole Volume", func() {
+		d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{
+			Name:         "sidecar",
+			Image:        "sidecar",
+			VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/sidecar"}},
+		})
+		configMaps, _ := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+	})
+
+	It("tracks all keys of a Volume mounted through a subPathExpr", func() {
+		setMounts(corev1.VolumeMount{Name: "config", MountPath: "/etc/app", SubPathExpr: "$(POD_NAME)"})
+		configMaps, _ := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+	})
+
+	It("tracks all keys if the subPath does not name a key", func() {
+		setMounts(
+			corev1.VolumeMount{Name: "config", MountPath: "/etc/app/key1", SubPath: "..data/key1"},
+			corev1.VolumeMount{Name: "credentials", MountPath: "/etc/app/other", SubPath: "other.conf"},
+		)
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key1": {}, "key2": {}}}))
+	})
+
+	It("tracks only the keys selected by the subPath of a projected Volume", func() {
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{{
+			Name: "projected",
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()}}},
+						{Secret: &corev1.SecretProjection{
+							LocalObjectReference: corev1.LocalObjectReference{Name: s.GetName()},
+							Items:                []corev1.KeyToPath{{Key: "key2", Path: "secret/key2"}},
+						}},
+					},
+				},
+			},
+		}}
+		setMounts(
+			corev1.VolumeMount{Name: "projected", MountPath: "/etc/app/key1", SubPath: "key1"},
+			corev1.VolumeMount{Name: "projected", MountPath: "/etc/app/secret", SubPath: "secret"},
+		)
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).To(HaveKeyWithValue(cm.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key1": {}, "secret": {}}}))
+		Expect(secrets).To(HaveKeyWithValue(s.GetName(), configMetadata{required: true, keys: map[string]struct{}{"key2": {}}}))
+	})
+
+	It("updates the hash when a key selected by the subPath changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		cm.Data["key1"] = modified
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+
+		updated := reconcileHash(c, h, d)
+		s.Data["key1"] = []byte(modified)
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(updated))
+	})
+
+	It("does not update the hash when a key not selected by the subPath changes", func() {
+		original := reconcileHash(c, h, d)
+
+		cm.Data["key2"] = modified
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		s.Data["key2"] = []byte(modified)
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).To(Equal(original))
+	})
+})
+
+// otherNamespaceClient returns every ConfigMap from another namespace, as a
+// misbehaving cache might
+type otherNamespaceClient struct {
+	client.Client
+}
+
+func (c *otherNamespaceClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	err := c.Client.Get(ctx, key, obj)
+	if cm, ok := obj.(*corev1.ConfigMap); ok && err == nil {
+		cm.SetNamespace("other")
+	}
+	return err
+}
+
+var _ = Describe("Wave cross-namespace children Suite", func() {
+	var d *appsv1.Deployment
+	var elsewhere *corev1.ConfigMap
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap1.GetName()},
+					},
+				},
+			},
+		}
+
+		elsewhere = utils.ExampleConfigMap1.DeepCopy()
+		elsewhere.SetNamespace("other")
+		elsewhere.Data = map[string]string{"key1": "elsewhere"}
+	})
+
+	It("never picks up a ConfigMap of the same name in another namespace", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, elsewhere)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(isMissingChildError(err)).To(BeTrue())
+	})
+
+	It("only hashes the ConfigMap in the workload's namespace", func() {
+		local := utils.ExampleConfigMap1.DeepCopy()
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, elsewhere, local)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(HaveLen(1))
+		Expect(children[0].object.GetNamespace()).To(Equal(d.GetNamespace()))
+		Expect(children[0].object.(*corev1.ConfigMap).Data).To(Equal(local.Data))
+	})
+
+	It("rejects a child that resolves to another namespace", func() {
+		c := &otherNamespaceClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d, utils.ExampleConfigMap1.DeepCopy())}
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("outside namespace " + d.GetNamespace()))
+	})
+
+	It("rejects extra children in another namespace", func() {
+		d.GetAnnotations()[ExtraConfigMapsAnnotation] = "other/" + elsewhere.GetName()
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, elsewhere, utils.ExampleConfigMap1.DeepCopy())
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Wave containers annotation Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var appConfig *corev1.ConfigMap
+	var sidecarConfig *corev1.ConfigMap
+
+	// getHash calculates the config hash of the Deployment
+	var getHash = func() string {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(current)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		appConfig = utils.ExampleConfigMap1.DeepCopy()
+		sidecarConfig = utils.ExampleConfigMap2.DeepCopy()
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:   requiredAnnotationValue,
+			ContainersAnnotation: "app",
+		})
+		d.Spec.Template.Spec.Volumes = nil
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+				EnvFrom: []corev1.EnvFromSource{
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: appConfig.GetName()}}},
+				},
+			},
+			{
+				Name:  "sidecar",
+				Image: "sidecar",
+				Env: []corev1.EnvVar{
+					{
+						Name: "KEY1",
+						ValueFrom: &corev1.EnvVarSource{
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: sidecarConfig.GetName()},
+								Key:                  "key1",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, appConfig, sidecarConfig)
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	It("only tracks the references of the listed containers", func() {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(HaveLen(1))
+		Expect(current[0].object.GetName()).To(Equal(appConfig.GetName()))
+	})
+
+	It("changes the hash when a listed container's ConfigMap changes", func() {
+		original := getHash()
+
+		appConfig.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), appConfig)).To(Succeed())
+
+		Expect(getHash()).NotTo(Equal(original))
+	})
+
+	It("does not change the hash when another container's ConfigMap changes", func() {
+		original := getHash()
+
+		sidecarConfig.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), sidecarConfig)).To(Succeed())
+
+		Expect(getHash()).To(Equal(original))
+	})
+
+	It("tracks the references of all containers without the annotation", func() {
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		original := getHash()
+
+		sidecarConfig.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), sidecarConfig)).To(Succeed())
+
+		Expect(getHash()).NotTo(Equal(original))
+	})
+
+	It("still tracks Volumes of the Pod", func() {
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "sidecar",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: sidecarConfig.GetName()},
+					},
+				},
+			},
+		}
+
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("Wave envFrom prefix Suite", func() {
+	var h *Handler
+	var d *appsv1.Deployment
+
+	// getHash calculates the config hash of the Deployment
+	var getHash = func() string {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(current)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		cm := utils.ExampleConfigMap1.DeepCopy()
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = nil
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						Prefix:       "APP_",
+						ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()}},
+					},
+				},
+			},
+		}
+
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, cm)
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	It("changes the hash when only the prefix changes", func() {
+		original := getHash()
+
+		d.Spec.Template.Spec.Containers[0].EnvFrom[0].Prefix = "SERVICE_"
+		Expect(getHash()).NotTo(Equal(original))
+	})
+
+	It("changes the hash when the prefix is removed", func() {
+		original := getHash()
+
+		d.Spec.Template.Spec.Containers[0].EnvFrom[0].Prefix = ""
+		Expect(getHash()).NotTo(Equal(original))
+	})
+})
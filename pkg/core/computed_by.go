@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import "fmt"
+
+const (
+	// defaultHashFormat identifies hashes computed over all children at once
+	defaultHashFormat = "v1"
+
+	// fnvHashFormat identifies hashes computed over all children at once
+	// with the FNV hash algorithm
+	fnvHashFormat = "fnv-v1"
+
+	// merkleHashFormat identifies hashes computed as the root over a leaf
+	// hash of each child
+	merkleHashFormat = "merkle-v1"
+)
+
+// getComputedBy returns the value of the ComputedByAnnotation for hashes
+// computed by the Handler, or an empty string if the version of Wave is not
+// known
+func (h *Handler) getComputedBy() string {
+	if h.opts.Version == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", h.opts.Version, h.getHashFormat())
+}
+
+// setComputedBy records the version of Wave and the hash format that
+// computed the configuration hash on the metadata of the given podController
+func (h *Handler) setComputedBy(obj podController) {
+	computedBy := h.getComputedBy()
+	if computedBy == "" {
+		return
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[ComputedByAnnotation] = computedBy
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave computed-by Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+	var recorder *record.FakeRecorder
+
+	// handle reconciles the Deployment with the given options and returns the
+	// resulting Deployment
+	var handle = func(opts Options) *appsv1.Deployment {
+		h := NewHandler(c, recorder, opts)
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return updated
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+	})
+
+	It("records the running version and hash format", func() {
+		Expect(handle(Options{Version: "v0.4.0"}).GetAnnotations()).To(HaveKeyWithValue(ComputedByAnnotation, "v0.4.0/v1"))
+	})
+
+	It("records the Merkle hash format", func() {
+		Expect(handle(Options{Version: "v0.4.0", MerkleHash: true}).GetAnnotations()).To(HaveKeyWithValue(ComputedByAnnotation, "v0.4.0/merkle-v1"))
+	})
+
+	It("records the FNV hash format", func() {
+		Expect(handle(Options{Version: "v0.4.0", HashAlgorithm: HashAlgorithmFNV}).GetAnnotations()).To(HaveKeyWithValue(ComputedByAnnotation, "v0.4.0/fnv-v1"))
+	})
+
+	It("updates the version without rolling out after an upgrade", func() {
+		original := handle(Options{Version: "v0.4.0"}).Spec.Template.DeepCopy()
+		Expect(events()).To(ContainElement(ContainSubstring("ConfigChanged")))
+
+		updated := handle(Options{Version: "v0.5.0"})
+		Expect(updated.GetAnnotations()).To(HaveKeyWithValue(ComputedByAnnotation, "v0.5.0/v1"))
+		Expect(updated.Spec.Template).To(Equal(*original))
+		Expect(events()).NotTo(ContainElement(ContainSubstring("ConfigChanged")))
+	})
+
+	It("does not record anything when the version is unknown", func() {
+		Expect(handle(Options{}).GetAnnotations()).NotTo(HaveKey(ComputedByAnnotation))
+	})
+})
@@ -0,0 +1,264 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Config mirrors the Options set by the controller's flags so that they can
+// be loaded from a YAML file.
+// Each key is the name of the corresponding flag and options whose key is
+// absent from the file are left unchanged.
+type Config struct {
+	IncludeOwnNamespace     *bool            `json:"include-own-namespace,omitempty"`
+	NamespaceAllowlist      []string         `json:"namespace-allowlist,omitempty"`
+	NamespaceDenylist       []string         `json:"namespace-denylist,omitempty"`
+	WatchLabelSelector      *string          `json:"watch-label-selector,omitempty"`
+	DefaultEnabled          *bool            `json:"default-enabled,omitempty"`
+	ReverseWatchCoalesce    *metav1.Duration `json:"reverse-watch-coalesce,omitempty"`
+	DebounceInterval        *metav1.Duration `json:"debounce-interval,omitempty"`
+	MissingChildGrace       *metav1.Duration `json:"missing-child-grace,omitempty"`
+	ExtraChildGVKs          []string         `json:"extra-child-gvks,omitempty"`
+	MerkleHash              *bool            `json:"merkle-hash,omitempty"`
+	HashAlgorithm           *string          `json:"hash-algorithm,omitempty"`
+	HashVersionPrefix       *bool            `json:"hash-version-prefix,omitempty"`
+	EnableKruise            *bool            `json:"enable-kruise,omitempty"`
+	EnableArgoRollouts      *bool            `json:"enable-argo-rollouts,omitempty"`
+	EnableDeploymentConfigs *bool            `json:"enable-deploymentconfigs,omitempty"`
+	EnableReplicaSets       *bool            `json:"enable-replicasets,omitempty"`
+	AnnotationWebhook       *bool            `json:"annotation-webhook,omitempty"`
+	HashWebhook             *bool            `json:"hash-webhook,omitempty"`
+	PreRollValidateTimeout  *metav1.Duration `json:"pre-roll-validate-timeout,omitempty"`
+	PreRollValidateFailOpen *bool            `json:"pre-roll-validate-fail-open,omitempty"`
+	PreRollAllowlist        []string         `json:"pre-roll-validate-allowlist,omitempty"`
+	PDBAware                *bool            `json:"pdb-aware,omitempty"`
+	PDBDefer                *bool            `json:"pdb-defer,omitempty"`
+	PartialHashPolicy       *string          `json:"partial-hash-policy,omitempty"`
+	ChildBundlesConfigMap   *string          `json:"child-bundles-configmap,omitempty"`
+	SharedConfigNamespace   *string          `json:"shared-config-namespace,omitempty"`
+	HashAnnotation          *string          `json:"hash-annotation,omitempty"`
+	FieldManager            *string          `json:"field-manager,omitempty"`
+	FinalizerName           *string          `json:"finalizer-name,omitempty"`
+	IndexChildren           *bool            `json:"index-children,omitempty"`
+	DisableOwnerReferences  *bool            `json:"disable-owner-references,omitempty"`
+	OwnerController         *bool            `json:"owner-controller,omitempty"`
+	SecretTypeAllowlist     []string         `json:"secret-type-allowlist,omitempty"`
+	SecretTypeKeys          []string         `json:"secret-type-keys,omitempty"`
+	ConcurrentReconciles    *int             `json:"concurrent-reconciles,omitempty"`
+	RateLimiterBaseDelay    *metav1.Duration `json:"rate-limiter-base-delay,omitempty"`
+	RateLimiterMaxDelay     *metav1.Duration `json:"rate-limiter-max-delay,omitempty"`
+	RequeueJitter           *float64         `json:"requeue-jitter,omitempty"`
+	MaxRolloutsPerNamespace *int             `json:"max-rollouts-per-namespace,omitempty"`
+	SkipPaused              *bool            `json:"skip-paused,omitempty"`
+	ConfigSummary           *bool            `json:"config-summary,omitempty"`
+	MaxDetailsSize          *int             `json:"max-details-size,omitempty"`
+	DryRun                  *bool            `json:"dry-run,omitempty"`
+	ReconcileTimeout        *metav1.Duration `json:"reconcile-timeout,omitempty"`
+	MaxReconcileInterval    *metav1.Duration `json:"max-reconcile-interval,omitempty"`
+	RolloutWindow           *string          `json:"rollout-window,omitempty"`
+}
+
+// LoadConfig reads the Config from the YAML file at the given path, rejecting
+// any key that does not correspond to an option
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyTo sets each option configured in the file on opts, unless its key is
+// overridden, so that flags given on the command line take precedence over
+// the file
+func (c *Config) ApplyTo(opts *Options, overridden func(key string) bool) error {
+	if c.IncludeOwnNamespace != nil && !overridden("include-own-namespace") {
+		opts.IncludeOwnNamespace = *c.IncludeOwnNamespace
+	}
+	if c.NamespaceAllowlist != nil && !overridden("namespace-allowlist") {
+		opts.NamespaceAllowlist = c.NamespaceAllowlist
+	}
+	if c.NamespaceDenylist != nil && !overridden("namespace-denylist") {
+		opts.NamespaceDenylist = c.NamespaceDenylist
+	}
+	if c.WatchLabelSelector != nil && !overridden("watch-label-selector") {
+		opts.WatchLabelSelector = nil
+		if *c.WatchLabelSelector != "" {
+			selector, err := labels.Parse(*c.WatchLabelSelector)
+			if err != nil {
+				return fmt.Errorf("error parsing watch-label-selector: %v", err)
+			}
+			opts.WatchLabelSelector = selector
+		}
+	}
+	if c.DefaultEnabled != nil && !overridden("default-enabled") {
+		opts.DefaultEnabled = *c.DefaultEnabled
+	}
+	if c.ReverseWatchCoalesce != nil && !overridden("reverse-watch-coalesce") {
+		opts.ReverseWatchCoalesce = c.ReverseWatchCoalesce.Duration
+	}
+	if c.DebounceInterval != nil && !overridden("debounce-interval") {
+		opts.DebounceInterval = c.DebounceInterval.Duration
+	}
+	if c.MissingChildGrace != nil && !overridden("missing-child-grace") {
+		opts.MissingChildGrace = c.MissingChildGrace.Duration
+	}
+	if c.ExtraChildGVKs != nil && !overridden("extra-child-gvks") {
+		kinds, err := ParseExtraChildGVKs(c.ExtraChildGVKs)
+		if err != nil {
+			return fmt.Errorf("error parsing extra-child-gvks: %v", err)
+		}
+		opts.ExtraChildKinds = kinds
+	}
+	if c.MerkleHash != nil && !overridden("merkle-hash") {
+		opts.MerkleHash = *c.MerkleHash
+	}
+	if c.HashAlgorithm != nil && !overridden("hash-algorithm") {
+		opts.HashAlgorithm = *c.HashAlgorithm
+	}
+	if c.HashVersionPrefix != nil && !overridden("hash-version-prefix") {
+		opts.HashVersionPrefix = *c.HashVersionPrefix
+	}
+	if c.EnableKruise != nil && !overridden("enable-kruise") {
+		opts.EnableKruise = *c.EnableKruise
+	}
+	if c.EnableArgoRollouts != nil && !overridden("enable-argo-rollouts") {
+		opts.EnableArgoRollouts = *c.EnableArgoRollouts
+	}
+	if c.EnableDeploymentConfigs != nil && !overridden("enable-deploymentconfigs") {
+		opts.EnableDeploymentConfigs = *c.EnableDeploymentConfigs
+	}
+	if c.EnableReplicaSets != nil && !overridden("enable-replicasets") {
+		opts.EnableReplicaSets = *c.EnableReplicaSets
+	}
+	if c.AnnotationWebhook != nil && !overridden("annotation-webhook") {
+		opts.AnnotationWebhook = *c.AnnotationWebhook
+	}
+	if c.HashWebhook != nil && !overridden("hash-webhook") {
+		opts.HashWebhook = *c.HashWebhook
+	}
+	if c.PreRollValidateTimeout != nil && !overridden("pre-roll-validate-timeout") {
+		opts.PreRollValidateTimeout = c.PreRollValidateTimeout.Duration
+	}
+	if c.PreRollValidateFailOpen != nil && !overridden("pre-roll-validate-fail-open") {
+		opts.PreRollValidateFailOpen = *c.PreRollValidateFailOpen
+	}
+	if c.PreRollAllowlist != nil && !overridden("pre-roll-validate-allowlist") {
+		opts.PreRollAllowlist = c.PreRollAllowlist
+	}
+	if c.PDBAware != nil && !overridden("pdb-aware") {
+		opts.PDBAware = *c.PDBAware
+	}
+	if c.PDBDefer != nil && !overridden("pdb-defer") {
+		opts.PDBDefer = *c.PDBDefer
+	}
+	if c.PartialHashPolicy != nil && !overridden("partial-hash-policy") {
+		opts.PartialHashPolicy = *c.PartialHashPolicy
+	}
+	if c.ChildBundlesConfigMap != nil && !overridden("child-bundles-configmap") {
+		opts.ChildBundles = types.NamespacedName{}
+		if *c.ChildBundlesConfigMap != "" {
+			opts.ChildBundles = types.NamespacedName{Namespace: opts.OwnNamespace, Name: *c.ChildBundlesConfigMap}
+		}
+	}
+	if c.SharedConfigNamespace != nil && !overridden("shared-config-namespace") {
+		opts.SharedConfigNamespace = *c.SharedConfigNamespace
+	}
+	if c.HashAnnotation != nil && !overridden("hash-annotation") {
+		opts.HashAnnotation = *c.HashAnnotation
+	}
+	if c.FieldManager != nil && !overridden("field-manager") {
+		opts.FieldManager = *c.FieldManager
+	}
+	if c.FinalizerName != nil && !overridden("finalizer-name") {
+		opts.FinalizerName = *c.FinalizerName
+	}
+	if c.IndexChildren != nil && !overridden("index-children") {
+		opts.IndexChildren = *c.IndexChildren
+	}
+	if c.DisableOwnerReferences != nil && !overridden("disable-owner-references") {
+		opts.DisableOwnerReferences = *c.DisableOwnerReferences
+	}
+	if c.OwnerController != nil && !overridden("owner-controller") {
+		opts.OwnerController = *c.OwnerController
+	}
+	if c.SecretTypeAllowlist != nil && !overridden("secret-type-allowlist") {
+		opts.SecretTypeAllowlist = c.SecretTypeAllowlist
+	}
+	if c.SecretTypeKeys != nil && !overridden("secret-type-keys") {
+		typeKeys, err := ParseSecretTypeKeys(c.SecretTypeKeys)
+		if err != nil {
+			return fmt.Errorf("error parsing secret-type-keys: %v", err)
+		}
+		opts.SecretTypeKeys = typeKeys
+	}
+	if c.ConcurrentReconciles != nil && !overridden("concurrent-reconciles") {
+		opts.ConcurrentReconciles = *c.ConcurrentReconciles
+	}
+	if c.RateLimiterBaseDelay != nil && !overridden("rate-limiter-base-delay") {
+		opts.RateLimiterBaseDelay = c.RateLimiterBaseDelay.Duration
+	}
+	if c.RateLimiterMaxDelay != nil && !overridden("rate-limiter-max-delay") {
+		opts.RateLimiterMaxDelay = c.RateLimiterMaxDelay.Duration
+	}
+	if c.ReconcileTimeout != nil && !overridden("reconcile-timeout") {
+		opts.ReconcileTimeout = c.ReconcileTimeout.Duration
+	}
+	if c.MaxReconcileInterval != nil && !overridden("max-reconcile-interval") {
+		opts.MaxReconcileInterval = c.MaxReconcileInterval.Duration
+	}
+	if c.RolloutWindow != nil && !overridden("rollout-window") {
+		opts.RolloutWindow = nil
+		if *c.RolloutWindow != "" {
+			window, err := ParseRolloutWindow(*c.RolloutWindow)
+			if err != nil {
+				return fmt.Errorf("error parsing rollout-window: %v", err)
+			}
+			opts.RolloutWindow = window
+		}
+	}
+	if c.RequeueJitter != nil && !overridden("requeue-jitter") {
+		opts.RequeueJitter = *c.RequeueJitter
+	}
+	if c.MaxRolloutsPerNamespace != nil && !overridden("max-rollouts-per-namespace") {
+		opts.MaxRolloutsPerNamespace = *c.MaxRolloutsPerNamespace
+	}
+	if c.SkipPaused != nil && !overridden("skip-paused") {
+		opts.SkipPaused = *c.SkipPaused
+	}
+	if c.ConfigSummary != nil && !overridden("config-summary") {
+		opts.ConfigSummary = *c.ConfigSummary
+	}
+	if c.MaxDetailsSize != nil && !overridden("max-details-size") {
+		opts.MaxDetailsSize = *c.MaxDetailsSize
+	}
+	if c.DryRun != nil && !overridden("dry-run") {
+		opts.DryRun = *c.DryRun
+	}
+	return nil
+}
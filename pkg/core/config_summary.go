@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// getConfigSummary returns a human readable summary of the number of children
+// of each kind, such as "2 configmaps, 1 secret". ConfigMaps and Secrets are
+// listed first, followed by any extra child kinds in alphabetical order.
+func getConfigSummary(children []configObject) string {
+	return strings.Join(getConfigSummaryEntries(children), ", ")
+}
+
+// getConfigSummaryEntries returns the entries of the configuration summary of
+// the children, one for each kind
+func getConfigSummaryEntries(children []configObject) []string {
+	counts := make(map[string]int)
+	for _, child := range children {
+		counts[strings.ToLower(kindOf(child.object))]++
+	}
+	if len(counts) == 0 {
+		return []string{"no children"}
+	}
+
+	kinds := []string{}
+	for kind := range counts {
+		if kind != "configmap" && kind != "secret" {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	kinds = append([]string{"configmap", "secret"}, kinds...)
+
+	entries := []string{}
+	for _, kind := range kinds {
+		switch count := counts[kind]; count {
+		case 0:
+		case 1:
+			entries = append(entries, fmt.Sprintf("1 %s", kind))
+		default:
+			entries = append(entries, fmt.Sprintf("%d %ss", count, kind))
+		}
+	}
+	return entries
+}
+
+// setConfigSummary records the summary of the children the instance tracks
+// itself, excluding those of other members of its hash group, on the metadata
+// of the given podController, if enabled.
+// The summary is only informational, is never part of the configuration hash
+// and is truncated to the Handler's details size.
+func (h *Handler) setConfigSummary(obj podController, children []configObject) {
+	if !h.opts.ConfigSummary {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ConfigSummaryAnnotation] = truncateDetails(getConfigSummaryEntries(children), ", ", h.getMaxDetailsSize())
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave config summary Suite", func() {
+	Context("getConfigSummary", func() {
+		It("counts the children of each kind", func() {
+			children := []configObject{
+				{object: utils.ExampleConfigMap1.DeepCopy()},
+				{object: utils.ExampleConfigMap2.DeepCopy()},
+				{object: utils.ExampleSecret1.DeepCopy()},
+			}
+			Expect(getConfigSummary(children)).To(Equal("2 configmaps, 1 secret"))
+		})
+
+		It("lists extra child kinds after ConfigMaps and Secrets", func() {
+			u := newUnstructured(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "SecretProviderClass"})
+			children := []configObject{
+				{object: u},
+				{object: utils.ExampleSecret1.DeepCopy()},
+				{object: utils.ExampleSecret2.DeepCopy()},
+			}
+			Expect(getConfigSummary(children)).To(Equal("2 secrets, 1 secretproviderclass"))
+		})
+
+		It("summarises a workload without children", func() {
+			Expect(getConfigSummary(nil)).To(Equal("no children"))
+		})
+	})
+
+	Context("When reconciling a Deployment", func() {
+		var d *appsv1.Deployment
+
+		// reconcile handles the Deployment with the given options and returns
+		// its updated state
+		var reconcile = func(opts Options) *appsv1.Deployment {
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, d.DeepCopy(),
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleSecret1.DeepCopy(),
+			)
+			h := NewHandler(c, record.NewFakeRecorder(100), opts)
+			_, err := h.HandleDeployment(d.DeepCopy())
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+
+			// Reconciling the rolled out Deployment again changes nothing
+			_, err = h.HandleDeployment(updated.DeepCopy())
+			Expect(err).NotTo(HaveOccurred())
+			again := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, again)).To(Succeed())
+			Expect(again.GetAnnotations()).To(Equal(updated.GetAnnotations()))
+			Expect(again.Spec.Template).To(Equal(updated.Spec.Template))
+			return updated
+		}
+
+		BeforeEach(func() {
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			d.Spec.Template.Spec.InitContainers = nil
+			d.Spec.Template.Spec.Containers = []corev1.Container{
+				{
+					Name:  "container",
+					Image: "container",
+					EnvFrom: []corev1.EnvFromSource{
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap1.GetName()}}},
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap2.GetName()}}},
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleSecret1.GetName()}}},
+					},
+				},
+			}
+			d.Spec.Template.Spec.Volumes = nil
+		})
+
+		It("records the summary of the tracked children on rollout", func() {
+			updated := reconcile(Options{ConfigSummary: true})
+			Expect(updated.GetAnnotations()).To(HaveKeyWithValue(ConfigSummaryAnnotation, "2 configmaps, 1 secret"))
+		})
+
+		It("does not fold the summary into the hash", func() {
+			withSummary := reconcile(Options{ConfigSummary: true})
+			withoutSummary := reconcile(Options{})
+			Expect(withSummary.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(BeEmpty())
+			Expect(withSummary.Spec.Template).To(Equal(withoutSummary.Spec.Template))
+			Expect(withSummary.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigSummaryAnnotation))
+		})
+
+		It("does not record a summary unless enabled", func() {
+			Expect(reconcile(Options{}).GetAnnotations()).NotTo(HaveKey(ConfigSummaryAnnotation))
+		})
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave config file Suite", func() {
+	var path string
+
+	// writeConfig writes the config file read by the tests
+	writeConfig := func(content string) {
+		f, err := ioutil.TempFile("", "wave-config")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString(content)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		path = f.Name()
+	}
+
+	// notOverridden overrides no option of the config file
+	notOverridden := func(string) bool { return false }
+
+	AfterEach(func() {
+		if path != "" {
+			Expect(os.Remove(path)).To(Succeed())
+			path = ""
+		}
+	})
+
+	It("configures the Handler with the options set in the file", func() {
+		writeConfig(`
+namespace-allowlist: [team-a, team-b]
+watch-label-selector: team=a
+debounce-interval: 30s
+hash-algorithm: fnv
+hash-annotation: example.com/config-hash
+finalizer-name: example.com/wave
+child-bundles-configmap: bundles
+shared-config-namespace: config
+concurrent-reconciles: 4
+skip-paused: false
+max-details-size: 1024
+pre-roll-validate-allowlist: [validator.example.com]
+`)
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		opts := Options{OwnNamespace: "wave-system", SkipPaused: true}
+		Expect(cfg.ApplyTo(&opts, notOverridden)).To(Succeed())
+		Expect(opts.NamespaceAllowlist).To(Equal([]string{"team-a", "team-b"}))
+		Expect(opts.WatchLabelSelector.String()).To(Equal("team=a"))
+		Expect(opts.DebounceInterval).To(Equal(30 * time.Second))
+		Expect(opts.ChildBundles).To(Equal(types.NamespacedName{Namespace: "wave-system", Name: "bundles"}))
+		Expect(opts.SharedConfigNamespace).To(Equal("config"))
+		Expect(opts.ConcurrentReconciles).To(Equal(4))
+		Expect(opts.SkipPaused).To(BeFalse())
+		Expect(opts.PreRollAllowlist).To(Equal([]string{"validator.example.com"}))
+
+		h := NewHandler(fake.NewFakeClient(), nil, opts)
+		Expect(h.getHashAnnotation()).To(Equal("example.com/config-hash"))
+		Expect(h.getFinalizerName()).To(Equal("example.com/wave"))
+		Expect(h.getHashFormat()).To(Equal("fnv-v1"))
+		Expect(h.getMaxDetailsSize()).To(Equal(1024))
+	})
+
+	It("leaves the options missing from the file unchanged", func() {
+		writeConfig("dry-run: true\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		opts := Options{HashAlgorithm: HashAlgorithmSHA256, SecretTypeAllowlist: DefaultSecretTypeAllowlist}
+		Expect(cfg.ApplyTo(&opts, notOverridden)).To(Succeed())
+		Expect(opts.DryRun).To(BeTrue())
+		Expect(opts.HashAlgorithm).To(Equal(HashAlgorithmSHA256))
+		Expect(opts.SecretTypeAllowlist).To(Equal(DefaultSecretTypeAllowlist))
+	})
+
+	It("lets overridden options take precedence over the file", func() {
+		writeConfig("hash-algorithm: fnv\ndry-run: true\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		opts := Options{HashAlgorithm: HashAlgorithmSHA256}
+		Expect(cfg.ApplyTo(&opts, func(key string) bool { return key == "hash-algorithm" })).To(Succeed())
+		Expect(opts.HashAlgorithm).To(Equal(HashAlgorithmSHA256))
+		Expect(opts.DryRun).To(BeTrue())
+	})
+
+	It("rejects keys that do not correspond to an option", func() {
+		writeConfig("merkle-hashes: true\n")
+		_, err := LoadConfig(path)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects an invalid label selector", func() {
+		writeConfig("watch-label-selector: \"team in (a\"\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.ApplyTo(&Options{}, notOverridden)).NotTo(Succeed())
+	})
+
+	It("parses the keys of Secret types", func() {
+		writeConfig("secret-type-keys: [\"kubernetes.io/basic-auth=password\"]\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		opts := Options{}
+		Expect(cfg.ApplyTo(&opts, notOverridden)).To(Succeed())
+		Expect(opts.SecretTypeKeys).To(Equal(map[string][]string{"kubernetes.io/basic-auth": {"password"}}))
+	})
+
+	It("parses the rollout window", func() {
+		writeConfig("rollout-window: \"22:00-06:00 Mon-Fri\"\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		opts := Options{}
+		Expect(cfg.ApplyTo(&opts, notOverridden)).To(Succeed())
+		Expect(opts.RolloutWindow).NotTo(BeNil())
+		Expect(opts.RolloutWindow.String()).To(Equal("22:00-06:00 Mon-Fri"))
+	})
+
+	It("rejects an invalid rollout window", func() {
+		writeConfig("rollout-window: \"22:00\"\n")
+		cfg, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.ApplyTo(&Options{}, notOverridden)).NotTo(Succeed())
+	})
+})
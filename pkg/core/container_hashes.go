@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordsContainerHashes returns true if the given podController has the
+// container hashes annotation set to true
+func recordsContainerHashes(obj podController) bool {
+	return obj.GetAnnotations()[ContainerHashesAnnotation] == requiredAnnotationValue
+}
+
+// getContainerChildKeys returns the kind and name of each ConfigMap and Secret
+// referenced by the container, through its EnvFrom and Env and the Volumes it
+// mounts
+func getContainerChildKeys(obj podController, container corev1.Container) map[string]struct{} {
+	configMaps := make(map[string]configMetadata)
+	secrets := make(map[string]configMetadata)
+
+	mounted := getMountedVolumes([]corev1.Container{container})
+	for _, vol := range obj.GetPodTemplate().Spec.Volumes {
+		if _, ok := mounted[vol.Name]; ok {
+			addVolumeChildNames(vol, nil, configMaps, secrets)
+		}
+	}
+	addContainerChildNames([]corev1.Container{container}, configMaps, secrets)
+	return toChildKeys(configMaps, secrets)
+}
+
+// setContainerHashes records the configuration hash of each container of the
+// podController on its metadata, if it has the container hashes annotation,
+// and removes the hashes of containers that no longer exist.
+//
+// Each container's hash is calculated over the given children that the
+// container references, so that it only changes when the configuration of
+// that container changes. The hashes are only recorded for diagnostics: the
+// configuration hash of the whole PodTemplate still drives rollouts.
+func (h *Handler) setContainerHashes(obj podController, children []configObject) error {
+	annotations := obj.GetAnnotations()
+	hashes := make(map[string]string)
+	if recordsContainerHashes(obj) {
+		for _, container := range getAllContainers(obj) {
+			keys := getContainerChildKeys(obj, container)
+			referenced := []configObject{}
+			for _, child := range children {
+				if child.object == nil {
+					continue
+				}
+				if _, ok := keys[kindOf(child.object)+"/"+child.object.GetName()]; ok {
+					referenced = append(referenced, child)
+				}
+			}
+			hash, err := h.calculateConfigHashWithFormat(referenced, h.getHashFormat(), nil)
+			if err != nil {
+				return err
+			}
+			hashes[ContainerHashAnnotationPrefix+container.Name] = hash
+		}
+	}
+
+	for key := range annotations {
+		if _, ok := hashes[key]; !ok && strings.HasPrefix(key, ContainerHashAnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for key, hash := range hashes {
+		annotations[key] = hash
+	}
+	obj.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave container hashes Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var appConfig, sidecarConfig *corev1.ConfigMap
+
+	const appHash = ContainerHashAnnotationPrefix + "app"
+	const sidecarHash = ContainerHashAnnotationPrefix + "sidecar"
+
+	// handle reconciles the Deployment and returns the annotations on its
+	// metadata
+	var handle = func() map[string]string {
+		key := client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}
+		current := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), key, current)).To(Succeed())
+		_, err := h.HandleDeployment(current)
+		Expect(err).NotTo(HaveOccurred())
+		d = &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), key, d)).To(Succeed())
+		return d.GetAnnotations()
+	}
+
+	// modify changes the data of the ConfigMap
+	var modify = func(cm *corev1.ConfigMap) {
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		appConfig = utils.ExampleConfigMap1.DeepCopy()
+		sidecarConfig = utils.ExampleConfigMap2.DeepCopy()
+
+		// The app consumes its ConfigMap through envFrom, the sidecar through
+		// a volume only it mounts
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			ContainerHashesAnnotation: requiredAnnotationValue,
+		})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "sidecar-config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: sidecarConfig.GetName()},
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "app",
+				Image: "app",
+				EnvFrom: []corev1.EnvFromSource{
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: appConfig.GetName()}}},
+				},
+			},
+			{
+				Name:         "sidecar",
+				Image:        "sidecar",
+				VolumeMounts: []corev1.VolumeMount{{Name: "sidecar-config", MountPath: "/etc/sidecar"}},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, appConfig, sidecarConfig)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("records the hash of each container's children", func() {
+		annotations := handle()
+		Expect(annotations).To(HaveKey(appHash))
+		Expect(annotations).To(HaveKey(sidecarHash))
+
+		expected, err := calculateConfigHash([]configObject{{object: appConfig, allKeys: true, required: true}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(annotations[appHash]).To(Equal(expected))
+	})
+
+	It("only changes the hash of the container whose children changed", func() {
+		original := handle()
+		modify(sidecarConfig)
+
+		annotations := handle()
+		Expect(annotations[appHash]).To(Equal(original[appHash]))
+		Expect(annotations[sidecarHash]).NotTo(Equal(original[sidecarHash]))
+		Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(BeEmpty())
+	})
+
+	It("removes the hashes of containers that no longer exist", func() {
+		handle()
+		d.Spec.Template.Spec.Containers = d.Spec.Template.Spec.Containers[:1]
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		annotations := handle()
+		Expect(annotations).To(HaveKey(appHash))
+		Expect(annotations).NotTo(HaveKey(sidecarHash))
+	})
+
+	It("does not record hashes without the annotation", func() {
+		handle()
+		delete(d.Annotations, ContainerHashesAnnotation)
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		annotations := handle()
+		Expect(annotations).NotTo(HaveKey(appHash))
+		Expect(annotations).NotTo(HaveKey(sidecarHash))
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave default enabled Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+
+	// reconcile handles the Deployment with the given default and returns
+	// its updated state
+	var reconcile = func(defaultEnabled bool) *appsv1.Deployment {
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{DefaultEnabled: defaultEnabled})
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(nil)
+	})
+
+	Context("when enabled by default", func() {
+		It("manages Deployments without an annotation", func() {
+			updated := reconcile(true)
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetFinalizers()).To(ContainElement(FinalizerString))
+		})
+
+		It("does not manage Deployments that opt out", func() {
+			d.SetAnnotations(map[string]string{EnabledAnnotation: "false"})
+			updated := reconcile(true)
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetFinalizers()).To(BeEmpty())
+		})
+	})
+
+	Context("when disabled by default", func() {
+		It("does not manage Deployments without an annotation", func() {
+			updated := reconcile(false)
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetFinalizers()).To(BeEmpty())
+		})
+
+		It("manages Deployments that opt in", func() {
+			d.SetAnnotations(map[string]string{EnabledAnnotation: requiredAnnotationValue})
+			updated := reconcile(false)
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetFinalizers()).To(ContainElement(FinalizerString))
+		})
+	})
+})
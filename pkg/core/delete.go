@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -28,24 +29,54 @@ import (
 // handleDelete removes all existing Owner References pointing to the object
 // before removing the object's Finalizer
 func (h *Handler) handleDelete(obj podController) (reconcile.Result, error) {
-	// Fetch all children with an OwnerReference pointing to the object
-	existing, err := h.getExistingChildren(obj)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error fetching children: %v", err)
-	}
+	return h.cleanUp(obj, false)
+}
+
+// handleOptOut cleans up an object that Wave is no longer enabled for as
+// handleDelete does, also removing the configuration hash from its
+// PodTemplate
+func (h *Handler) handleOptOut(obj podController) (reconcile.Result, error) {
+	return h.cleanUp(obj, true)
+}
+
+// cleanUp removes all existing Owner References pointing to the object before
+// removing the object's Finalizer and, if removeHash is set, its configuration
+// hash. Children are left untouched if OwnerReferences are disabled.
+func (h *Handler) cleanUp(obj podController, removeHash bool) (reconcile.Result, error) {
+	// The object is no longer being managed so stop tracking missing and
+	// changed children
+	h.clearMissingChild(obj)
+	h.clearChildHashes(obj)
+	h.clearBlockedByPDB(obj)
+	h.clearOwnedByLabelled(obj)
+	h.clearRolloutInProgress(obj)
+	childCounts.remove(obj)
+	configDrifts.remove(obj)
+
+	// Remove the OwnerReferences from all children with an OwnerReference
+	// pointing to the object, unless children must never be updated
+	if !h.opts.DisableOwnerReferences {
+		existing, err := h.getAllExistingChildren(obj)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error fetching children: %v", err)
+		}
 
-	// Remove the OwnerReferences from the children
-	err = h.removeOwnerReferences(obj, existing)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error removing owner references from children: %v", err)
+		err = h.removeOwnerReferences(obj, existing)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error removing owner references from children: %v", err)
+		}
 	}
 
 	// Remove the object's Finalizer and update if necessary
 	copy := obj.DeepCopy()
-	removeFinalizer(copy)
+	removeFinalizer(copy, h.getFinalizerName())
+	if removeHash {
+		removeConfigHash(copy, h.getHashAnnotation())
+		removeStatus(copy)
+	}
 	if !reflect.DeepEqual(obj, copy) {
 		err := h.Update(context.TODO(), copy.GetObject())
-		if err != nil {
+		if err != nil && !errors.IsNotFound(err) {
 			return reconcile.Result{}, fmt.Errorf("error updating Deployment: %v", err)
 		}
 	}
@@ -31,7 +31,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -56,7 +58,7 @@ var _ = Describe("Wave owner references Suite", func() {
 		var cerr error
 		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 		Expect(cerr).NotTo(HaveOccurred())
-		h = NewHandler(c, mgr.GetEventRecorderFor("wave"))
+		h = NewHandler(c, mgr.GetEventRecorderFor("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -175,3 +177,110 @@ var _ = Describe("Wave owner references Suite", func() {
 	})
 
 })
+
+var _ = Describe("Wave clean up Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var otherRef metav1.OwnerReference
+
+	// getDeployment returns the current state of the Deployment
+	var getDeployment = func() *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	// getConfigMap returns the current state of the ConfigMap
+	var getConfigMap = func() *corev1.ConfigMap {
+		updated := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID("example-deployment")
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:   requiredAnnotationValue,
+			HashTargetAnnotation: "annotation,env:CONFIG_HASH",
+		})
+
+		otherRef = metav1.OwnerReference{
+			APIVersion: "example.com/v1",
+			Kind:       "Other",
+			Name:       "other",
+			UID:        "other-owner",
+		}
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetUID("example-configmap1")
+		cm.SetOwnerReferences([]metav1.OwnerReference{otherRef})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		d = getDeployment()
+		Expect(d.GetFinalizers()).To(ContainElement(FinalizerString))
+		Expect(getConfigMap().GetOwnerReferences()).To(ContainElement(getOwnerReference(&deployment{d})))
+	})
+
+	Context("when the Deployment opts out", func() {
+		BeforeEach(func() {
+			annotations := d.GetAnnotations()
+			delete(annotations, RequiredAnnotation)
+			d.SetAnnotations(annotations)
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+			_, err := h.HandleDeployment(getDeployment())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes only its own OwnerReference from the children", func() {
+			Expect(getConfigMap().GetOwnerReferences()).To(ConsistOf(otherRef))
+		})
+
+		It("removes the configuration hash from the PodTemplate", func() {
+			updated := getDeployment()
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetAnnotations()).NotTo(HaveKey(AppliedHashEnvAnnotation))
+			for _, container := range updated.Spec.Template.Spec.Containers {
+				for _, env := range container.Env {
+					Expect(env.Name).NotTo(Equal("CONFIG_HASH"))
+				}
+			}
+		})
+
+		It("removes the finalizer", func() {
+			Expect(getDeployment().GetFinalizers()).NotTo(ContainElement(FinalizerString))
+		})
+	})
+
+	Context("when the Deployment is deleted", func() {
+		BeforeEach(func() {
+			now := metav1.Now()
+			d.SetDeletionTimestamp(&now)
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+			_, err := h.HandleDeployment(getDeployment())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes only its own OwnerReference from the children", func() {
+			Expect(getConfigMap().GetOwnerReferences()).To(ConsistOf(otherRef))
+		})
+
+		It("leaves the configuration hash on the PodTemplate", func() {
+			Expect(getDeployment().Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("removes the finalizer", func() {
+			Expect(getDeployment().GetFinalizers()).NotTo(ContainElement(FinalizerString))
+		})
+	})
+})
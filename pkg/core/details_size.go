@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxDetailsSize is the size in bytes that each details annotation is
+// truncated to if Options.MaxDetailsSize is not positive
+const DefaultMaxDetailsSize = 4096
+
+// truncatedDetailMarker ends a details message that was truncated
+const truncatedDetailMarker = "... (truncated)"
+
+// getMaxDetailsSize returns the size in bytes that the Handler truncates each
+// details annotation to
+func (h *Handler) getMaxDetailsSize() int {
+	if h.opts.MaxDetailsSize <= 0 {
+		return DefaultMaxDetailsSize
+	}
+	return h.opts.MaxDetailsSize
+}
+
+// truncateDetails joins the entries with the separator, keeping as many of
+// the first entries as fit within the budget in bytes along with a marker
+// counting the entries left out, such as "a,b,+3 more".
+// The entries are kept in the order given, so that the same entries are
+// always truncated in the same way. Only the marker is returned if not even
+// the first entry fits.
+func truncateDetails(entries []string, sep string, budget int) string {
+	joined := strings.Join(entries, sep)
+	if len(joined) <= budget {
+		return joined
+	}
+
+	kept, size := 0, 0
+	for i, entry := range entries {
+		// The size of the first i+1 entries followed by the marker
+		next := size + len(entry) + len(sep)
+		if next+len(detailsMarker(len(entries)-i-1)) > budget {
+			break
+		}
+		kept, size = i+1, next
+	}
+	return strings.Join(append(entries[:kept:kept], detailsMarker(len(entries)-kept)), sep)
+}
+
+// detailsMarker returns the marker counting the entries left out of truncated
+// details
+func detailsMarker(omitted int) string {
+	return fmt.Sprintf("+%d more", omitted)
+}
+
+// truncateDetail truncates the message to the budget in bytes, ending it
+// with a marker if it was truncated. The message is never split within a
+// character.
+func truncateDetail(message string, budget int) string {
+	if len(message) <= budget {
+		return message
+	}
+
+	end := budget - len(truncatedDetailMarker)
+	if end < 0 {
+		end = 0
+	}
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+	return message[:end] + truncatedDetailMarker
+}
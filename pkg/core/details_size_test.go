@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave details size Suite", func() {
+	Context("truncateDetails", func() {
+		It("joins the entries that fit within the budget", func() {
+			Expect(truncateDetails([]string{"a", "b", "c"}, ",", 5)).To(Equal("a,b,c"))
+		})
+
+		It("keeps the first entries and counts those left out", func() {
+			entries := []string{"aaaa", "bbbb", "cccc", "dddd"}
+			Expect(truncateDetails(entries, ",", 17)).To(Equal("aaaa,bbbb,+2 more"))
+			Expect(truncateDetails(entries, ",", 16)).To(Equal("aaaa,+3 more"))
+			Expect(truncateDetails(entries, ",", 3)).To(Equal("+4 more"))
+		})
+	})
+
+	Context("truncateDetail", func() {
+		It("leaves messages within the budget unchanged", func() {
+			Expect(truncateDetail("message", 7)).To(Equal("message"))
+		})
+
+		It("truncates longer messages without splitting characters", func() {
+			message := strings.Repeat("é", 20)
+			truncated := truncateDetail(message, 20)
+			Expect(len(truncated)).To(BeNumerically("<=", 20))
+			Expect(truncated).To(Equal("éé" + truncatedDetailMarker))
+		})
+	})
+
+	Context("When reconciling a Deployment with many children", func() {
+		const budget = 256
+		var c client.Client
+		var h *Handler
+		var d *appsv1.Deployment
+		var configMaps []*corev1.ConfigMap
+
+		// handle reconciles the Deployment with the Handler and refreshes it
+		// from the client
+		var handle = func(h *Handler) error {
+			_, err := h.HandleDeployment(d)
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			d = updated
+			return err
+		}
+
+		BeforeEach(func() {
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			objs := []runtime.Object{
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			}
+
+			configMaps = nil
+			container := &d.Spec.Template.Spec.Containers[0]
+			for i := 0; i < 100; i++ {
+				cm := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("many-%03d", i), Namespace: d.GetNamespace()},
+					Data:       map[string]string{"key": "value"},
+				}
+				configMaps = append(configMaps, cm)
+				objs = append(objs, cm)
+				container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: cm.GetName()}},
+				})
+			}
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, append(objs, d)...)
+			h = NewHandler(c, record.NewFakeRecorder(1000), Options{MaxDetailsSize: budget})
+			Expect(handle(h)).To(Succeed())
+		})
+
+		It("truncates the last changed children to the budget", func() {
+			for _, cm := range configMaps {
+				cm.Data["key"] = "modified"
+				Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			}
+			Expect(handle(h)).To(Succeed())
+
+			changed := d.GetAnnotations()[LastChangedChildrenAnnotation]
+			Expect(len(changed)).To(BeNumerically("<=", budget))
+			Expect(changed).To(HavePrefix("ConfigMap/many-000,ConfigMap/many-001,"))
+			Expect(changed).To(MatchRegexp(`,\+\d+ more$`))
+		})
+
+		It("never truncates the configuration hash", func() {
+			for _, cm := range configMaps {
+				cm.Data["key"] = "modified"
+				Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			}
+			Expect(handle(h)).To(Succeed())
+			hash := d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+			// A Handler without the budget computes the same hash
+			Expect(handle(NewHandler(c, record.NewFakeRecorder(1000), Options{}))).To(Succeed())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hash))
+		})
+
+		It("truncates the status message naming missing children to the budget", func() {
+			for _, cm := range configMaps {
+				Expect(c.Delete(context.TODO(), cm)).To(Succeed())
+			}
+			Expect(handle(h)).NotTo(Succeed())
+
+			message := d.GetAnnotations()[StatusMessageAnnotation]
+			Expect(len(message)).To(BeNumerically("<=", budget))
+			Expect(message).To(HavePrefix("Missing children: ConfigMap/many-000, "))
+			Expect(message).To(MatchRegexp(`, \+\d+ more$`))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getTemplateConfigHash returns the configuration hash written to the
+// PodTemplate of the given podController under the given annotation key, or
+// to the first of its environment variable targets that is set, or an empty
+// string if no hash has been written
+func getTemplateConfigHash(obj podController, key string) string {
+	podTemplate := obj.GetPodTemplate()
+	if hash, ok := podTemplate.GetAnnotations()[key]; ok {
+		return hash
+	}
+
+	names := getAppliedHashEnv(obj)
+	if len(names) == 0 {
+		names = getHashTargets(obj).env
+	}
+	var containers []corev1.Container
+	containers = append(containers, podTemplate.Spec.InitContainers...)
+	containers = append(containers, podTemplate.Spec.Containers...)
+	for _, name := range names {
+		for _, container := range containers {
+			for _, env := range container.Env {
+				if env.Name == name {
+					return env.Value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// getAppliedConfigHash returns the configuration hash that the Pods of the
+// given podController are running with: the hash recorded when they were last
+// restarted if they are restarted by deleting them, the adopted hash while it
+// is adopted, or the hash written to the PodTemplate otherwise. The hash
+// written to the PodTemplate of an observe-only podController is the one baked
+// in by whatever rolls it out.
+func (h *Handler) getAppliedConfigHash(obj podController) string {
+	annotations := obj.GetAnnotations()
+	if !isObserveOnly(obj) {
+		if deletesPods(obj) {
+			return annotations[RestartedConfigHashAnnotation]
+		}
+		if adopted, ok := annotations[AdoptedConfigHashAnnotation]; ok {
+			return adopted
+		}
+	}
+	return getTemplateConfigHash(obj, h.getHashAnnotation())
+}
+
+// getConfigDrift returns the configuration hash that the given podController
+// has drifted from, or an empty string if it is running with the hash or no
+// hash has been applied to it yet
+func (h *Handler) getConfigDrift(obj podController, hash string) string {
+	applied := h.getAppliedConfigHash(obj)
+	if applied == "" || applied == hash {
+		return ""
+	}
+	return hash
+}
+
+// setConfigDrift records the configuration hash that the given podController
+// has drifted from on its metadata, removing it if the drift is empty
+func setConfigDrift(obj podController, drift string) {
+	annotations := obj.GetAnnotations()
+	if drift == "" {
+		if _, ok := annotations[ConfigDriftAnnotation]; ok {
+			delete(annotations, ConfigDriftAnnotation)
+			obj.SetAnnotations(annotations)
+		}
+		return
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ConfigDriftAnnotation] = drift
+	obj.SetAnnotations(annotations)
+}
+
+// reportConfigDrift reports whether the given podController has drifted from
+// its configuration hash in wave_config_drift
+func reportConfigDrift(obj podController, drift string) {
+	if drift == "" {
+		configDrifts.set(obj, 0)
+		return
+	}
+	configDrifts.set(obj, 1)
+}
+
+// reportDeferred reports that the rollout of the given podController has been
+// deferred as reportStatus does, with the RolloutDeferred reason, along with its drift from the configuration
+// hash as its PodTemplate is left untouched
+func (h *Handler) reportDeferred(obj podController, hash, message string) {
+	drift := h.getConfigDrift(obj, hash)
+	reportConfigDrift(obj, drift)
+
+	copy := obj.DeepCopy()
+	setConfigDrift(copy, drift)
+	setStatus(copy, StatusSynced, message)
+	setStatusReason(copy, ReasonRolloutDeferred)
+	if h.opts.DryRun || reflect.DeepEqual(obj.GetAnnotations(), copy.GetAnnotations()) {
+		return
+	}
+
+	err := h.Update(context.TODO(), copy.GetObject())
+	if err != nil {
+		h.log.Error(err, "error reporting instance status", "namespace", obj.GetNamespace(), "name", obj.GetName(), "status", StatusSynced)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// getConfigDriftMetric returns the value of wave_config_drift for the given
+// namespace and kind, and whether the series exists
+func getConfigDriftMetric(namespace, kind string) (float64, bool) {
+	family, ok := scrapeMetrics()["wave_config_drift"]
+	if !ok {
+		return 0, false
+	}
+	for _, m := range family.GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["namespace"] == namespace && labels["kind"] == kind {
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+var _ = Describe("Wave configuration drift Suite", func() {
+	var h *Handler
+	var d *appsv1.Deployment
+	var pc podController
+
+	BeforeEach(func() {
+		h = NewHandler(nil, record.NewFakeRecorder(100), Options{})
+		d = utils.ExampleDeployment.DeepCopy()
+		pc = &deployment{d}
+	})
+
+	Context("getConfigDrift", func() {
+		It("reports no drift when no hash has been applied", func() {
+			Expect(h.getConfigDrift(pc, "1234")).To(BeEmpty())
+		})
+
+		It("reports no drift when the PodTemplate carries the hash", func() {
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "1234"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(BeEmpty())
+		})
+
+		It("reports the hash when the PodTemplate carries another hash", func() {
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "5678"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(Equal("1234"))
+		})
+
+		It("reads the hash from the environment variable targets", func() {
+			d.SetAnnotations(map[string]string{HashTargetAnnotation: "env:CONFIG_HASH"})
+			d.Spec.Template.Spec.Containers[0].Env = append(d.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "CONFIG_HASH", Value: "5678"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(Equal("1234"))
+			Expect(h.getConfigDrift(pc, "5678")).To(BeEmpty())
+		})
+
+		It("compares the adopted hash while it is adopted", func() {
+			d.SetAnnotations(map[string]string{AdoptedConfigHashAnnotation: "1234"})
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "5678"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(BeEmpty())
+		})
+
+		It("compares the restarted hash of instances restarted by deleting their Pods", func() {
+			d.SetAnnotations(map[string]string{RestartStrategyAnnotation: RestartStrategyDeletePods, RestartedConfigHashAnnotation: "5678"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(Equal("1234"))
+		})
+
+		It("compares the PodTemplate of observe-only instances", func() {
+			d.SetAnnotations(map[string]string{TrackOnlyAnnotation: "true", RestartStrategyAnnotation: RestartStrategyDeletePods, RestartedConfigHashAnnotation: "1234"})
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "5678"})
+
+			Expect(h.getConfigDrift(pc, "1234")).To(Equal("1234"))
+		})
+	})
+
+	Context("when reconciling", func() {
+		const namespace = "config-drift"
+		var c client.Client
+		var opts Options
+
+		// handle reconciles the Deployment and returns it as updated
+		handle := func() *appsv1.Deployment {
+			h = NewHandler(c, record.NewFakeRecorder(100), opts)
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: d.GetName()}, updated)).To(Succeed())
+			d = updated
+			return updated
+		}
+
+		// setTemplateHash bakes the hash into the PodTemplate of the
+		// Deployment, as a CI pipeline rolling it out would
+		setTemplateHash := func(hash string) {
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: hash})
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+		}
+
+		// modifyConfigMap changes the data of a child of the Deployment
+		modifyConfigMap := func() {
+			cm := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: utils.ExampleConfigMap1.GetName()}, cm)).To(Succeed())
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			// A Deployment in its own namespace so that other tests don't
+			// affect the gauge
+			opts = Options{}
+			d.SetNamespace(namespace)
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+			objects := []runtime.Object{d}
+			for _, child := range []Object{
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			} {
+				child.SetNamespace(namespace)
+				objects = append(objects, child)
+			}
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+		})
+
+		Context("a track-only Deployment", func() {
+			var hash string
+
+			BeforeEach(func() {
+				d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue, TrackOnlyAnnotation: "true"})
+				Expect(c.Update(context.TODO(), d)).To(Succeed())
+				hash = handle().GetAnnotations()[ObservedConfigHashAnnotation]
+				Expect(hash).NotTo(BeEmpty())
+			})
+
+			It("reports no drift when the PodTemplate carries the hash", func() {
+				setTemplateHash(hash)
+				updated := handle()
+
+				Expect(updated.GetAnnotations()).NotTo(HaveKey(ConfigDriftAnnotation))
+				value, ok := getConfigDriftMetric(namespace, "Deployment")
+				Expect(ok).To(BeTrue())
+				Expect(value).To(Equal(0.0))
+			})
+
+			It("reports drift without rolling out when the PodTemplate hash has been tampered with", func() {
+				setTemplateHash("tampered")
+				updated := handle()
+
+				Expect(updated.GetAnnotations()).To(HaveKeyWithValue(ConfigDriftAnnotation, hash))
+				Expect(updated.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "tampered"))
+				value, _ := getConfigDriftMetric(namespace, "Deployment")
+				Expect(value).To(Equal(1.0))
+			})
+
+			It("reports drift when the children change", func() {
+				setTemplateHash(hash)
+				handle()
+				modifyConfigMap()
+				updated := handle()
+
+				Expect(updated.GetAnnotations()[ConfigDriftAnnotation]).To(Equal(updated.GetAnnotations()[ObservedConfigHashAnnotation]))
+				Expect(updated.GetAnnotations()[ConfigDriftAnnotation]).NotTo(Equal(hash))
+			})
+
+			It("clears the drift once the hash is baked in again", func() {
+				setTemplateHash("tampered")
+				handle()
+				setTemplateHash(hash)
+				updated := handle()
+
+				Expect(updated.GetAnnotations()).NotTo(HaveKey(ConfigDriftAnnotation))
+				value, _ := getConfigDriftMetric(namespace, "Deployment")
+				Expect(value).To(Equal(0.0))
+			})
+
+			It("removes the drift when the Deployment opts out", func() {
+				setTemplateHash("tampered")
+				handle()
+				annotations := d.GetAnnotations()
+				delete(annotations, RequiredAnnotation)
+				d.SetAnnotations(annotations)
+				Expect(c.Update(context.TODO(), d)).To(Succeed())
+				updated := handle()
+
+				Expect(updated.GetAnnotations()).NotTo(HaveKey(ConfigDriftAnnotation))
+				_, ok := getConfigDriftMetric(namespace, "Deployment")
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		It("rolls a managed Deployment back to the hash when it has been tampered with", func() {
+			hash := handle().Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			setTemplateHash("tampered")
+			updated := handle()
+
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hash))
+			Expect(updated.GetAnnotations()).NotTo(HaveKey(ConfigDriftAnnotation))
+			value, _ := getConfigDriftMetric(namespace, "Deployment")
+			Expect(value).To(Equal(0.0))
+		})
+
+		It("reports drift while the rollout of a managed Deployment is deferred", func() {
+			opts = Options{SkipPaused: true}
+			handle()
+			d.Spec.Paused = true
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+			modifyConfigMap()
+			updated := handle()
+
+			Expect(updated.GetAnnotations()).To(HaveKey(ConfigDriftAnnotation))
+			Expect(updated.GetAnnotations()[ConfigDriftAnnotation]).NotTo(Equal(updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+			value, _ := getConfigDriftMetric(namespace, "Deployment")
+			Expect(value).To(Equal(1.0))
+
+			d.Spec.Paused = false
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+			updated = handle()
+
+			Expect(updated.GetAnnotations()).NotTo(HaveKey(ConfigDriftAnnotation))
+			value, _ = getConfigDriftMetric(namespace, "Deployment")
+			Expect(value).To(Equal(0.0))
+		})
+	})
+})
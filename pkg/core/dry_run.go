@@ -0,0 +1,37 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+)
+
+// reportDryRun logs whether the instance would have been rolled out to the
+// given hash, and which of its children changed, in place of updating it.
+// The child hashes are only recorded while no rollout is pending, so that the
+// changed children are named against the configuration the instance last
+// rolled out with.
+func (h *Handler) reportDryRun(instance podController, hash string, rollout bool, childHashes map[string]string) {
+	log := h.log.WithValues("kind", kindOf(instance))
+	if !rollout {
+		h.setChildHashes(instance, childHashes)
+		log.V(0).Info("Dry run, no rollout required", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+		return
+	}
+	changed := h.getChangedChildren(instance, childHashes)
+	log.V(0).Info("Dry run, would update instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "changed", strings.Join(changed, ", "))
+}
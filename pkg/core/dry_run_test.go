@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave dry-run Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var recorder *record.FakeRecorder
+
+	// getDeployment returns the current state of the Deployment
+	var getDeployment = func() *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{DryRun: true})
+	})
+
+	It("does not modify the Deployment or its children when the configuration changes", func() {
+		original := getDeployment()
+
+		_, err := h.HandleDeployment(original)
+		Expect(err).NotTo(HaveOccurred())
+
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		_, err = h.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := getDeployment()
+		Expect(updated.GetAnnotations()).To(Equal(original.GetAnnotations()))
+		Expect(updated.Spec.Template.GetAnnotations()).To(Equal(original.Spec.Template.GetAnnotations()))
+		Expect(updated.GetFinalizers()).To(BeEmpty())
+
+		child := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, child)).To(Succeed())
+		Expect(child.GetOwnerReferences()).To(BeEmpty())
+	})
+
+	It("does not record a ConfigChanged event", func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive(ContainSubstring("ConfigChanged")))
+	})
+
+	It("names the children that changed since the configuration was last applied", func() {
+		h.opts.DryRun = false
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		h.opts.DryRun = true
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		current, err := h.getCurrentChildren(&deployment{getDeployment()})
+		Expect(err).NotTo(HaveOccurred())
+		childHashes, err := h.getChildHashes(current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.getChangedChildren(&deployment{d}, childHashes)).To(ConsistOf("ConfigMap/" + cm.GetName()))
+
+		// The changed children are still named while the rollout is pending
+		_, err = h.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.getChangedChildren(&deployment{d}, childHashes)).To(ConsistOf("ConfigMap/" + cm.GetName()))
+	})
+})
@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// dumpPageSize is the number of objects of each kind requested at a time
+// while dumping
+const dumpPageSize = 500
+
+// Dump is the JSON document written by Handler.Dump
+type Dump struct {
+	// Workloads are the workloads Wave is enabled for, with the hash
+	// currently stored on each of them
+	Workloads []DumpWorkload `json:"workloads"`
+
+	// Edges link each ConfigMap and Secret to the workloads owning it
+	Edges []DumpEdge `json:"edges"`
+}
+
+// DumpObject identifies an object in a Dump
+type DumpObject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// DumpWorkload is a workload in a Dump
+type DumpWorkload struct {
+	DumpObject
+	Hash string `json:"hash,omitempty"`
+}
+
+// DumpEdge links a child to a workload owning it in a Dump
+type DumpEdge struct {
+	Child DumpObject `json:"child"`
+	Owner DumpObject `json:"owner"`
+}
+
+// Dump writes a snapshot of everything Wave tracks as a JSON Dump: each
+// workload Wave is enabled for with its stored hash, and an edge from each
+// ConfigMap and Secret to each workload owning it. A child is owned by a
+// workload if it carries both the workload's OwnerReference and its owned-by
+// label, as for the children Wave cleans up.
+//
+// Objects are listed a page at a time across all namespaces and written as
+// they are listed, so that large clusters are never held in memory at once.
+// Nothing is updated, so Dump can be run against any cluster the Handler's
+// client can read.
+func (h *Handler) Dump(w io.Writer) error {
+	_, err := io.WriteString(w, `{"workloads":[`)
+	if err != nil {
+		return err
+	}
+	first := true
+	for _, list := range h.getWorkloadLists() {
+		err := h.listPages(list, func(page runtime.Object) error {
+			for _, instance := range podControllersFromList(page) {
+				if h.isExcludedNamespace(instance.GetNamespace()) || !h.isEnabled(instance) {
+					continue
+				}
+				workload := DumpWorkload{DumpObject: dumpObjectOf(instance), Hash: h.getStoredHash(instance)}
+				err := writeJSONElement(w, &first, workload)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error dumping workloads: %v", err)
+		}
+	}
+
+	_, err = io.WriteString(w, `],"edges":[`)
+	if err != nil {
+		return err
+	}
+	first = true
+	for _, list := range []runtime.Object{&corev1.ConfigMapList{}, &corev1.SecretList{}} {
+		err := h.listPages(list, func(page runtime.Object) error {
+			items, err := meta.ExtractList(page)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				child, ok := item.(Object)
+				if !ok || h.isExcludedNamespace(child.GetNamespace()) {
+					continue
+				}
+				for _, ref := range dedupeOwnerReferences(child.GetOwnerReferences()) {
+					if !hasOwnedByLabel(child, &metav1.ObjectMeta{UID: ref.UID}) {
+						continue
+					}
+					edge := DumpEdge{
+						Child: dumpObjectOf(child),
+						Owner: DumpObject{Kind: ref.Kind, Namespace: child.GetNamespace(), Name: ref.Name},
+					}
+					err := writeJSONElement(w, &first, edge)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error dumping children: %v", err)
+		}
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// dumpObjectOf returns the DumpObject identifying the given object
+func dumpObjectOf(obj Object) DumpObject {
+	return DumpObject{Kind: kindOf(obj), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// writeJSONElement writes the JSON encoding of v as an element of a JSON
+// array, preceded by a comma unless it is the first element
+func writeJSONElement(w io.Writer, first *bool, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !*first {
+		data = append([]byte(","), data...)
+	}
+	*first = false
+	_, err = w.Write(data)
+	return err
+}
+
+// listPages lists the objects of the given list type across all namespaces a
+// page at a time, calling fn with each page. Clients that do not paginate,
+// such as caches, return every object in a single page.
+func (h *Handler) listPages(list runtime.Object, fn func(runtime.Object) error) error {
+	continueToken := ""
+	for {
+		page := list.DeepCopyObject()
+		err := h.List(context.TODO(), page, &client.ListOptions{Raw: &metav1.ListOptions{Limit: dumpPageSize, Continue: continueToken}})
+		if err != nil {
+			return err
+		}
+		err = fn(page)
+		if err != nil {
+			return err
+		}
+		accessor, err := meta.ListAccessor(page)
+		if err != nil {
+			return err
+		}
+		continueToken = accessor.GetContinue()
+		if continueToken == "" {
+			return nil
+		}
+	}
+}
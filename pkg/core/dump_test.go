@@ -0,0 +1,209 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// pagingClient returns lists one item at a time, honouring the limit and
+// continue token of each request as the API server does
+type pagingClient struct {
+	client.Client
+	pages int
+}
+
+func (c *pagingClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	err := c.Client.List(ctx, list, opts...)
+	if err != nil {
+		return err
+	}
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.Raw == nil || listOpts.Raw.Limit == 0 {
+		return nil
+	}
+	c.pages++
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	if listOpts.Raw.Continue != "" {
+		offset, err = strconv.Atoi(listOpts.Raw.Continue)
+		if err != nil {
+			return err
+		}
+	}
+	end := offset + 1
+	if end > len(items) {
+		end = len(items)
+	}
+	err = meta.SetList(list, items[offset:end])
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.ListAccessor(list)
+	if err != nil {
+		return err
+	}
+	if end < len(items) {
+		accessor.SetContinue(strconv.Itoa(end))
+	}
+	return nil
+}
+
+var _ = Describe("Wave dump Suite", func() {
+	var c client.Client
+	var a, b *appsv1.Deployment
+
+	// inNamespace returns a copy of each object in the given namespace
+	inNamespace := func(namespace string, objs ...Object) []runtime.Object {
+		copies := []runtime.Object{}
+		for _, obj := range objs {
+			copy := obj.DeepCopyObject().(Object)
+			copy.SetNamespace(namespace)
+			copies = append(copies, copy)
+		}
+		return copies
+	}
+
+	// dump returns the Dump written by a Handler reading through the client
+	dump := func(c client.Client) (Dump, string) {
+		out := &bytes.Buffer{}
+		Expect(NewHandler(c, record.NewFakeRecorder(100), Options{}).Dump(out)).To(Succeed())
+		result := Dump{}
+		Expect(json.Unmarshal(out.Bytes(), &result)).To(Succeed())
+		return result, out.String()
+	}
+
+	// edge returns the DumpEdge from the child to the Deployment
+	edge := func(kind, name string, owner *appsv1.Deployment) DumpEdge {
+		return DumpEdge{
+			Child: DumpObject{Kind: kind, Namespace: owner.GetNamespace(), Name: name},
+			Owner: DumpObject{Kind: "Deployment", Namespace: owner.GetNamespace(), Name: owner.GetName()},
+		}
+	}
+
+	// getHash returns the hash stored on the Deployment
+	getHash := func(d *appsv1.Deployment) string {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		return fetched.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+	}
+
+	BeforeEach(func() {
+		a = utils.ExampleDeployment.DeepCopy()
+		a.SetUID(types.UID("a"))
+		a.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		b = a.DeepCopy()
+		b.SetNamespace("other")
+		b.SetUID(types.UID("b"))
+		disabled := utils.ExampleDeployment.DeepCopy()
+		disabled.SetName("disabled")
+		disabled.SetUID(types.UID("disabled"))
+
+		// A ConfigMap owned by another controller is not tracked by Wave
+		foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:            "foreign",
+			Namespace:       a.GetNamespace(),
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Deployment", Name: a.GetName(), UID: a.GetUID()}},
+		}}
+
+		children := []Object{
+			utils.ExampleConfigMap1, utils.ExampleConfigMap2, utils.ExampleConfigMap3,
+			utils.ExampleSecret1, utils.ExampleSecret2, utils.ExampleSecret3,
+		}
+		objects := []runtime.Object{a, b, disabled, foreign}
+		objects = append(objects, inNamespace(a.GetNamespace(), children...)...)
+		objects = append(objects, inNamespace(b.GetNamespace(), children...)...)
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+		for _, d := range []*appsv1.Deployment{a, b} {
+			_, err := h.HandleDeployment(d.DeepCopy())
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("contains the enabled workloads of every namespace with their hashes", func() {
+		result, _ := dump(c)
+		Expect(result.Workloads).To(ConsistOf(
+			DumpWorkload{DumpObject: DumpObject{Kind: "Deployment", Namespace: a.GetNamespace(), Name: a.GetName()}, Hash: getHash(a)},
+			DumpWorkload{DumpObject: DumpObject{Kind: "Deployment", Namespace: b.GetNamespace(), Name: b.GetName()}, Hash: getHash(b)},
+		))
+		Expect(getHash(a)).NotTo(BeEmpty())
+	})
+
+	It("contains an edge from each owned child to its owner", func() {
+		result, _ := dump(c)
+		expected := []DumpEdge{}
+		for _, d := range []*appsv1.Deployment{a, b} {
+			for _, name := range []string{"example1", "example2", "example3"} {
+				expected = append(expected, edge("ConfigMap", name, d), edge("Secret", name, d))
+			}
+		}
+		Expect(result.Edges).To(ConsistOf(expected))
+	})
+
+	It("only contains edges to the workloads still owning a child", func() {
+		deleted := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: b.GetNamespace(), Name: b.GetName()}, deleted)).To(Succeed())
+		now := metav1.Now()
+		deleted.SetDeletionTimestamp(&now)
+		_, err := NewHandler(c, record.NewFakeRecorder(100), Options{}).HandleDeployment(deleted)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, _ := dump(c)
+		for _, e := range result.Edges {
+			Expect(e.Owner.Namespace).To(Equal(a.GetNamespace()))
+		}
+		Expect(result.Edges).To(HaveLen(6))
+	})
+
+	It("writes the same dump a page at a time", func() {
+		_, expected := dump(c)
+		paging := &pagingClient{Client: c}
+		_, paged := dump(paging)
+		Expect(paged).To(Equal(expected))
+		Expect(paging.pages).To(BeNumerically(">", 7))
+	})
+
+	It("never updates the cluster", func() {
+		counting := &childUpdateClient{Client: c}
+		dump(counting)
+		Expect(counting.updates).To(BeZero())
+	})
+})
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// externalDigestRef identifies a field of an object, managed by another
+// operator, that holds a digest of the workload's configuration
+type externalDigestRef struct {
+	groupKind schema.GroupKind
+	name      string
+	path      []string
+}
+
+// String returns the reference in the form used by the ExternalDigestAnnotation
+func (r externalDigestRef) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", r.groupKind.Group, r.groupKind.Kind, r.name, strings.Join(r.path, "."))
+}
+
+// getExternalDigestRefs parses the ExternalDigestAnnotation of the given
+// podController. Entries are separated by `,` and take the form
+// `<group>/<kind>/<name>/<field path>`, where the group is empty for the
+// core API group and the field path is a dot separated path such as
+// `status.digest`.
+func getExternalDigestRefs(obj podController) ([]externalDigestRef, error) {
+	annotation := obj.GetAnnotations()[ExternalDigestAnnotation]
+	if annotation == "" {
+		return nil, nil
+	}
+
+	var refs []externalDigestRef
+	for _, entry := range strings.Split(annotation, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "/", 4)
+		if len(parts) != 4 || parts[1] == "" || parts[2] == "" || strings.Trim(parts[3], ".") == "" {
+			return nil, fmt.Errorf("invalid external digest reference %q", entry)
+		}
+		refs = append(refs, externalDigestRef{
+			groupKind: schema.GroupKind{Group: parts[0], Kind: parts[1]},
+			name:      parts[2],
+			path:      strings.Split(strings.Trim(parts[3], "."), "."),
+		})
+	}
+	return refs, nil
+}
+
+// addExternalDigests folds the digests referenced by the podController into
+// the configuration hash, so that a change to any of them changes the hash.
+// The hash is returned unchanged if no digests are referenced.
+//
+// A digest that cannot be read is recorded as a Warning event and returned
+// as an error.
+func (h *Handler) addExternalDigests(obj podController, hash string) (string, error) {
+	refs, err := getExternalDigestRefs(obj)
+	if err != nil {
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "ExternalDigestInvalid", "%v", err)
+		return "", err
+	}
+	if len(refs) == 0 {
+		return hash, nil
+	}
+
+	digests := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		digest, err := h.getExternalDigest(obj.GetNamespace(), ref)
+		if err != nil {
+			h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "ExternalDigestMissing", "Unable to read external digest %s: %v", ref, err)
+			return "", fmt.Errorf("error reading external digest %s: %v", ref, err)
+		}
+		digests = append(digests, ref.String()+"="+digest)
+	}
+	sort.Strings(digests)
+
+	combined := sha256.New()
+	fmt.Fprintf(combined, "%s\n", hash)
+	for _, digest := range digests {
+		fmt.Fprintf(combined, "%s\n", digest)
+	}
+	return fmt.Sprintf("%x", combined.Sum(nil)), nil
+}
+
+// getExternalDigest reads the referenced field of the referenced object,
+// which is looked up in the given namespace unless it is cluster scoped
+func (h *Handler) getExternalDigest(namespace string, ref externalDigestRef) (string, error) {
+	if h.opts.RESTMapper == nil {
+		return "", fmt.Errorf("no RESTMapper configured")
+	}
+	mapping, err := h.opts.RESTMapper.RESTMapping(ref.groupKind)
+	if err != nil {
+		return "", fmt.Errorf("error looking up kind %s: %v", ref.groupKind.String(), err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = ""
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(mapping.GroupVersionKind)
+	err = h.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: ref.name}, obj)
+	if err != nil {
+		return "", err
+	}
+
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, ref.path...)
+	if err != nil {
+		return "", err
+	}
+	if !found || value == nil {
+		return "", fmt.Errorf("field %s not found", strings.Join(ref.path, "."))
+	}
+	return fmt.Sprintf("%v", value), nil
+}
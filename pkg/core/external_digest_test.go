@@ -0,0 +1,196 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// myConfigGVK is the kind of the custom resource holding external digests
+var myConfigGVK = schema.GroupVersionKind{Group: "mygroup", Version: "v1", Kind: "MyConfig"}
+
+// customResourceClient serves unstructured custom resources, which the fake
+// client cannot decode, from memory
+type customResourceClient struct {
+	client.Client
+	objects map[client.ObjectKey]*unstructured.Unstructured
+}
+
+func (c *customResourceClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return c.Client.Get(ctx, key, obj)
+	}
+	stored, ok := c.objects[key]
+	if !ok || stored.GroupVersionKind() != u.GroupVersionKind() {
+		return errors.NewNotFound(schema.GroupResource{Group: u.GroupVersionKind().Group, Resource: u.GetKind()}, key.Name)
+	}
+	stored.DeepCopyInto(u)
+	return nil
+}
+
+func (c *customResourceClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	ul, ok := list.(*unstructured.UnstructuredList)
+	if !ok {
+		return c.Client.List(ctx, list, opts...)
+	}
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	kind := strings.TrimSuffix(ul.GetKind(), "List")
+	ul.Items = nil
+	for key, stored := range c.objects {
+		if stored.GetKind() != kind || stored.GroupVersionKind().Group != ul.GroupVersionKind().Group {
+			continue
+		}
+		if listOpts.Namespace != "" && key.Namespace != listOpts.Namespace {
+			continue
+		}
+		ul.Items = append(ul.Items, *stored.DeepCopy())
+	}
+	return nil
+}
+
+func (c *customResourceClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return c.Client.Update(ctx, obj, opts...)
+	}
+	key := client.ObjectKey{Namespace: u.GetNamespace(), Name: u.GetName()}
+	if _, ok := c.objects[key]; !ok {
+		return errors.NewNotFound(schema.GroupResource{Group: u.GroupVersionKind().Group, Resource: u.GetKind()}, key.Name)
+	}
+	c.objects[key] = u.DeepCopy()
+	return nil
+}
+
+var _ = Describe("Wave external digest Suite", func() {
+	var c *customResourceClient
+	var h *Handler
+	var d *appsv1.Deployment
+	var recorder *record.FakeRecorder
+
+	// setDigest stores a MyConfig with the given status digest
+	var setDigest = func(digest string) {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(myConfigGVK)
+		u.SetNamespace(d.GetNamespace())
+		u.SetName("app")
+		Expect(unstructured.SetNestedField(u.Object, digest, "status", "digest")).To(Succeed())
+		c.objects[client.ObjectKey{Namespace: d.GetNamespace(), Name: "app"}] = u
+	}
+
+	// reconcileHash handles the Deployment and returns the resulting config
+	// hash
+	var reconcileHash = func() (string, error) {
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		_, err := h.HandleDeployment(d)
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation], err
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:       requiredAnnotationValue,
+			ExternalDigestAnnotation: "mygroup/MyConfig/app/status.digest",
+		})
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{myConfigGVK.GroupVersion()})
+		mapper.Add(myConfigGVK, meta.RESTScopeNamespace)
+
+		c = &customResourceClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			),
+			objects: make(map[client.ObjectKey]*unstructured.Unstructured),
+		}
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{RESTMapper: mapper})
+	})
+
+	Context("getExternalDigestRefs", func() {
+		It("parses each reference", func() {
+			d.SetAnnotations(map[string]string{ExternalDigestAnnotation: "mygroup/MyConfig/app/status.digest, /ConfigMap/bundle/.metadata.uid"})
+			refs, err := getExternalDigestRefs(&deployment{d})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refs).To(Equal([]externalDigestRef{
+				{groupKind: schema.GroupKind{Group: "mygroup", Kind: "MyConfig"}, name: "app", path: []string{"status", "digest"}},
+				{groupKind: schema.GroupKind{Kind: "ConfigMap"}, name: "bundle", path: []string{"metadata", "uid"}},
+			}))
+		})
+
+		It("returns an error for an invalid reference", func() {
+			d.SetAnnotations(map[string]string{ExternalDigestAnnotation: "mygroup/MyConfig/app"})
+			_, err := getExternalDigestRefs(&deployment{d})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("updates the config hash when the status digest changes", func() {
+		setDigest("sha256:1")
+		original, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(original).NotTo(BeEmpty())
+
+		Expect(reconcileHash()).To(Equal(original))
+
+		setDigest("sha256:2")
+		Expect(reconcileHash()).NotTo(Equal(original))
+	})
+
+	It("does not change the config hash of workloads without external digests", func() {
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		withoutDigest, err := h.addExternalDigests(&deployment{d}, "hash")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(withoutDigest).To(Equal("hash"))
+	})
+
+	It("records a Warning event when the object is missing", func() {
+		_, err := reconcileHash()
+		Expect(err).To(HaveOccurred())
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		Expect(events).To(ContainElement(ContainSubstring("ExternalDigestMissing")))
+	})
+
+	It("returns an error when the field is missing", func() {
+		setDigest("sha256:1")
+		unstructured.RemoveNestedField(c.objects[client.ObjectKey{Namespace: d.GetNamespace(), Name: "app"}].Object, "status")
+		_, err := reconcileHash()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("field status.digest not found"))
+	})
+})
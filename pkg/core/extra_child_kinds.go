@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ChildExtractor finds the children of a kind other than ConfigMap or Secret
+// that a PodTemplate references, and extracts the configuration of each child
+// that is hashed
+type ChildExtractor interface {
+	// GetReferences returns the names of the children of the extractor's kind
+	// referenced by the volumes or environment of the PodTemplate
+	GetReferences(template *corev1.PodTemplateSpec) []string
+
+	// GetData returns the configuration held by the child
+	GetData(child *unstructured.Unstructured) (map[string]string, error)
+}
+
+// DataExtractor is the ChildExtractor of kinds that hold their configuration
+// in a `data` map, as ConfigMaps do.
+// A child is referenced by a CSI volume whose attributes name it under the
+// kind with a lower case first letter, such as `secretProviderClass` for a
+// SecretProviderClass.
+type DataExtractor struct {
+	Kind string
+}
+
+// GetReferences returns the names of the children referenced by the CSI
+// volumes of the PodTemplate
+func (e DataExtractor) GetReferences(template *corev1.PodTemplateSpec) []string {
+	if e.Kind == "" {
+		return nil
+	}
+	attribute := strings.ToLower(e.Kind[:1]) + e.Kind[1:]
+
+	var names []string
+	for _, vol := range template.Spec.Volumes {
+		if vol.CSI == nil {
+			continue
+		}
+		if name := vol.CSI.VolumeAttributes[attribute]; name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetData returns the `data` map of the child, with values that are not
+// strings encoded as JSON
+func (e DataExtractor) GetData(child *unstructured.Unstructured) (map[string]string, error) {
+	raw, _, err := unstructured.NestedMap(child.Object, "data")
+	if err != nil {
+		return nil, fmt.Errorf("error reading data of %s %s: %v", child.GetKind(), child.GetName(), err)
+	}
+
+	data := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if s, ok := value.(string); ok {
+			data[key] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding key %s of %s %s: %v", key, child.GetKind(), child.GetName(), err)
+		}
+		data[key] = string(encoded)
+	}
+	return data, nil
+}
+
+// ParseExtraChildGVKs parses extra child kinds, each given in the form
+// `<group>/<version>/<kind>`, into the Options.ExtraChildKinds tracking each
+// of them with a DataExtractor
+func ParseExtraChildGVKs(values []string) (map[schema.GroupVersionKind]ChildExtractor, error) {
+	kinds := make(map[schema.GroupVersionKind]ChildExtractor)
+	for _, value := range values {
+		parts := strings.Split(strings.TrimSpace(value), "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid extra child kind %q", value)
+		}
+		gvk := schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+		kinds[gvk] = DataExtractor{Kind: gvk.Kind}
+	}
+	return kinds, nil
+}
+
+// ExtraChildObjects returns an empty object of each extra child kind in the
+// options, sorted by kind, for the controllers to watch
+func ExtraChildObjects(opts Options) []runtime.Object {
+	gvks := getExtraChildGVKs(opts)
+	objects := make([]runtime.Object, 0, len(gvks))
+	for _, gvk := range gvks {
+		objects = append(objects, newUnstructured(gvk))
+	}
+	return objects
+}
+
+// getExtraChildGVKs returns the extra child kinds in the options, sorted so
+// that they are always looked up in the same order
+func getExtraChildGVKs(opts Options) []schema.GroupVersionKind {
+	gvks := make([]schema.GroupVersionKind, 0, len(opts.ExtraChildKinds))
+	for gvk := range opts.ExtraChildKinds {
+		gvks = append(gvks, gvk)
+	}
+	sort.Slice(gvks, func(i, j int) bool {
+		return gvks[i].String() < gvks[j].String()
+	})
+	return gvks
+}
+
+// newUnstructured returns an empty object of the given kind
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
+
+// getExtraKindChildNames returns the names of the children of each extra
+// child kind referenced by the PodTemplate of the podController
+func (h *Handler) getExtraKindChildNames(obj podController) map[schema.GroupVersionKind]map[string]configMetadata {
+	names := make(map[schema.GroupVersionKind]map[string]configMetadata)
+	for gvk, extractor := range h.opts.ExtraChildKinds {
+		for _, name := range extractor.GetReferences(obj.GetPodTemplate()) {
+			if names[gvk] == nil {
+				names[gvk] = make(map[string]configMetadata)
+			}
+			names[gvk][name] = configMetadata{required: true, allKeys: true}
+		}
+	}
+	return names
+}
+
+// getExtraKindData extracts the configuration of a child of an extra child
+// kind with the extractor of its kind
+func (h *Handler) getExtraKindData(child *unstructured.Unstructured) (map[string]string, error) {
+	extractor, ok := h.opts.ExtraChildKinds[child.GroupVersionKind()]
+	if !ok {
+		return nil, fmt.Errorf("no extractor for kind %s", child.GroupVersionKind().String())
+	}
+	return extractor.GetData(child)
+}
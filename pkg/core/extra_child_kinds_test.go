@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// myConfigDriver is the CSI driver through which Pods mount MyConfigs
+const myConfigDriver = "myconfig.mygroup"
+
+// myConfigExtractor finds the MyConfigs mounted through the CSI driver and
+// hashes their settings
+type myConfigExtractor struct{}
+
+func (myConfigExtractor) GetReferences(template *corev1.PodTemplateSpec) []string {
+	var names []string
+	for _, vol := range template.Spec.Volumes {
+		if vol.CSI != nil && vol.CSI.Driver == myConfigDriver {
+			names = append(names, vol.CSI.VolumeAttributes["name"])
+		}
+	}
+	return names
+}
+
+func (myConfigExtractor) GetData(child *unstructured.Unstructured) (map[string]string, error) {
+	settings, _, err := unstructured.NestedStringMap(child.Object, "spec", "settings")
+	return settings, err
+}
+
+var _ = Describe("Wave extra child kinds Suite", func() {
+	var c *customResourceClient
+	var h *Handler
+	var d *appsv1.Deployment
+	var key client.ObjectKey
+
+	// setSettings stores the MyConfig mounted by the Deployment with the given
+	// settings
+	setSettings := func(settings map[string]string) {
+		u := newUnstructured(myConfigGVK)
+		u.SetNamespace(d.GetNamespace())
+		u.SetName("app")
+		u.SetUID(types.UID("app"))
+		Expect(unstructured.SetNestedStringMap(u.Object, settings, "spec", "settings")).To(Succeed())
+		if stored, ok := c.objects[key]; ok {
+			u.SetOwnerReferences(stored.GetOwnerReferences())
+		}
+		c.objects[key] = u
+	}
+
+	// reconcileHash handles the Deployment and returns the resulting config
+	// hash
+	reconcileHash := func() (string, error) {
+		_, err := h.HandleDeployment(d)
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation], err
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "myconfig",
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{
+					Driver:           myConfigDriver,
+					VolumeAttributes: map[string]string{"name": "app"},
+				},
+			},
+		})
+		key = client.ObjectKey{Namespace: d.GetNamespace(), Name: "app"}
+
+		c = &customResourceClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			),
+			objects: make(map[client.ObjectKey]*unstructured.Unstructured),
+		}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{
+			ExtraChildKinds: map[schema.GroupVersionKind]ChildExtractor{myConfigGVK: myConfigExtractor{}},
+		})
+	})
+
+	It("hashes the data extracted from children of extra kinds", func() {
+		setSettings(map[string]string{"level": "info"})
+		original, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(original).NotTo(BeEmpty())
+
+		setSettings(map[string]string{"level": "debug"})
+		changed, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).NotTo(Equal(original))
+
+		setSettings(map[string]string{"level": "info"})
+		Expect(reconcileHash()).To(Equal(original))
+	})
+
+	It("hashes extra children in incremental hashing mode", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{
+			MerkleHash:      true,
+			ExtraChildKinds: map[schema.GroupVersionKind]ChildExtractor{myConfigGVK: myConfigExtractor{}},
+		})
+		setSettings(map[string]string{"level": "info"})
+		original, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+
+		setSettings(map[string]string{"level": "debug"})
+		Expect(reconcileHash()).NotTo(Equal(original))
+	})
+
+	It("adds an OwnerReference to children of extra kinds", func() {
+		setSettings(map[string]string{"level": "info"})
+		_, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.objects[key].GetOwnerReferences()).To(Equal([]metav1.OwnerReference{getOwnerReference(&deployment{d})}))
+	})
+
+	It("removes the OwnerReference once the child is no longer referenced", func() {
+		setSettings(map[string]string{"level": "info"})
+		_, err := reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.objects[key].GetOwnerReferences()).To(HaveLen(1))
+
+		volumes := d.Spec.Template.Spec.Volumes
+		d.Spec.Template.Spec.Volumes = volumes[:len(volumes)-1]
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		_, err = reconcileHash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.objects[key].GetOwnerReferences()).To(BeEmpty())
+	})
+
+	It("returns an error when a referenced child of an extra kind is missing", func() {
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(BeAssignableToTypeOf(&missingChildError{}))
+		Expect(err.(*missingChildError).missing).To(Equal([]string{"MyConfig/app"}))
+	})
+
+	It("does not track kinds that are not configured", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		for _, child := range children {
+			Expect(child.object).NotTo(BeAssignableToTypeOf(&unstructured.Unstructured{}))
+		}
+	})
+
+	Context("DataExtractor", func() {
+		extractor := DataExtractor{Kind: "SecretProviderClass"}
+
+		It("finds the children named by the attributes of CSI volumes", func() {
+			template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+				{Name: "secrets", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+					Driver:           "secrets-store.csi.k8s.io",
+					VolumeAttributes: map[string]string{"secretProviderClass": "vault"},
+				}}},
+				{Name: "other", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "other"}}},
+				{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+			}}}
+			Expect(extractor.GetReferences(template)).To(Equal([]string{"vault"}))
+		})
+
+		It("extracts the data map, encoding values that are not strings", func() {
+			u := &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"name": "app", "replicas": int64(3)},
+			}}
+			Expect(extractor.GetData(u)).To(Equal(map[string]string{"name": "app", "replicas": "3"}))
+		})
+	})
+
+	Context("ParseExtraChildGVKs", func() {
+		It("parses each kind with a DataExtractor", func() {
+			kinds, err := ParseExtraChildGVKs([]string{"mygroup/v1/MyConfig"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kinds).To(Equal(map[schema.GroupVersionKind]ChildExtractor{myConfigGVK: DataExtractor{Kind: "MyConfig"}}))
+		})
+
+		It("rejects kinds without a group, version and kind", func() {
+			_, err := ParseExtraChildGVKs([]string{"v1/MyConfig"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
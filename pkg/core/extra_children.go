@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addExtraChildren adds the ConfigMaps and Secrets listed in the extra
+// children annotations of the given podController to those referenced by the
+// podController. Extra children are always required and hashed in full.
+//
+// Each annotation holds a comma separated list of names, optionally in the
+// form `<namespace>/<name>`. Children must be in the namespace of the
+// podController or the given shared config namespace, if it is not empty;
+// references to any other namespace are rejected so that a workload cannot
+// take ownership of, or observe, children it could not mount.
+// Children in the shared config namespace are added under their
+// `<namespace>/<name>` key, which no name can clash with.
+//
+// Invalid references are skipped and the first of them is returned as an
+// error once the other children have been added.
+func addExtraChildren(obj podController, shared string, configMaps, secrets map[string]configMetadata) error {
+	var errs []error
+	for _, extra := range []struct {
+		annotation string
+		children   map[string]configMetadata
+	}{
+		{ExtraConfigMapsAnnotation, configMaps},
+		{ExtraSecretsAnnotation, secrets},
+		{WatchSecretsAnnotation, secrets},
+	} {
+		names, err := getExtraChildren(obj, extra.annotation, shared)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, name := range names {
+			extra.children[name] = addBundleMember(extra.children[name])
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// getExtraChildren returns the keys of the children listed in the given
+// extra children annotation of the podController, along with an error for the
+// first invalid reference
+func getExtraChildren(obj podController, annotation, shared string) ([]string, error) {
+	var names []string
+	var invalid error
+	for _, ref := range strings.Split(obj.GetAnnotations()[annotation], ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		name, err := parseExtraChild(obj, ref, annotation, shared)
+		if err != nil {
+			if invalid == nil {
+				invalid = err
+			}
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, invalid
+}
+
+// parseExtraChild returns the key of the child referenced by an entry of the
+// given extra children annotation of the podController
+func parseExtraChild(obj podController, ref, annotation, shared string) (string, error) {
+	name := ref
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		switch {
+		case parts[0] == obj.GetNamespace():
+			name = parts[1]
+		case shared != "" && parts[0] == shared:
+			name = parts[1]
+			if name != "" && !strings.Contains(name, "/") {
+				return sharedChildKey(shared, name), nil
+			}
+		case shared != "":
+			return "", fmt.Errorf("invalid reference %q in %s: children must be in namespace %s or the shared config namespace %s", ref, annotation, obj.GetNamespace(), shared)
+		default:
+			return "", fmt.Errorf("invalid reference %q in %s: children must be in namespace %s", ref, annotation, obj.GetNamespace())
+		}
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid reference %q in %s", ref, annotation)
+	}
+	return name, nil
+}
+
+// removeExcludedChildren removes the ConfigMaps and Secrets listed in the
+// exclude children annotation of the given podController from those
+// referenced by the podController, however they are referenced.
+//
+// The annotation holds a comma separated list of children in the form
+// `configmap/<name>` or `secret/<name>`, where `cm` may be used in place of
+// `configmap`.
+func removeExcludedChildren(obj podController, configMaps, secrets map[string]configMetadata) error {
+	for _, ref := range strings.Split(obj.GetAnnotations()[ExcludeChildrenAnnotation], ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		parts := strings.SplitN(ref, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("invalid reference %q in %s", ref, ExcludeChildrenAnnotation)
+		}
+		switch strings.ToLower(parts[0]) {
+		case "configmap", "cm":
+			delete(configMaps, parts[1])
+		case "secret":
+			delete(secrets, parts[1])
+		default:
+			return fmt.Errorf("invalid reference %q in %s", ref, ExcludeChildrenAnnotation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave extra children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var extra *corev1.ConfigMap
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			ExtraConfigMapsAnnotation: "runtime-config",
+			ExtraSecretsAnnotation:    d.GetNamespace() + "/example2",
+		})
+
+		extra = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: d.GetNamespace(), Name: "runtime-config"},
+			Data:       map[string]string{"feature-flags": "original"},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, extra,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("adds the listed children to the workload's children", func() {
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(configMaps).NotTo(HaveKey("runtime-config"))
+
+		Expect(addExtraChildren(&deployment{d}, "", configMaps, secrets)).To(Succeed())
+		Expect(configMaps).To(HaveKeyWithValue("runtime-config", configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKeyWithValue("example2", configMetadata{required: true, allKeys: true}))
+	})
+
+	It("rolls the workload when an extra child changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		extra.Data["feature-flags"] = "modified"
+		Expect(c.Update(context.TODO(), extra)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("takes ownership of extra children", func() {
+		reconcileHash(c, h, d)
+
+		child := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: extra.GetNamespace(), Name: extra.GetName()}, child)).To(Succeed())
+		Expect(child.GetOwnerReferences()).To(ContainElement(utils.GetOwnerRefDeployment(d)))
+	})
+
+	Context("when a Secret is only listed in the watch-secrets annotation", func() {
+		var watched *corev1.Secret
+
+		BeforeEach(func() {
+			watched = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: d.GetNamespace(), Name: "db-creds"},
+				Data:       map[string][]byte{"password": []byte("original")},
+			}
+			Expect(c.Create(context.TODO(), watched)).To(Succeed())
+
+			d.GetAnnotations()[WatchSecretsAnnotation] = "db-creds"
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+		})
+
+		It("rolls the workload when the Secret changes", func() {
+			original := reconcileHash(c, h, d)
+			Expect(original).NotTo(BeEmpty())
+
+			updated := &corev1.Secret{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: watched.GetNamespace(), Name: watched.GetName()}, updated)).To(Succeed())
+			updated.Data["password"] = []byte("modified")
+			Expect(c.Update(context.TODO(), updated)).To(Succeed())
+
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("takes ownership of the Secret", func() {
+			reconcileHash(c, h, d)
+
+			child := &corev1.Secret{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: watched.GetNamespace(), Name: watched.GetName()}, child)).To(Succeed())
+			Expect(child.GetOwnerReferences()).To(ContainElement(utils.GetOwnerRefDeployment(d)))
+		})
+	})
+
+	It("rejects references to other namespaces", func() {
+		d.GetAnnotations()[ExtraConfigMapsAnnotation] = "kube-system/runtime-config"
+		configMaps, secrets := getChildNamesByType(&deployment{d})
+		Expect(addExtraChildren(&deployment{d}, "", configMaps, secrets)).NotTo(Succeed())
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("includes extra children in the child index", func() {
+		Expect(getChildIndexValues(d)).To(ContainElement("ConfigMap/runtime-config"))
+	})
+})
+
+var _ = Describe("Wave exclude children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var a, b *appsv1.Deployment
+	var shared *corev1.ConfigMap
+
+	BeforeEach(func() {
+		shared = utils.ExampleConfigMap1.DeepCopy()
+
+		a = utils.ExampleDeployment.DeepCopy()
+		a.SetName("a")
+		a.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		b = utils.ExampleDeployment.DeepCopy()
+		b.SetName("b")
+		b.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			ExcludeChildrenAnnotation: "cm/" + shared.GetName(),
+		})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, a, b, shared,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("only rolls the Deployment that does not exclude a changed child", func() {
+		originalA := reconcileHash(c, h, a)
+		originalB := reconcileHash(c, h, b)
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, shared)).To(Succeed())
+		shared.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), shared)).To(Succeed())
+
+		Expect(reconcileHash(c, h, a)).NotTo(Equal(originalA))
+		Expect(reconcileHash(c, h, b)).To(Equal(originalB))
+	})
+
+	It("does not take ownership of an excluded child", func() {
+		reconcileHash(c, h, a)
+		reconcileHash(c, h, b)
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: shared.GetNamespace(), Name: shared.GetName()}, shared)).To(Succeed())
+		Expect(shared.GetOwnerReferences()).To(HaveLen(1))
+		Expect(shared.GetOwnerReferences()[0].Name).To(Equal(a.GetName()))
+	})
+
+	It("excludes Secrets", func() {
+		b.Annotations[ExcludeChildrenAnnotation] = "secret/" + utils.ExampleSecret1.GetName()
+		configMaps, secrets := getChildNamesByType(&deployment{b})
+		Expect(removeExcludedChildren(&deployment{b}, configMaps, secrets)).To(Succeed())
+		Expect(secrets).NotTo(HaveKey(utils.ExampleSecret1.GetName()))
+		Expect(configMaps).To(HaveKey(shared.GetName()))
+	})
+
+	It("rejects invalid references", func() {
+		for _, value := range []string{shared.GetName(), "pod/example", "configmap/"} {
+			b.Annotations[ExcludeChildrenAnnotation] = value
+			Expect(removeExcludedChildren(&deployment{b}, map[string]configMetadata{}, map[string]configMetadata{})).NotTo(Succeed())
+		}
+	})
+})
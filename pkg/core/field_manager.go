@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultFieldManager is the field manager that Wave's writes are attributed
+// to when none is configured
+const DefaultFieldManager = "wave"
+
+// fieldManagerClient wraps a client.Client and attributes every write made by
+// the Handler to the configured field manager
+type fieldManagerClient struct {
+	client.Client
+	fieldManager string
+}
+
+// newFieldManagerClient wraps the client so that writes are attributed to the
+// given field manager, or to DefaultFieldManager if it is empty
+func newFieldManagerClient(c client.Client, fieldManager string) *fieldManagerClient {
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	return &fieldManagerClient{Client: c, fieldManager: fieldManager}
+}
+
+// Create wraps client.Client.Create
+func (c *fieldManagerClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return c.Client.Create(ctx, obj, append([]client.CreateOption{client.FieldOwner(c.fieldManager)}, opts...)...)
+}
+
+// Update wraps client.Client.Update
+func (c *fieldManagerClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.Client.Update(ctx, obj, append([]client.UpdateOption{client.FieldOwner(c.fieldManager)}, opts...)...)
+}
+
+// Patch wraps client.Client.Patch
+func (c *fieldManagerClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.Client.Patch(ctx, obj, patch, append([]client.PatchOption{client.FieldOwner(c.fieldManager)}, opts...)...)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fieldManagerRecordingClient records the field manager of every update,
+// keyed by the type and name of the updated object
+type fieldManagerRecordingClient struct {
+	client.Client
+	fieldManagers map[string]string
+}
+
+func (c *fieldManagerRecordingClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	updateOpts := &client.UpdateOptions{}
+	updateOpts.ApplyOptions(opts)
+	c.fieldManagers[fmt.Sprintf("%T/%s", obj, obj.(Object).GetName())] = updateOpts.FieldManager
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("Wave field manager Suite", func() {
+	var d *appsv1.Deployment
+	var c *fieldManagerRecordingClient
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = &fieldManagerRecordingClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			),
+			fieldManagers: make(map[string]string),
+		}
+	})
+
+	It("attributes every write to the configured field manager", func() {
+		h := NewHandler(c, record.NewFakeRecorder(10), Options{FieldManager: "wave-test"})
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.fieldManagers).To(HaveKeyWithValue("*v1.Deployment/"+d.GetName(), "wave-test"))
+		Expect(c.fieldManagers).To(HaveKeyWithValue("*v1.ConfigMap/"+utils.ExampleConfigMap1.GetName(), "wave-test"))
+		Expect(c.fieldManagers).To(HaveKeyWithValue("*v1.Secret/"+utils.ExampleSecret1.GetName(), "wave-test"))
+		for _, fieldManager := range c.fieldManagers {
+			Expect(fieldManager).To(Equal("wave-test"))
+		}
+	})
+
+	It("attributes writes to the default field manager when none is configured", func() {
+		h := NewHandler(c, record.NewFakeRecorder(10), Options{})
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.fieldManagers).NotTo(BeEmpty())
+		for _, fieldManager := range c.fieldManagers {
+			Expect(fieldManager).To(Equal(DefaultFieldManager))
+		}
+	})
+})
@@ -16,29 +16,34 @@ limitations under the License.
 
 package core
 
-// addFinalizer adds the wave finalizer to the given PodController
-func addFinalizer(obj podController) {
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// addFinalizer adds the given finalizer to the given PodController
+func addFinalizer(obj podController, name string) {
 	finalizers := obj.GetFinalizers()
 	for _, finalizer := range finalizers {
-		if finalizer == FinalizerString {
+		if finalizer == name {
 			// podController already contains the finalizer
 			return
 		}
 	}
 
 	//podController doesn't contain the finalizer, so add it
-	finalizers = append(finalizers, FinalizerString)
+	finalizers = append(finalizers, name)
 	obj.SetFinalizers(finalizers)
 }
 
-// removeFinalizer removes the wave finalizer from the given podController
-func removeFinalizer(obj podController) {
+// removeFinalizer removes the given finalizer from the given podController,
+// leaving any other finalizers in place
+func removeFinalizer(obj podController, name string) {
 	finalizers := obj.GetFinalizers()
 
-	// Filter existing finalizers removing any that match the finalizerString
+	// Filter existing finalizers removing any that match the name
 	newFinalizers := []string{}
 	for _, finalizer := range finalizers {
-		if finalizer != FinalizerString {
+		if finalizer != name {
 			newFinalizers = append(newFinalizers, finalizer)
 		}
 	}
@@ -47,11 +52,11 @@ func removeFinalizer(obj podController) {
 	obj.SetFinalizers(newFinalizers)
 }
 
-// hasFinalizer checks for the presence of the Wave finalizer
-func hasFinalizer(obj podController) bool {
+// hasFinalizer checks for the presence of the given finalizer
+func hasFinalizer(obj metav1.Object, name string) bool {
 	finalizers := obj.GetFinalizers()
 	for _, finalizer := range finalizers {
-		if finalizer == FinalizerString {
+		if finalizer == name {
 			// podController already contains the finalizer
 			return true
 		}
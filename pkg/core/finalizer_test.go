@@ -17,10 +17,17 @@ limitations under the License.
 package core
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("Wave finalizer Suite", func() {
@@ -34,7 +41,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 
 	Context("addFinalizer", func() {
 		It("adds the wave finalizer to the deployment", func() {
-			addFinalizer(podControllerDeployment)
+			addFinalizer(podControllerDeployment, FinalizerString)
 
 			Expect(deploymentObject.GetFinalizers()).To(ContainElement(FinalizerString))
 		})
@@ -43,7 +50,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f := deploymentObject.GetFinalizers()
 			f = append(f, "kubernetes")
 			deploymentObject.SetFinalizers(f)
-			addFinalizer(podControllerDeployment)
+			addFinalizer(podControllerDeployment, FinalizerString)
 
 			Expect(deploymentObject.GetFinalizers()).To(ContainElement("kubernetes"))
 		})
@@ -54,7 +61,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f := deploymentObject.GetFinalizers()
 			f = append(f, FinalizerString)
 			deploymentObject.SetFinalizers(f)
-			removeFinalizer(podControllerDeployment)
+			removeFinalizer(podControllerDeployment, FinalizerString)
 
 			Expect(deploymentObject.GetFinalizers()).NotTo(ContainElement(FinalizerString))
 		})
@@ -63,7 +70,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f := deploymentObject.GetFinalizers()
 			f = append(f, "kubernetes")
 			deploymentObject.SetFinalizers(f)
-			removeFinalizer(podControllerDeployment)
+			removeFinalizer(podControllerDeployment, FinalizerString)
 
 			Expect(deploymentObject.GetFinalizers()).To(ContainElement("kubernetes"))
 		})
@@ -75,18 +82,76 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f = append(f, FinalizerString)
 			deploymentObject.SetFinalizers(f)
 
-			Expect(hasFinalizer(podControllerDeployment)).To(BeTrue())
+			Expect(hasFinalizer(podControllerDeployment, FinalizerString)).To(BeTrue())
 		})
 
 		It("returns false if the deployment doesn't have the finalizer", func() {
 			// Test without any finalizers
-			Expect(hasFinalizer(podControllerDeployment)).To(BeFalse())
+			Expect(hasFinalizer(podControllerDeployment, FinalizerString)).To(BeFalse())
 
 			// Test with a different finalizer
 			f := deploymentObject.GetFinalizers()
 			f = append(f, "kubernetes")
 			deploymentObject.SetFinalizers(f)
-			Expect(hasFinalizer(podControllerDeployment)).To(BeFalse())
+			Expect(hasFinalizer(podControllerDeployment, FinalizerString)).To(BeFalse())
 		})
 	})
 })
+
+var _ = Describe("Wave finalizer name Suite", func() {
+	const tenantA = "tenant-a.example.com/wave"
+	const tenantB = "tenant-b.example.com/wave"
+
+	var c client.Client
+	var d *appsv1.Deployment
+	var handlerA *Handler
+	var handlerB *Handler
+
+	// getDeployment returns the current state of the Deployment
+	var getDeployment = func() *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		handlerA = NewHandler(c, record.NewFakeRecorder(100), Options{FinalizerName: tenantA})
+		handlerB = NewHandler(c, record.NewFakeRecorder(100), Options{FinalizerName: tenantB})
+
+		_, err := handlerA.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = handlerB.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("adds the configured finalizer of each instance", func() {
+		Expect(getDeployment().GetFinalizers()).To(ConsistOf(tenantA, tenantB))
+	})
+
+	It("only removes the configured finalizer during clean up", func() {
+		deleting := getDeployment()
+		now := metav1.Now()
+		deleting.SetDeletionTimestamp(&now)
+		Expect(c.Update(context.TODO(), deleting)).To(Succeed())
+
+		_, err := handlerA.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getDeployment().GetFinalizers()).To(ConsistOf(tenantB))
+
+		_, err = handlerB.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getDeployment().GetFinalizers()).To(BeEmpty())
+	})
+
+	It("uses the default finalizer when none is configured", func() {
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+		Expect(h.getFinalizerName()).To(Equal(FinalizerString))
+	})
+})
@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// addForceRolloutToken folds the force rollout token of the podController
+// into the configuration hash, so that changing the token rolls the
+// podController out even when none of its children changed.
+// The hash is returned unchanged if no token is set.
+func addForceRolloutToken(obj podController, hash string) string {
+	token := obj.GetAnnotations()[ForceRolloutAnnotation]
+	if token == "" {
+		return hash
+	}
+
+	combined := sha256.New()
+	fmt.Fprintf(combined, "%s\n", hash)
+	fmt.Fprintf(combined, "%s=%s\n", ForceRolloutAnnotation, token)
+	return fmt.Sprintf("%x", combined.Sum(nil))
+}
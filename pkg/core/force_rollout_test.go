@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave force rollout Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+
+	// setToken sets the force rollout token of the Deployment
+	var setToken = func(token string) {
+		annotations := d.GetAnnotations()
+		annotations[ForceRolloutAnnotation] = token
+		d.SetAnnotations(annotations)
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("does not change the hash when no token is set", func() {
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		expected, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reconcileHash(c, h, d)).To(Equal(expected))
+	})
+
+	It("changes the hash when only the token changes", func() {
+		setToken("2019-01-01T00:00:00Z")
+		first := reconcileHash(c, h, d)
+
+		setToken("2019-01-02T00:00:00Z")
+		second := reconcileHash(c, h, d)
+		Expect(second).NotTo(Equal(first))
+
+		Expect(reconcileHash(c, h, d)).To(Equal(second))
+	})
+
+	It("still changes the hash when the configuration changes", func() {
+		setToken("2019-01-01T00:00:00Z")
+		original := reconcileHash(c, h, d)
+
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+})
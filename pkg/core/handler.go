@@ -20,9 +20,17 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -33,11 +41,74 @@ import (
 type Handler struct {
 	client.Client
 	recorder record.EventRecorder
+	opts     Options
+	log      logr.Logger
+
+	// now returns the current time
+	now func() time.Time
+
+	// handlerState is shared by each copy of the Handler made to reconcile
+	// an instance within a deadline
+	*handlerState
+}
+
+// handlerState holds the state the Handler keeps across reconciliations
+type handlerState struct {
+	// throttled counts the requests made by the Handler that were throttled
+	// by the API server, and backoff tracks the instances affected
+	throttled int64
+	backoff   throttleBackoff
+
+	// missingSince records when each instance was first seen with a missing
+	// required child, and missingAttempts how many times it has been checked
+	// since
+	missingMutex    sync.Mutex
+	missingSince    map[string]time.Time
+	missingAttempts map[string]int
+
+	// batchSince records when the batch window of each instance with a
+	// pending rollout opened
+	batchMutex sync.Mutex
+	batchSince map[string]time.Time
+
+	// labelledOwners records the UIDs of the instances whose owned children
+	// are all known to carry their owned-by label
+	labelledMutex  sync.Mutex
+	labelledOwners map[types.UID]struct{}
+
+	// pdbBlocked records the configuration hash of each instance whose
+	// rollout was last counted as blocked by a PodDisruptionBudget
+	pdbMutex   sync.Mutex
+	pdbBlocked map[string]string
+
+	// childHashes records the leaf hash of each child of each instance when
+	// its configuration was last applied, so that the children that changed
+	// can be named when it next rolls out
+	childMutex  sync.Mutex
+	childHashes map[string]map[string]string
+
+	// cache caches what is computed from each child, unless a HashCache is
+	// shared through the options
+	cache HashCache
+
+	// rollouts tracks the Deployments with a rollout in progress when the
+	// number of rollouts per namespace is limited
+	rollouts rolloutLimiter
+
+	// progressing records the generation each instance was updated to when
+	// the Handler rolled it out, until the rollout completes
+	progressMutex sync.Mutex
+	progressing   map[string]int64
 }
 
 // NewHandler constructs a new instance of Handler
-func NewHandler(c client.Client, r record.EventRecorder) *Handler {
-	return &Handler{Client: c, recorder: r}
+func NewHandler(c client.Client, r record.EventRecorder, opts Options) *Handler {
+	h := &Handler{recorder: r, opts: opts, log: opts.Logger, now: time.Now, handlerState: &handlerState{}}
+	if h.log == nil {
+		h.log = logf.Log.WithName("wave")
+	}
+	h.Client = &throttleClient{Client: newFieldManagerClient(c, opts.FieldManager), throttled: &h.throttled}
+	return h
 }
 
 // HandleDeployment is called by the deployment controller to reconcile deployments
@@ -55,63 +126,374 @@ func (h *Handler) HandleDaemonSet(instance *appsv1.DaemonSet) (reconcile.Result,
 	return h.handlePodController(&daemonset{DaemonSet: instance})
 }
 
-// handlePodController reconciles the state of a podController
+// HandleReplicaSet is called by the ReplicaSet controller to reconcile
+// ReplicaSets
+func (h *Handler) HandleReplicaSet(instance *appsv1.ReplicaSet) (reconcile.Result, error) {
+	return h.handlePodController(&replicaset{ReplicaSet: instance})
+}
+
+// HandleCronJob is called by the CronJob controller to reconcile CronJobs
+func (h *Handler) HandleCronJob(instance *batchv1beta1.CronJob) (reconcile.Result, error) {
+	return h.handlePodController(&cronjob{CronJob: instance})
+}
+
+// HandleUnstructured is called by the controllers for workloads that are not
+// built in apps/v1 types, such as OpenKruise CloneSets, to reconcile them.
+// The workload must keep its PodTemplate at spec.template.
+func (h *Handler) HandleUnstructured(instance *unstructured.Unstructured) (reconcile.Result, error) {
+	return h.handlePodController(&unstructuredPodController{Unstructured: instance})
+}
+
+// handlePodController reconciles the state of a podController, backing off
+// if the API server is throttling requests.
+// Once Wave is shutting down, the podController is requeued instead.
 func (h *Handler) handlePodController(instance podController) (reconcile.Result, error) {
-	log := logf.Log.WithName("wave")
+	if !h.opts.Shutdown.begin() {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	defer h.opts.Shutdown.done()
 
-	// If the required annotation isn't present, ignore the instance
-	if !hasRequiredAnnotation(instance) {
+	return h.withThrottleBackoff(instance, func() (reconcile.Result, error) {
+		result, err := h.withReconcileTimeout(func(h *Handler) (reconcile.Result, error) {
+			result, err := h.reconcilePodController(instance)
+			h.recordReconcileReason(instance, result, err)
+			return result.Result, err
+		})
+		if err != nil && h.isManaged(instance) {
+			h.reportReconcileStatus(instance, err)
+		}
+		result, err = h.withRequeueAfter(instance, result, err)
+		return h.withMaxReconcileInterval(instance, result, err), err
+	})
+}
+
+// isManaged returns true if Wave manages the podController, rather than
+// cleaning up after it
+func (h *Handler) isManaged(instance podController) bool {
+	return !h.isExcludedNamespace(instance.GetNamespace()) && h.isEnabled(instance) && !toBeDeleted(instance)
+}
+
+// reconcilePodController reconciles the state of a podController, returning
+// the reason for the outcome if it succeeds
+func (h *Handler) reconcilePodController(instance podController) (reconcileResult, error) {
+	log := h.log.WithValues("kind", kindOf(instance))
+	reconcilesTotal.Inc()
+
+	// If the instance is in an excluded namespace, ignore the instance
+	if h.isExcludedNamespace(instance.GetNamespace()) {
+		// Perform deletion logic if the finalizer is present on the object
+		if hasFinalizer(instance, h.getFinalizerName()) {
+			log.V(0).Info("Instance in excluded namespace, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
+			return withReason(ReasonSkipped)(h.handleDelete(instance))
+		}
+		h.clearChildHashes(instance)
+		childCounts.remove(instance)
+		configDrifts.remove(instance)
+		return reconcileResult{reason: ReasonSkipped}, nil
+	}
+
+	// If Wave isn't enabled for the instance, ignore the instance
+	if !h.isEnabled(instance) {
 		// Perform deletion logic if the finalizer is present on the object
-		if hasFinalizer(instance) {
-			log.V(0).Info("Required annotation removed from instance, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
-			return h.handleDelete(instance)
+		if hasFinalizer(instance, h.getFinalizerName()) {
+			log.V(0).Info("Wave disabled for instance, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
+			return withReason(ReasonSkipped)(h.handleOptOut(instance))
 		}
-		return reconcile.Result{}, nil
+		h.clearChildHashes(instance)
+		childCounts.remove(instance)
+		configDrifts.remove(instance)
+		return reconcileResult{reason: ReasonSkipped}, nil
 	}
 
 	// If the instance is marked for deletion, run cleanup process
 	if toBeDeleted(instance) {
 		log.V(0).Info("Instance marked for deletion, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
-		return h.handleDelete(instance)
+		return withReason(ReasonSkipped)(h.handleDelete(instance))
 	}
 
 	// Get all children that have an OwnerReference pointing to this instance
-	existing, err := h.getExistingChildren(instance)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error fetching existing children: %v", err)
+	var existing []Object
+	var err error
+	if h.managesOwnerReferences() {
+		existing, err = h.getExistingChildren(instance)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error fetching existing children: %v", err)
+		}
 	}
 
 	// Get all children that the instance currently references
 	current, err := h.getCurrentChildren(instance)
+	var missingChildren []string
+	if err != nil {
+		// Required children may briefly disappear while configuration is being
+		// re-applied, so check again with a backoff for the grace period
+		// before reporting them
+		if missing, ok := err.(*missingChildError); ok {
+			if remaining := h.missingChildGraceRemaining(instance); remaining > 0 {
+				backoff := h.missingChildBackoff(instance)
+				if backoff > remaining {
+					backoff = remaining
+				}
+				log.V(0).Info("Required child missing, waiting for it to reappear", "namespace", instance.GetNamespace(), "name", instance.GetName(), "remaining", remaining.String(), "requeueAfter", backoff.String())
+				return reconcileResult{Result: reconcile.Result{RequeueAfter: backoff}, reason: ReasonMissingChild}, nil
+			}
+			h.recorder.Eventf(instance.GetObject(), corev1.EventTypeWarning, "MissingChild", "Required child missing: %v", err)
+			// Workloads requiring all of their children are checked again
+			// with a backoff until every child exists
+			if requiresAllChildren(instance) {
+				childrenErrorsTotal.Inc()
+				backoff := h.missingChildBackoff(instance)
+				log.V(0).Info("Rollout blocked until all children exist", "namespace", instance.GetNamespace(), "name", instance.GetName(), "requeueAfter", backoff.String())
+				h.reportStatus(instance, StatusMissingChildren, ReasonMissingChild, h.describeMissingChildren(missing.missing))
+				return reconcileResult{Result: reconcile.Result{RequeueAfter: backoff}, reason: ReasonMissingChild}, nil
+			}
+			// Workloads rolling out on a missing child are hashed from the
+			// children that do exist, with the missing children folded in
+			if !rollsOnMissing(instance) {
+				childrenErrorsTotal.Inc()
+				return reconcileResult{}, &missingChildError{err: fmt.Errorf("error fetching current children: %v", err), missing: missing.missing}
+			}
+			log.V(0).Info("Rolling out with missing children", "namespace", instance.GetNamespace(), "name", instance.GetName(), "missing", missing.missing)
+			current, missingChildren = missing.children, missing.missing
+		} else {
+			childrenErrorsTotal.Inc()
+			return reconcileResult{}, fmt.Errorf("error fetching current children: %v", err)
+		}
+	}
+	if len(missingChildren) == 0 {
+		h.clearMissingChild(instance)
+	}
+	childCounts.set(instance, len(current))
+	tracked := current
+
+	// Merge in the children of any other members of the instance's hash group
+	current, err = h.getHashGroupChildren(instance, current)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error fetching current children: %v", err)
+		return reconcileResult{}, fmt.Errorf("error fetching hash group children: %v", err)
 	}
 
 	// Reconcile the OwnerReferences on the existing and current children
-	err = h.updateOwnerReferences(instance, existing, current)
+	// Children are left untouched in dry-run mode and when they are watched
+	// through the child index
+	if h.managesOwnerReferences() {
+		err = h.updateOwnerReferences(instance, existing, current)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error updating OwnerReferences: %v", err)
+		}
+		h.setOwnedByLabelled(instance)
+	}
+
+	// Calculate the hash as the webhook does, from the normalized children
+	hash, current, err := h.computeConfigHash(instance, current, missingChildren)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error updating OwnerReferences: %v", err)
+		return reconcileResult{}, err
 	}
 
-	hash, err := calculateConfigHash(current)
+	h.warnJSONPathFallbacks(instance, current)
+
+	childHashes, err := h.getChildHashes(current)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error calculating configuration hash: %v", err)
+		return reconcileResult{}, fmt.Errorf("error calculating child hashes: %v", err)
 	}
 
 	// Update the desired state of the Deployment in a DeepCopy
+	// Observe-only instances only record the hash on their metadata so that
+	// the PodTemplate is never modified and no rollout is triggered
+	// Adopted hashes are recorded on the metadata at a new hash epoch without
+	// modifying the PodTemplate
+	// Instances restarted by deleting their Pods also record the hash on their
+	// metadata, and roll out when it changes. ReplicaSets record it on their
+	// PodTemplate too, so that the Pods replacing those deleted carry it.
 	copy := instance.DeepCopy()
-	setConfigHash(copy, hash)
-	addFinalizer(copy)
+	observeOnly := isObserveOnly(instance)
+	deletePods := !observeOnly && deletesPods(instance)
+	adopted := false
+	restart := false
+	if observeOnly {
+		setObservedConfigHash(copy, hash)
+	} else if deletePods {
+		restart = setRestartedConfigHash(copy, hash)
+		if setsPodTemplateOnRestart(copy) {
+			setConfigHash(copy, hash, h.getHashAnnotation())
+		}
+	} else {
+		adopted = updateConfigHash(copy, hash, h.getHashAnnotation())
+	}
+	h.setComputedBy(copy)
+	err = h.setContainerHashes(copy, current)
+	if err != nil {
+		return reconcileResult{}, fmt.Errorf("error calculating container hashes: %v", err)
+	}
+	addFinalizer(copy, h.getFinalizerName())
+	clearPendingConfigHash(copy)
+	setStatus(copy, StatusSynced, "")
+
+	// Record whether the PodTemplate will still differ from the configuration
+	// hash, such as for observe-only instances rolled out by another process
+	drift := h.getConfigDrift(copy, hash)
+	setConfigDrift(copy, drift)
+
+	// Paused workloads, workloads within their batch window or outside the
+	// rollout window, guarded by a PodDisruptionBudget allowing no
+	// disruptions, with a pre-roll validation endpoint that has not accepted
+	// the new configuration, or waiting for a workload with a lower rollout
+	// order, do not roll out
+	rollout := restart || (!observeOnly && !deletePods && !adopted && !reflect.DeepEqual(instance.GetPodTemplate(), copy.GetPodTemplate()))
+	reason := ReasonNoChange
+	if rollout {
+		reason = ReasonRolloutTriggered
+	}
+
+	// In dry-run mode, report the rollout rather than updating the instance
+	if h.opts.DryRun {
+		reportConfigDrift(instance, h.getConfigDrift(instance, hash))
+		h.reportDryRun(instance, hash, rollout, childHashes)
+		return reconcileResult{reason: ReasonDryRun}, nil
+	}
+
+	if !rollout {
+		h.clearBatchWindow(instance)
+		h.setChildHashes(instance, childHashes)
+	} else {
+		// Pods are only deleted if the selector matches the instance's own
+		// PodTemplate, so that the Pods of other workloads are never deleted
+		if deletePods {
+			if err := checkPodSelector(copy); err != nil {
+				log.Error(err, "Refusing to restart instance by deleting its pods", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+				h.recorder.Eventf(instance.GetObject(), corev1.EventTypeWarning, "PodSelectorMismatch", "Refusing to delete Pods: %v", err)
+				return reconcileResult{}, fmt.Errorf("error restarting instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+			}
+		}
+
+		if h.deferWhilePaused(copy) {
+			log.V(0).Info("Instance paused, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			h.reportDeferred(instance, hash, "Rollout deferred while paused")
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: pausedRequeue}, reason: ReasonRolloutDeferred}, nil
+		}
+
+		if remaining := h.batchWindowRemaining(copy, hash); remaining > 0 {
+			log.V(0).Info("Batching configuration changes, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "remaining", remaining.String())
+			h.reportDeferred(instance, hash, "Rollout deferred by batch window")
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: remaining}, reason: ReasonRolloutDeferred}, nil
+		}
+
+		if remaining := h.rolloutWindowRemaining(); remaining > 0 {
+			log.V(0).Info("Outside rollout window, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "remaining", remaining.String())
+			err := h.recordPendingConfigHash(instance, hash, remaining)
+			if err != nil {
+				return reconcileResult{}, err
+			}
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: remaining}, reason: ReasonRolloutDeferred}, nil
+		}
 
-	// If the desired state doesn't match the existing state, update it
+		deferred, err := h.checkPodDisruptionBudgets(copy, hash)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error checking PodDisruptionBudgets: %v", err)
+		}
+		if deferred {
+			log.V(0).Info("Rollout blocked by PodDisruptionBudget, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			h.reportDeferred(instance, hash, "Rollout deferred by PodDisruptionBudget")
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: pdbBlockedRequeue}, reason: ReasonRolloutDeferred}, nil
+		}
+
+		accepted, err := h.validatePreRoll(copy, hash, current)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error validating configuration: %v", err)
+		}
+		if !accepted {
+			log.V(0).Info("Configuration rejected, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			h.reportDeferred(instance, hash, "Rollout deferred until the configuration is accepted")
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: preRollValidateRequeue}, reason: ReasonRolloutDeferred}, nil
+		}
+
+		blocker, err := h.getRolloutOrderBlocker(copy)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error checking rollout order: %v", err)
+		}
+		if blocker != "" {
+			log.V(0).Info("Waiting for a lower rollout order, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "waitingFor", blocker)
+			h.reportDeferred(instance, hash, fmt.Sprintf("Rollout deferred until %s has rolled out", blocker))
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: rolloutOrderRequeue}, reason: ReasonRolloutDeferred}, nil
+		}
+
+		reserved, err := h.reserveRollout(copy)
+		if err != nil {
+			return reconcileResult{}, fmt.Errorf("error checking rollouts in progress: %v", err)
+		}
+		if !reserved {
+			log.V(0).Info("Rollout limit reached, deferring rollout", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "maxRolloutsPerNamespace", h.opts.MaxRolloutsPerNamespace)
+			h.reportDeferred(instance, hash, "Rollout deferred by rollout limit")
+			return reconcileResult{Result: reconcile.Result{RequeueAfter: getRequeueAfter(instance, rolloutLimitRequeue)}, reason: ReasonRolloutDeferred}, nil
+		}
+	}
+
+	// Report the completion of the instance's last rollout
+	h.checkRolloutProgress(instance)
+
+	// If the desired state doesn't match the existing state, update it,
+	// recording the reason for the update alongside its status
 	if !reflect.DeepEqual(instance, copy) {
-		log.V(0).Info("Updating instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
-		h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "ConfigChanged", "Configuration hash updated to %s", hash)
+		setStatusReason(copy, reason)
+		if observeOnly {
+			log.V(0).Info("Updating observed instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "ConfigObserved", "Observed configuration hash updated to %s", hash)
+		} else if adopted {
+			epoch := copy.GetAnnotations()[AdoptedHashEpochAnnotation]
+			if epoch != instance.GetAnnotations()[AdoptedHashEpochAnnotation] {
+				log.V(0).Info("Adopting instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "epoch", epoch)
+				h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "ConfigAdopted", "Configuration hash %s adopted at epoch %s", hash, epoch)
+			}
+		} else if rollout {
+			changed := h.getChangedChildren(instance, childHashes)
+			h.setLastChangedChildren(copy, instance, changed)
+			h.setConfigSummary(copy, tracked)
+			log.V(0).Info("Updating instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "changed", strings.Join(changed, ", "))
+			h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "ConfigChanged", "Configuration hash updated to %s%s", hash, describeChangedChildren(changed))
+			if deletePods {
+				// Pods are deleted before the hash is recorded so that they
+				// are deleted again if recording the hash fails
+				deleted, err := h.deletePods(instance)
+				if err != nil {
+					h.releaseRollout(copy)
+					return reconcileResult{}, fmt.Errorf("error deleting pods of instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+				}
+				log.V(0).Info("Deleted instance pods", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash, "pods", deleted)
+				h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "PodsDeleted", "Deleted %d Pods to restart them with configuration hash %s", deleted, hash)
+			} else {
+				setLastUpdateTime(copy, h.now())
+			}
+		} else {
+			log.V(0).Info("Updating instance metadata", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+		}
 		err := h.Update(context.TODO(), copy.GetObject())
 		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+			if rollout {
+				h.releaseRollout(copy)
+			}
+			// Retrying cannot succeed if the instance has been deleted or the
+			// update is rejected as invalid, so wait for the instance or its
+			// children to change instead
+			if errors.IsNotFound(err) {
+				log.V(0).Info("Instance deleted while updating, skipping", "namespace", instance.GetNamespace(), "name", instance.GetName())
+				return reconcileResult{reason: ReasonSkipped}, nil
+			}
+			if errors.IsInvalid(err) {
+				log.Error(err, "Instance update rejected, not retrying", "namespace", instance.GetNamespace(), "name", instance.GetName())
+				h.recorder.Eventf(instance.GetObject(), corev1.EventTypeWarning, "UpdateRejected", "Update rejected: %v", err)
+				h.reportStatus(instance, StatusError, ReasonError, fmt.Sprintf("Update rejected: %v", err))
+				return reconcileResult{reason: ReasonError}, nil
+			}
+			return reconcileResult{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+		}
+		if rollout {
+			h.recordRollout(copy)
+			h.setRolloutInProgress(copy)
+			rolloutsTotal.WithLabelValues(instance.GetNamespace()).Inc()
+			h.clearBatchWindow(instance)
+			h.setChildHashes(instance, childHashes)
 		}
 	}
+	reportConfigDrift(instance, drift)
 
-	return reconcile.Result{}, nil
+	return reconcileResult{reason: reason}, nil
 }
@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Wave controller Suite", func() {
@@ -66,7 +67,7 @@ var _ = Describe("Wave controller Suite", func() {
 		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 		Expect(cerr).NotTo(HaveOccurred())
 
-		h = NewHandler(c, mgr.GetEventRecorderFor("wave"))
+		h = NewHandler(c, mgr.GetEventRecorderFor("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		stopMgr, mgrStopped = StartTestManager(mgr)
@@ -170,6 +171,12 @@ var _ = Describe("Wave controller Suite", func() {
 				}
 			})
 
+			It("Adds OwnerReferences to a ConfigMap and a Secret sharing a name", func() {
+				Expect(cm2.GetName()).To(Equal(s2.GetName()))
+				m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ConsistOf(ownerRef)))
+				m.Eventually(s2, timeout).Should(utils.WithOwnerReferences(ConsistOf(ownerRef)))
+			})
+
 			It("Adds a finalizer to the Deployment", func() {
 				m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
 			})
@@ -463,6 +470,71 @@ var _ = Describe("Wave controller Suite", func() {
 			})
 		})
 
+		Context("And it has the required and observe-only annotations", func() {
+			var originalTemplate corev1.PodTemplateSpec
+
+			BeforeEach(func() {
+				originalTemplate = *deployment.Spec.Template.DeepCopy()
+
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					obj.SetAnnotations(map[string]string{
+						RequiredAnnotation:    requiredAnnotationValue,
+						ObserveOnlyAnnotation: requiredAnnotationValue,
+					})
+					return obj
+				}, timeout).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Get the updated Deployment
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Adds OwnerReferences to all children", func() {
+				for _, obj := range []Object{cm1, cm2, cm3, s1, s2, s3} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Records the config hash on the Deployment's metadata", func() {
+				m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKey(ObservedConfigHashAnnotation)))
+			})
+
+			It("Does not modify the Pod Template", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(originalTemplate.GetAnnotations()))
+			})
+
+			Context("And a child is updated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKey(ObservedConfigHashAnnotation)))
+					originalHash = deployment.GetAnnotations()[ObservedConfigHashAnnotation]
+
+					m.Update(cm1, func(obj utils.Object) utils.Object {
+						cm := obj.(*corev1.ConfigMap)
+						cm.Data["key1"] = modified
+						return cm
+					}, timeout).Should(Succeed())
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Updates the observed config hash on the Deployment's metadata", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(ObservedConfigHashAnnotation, originalHash)))
+				})
+
+				It("Does not modify the Pod Template", func() {
+					m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				})
+			})
+		})
+
 		Context("And it does not have the required annotation", func() {
 			BeforeEach(func() {
 				// Get the updated Deployment
@@ -483,6 +555,258 @@ var _ = Describe("Wave controller Suite", func() {
 				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithAnnotations(ContainElement(ConfigHashAnnotation)))
 			})
 		})
+
+		Context("And an init container and a container share a ConfigMap with different prefixes", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					d := obj.(*appsv1.Deployment)
+					annotations := d.GetAnnotations()
+					if annotations == nil {
+						annotations = make(map[string]string)
+					}
+					annotations[RequiredAnnotation] = requiredAnnotationValue
+					d.SetAnnotations(annotations)
+
+					containers := d.Spec.Template.Spec.Containers
+					containers[0].EnvFrom = append(containers[0].EnvFrom, corev1.EnvFromSource{
+						Prefix: "MAIN_",
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: cm3.GetName(),
+							},
+						},
+					})
+					d.Spec.Template.Spec.InitContainers = []corev1.Container{
+						{
+							Name:  "init",
+							Image: "init",
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									Prefix: "INIT_",
+									ConfigMapRef: &corev1.ConfigMapEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: cm3.GetName(),
+										},
+									},
+								},
+							},
+						},
+					}
+					return d
+				}, timeout).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			})
+
+			It("Adds a single OwnerReference to the shared ConfigMap", func() {
+				m.Eventually(cm3, timeout).Should(utils.WithOwnerReferences(ConsistOf(ownerRef)))
+			})
+
+			Context("And the init container's prefix is changed", func() {
+				BeforeEach(func() {
+					m.Update(deployment, func(obj utils.Object) utils.Object {
+						d := obj.(*appsv1.Deployment)
+						d.Spec.Template.Spec.InitContainers[0].EnvFrom[0].Prefix = "SETUP_"
+						return d
+					}, timeout).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				It("Keeps a single OwnerReference on the shared ConfigMap", func() {
+					m.Consistently(cm3, consistentlyTimeout).Should(utils.WithOwnerReferences(ConsistOf(ownerRef)))
+				})
+			})
+		})
+
+		Context("And its hash epoch is bumped", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				annotations := deployment.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[RequiredAnnotation] = requiredAnnotationValue
+
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					obj.SetAnnotations(annotations)
+					return obj
+				}, timeout).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+				// Change the configuration and bump the epoch together so that the
+				// new hash is adopted rather than rolled out
+				m.Update(cm1, func(obj utils.Object) utils.Object {
+					cm := obj.(*corev1.ConfigMap)
+					cm.Data["key1"] = modified
+					return cm
+				}, timeout).Should(Succeed())
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					annotations := obj.GetAnnotations()
+					annotations[HashEpochAnnotation] = "2"
+					obj.SetAnnotations(annotations)
+					return obj
+				}, timeout).Should(Succeed())
+				_, err = h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Adopts the new hash without updating the Pod Template", func() {
+				m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKeyWithValue(AdoptedHashEpochAnnotation, "2")))
+				m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKey(AdoptedConfigHashAnnotation)))
+				m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+			})
+
+			Context("And a child is then updated", func() {
+				BeforeEach(func() {
+					m.Update(cm2, func(obj utils.Object) utils.Object {
+						cm := obj.(*corev1.ConfigMap)
+						cm.Data["key1"] = modified
+						return cm
+					}, timeout).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				It("Removes the adopted hash", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithAnnotations(HaveKey(AdoptedConfigHashAnnotation)))
+				})
+			})
+		})
+
+		Context("And a required child is missing within the grace period", func() {
+			var result reconcile.Result
+			var handleErr error
+
+			BeforeEach(func() {
+				h = NewHandler(c, h.recorder, Options{MissingChildGrace: time.Minute})
+
+				annotations := deployment.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[RequiredAnnotation] = requiredAnnotationValue
+
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					obj.SetAnnotations(annotations)
+					return obj
+				}, timeout).Should(Succeed())
+
+				m.Delete(cm2).Should(Succeed())
+				m.Get(cm2, timeout).ShouldNot(Succeed())
+
+				result, handleErr = h.HandleDeployment(deployment)
+			})
+
+			It("Requeues the Deployment without an error", func() {
+				Expect(handleErr).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			})
+
+			It("Doesn't send a warning event", func() {
+				eventReason := func(event corev1.Event) string {
+					return event.Reason
+				}
+				Consistently(func() []corev1.Event {
+					events := &corev1.EventList{}
+					Expect(c.List(context.TODO(), events)).To(Succeed())
+					return events.Items
+				}, consistentlyTimeout).ShouldNot(ContainElement(WithTransform(eventReason, Equal("MissingChild"))))
+			})
+
+			Context("And the child reappears", func() {
+				BeforeEach(func() {
+					cm2 = utils.ExampleConfigMap2.DeepCopy()
+					m.Create(cm2).Should(Succeed())
+					m.Get(cm2, timeout).Should(Succeed())
+
+					m.Get(deployment, timeout).Should(Succeed())
+					result, handleErr = h.HandleDeployment(deployment)
+				})
+
+				It("Reconciles the Deployment without an error", func() {
+					Expect(handleErr).NotTo(HaveOccurred())
+					Expect(result).To(Equal(reconcile.Result{}))
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				})
+
+				It("Adds an OwnerReference to the recreated child", func() {
+					m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+			})
+		})
+
+		Context("And it is in the controller's own namespace", func() {
+			BeforeEach(func() {
+				h = NewHandler(c, h.recorder, Options{OwnNamespace: deployment.GetNamespace()})
+
+				annotations := deployment.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[RequiredAnnotation] = requiredAnnotationValue
+
+				m.Update(deployment, func(obj utils.Object) utils.Object {
+					obj.SetAnnotations(annotations)
+					return obj
+				}, timeout).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Get the updated Deployment
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Doesn't add any OwnerReferences to any children", func() {
+				for _, obj := range []Object{cm1, cm2, s1, s2} {
+					m.Consistently(obj, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Doesn't add a finalizer to the Deployment", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+			})
+
+			It("Doesn't add a config hash to the Pod Template", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			})
+
+			Context("And the own namespace is included", func() {
+				BeforeEach(func() {
+					h = NewHandler(c, h.recorder, Options{OwnNamespace: deployment.GetNamespace(), IncludeOwnNamespace: true})
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Adds OwnerReferences to all children", func() {
+					for _, obj := range []Object{cm1, cm2, cm3, s1, s2, s3} {
+						m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Adds a config hash to the Pod Template", func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				})
+			})
+		})
 	})
 
 })
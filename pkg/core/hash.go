@@ -17,96 +17,257 @@ limitations under the License.
 package core
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // calculateConfigHash uses sha256 to hash the configuration within the child
 // objects and returns a hash as a string
 func calculateConfigHash(children []configObject) (string, error) {
+	return calculateConfigHashWith(children, HashAlgorithmSHA256)
+}
+
+// calculateConfigHashWith uses the given algorithm to hash the configuration
+// within the child objects and returns a hash as a string
+func calculateConfigHashWith(children []configObject, algorithm string) (string, error) {
+	return calculateCachedConfigHash(children, algorithm, nil, nil)
+}
+
+// calculateCachedConfigHash uses the given algorithm to hash the
+// configuration within the child objects, reusing the serialised data of
+// children that are unchanged in the cache, and returns a hash as a string
+func calculateCachedConfigHash(children []configObject, algorithm string, cache *fragmentCache, stats *cacheStats) (string, error) {
+	hashSourceBytes, err := getCachedHashSource(children, cache, stats)
+	if err != nil {
+		return "", err
+	}
+
+	hasher, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	hasher.Write(hashSourceBytes)
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// getHashSource serialises the configuration within the child objects
+// deterministically, regardless of the order of the children, so that it can
+// be hashed
+func getHashSource(children []configObject) ([]byte, error) {
+	return getCachedHashSource(children, nil, nil)
+}
+
+// getCachedHashSource serialises the configuration within the child objects
+// like getHashSource, reusing the serialised data of children that are
+// unchanged in the cache.
+// The result is identical with or without a cache.
+func getCachedHashSource(children []configObject, cache *fragmentCache, stats *cacheStats) ([]byte, error) {
 	// hashSource contains all the data to be hashed
+	// Prefixes and binary data are omitted when empty so that hashes of
+	// children referenced without an EnvFrom prefix, or without binary data,
+	// are unchanged
 	hashSource := struct {
-		ConfigMaps map[string]map[string]string `json:"configMaps"`
-		Secrets    map[string]map[string][]byte `json:"secrets"`
+		ConfigMaps          map[string]json.RawMessage `json:"configMaps"`
+		Secrets             map[string]json.RawMessage `json:"secrets"`
+		ConfigMapBinaryData map[string]json.RawMessage `json:"configMapBinaryData,omitempty"`
+		ConfigMapPrefixes   map[string][]string        `json:"configMapPrefixes,omitempty"`
+		SecretPrefixes      map[string][]string        `json:"secretPrefixes,omitempty"`
+		ExtraChildren       map[string]json.RawMessage `json:"extraChildren,omitempty"`
 	}{
-		ConfigMaps: make(map[string]map[string]string),
-		Secrets:    make(map[string]map[string][]byte),
+		ConfigMaps:          make(map[string]json.RawMessage),
+		Secrets:             make(map[string]json.RawMessage),
+		ConfigMapBinaryData: make(map[string]json.RawMessage),
+		ConfigMapPrefixes:   make(map[string][]string),
+		SecretPrefixes:      make(map[string][]string),
+		ExtraChildren:       make(map[string]json.RawMessage),
 	}
 
 	// Add the data from each child to the hashSource
-	// All children should be in the same namespace so each one should have a
-	// unique name
-	for _, child := range children {
-		if child.object != nil {
-			switch child.object.(type) {
-			case *corev1.ConfigMap:
-				hashSource.ConfigMaps[child.object.GetName()] = getConfigMapData(child)
-			case *corev1.Secret:
-				hashSource.Secrets[child.object.GetName()] = getSecretData(child)
-			default:
-				return "", fmt.Errorf("passed unknown type: %v", reflect.TypeOf(child))
+	// Children are keyed by namespace and name, as children read from a
+	// shared namespace may share a name with children in the workload's own
+	// namespace. ConfigMaps and Secrets are kept in separate maps so that a
+	// ConfigMap and a Secret sharing a name never overwrite each other and
+	// each contribute to the hash independently.
+	// Children are folded in sorted, with any duplicates merged, so that the
+	// result never depends on the order the children were found in.
+	for _, child := range sortChildren(children) {
+		switch child.object.(type) {
+		case *corev1.ConfigMap, *corev1.Secret, *unstructured.Unstructured:
+		default:
+			return nil, fmt.Errorf("passed unknown type: %v", reflect.TypeOf(child))
+		}
+
+		fragment, err := cache.getFragment(child, stats)
+		if err != nil {
+			return nil, err
+		}
+		name := child.object.GetNamespace() + "/" + child.object.GetName()
+		if u, ok := child.object.(*unstructured.Unstructured); ok {
+			hashSource.ExtraChildren[u.GroupVersionKind().GroupKind().String()+"/"+name] = fragment.data
+		} else if _, ok := child.object.(*corev1.ConfigMap); ok {
+			hashSource.ConfigMaps[name] = fragment.data
+			if len(fragment.binaryData) > 0 {
+				hashSource.ConfigMapBinaryData[name] = fragment.binaryData
+			}
+			if len(child.prefixes) > 0 {
+				hashSource.ConfigMapPrefixes[name] = getPrefixes(child)
+			}
+		} else {
+			hashSource.Secrets[name] = fragment.data
+			if len(child.prefixes) > 0 {
+				hashSource.SecretPrefixes[name] = getPrefixes(child)
 			}
 		}
 	}
 
 	// Convert the hashSource to a byte slice so that it can be hashed
+	// Maps are marshalled with sorted keys, so the result is deterministic
 	hashSourceBytes, err := json.Marshal(hashSource)
 	if err != nil {
-		return "", fmt.Errorf("unable to marshal JSON: %v", err)
+		return nil, fmt.Errorf("unable to marshal JSON: %v", err)
 	}
+	return hashSourceBytes, nil
+}
 
-	hashBytes := sha256.Sum256(hashSourceBytes)
-	return fmt.Sprintf("%x", hashBytes), nil
+// sortChildren returns the children sorted by kind, namespace and name, with
+// the references of any child present more than once merged into one.
+// Children without an object are dropped.
+func sortChildren(children []configObject) []configObject {
+	present := make([]configObject, 0, len(children))
+	for _, child := range children {
+		if child.object != nil {
+			present = append(present, child)
+		}
+	}
+	sorted := mergeChildren(nil, present)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].object, sorted[j].object
+		if kindOf(a) != kindOf(b) {
+			return kindOf(a) < kindOf(b)
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+	return sorted
 }
 
 // getConfigMapData extracts all the relevant data from the ConfigMap, whether that is
-// the whole ConfigMap or only the specified keys.
+// the whole ConfigMap or only the specified keys, applying any normalizers
+// configured on the ConfigMap and any JSONPaths and thresholds configured on
+// the workload.
+// Keys that are excluded by the ConfigMap's key filter, or that could not be normalized and
+// are skipped, are omitted.
 func getConfigMapData(child configObject) map[string]string {
 	cm := *child.object.(*corev1.ConfigMap)
-	if child.allKeys {
+	stripper := getCommentStripper(&cm)
+	filter := getChildKeyFilter(child)
+	if child.allKeys && stripper == nil && len(child.jsonPaths) == 0 && len(child.thresholds) == 0 && len(child.skippedKeys) == 0 && filter == nil {
 		return cm.Data
 	}
 	keyData := make(map[string]string)
-	for key := range child.keys {
-		if value, exists := cm.Data[key]; exists {
-			keyData[key] = value
+	for key, value := range cm.Data {
+		if _, exists := child.keys[key]; !exists && !child.allKeys {
+			continue
+		}
+		if isIgnoredKey(child, filter, key) {
+			continue
+		}
+		if stripper != nil {
+			value = string(stripper.strip(key, []byte(value)))
+		}
+		if path, ok := child.jsonPaths[key]; ok {
+			value = applyJSONPath(value, path)
 		}
+		if thresholds, ok := child.thresholds[key]; ok {
+			value = applyThreshold(value, thresholds)
+		}
+		keyData[key] = value
+	}
+	return keyData
+}
+
+// getConfigMapBinaryData extracts the relevant binary data from the
+// ConfigMap, whether that is the whole of its binary data or only the
+// specified keys.
+// Keys that are excluded by the ConfigMap's key filter are omitted. Binary
+// data is never normalized.
+func getConfigMapBinaryData(child configObject) map[string][]byte {
+	cm := *child.object.(*corev1.ConfigMap)
+	filter := getChildKeyFilter(child)
+	keyData := make(map[string][]byte)
+	for key, value := range cm.BinaryData {
+		if _, exists := child.keys[key]; !exists && !child.allKeys {
+			continue
+		}
+		if isIgnoredKey(child, filter, key) {
+			continue
+		}
+		keyData[key] = value
 	}
 	return keyData
 }
 
 // getSecretData extracts all the relevant data from the Secret, whether that is
-// the whole Secret or only the specified keys.
+// the whole Secret or only the specified keys, applying any normalizers
+// configured on the Secret.
+// Keys that are excluded by the Secret's key filter, or that could not be normalized and
+// are skipped, are omitted.
 func getSecretData(child configObject) map[string][]byte {
 	s := *child.object.(*corev1.Secret)
-	if child.allKeys {
-		return s.Data
+	stripper := getCommentStripper(&s)
+	filter := getChildKeyFilter(child)
+	data := getSecretValues(&s)
+	if child.allKeys && stripper == nil && len(child.skippedKeys) == 0 && filter == nil {
+		return data
 	}
 	keyData := make(map[string][]byte)
-	for key := range child.keys {
-		if value, exists := s.Data[key]; exists {
-			keyData[key] = value
+	for key, value := range data {
+		if _, exists := child.keys[key]; !exists && !child.allKeys {
+			continue
+		}
+		if isIgnoredKey(child, filter, key) {
+			continue
+		}
+		if stripper != nil {
+			value = stripper.strip(key, value)
 		}
+		keyData[key] = value
 	}
 	return keyData
 }
 
-// setConfigHash upates the configuration hash of the given Deployment to the
-// given string
-func setConfigHash(obj podController, hash string) {
-	// Get the existing annotations
-	podTemplate := obj.GetPodTemplate()
-	annotations := podTemplate.GetAnnotations()
-	if annotations == nil {
-		annotations = make(map[string]string)
+// getSecretValues returns the data of the Secret with its stringData merged
+// over it, as the API server does when the Secret is written.
+// Secrets read from the API server never carry stringData, but Secrets built
+// by other clients may.
+func getSecretValues(s *corev1.Secret) map[string][]byte {
+	if len(s.StringData) == 0 {
+		return s.Data
+	}
+	data := make(map[string][]byte, len(s.Data)+len(s.StringData))
+	for key, value := range s.Data {
+		data[key] = value
+	}
+	for key, value := range s.StringData {
+		data[key] = []byte(value)
 	}
+	return data
+}
 
-	// Update the annotations
-	annotations[ConfigHashAnnotation] = hash
-	podTemplate.SetAnnotations(annotations)
-	obj.SetPodTemplate(podTemplate)
+// getPrefixes returns the sorted EnvFrom prefixes of the child, each in the
+// form `<container>=<prefix>`
+func getPrefixes(child configObject) []string {
+	prefixes := make([]string, 0, len(child.prefixes))
+	for prefix := range child.prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
 }
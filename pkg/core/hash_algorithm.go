@@ -0,0 +1,63 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/fnv"
+)
+
+const (
+	// HashAlgorithmSHA256 hashes configuration with sha256
+	HashAlgorithmSHA256 = "sha256"
+
+	// HashAlgorithmFNV hashes configuration with the 64 bit FNV-1a hash.
+	// This produces different hashes to HashAlgorithmSHA256.
+	HashAlgorithmFNV = "fnv"
+)
+
+// ValidateHashAlgorithm returns an error if the given algorithm is not one of
+// the HashAlgorithm constants
+func ValidateHashAlgorithm(algorithm string) error {
+	switch algorithm {
+	case HashAlgorithmSHA256, HashAlgorithmFNV:
+		return nil
+	}
+	return fmt.Errorf("unknown hash algorithm %q", algorithm)
+}
+
+// newHash returns a new hash.Hash for the given algorithm, defaulting to
+// sha256 if the algorithm is empty
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", HashAlgorithmSHA256:
+		return sha256.New(), nil
+	case HashAlgorithmFNV:
+		return fnv.New64a(), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+}
+
+// getHashAlgorithm returns the algorithm the Handler hashes configuration with
+func (h *Handler) getHashAlgorithm() string {
+	if h.opts.HashAlgorithm == "" {
+		return HashAlgorithmSHA256
+	}
+	return h.opts.HashAlgorithm
+}
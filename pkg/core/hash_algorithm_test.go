@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave hash algorithm Suite", func() {
+	var children []configObject
+
+	BeforeEach(func() {
+		children = []configObject{
+			{object: utils.ExampleConfigMap1.DeepCopy(), allKeys: true},
+			{object: utils.ExampleConfigMap2.DeepCopy(), allKeys: true},
+			{object: utils.ExampleSecret1.DeepCopy(), allKeys: true},
+		}
+	})
+
+	Context("calculateConfigHashWith", func() {
+		for _, algorithm := range []string{HashAlgorithmSHA256, HashAlgorithmFNV} {
+			algorithm := algorithm
+
+			It("returns the same "+algorithm+" hash for the same children in any order", func() {
+				h1, err := calculateConfigHashWith(children, algorithm)
+				Expect(err).NotTo(HaveOccurred())
+
+				reversed := []configObject{children[2], children[1], children[0]}
+				h2, err := calculateConfigHashWith(reversed, algorithm)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(h2).To(Equal(h1))
+			})
+
+			It("returns a different "+algorithm+" hash when a child changes", func() {
+				h1, err := calculateConfigHashWith(children, algorithm)
+				Expect(err).NotTo(HaveOccurred())
+
+				modified := utils.ExampleConfigMap1.DeepCopy()
+				modified.Data["key1"] = "modified"
+				children[0].object = modified
+				h2, err := calculateConfigHashWith(children, algorithm)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(h2).NotTo(Equal(h1))
+			})
+		}
+
+		It("returns the same hash as calculateConfigHash with sha256", func() {
+			expected, err := calculateConfigHash(children)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calculateConfigHashWith(children, HashAlgorithmSHA256)).To(Equal(expected))
+		})
+
+		It("returns a different hash with fnv", func() {
+			sha, err := calculateConfigHashWith(children, HashAlgorithmSHA256)
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := calculateConfigHashWith(children, HashAlgorithmFNV)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).NotTo(Equal(sha))
+			Expect(hash).To(HaveLen(16))
+		})
+
+		It("returns an error for an unknown algorithm", func() {
+			_, err := calculateConfigHashWith(children, "md5")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("ValidateHashAlgorithm", func() {
+		It("accepts the known algorithms", func() {
+			Expect(ValidateHashAlgorithm(HashAlgorithmSHA256)).To(Succeed())
+			Expect(ValidateHashAlgorithm(HashAlgorithmFNV)).To(Succeed())
+		})
+
+		It("rejects unknown algorithms", func() {
+			Expect(ValidateHashAlgorithm("md5")).NotTo(Succeed())
+		})
+	})
+
+	Context("with the fnv algorithm", func() {
+		It("writes a stable fnv hash to the PodTemplate across Handlers", func() {
+			d := utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+
+			// handle reconciles the Deployment, as after a restart, and
+			// returns its configuration hash
+			handle := func() string {
+				h := NewHandler(c, record.NewFakeRecorder(100), Options{HashAlgorithm: HashAlgorithmFNV})
+				_, err := h.HandleDeployment(d)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+				return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			}
+
+			hash := handle()
+			Expect(hash).To(HaveLen(16))
+			Expect(handle()).To(Equal(hash))
+		})
+	})
+})
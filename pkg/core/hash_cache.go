@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// HashCache caches what the Handler computes from each child between
+// configuration hashes. A HashCache may be shared by the Handlers of every
+// controller through their Options, so that WatchChildren evicts the children
+// deleted from the cluster from it.
+type HashCache struct {
+	// leaves caches the leaf hash of each child when Merkle hashing is
+	// enabled, and fragments the serialised data of each child otherwise
+	leaves    leafHashCache
+	fragments fragmentCache
+}
+
+// forget evicts every entry cached for the child
+func (c *HashCache) forget(obj Object) {
+	c.leaves.forget(obj)
+	c.fragments.forget(obj)
+}
+
+// newHashCachePredicate returns a Predicate for child watches that evicts the
+// children deleted from the cluster from the HashCache. Every event is
+// admitted.
+func newHashCachePredicate(cache *HashCache) predicate.Predicate {
+	return predicate.Funcs{
+		DeleteFunc: func(evt event.DeleteEvent) bool {
+			if obj, ok := evt.Object.(Object); ok {
+				cache.forget(obj)
+			}
+			return true
+		},
+	}
+}
+
+// getHashCache returns the HashCache shared through the Handler's options, or
+// the Handler's own cache if none is shared
+func (h *Handler) getHashCache() *HashCache {
+	if h.opts.HashCache != nil {
+		return h.opts.HashCache
+	}
+	return &h.cache
+}
+
+// childCache caches a value computed from each child, keyed by the identity
+// of the child and the parts of it the value is computed from, along with the
+// resourceVersion it was computed at.
+// Storing a value for a new UID or resourceVersion of a child evicts the
+// values cached for its previous ones, and forgetting a child evicts all of
+// its values, so that the cache never holds more than the latest version of
+// each child that exists.
+type childCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedEntry
+
+	// keys holds the keys of the entries of each child, by its kind,
+	// namespace and name
+	keys map[string]map[string]struct{}
+}
+
+// cachedEntry is a value computed from a child at a given resourceVersion
+type cachedEntry struct {
+	uid             types.UID
+	resourceVersion string
+	value           interface{}
+}
+
+// get returns the value cached for the child if the child has not changed
+// since it was cached
+func (c *childCache) get(child configObject) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[leafCacheKey(child)]
+	if !ok || entry.resourceVersion != child.object.GetResourceVersion() {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// set caches the value computed from the child, evicting the values cached
+// for other versions of the child
+func (c *childCache) set(child configObject, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedEntry)
+		c.keys = make(map[string]map[string]struct{})
+	}
+
+	name := childCacheName(child.object)
+	uid, resourceVersion := child.object.GetUID(), child.object.GetResourceVersion()
+	for key := range c.keys[name] {
+		if entry := c.entries[key]; entry.uid != uid || entry.resourceVersion != resourceVersion {
+			delete(c.entries, key)
+			delete(c.keys[name], key)
+		}
+	}
+
+	key := leafCacheKey(child)
+	c.entries[key] = cachedEntry{uid: uid, resourceVersion: resourceVersion, value: value}
+	if c.keys[name] == nil {
+		c.keys[name] = make(map[string]struct{})
+	}
+	c.keys[name][key] = struct{}{}
+}
+
+// forget evicts every value cached for the child
+func (c *childCache) forget(obj Object) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	name := childCacheName(obj)
+	for key := range c.keys[name] {
+		delete(c.entries, key)
+	}
+	delete(c.keys, name)
+}
+
+// childCacheName returns the kind, namespace and name identifying the child
+// in a childCache
+func childCacheName(obj Object) string {
+	return fmt.Sprintf("%s/%s/%s", kindOf(obj), obj.GetNamespace(), obj.GetName())
+}
+
+// cacheStats counts the children whose hashes were found in, or missing
+// from, a hash cache while calculating a configuration hash
+type cacheStats struct {
+	hits   int
+	misses int
+}
+
+// record counts a lookup of a child in a hash cache
+func (s *cacheStats) record(hit bool) {
+	if hit {
+		hashCacheHitsTotal.Inc()
+	} else {
+		hashCacheMissesTotal.Inc()
+	}
+	if s == nil {
+		return
+	}
+	if hit {
+		s.hits++
+	} else {
+		s.misses++
+	}
+}
+
+// fragmentCache caches the serialised data of each child so that the hash
+// source only needs to serialise children that have changed since they were
+// last seen
+type fragmentCache struct {
+	childCache
+}
+
+// cachedFragment is the serialised data of a child
+type cachedFragment struct {
+	data       json.RawMessage
+	binaryData json.RawMessage
+}
+
+// getFragment returns the serialised data of the child from the cache if the
+// child has not changed since it was cached, otherwise it serialises the
+// child and updates the cache.
+// A nil cache, or a child without a resourceVersion, is never cached.
+func (c *fragmentCache) getFragment(child configObject, stats *cacheStats) (cachedFragment, error) {
+	if c == nil || child.object.GetResourceVersion() == "" {
+		return newFragment(child)
+	}
+
+	if cached, ok := c.get(child); ok {
+		stats.record(true)
+		return cached.(cachedFragment), nil
+	}
+	stats.record(false)
+
+	fragment, err := newFragment(child)
+	if err != nil {
+		return cachedFragment{}, err
+	}
+	c.set(child, fragment)
+	return fragment, nil
+}
+
+// newFragment serialises the data of the child.
+// The binary data of a ConfigMap is left empty if it has none.
+func newFragment(child configObject) (cachedFragment, error) {
+	var data interface{}
+	var binaryData map[string][]byte
+	switch child.object.(type) {
+	case *corev1.ConfigMap:
+		data = getConfigMapData(child)
+		binaryData = getConfigMapBinaryData(child)
+	case *corev1.Secret:
+		data = getSecretData(child)
+	default:
+		data = child.extracted
+	}
+
+	fragment := cachedFragment{}
+	var err error
+	fragment.data, err = json.Marshal(data)
+	if err != nil {
+		return cachedFragment{}, fmt.Errorf("unable to marshal JSON: %v", err)
+	}
+	if len(binaryData) > 0 {
+		fragment.binaryData, err = json.Marshal(binaryData)
+		if err != nil {
+			return cachedFragment{}, fmt.Errorf("unable to marshal JSON: %v", err)
+		}
+	}
+	return fragment, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Wave hash cache Suite", func() {
+	var children []configObject
+	var hashCache *HashCache
+	var cache *fragmentCache
+	var stats *cacheStats
+
+	// hash calculates the configuration hash of the children with the cache
+	var hash = func() string {
+		hash, err := calculateCachedConfigHash(children, HashAlgorithmSHA256, cache, stats)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		children = newMerkleChildren(3, 16)
+		hashCache = &HashCache{}
+		cache = &hashCache.fragments
+		stats = &cacheStats{}
+	})
+
+	It("returns the same hash as without a cache", func() {
+		uncached, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash()).To(Equal(uncached))
+		Expect(hash()).To(Equal(uncached))
+	})
+
+	It("returns the same hash as without a cache for Secrets and binary data", func() {
+		children[0].object.(*corev1.ConfigMap).BinaryData = map[string][]byte{"binary": {0x00}}
+		children = append(children, configObject{object: &corev1.Secret{Data: map[string][]byte{"key": []byte("<value>")}}, allKeys: true})
+		children[len(children)-1].object.SetName("example")
+		children[len(children)-1].object.SetResourceVersion("1")
+
+		uncached, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash()).To(Equal(uncached))
+		Expect(hash()).To(Equal(uncached))
+	})
+
+	It("reuses the fragments of unchanged children", func() {
+		hash()
+		Expect(stats.misses).To(Equal(3))
+		Expect(stats.hits).To(BeZero())
+
+		stats = &cacheStats{}
+		hash()
+		Expect(stats.hits).To(Equal(3))
+		Expect(stats.misses).To(BeZero())
+	})
+
+	It("invalidates the fragment of a child when its resourceVersion changes", func() {
+		original := hash()
+		updateMerkleChild(children[0], "modified")
+
+		stats = &cacheStats{}
+		updated := hash()
+		Expect(updated).NotTo(Equal(original))
+		Expect(stats.misses).To(Equal(1))
+		Expect(stats.hits).To(Equal(2))
+
+		uncached, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(Equal(uncached))
+	})
+
+	It("does not reuse the fragment of a recreated child", func() {
+		hash()
+		children[0].object.SetUID(types.UID("recreated"))
+
+		stats = &cacheStats{}
+		hash()
+		Expect(stats.misses).To(Equal(1))
+	})
+
+	It("never caches children without a resourceVersion", func() {
+		children[0].object.SetResourceVersion("")
+		hash()
+		Expect(cache.entries).To(HaveLen(len(children) - 1))
+	})
+
+	It("evicts the fragments of previous versions of a child", func() {
+		// Another workload referencing only some of the keys of the first child
+		partial := configObject{object: children[0].object, keys: map[string]struct{}{"key": {}}}
+		_, err := calculateCachedConfigHash([]configObject{partial}, HashAlgorithmSHA256, cache, stats)
+		Expect(err).NotTo(HaveOccurred())
+		hash()
+		Expect(cache.entries).To(HaveLen(len(children) + 1))
+
+		updateMerkleChild(children[0], "modified")
+		hash()
+		Expect(cache.entries).To(HaveLen(len(children)))
+	})
+
+	It("evicts the fragments of a recreated child", func() {
+		hash()
+		children[0].object.SetUID(types.UID("recreated"))
+		hash()
+		Expect(cache.entries).To(HaveLen(len(children)))
+	})
+
+	It("evicts the fragments of a deleted child", func() {
+		hash()
+		deleted := children[0].object
+		Expect(newHashCachePredicate(hashCache).Delete(event.DeleteEvent{Meta: deleted, Object: deleted})).To(BeTrue())
+		Expect(cache.entries).To(HaveLen(len(children) - 1))
+		Expect(cache.keys).NotTo(HaveKey(childCacheName(deleted)))
+
+		stats = &cacheStats{}
+		hash()
+		Expect(stats.misses).To(Equal(1))
+	})
+})
+
+func BenchmarkFlatHashRepeatedReconcile(b *testing.B) {
+	children := newMerkleChildren(benchmarkChildren, benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := calculateConfigHash(children); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCachedFlatHashRepeatedReconcile(b *testing.B) {
+	children := newMerkleChildren(benchmarkChildren, benchmarkSize)
+	cache := &fragmentCache{}
+	if _, err := calculateCachedConfigHash(children, HashAlgorithmSHA256, cache, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := calculateCachedConfigHash(children, HashAlgorithmSHA256, cache, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
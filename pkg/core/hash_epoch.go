@@ -0,0 +1,54 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// updateConfigHash sets the configuration hash of the given podController,
+// taking its hash epoch into account, and returns true if the hash was
+// adopted rather than set on the PodTemplate.
+//
+// When the hash epoch differs from the last adopted epoch, the hash is
+// recorded on the metadata as adopted at the new epoch and the PodTemplate is
+// left untouched. The PodTemplate is then only updated once the hash differs
+// from the adopted hash. The hash is written to the PodTemplate under the
+// given annotation key.
+func updateConfigHash(obj podController, hash string, key string) bool {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	epoch := annotations[HashEpochAnnotation]
+	if epoch != "" && epoch != annotations[AdoptedHashEpochAnnotation] {
+		annotations[AdoptedHashEpochAnnotation] = epoch
+		annotations[AdoptedConfigHashAnnotation] = hash
+		obj.SetAnnotations(annotations)
+		return true
+	}
+
+	if adopted, ok := annotations[AdoptedConfigHashAnnotation]; ok {
+		if adopted == hash {
+			return true
+		}
+		// The configuration has changed since it was adopted, resume normal
+		// updates of the PodTemplate
+		delete(annotations, AdoptedConfigHashAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+
+	setConfigHash(obj, hash, key)
+	return false
+}
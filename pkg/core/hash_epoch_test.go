@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+)
+
+var _ = Describe("Wave hash epoch Suite", func() {
+	var podControllerDeployment podController
+
+	BeforeEach(func() {
+		podControllerDeployment = &deployment{utils.ExampleDeployment.DeepCopy()}
+		setConfigHash(podControllerDeployment, "original", ConfigHashAnnotation)
+	})
+
+	Context("updateConfigHash", func() {
+		It("sets the hash on the PodTemplate when no epoch is set", func() {
+			Expect(updateConfigHash(podControllerDeployment, "changed", ConfigHashAnnotation)).To(BeFalse())
+			Expect(podControllerDeployment.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "changed"))
+		})
+
+		Context("when the epoch is bumped", func() {
+			BeforeEach(func() {
+				podControllerDeployment.SetAnnotations(map[string]string{HashEpochAnnotation: "2"})
+			})
+
+			It("adopts the hash without changing the PodTemplate", func() {
+				Expect(updateConfigHash(podControllerDeployment, "renormalized", ConfigHashAnnotation)).To(BeTrue())
+				Expect(podControllerDeployment.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "original"))
+				Expect(podControllerDeployment.GetAnnotations()).To(HaveKeyWithValue(AdoptedHashEpochAnnotation, "2"))
+				Expect(podControllerDeployment.GetAnnotations()).To(HaveKeyWithValue(AdoptedConfigHashAnnotation, "renormalized"))
+			})
+
+			It("keeps the PodTemplate unchanged while the hash matches the adopted hash", func() {
+				updateConfigHash(podControllerDeployment, "renormalized", ConfigHashAnnotation)
+				Expect(updateConfigHash(podControllerDeployment, "renormalized", ConfigHashAnnotation)).To(BeTrue())
+				Expect(podControllerDeployment.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "original"))
+			})
+
+			It("updates the PodTemplate once the hash changes again", func() {
+				updateConfigHash(podControllerDeployment, "renormalized", ConfigHashAnnotation)
+				Expect(updateConfigHash(podControllerDeployment, "changed", ConfigHashAnnotation)).To(BeFalse())
+				Expect(podControllerDeployment.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "changed"))
+				Expect(podControllerDeployment.GetAnnotations()).NotTo(HaveKey(AdoptedConfigHashAnnotation))
+				Expect(podControllerDeployment.GetAnnotations()).To(HaveKeyWithValue(AdoptedHashEpochAnnotation, "2"))
+			})
+
+			It("does not adopt again until the epoch is bumped again", func() {
+				updateConfigHash(podControllerDeployment, "renormalized", ConfigHashAnnotation)
+				updateConfigHash(podControllerDeployment, "changed", ConfigHashAnnotation)
+				Expect(updateConfigHash(podControllerDeployment, "changed-again", ConfigHashAnnotation)).To(BeFalse())
+
+				annotations := podControllerDeployment.GetAnnotations()
+				annotations[HashEpochAnnotation] = "3"
+				podControllerDeployment.SetAnnotations(annotations)
+				Expect(updateConfigHash(podControllerDeployment, "renormalized-again", ConfigHashAnnotation)).To(BeTrue())
+				Expect(podControllerDeployment.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "changed-again"))
+			})
+		})
+	})
+})
@@ -0,0 +1,144 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hashFormatSeparator separates the hash format from the digest of a
+// configuration hash prefixed with its format
+const hashFormatSeparator = ":"
+
+// hashFormats lists the formats of the hashes computed by the Handler
+var hashFormats = []string{defaultHashFormat, fnvHashFormat, merkleHashFormat}
+
+// getHashFormat returns the format of the hashes computed by the Handler
+func (h *Handler) getHashFormat() string {
+	if h.opts.MerkleHash {
+		return merkleHashFormat
+	}
+	if h.getHashAlgorithm() == HashAlgorithmFNV {
+		return fnvHashFormat
+	}
+	return defaultHashFormat
+}
+
+// calculateConfigHashWithFormat calculates the configuration hash of the
+// children in the given hash format, whatever format the Handler computes.
+// Incremental hashing always uses sha256.
+func (h *Handler) calculateConfigHashWithFormat(children []configObject, format string, stats *cacheStats) (string, error) {
+	switch format {
+	case defaultHashFormat:
+		return calculateCachedConfigHash(children, HashAlgorithmSHA256, &h.getHashCache().fragments, stats)
+	case fnvHashFormat:
+		return calculateCachedConfigHash(children, HashAlgorithmFNV, &h.getHashCache().fragments, stats)
+	case merkleHashFormat:
+		return h.getHashCache().leaves.calculateMerkleConfigHash(children, stats)
+	}
+	return "", fmt.Errorf("unknown hash format %q", format)
+}
+
+// hashConfig hashes the children of the instance in the given hash format and
+// folds in everything else the configuration hash depends on
+func (h *Handler) hashConfig(instance podController, children []configObject, missingChildren []string, format string) (string, error) {
+	hash, err := h.calculateConfigHash(instance, children, format)
+	if err != nil {
+		return "", fmt.Errorf("error calculating configuration hash: %v", err)
+	}
+
+	// Fold in any digests computed by other operators
+	hash, err = h.addExternalDigests(instance, hash)
+	if err != nil {
+		return "", fmt.Errorf("error adding external digests: %v", err)
+	}
+
+	// Fold in any required children that are missing
+	hash = addMissingChildren(hash, missingChildren)
+
+	// Fold in the token used to force a rollout
+	hash = addForceRolloutToken(instance, hash)
+
+	// Fold in the salt of the instance's hash
+	return addHashSalt(instance, hash), nil
+}
+
+// isHashFormat returns true if the format is one of the formats of the hashes
+// computed by the Handler
+func isHashFormat(format string) bool {
+	for _, f := range hashFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixedHash splits a configuration hash prefixed with its format into
+// the format and the digest. Hashes without a prefix have an empty format.
+func parsePrefixedHash(hash string) (string, string) {
+	parts := strings.SplitN(hash, hashFormatSeparator, 2)
+	if len(parts) != 2 {
+		return "", hash
+	}
+	return parts[0], parts[1]
+}
+
+// formatConfigHash prefixes the configuration hash computed from the children
+// and missing children with the Handler's hash format, if hash version
+// prefixes are enabled.
+//
+// If the hash on the PodTemplate of the instance was computed in another
+// format, it is recomputed through hashConfig in that format, and kept if it
+// is unchanged so that changing the hash format does not trigger a rollout.
+// Hashes without a prefix are compared in every format, and hashes of formats
+// unknown to this version of Wave are replaced.
+func (h *Handler) formatConfigHash(instance podController, children []configObject, missingChildren []string, hash string) (string, error) {
+	if !h.opts.HashVersionPrefix {
+		return hash, nil
+	}
+	format := h.getHashFormat()
+	prefixed := format + hashFormatSeparator + hash
+
+	stored, ok := instance.GetPodTemplate().GetAnnotations()[h.getHashAnnotation()]
+	if !ok || stored == prefixed {
+		return prefixed, nil
+	}
+	storedFormat, digest := parsePrefixedHash(stored)
+	if storedFormat == format {
+		return prefixed, nil
+	}
+	formats := hashFormats
+	if storedFormat != "" {
+		if !isHashFormat(storedFormat) {
+			return prefixed, nil
+		}
+		formats = []string{storedFormat}
+	}
+
+	for _, f := range formats {
+		equivalent, err := h.hashConfig(instance, children, missingChildren, f)
+		if err != nil {
+			return "", err
+		}
+		if equivalent == digest {
+			return stored, nil
+		}
+	}
+	return prefixed, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave hash format Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+
+	// handle reconciles the Deployment with the given options, as after a
+	// restart, and returns its configuration hash
+	var handle = func(opts Options) string {
+		h := NewHandler(c, record.NewFakeRecorder(100), opts)
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+	}
+
+	// modifyConfigMap changes a ConfigMap referenced by the Deployment
+	var modifyConfigMap = func() {
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: utils.ExampleConfigMap1.GetNamespace(), Name: utils.ExampleConfigMap1.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+	})
+
+	It("prefixes the hash with its format", func() {
+		hash := handle(Options{HashAlgorithm: HashAlgorithmFNV, HashVersionPrefix: true})
+		Expect(hash).To(HavePrefix(fnvHashFormat + hashFormatSeparator))
+		Expect(hash).To(HaveLen(len(fnvHashFormat+hashFormatSeparator) + 16))
+	})
+
+	It("does not prefix the hash by default", func() {
+		Expect(handle(Options{})).NotTo(ContainSubstring(hashFormatSeparator))
+	})
+
+	It("keeps an unprefixed hash when the prefix is enabled", func() {
+		original := handle(Options{})
+		Expect(handle(Options{HashVersionPrefix: true})).To(Equal(original))
+	})
+
+	It("keeps the hash when only the format changes", func() {
+		original := handle(Options{HashVersionPrefix: true})
+		Expect(original).To(HavePrefix(defaultHashFormat + hashFormatSeparator))
+
+		Expect(handle(Options{HashAlgorithm: HashAlgorithmFNV, HashVersionPrefix: true})).To(Equal(original))
+		Expect(handle(Options{MerkleHash: true, HashVersionPrefix: true})).To(Equal(original))
+	})
+
+	It("keeps an unprefixed hash of another algorithm", func() {
+		original := handle(Options{HashAlgorithm: HashAlgorithmFNV})
+		Expect(handle(Options{HashVersionPrefix: true})).To(Equal(original))
+	})
+
+	It("keeps the hash when only the format changes while a child is missing", func() {
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue, RollOnMissingAnnotation: requiredAnnotationValue})
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+
+		original := handle(Options{HashVersionPrefix: true})
+		Expect(handle(Options{HashAlgorithm: HashAlgorithmFNV, HashVersionPrefix: true})).To(Equal(original))
+	})
+
+	It("rolls out in the new format when the configuration changes", func() {
+		original := handle(Options{HashVersionPrefix: true})
+		Expect(handle(Options{HashAlgorithm: HashAlgorithmFNV, HashVersionPrefix: true})).To(Equal(original))
+
+		modifyConfigMap()
+		hash := handle(Options{HashAlgorithm: HashAlgorithmFNV, HashVersionPrefix: true})
+		Expect(hash).NotTo(Equal(original))
+		Expect(hash).To(HavePrefix(fnvHashFormat + hashFormatSeparator))
+	})
+
+	It("rolls out when the configuration changes in the same format", func() {
+		original := handle(Options{HashVersionPrefix: true})
+		modifyConfigMap()
+		Expect(handle(Options{HashVersionPrefix: true})).NotTo(Equal(original))
+	})
+})
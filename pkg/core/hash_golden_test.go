@@ -0,0 +1,284 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// updateGolden rewrites the golden hashes from the current hash algorithm,
+// for use when a change to the hashes is intended
+var updateGolden = flag.Bool("update-golden", false, "Rewrite the golden configuration hashes in testdata")
+
+// goldenHashesPath is the file holding the golden configuration hash of each
+// fixture
+var goldenHashesPath = filepath.Join("testdata", "config_hashes.golden")
+
+// goldenConfigMap returns the ConfigMap used by the golden hash fixtures
+func goldenConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-config", Namespace: "golden", UID: "golden-config"},
+		Data: map[string]string{
+			"app.yaml":      "log-level: info\nreplicas: 3\n",
+			"settings.json": `{"database":{"host":"db","maxConnections":20},"ratio":0.25,"features":{"b":true,"a":false,"c":1e21}}`,
+			"timeout":       "30",
+			"message":       "héllo wörld",
+		},
+		BinaryData: map[string][]byte{
+			"logo.png": {0x89, 0x50, 0x4e, 0x47, 0x00, 0xff},
+		},
+	}
+}
+
+// goldenSecret returns the Secret used by the golden hash fixtures
+func goldenSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-secret", Namespace: "golden", UID: "golden-secret"},
+		Type:       corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"username": []byte("admin"),
+			"password": []byte("s3cr3t"),
+			"token":    {0x00, 0x01, 0xfe, 0xff},
+		},
+	}
+}
+
+// goldenTLSSecret returns the TLS Secret used by the golden hash fixtures
+func goldenTLSSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-tls", Namespace: "golden", UID: "golden-tls"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("certificate"),
+			corev1.TLSPrivateKeyKey: []byte("private key"),
+			"ca.crt":                []byte("ca bundle"),
+		},
+	}
+}
+
+// goldenDeployment returns a Deployment whose containers reference the golden
+// children in several ways
+func goldenDeployment() *appsv1.Deployment {
+	optional := true
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden", Namespace: "golden", UID: "golden"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{
+						Name:  "init",
+						Image: "init",
+						EnvFrom: []corev1.EnvFromSource{{
+							Prefix: "INIT_",
+							ConfigMapRef: &corev1.ConfigMapEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "golden-config"},
+							},
+						}},
+					}},
+					Containers: []corev1.Container{
+						{
+							Name:  "app",
+							Image: "app",
+							Env: []corev1.EnvVar{{
+								Name: "TIMEOUT",
+								ValueFrom: &corev1.EnvVarSource{
+									ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "golden-config"},
+										Key:                  "timeout",
+									},
+								},
+							}},
+							EnvFrom: []corev1.EnvFromSource{{
+								SecretRef: &corev1.SecretEnvSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "golden-secret"},
+								},
+							}},
+						},
+						{
+							Name:  "sidecar",
+							Image: "sidecar",
+							Env: []corev1.EnvVar{{
+								Name: "PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "golden-secret"},
+										Key:                  "password",
+									},
+								},
+							}},
+							VolumeMounts: []corev1.VolumeMount{{Name: "tls", MountPath: "/tls"}},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "tls",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{SecretName: "golden-tls"},
+							},
+						},
+						{
+							Name: "missing",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "golden-missing"},
+									Optional:             &optional,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// goldenHashes returns the configuration hash of each fixture, keyed by the
+// name of the fixture
+func goldenHashes() (map[string]string, error) {
+	fixtures := map[string]func() (string, error){
+		"configmap-all-keys": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), allKeys: true}})
+		},
+		"configmap-single-key": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), keys: map[string]struct{}{"timeout": {}}}})
+		},
+		"configmap-binary-data": func() (string, error) {
+			cm := goldenConfigMap()
+			cm.Data = nil
+			return calculateConfigHash([]configObject{{object: cm, allKeys: true}})
+		},
+		"configmap-prefixes": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), allKeys: true, prefixes: map[string]struct{}{"B_": {}, "A_": {}}}})
+		},
+		"configmap-json-path": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), allKeys: true, jsonPaths: map[string]string{"settings.json": "$.database.maxConnections,$.ratio"}}})
+		},
+		"configmap-json-path-wildcard": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), allKeys: true, jsonPaths: map[string]string{"settings.json": "$.features.*"}}})
+		},
+		"configmap-threshold": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenConfigMap(), allKeys: true, thresholds: map[string][]float64{"timeout": {10, 60}}}})
+		},
+		"secret-all-keys": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenSecret(), allKeys: true}})
+		},
+		"secret-single-key": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenSecret(), keys: map[string]struct{}{"password": {}}}})
+		},
+		"secret-tls": func() (string, error) {
+			return calculateConfigHash([]configObject{{object: goldenTLSSecret(), allKeys: true}})
+		},
+		"children-fnv": func() (string, error) {
+			return calculateConfigHashWith([]configObject{
+				{object: goldenConfigMap(), allKeys: true},
+				{object: goldenSecret(), allKeys: true},
+			}, HashAlgorithmFNV)
+		},
+		"children-merkle": func() (string, error) {
+			return (&leafHashCache{}).calculateMerkleConfigHash([]configObject{
+				{object: goldenConfigMap(), allKeys: true},
+				{object: goldenSecret(), allKeys: true},
+				{object: goldenTLSSecret(), allKeys: true},
+			}, nil)
+		},
+		"deployment-multi-container": func() (string, error) {
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, goldenConfigMap(), goldenSecret(), goldenTLSSecret())
+			h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+			return h.ComputeConfigHash(goldenDeployment())
+		},
+		"deployment-multi-container-prefixed": func() (string, error) {
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, goldenConfigMap(), goldenSecret(), goldenTLSSecret())
+			h := NewHandler(c, record.NewFakeRecorder(100), Options{HashVersionPrefix: true})
+			return h.ComputeConfigHash(goldenDeployment())
+		},
+	}
+
+	hashes := make(map[string]string, len(fixtures))
+	for name, fixture := range fixtures {
+		hash, err := fixture()
+		if err != nil {
+			return nil, fmt.Errorf("error hashing fixture %s: %v", name, err)
+		}
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// formatGoldenHashes returns the hashes as sorted lines of a fixture name
+// and its hash
+func formatGoldenHashes(hashes map[string]string) string {
+	lines := make([]string, 0, len(hashes))
+	for name, hash := range hashes {
+		lines = append(lines, name+" "+hash)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var _ = Describe("Wave golden hashes Suite", func() {
+	It("computes the golden hash of every fixture", func() {
+		hashes, err := goldenHashes()
+		Expect(err).NotTo(HaveOccurred())
+
+		if *updateGolden {
+			Expect(ioutil.WriteFile(goldenHashesPath, []byte(formatGoldenHashes(hashes)), 0644)).To(Succeed())
+		}
+		golden, err := ioutil.ReadFile(goldenHashesPath)
+		Expect(err).NotTo(HaveOccurred())
+		// A change to these hashes rolls out every workload when Wave is
+		// upgraded. Only update them with -update-golden when that is intended.
+		Expect(formatGoldenHashes(hashes)).To(Equal(string(golden)))
+	})
+
+	It("computes the same hashes every time", func() {
+		first, err := goldenHashes()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 20; i++ {
+			hashes, err := goldenHashes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hashes).To(Equal(first))
+		}
+	})
+
+	It("computes the same hash whatever the order of the children", func() {
+		children := []configObject{
+			{object: goldenConfigMap(), allKeys: true},
+			{object: goldenSecret(), allKeys: true},
+			{object: goldenTLSSecret(), allKeys: true},
+		}
+		reversed := []configObject{children[2], children[1], children[0]}
+		h1, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		h2, err := calculateConfigHash(reversed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h2).To(Equal(h1))
+	})
+})
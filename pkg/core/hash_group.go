@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// getHashGroup returns the name of the hash group the podController belongs
+// to, or an empty string if the annotation is not set
+func getHashGroup(obj podController) string {
+	return obj.GetAnnotations()[HashGroupAnnotation]
+}
+
+// isExcludedFromAggregate returns true if the given podController has the
+// exclude-from-aggregate annotation set to true
+func isExcludedFromAggregate(obj podController) bool {
+	return obj.GetAnnotations()[ExcludeFromAggregateAnnotation] == requiredAnnotationValue
+}
+
+// getHashGroupChildren returns the children referenced by the instance merged
+// with the children referenced by every other member of its hash group.
+//
+// Every member of a group therefore tracks, and hashes, the same set of
+// children, so a change to the configuration of any member rolls all of the
+// members. Members are only ever read, so computing the group never triggers
+// a reconcile of another member.
+//
+// Members excluded from the aggregate still track the children of the rest of
+// the group, but their own children are omitted from the other members.
+func (h *Handler) getHashGroupChildren(instance podController, current []configObject) ([]configObject, error) {
+	group := getHashGroup(instance)
+	if group == "" {
+		return current, nil
+	}
+
+	members, err := h.listHashGroupMembers(instance.GetNamespace(), group)
+	if err != nil {
+		return []configObject{}, fmt.Errorf("error listing members of hash group %s: %v", group, err)
+	}
+
+	var errs []string
+	children := current
+	for _, member := range members {
+		if member.GetUID() == instance.GetUID() || isExcludedFromAggregate(member) {
+			continue
+		}
+		memberChildren, err := h.getCurrentChildren(member)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", kindOf(member), member.GetName(), err))
+			continue
+		}
+		children = mergeChildren(children, memberChildren)
+	}
+	if len(errs) > 0 {
+		return []configObject{}, fmt.Errorf("error(s) encountered when getting children of hash group %s: %s", group, strings.Join(errs, ", "))
+	}
+
+	return children, nil
+}
+
+// listHashGroupMembers lists all Wave enabled workloads of every kind Wave
+// reconciles in the namespace that belong to the given hash group
+func (h *Handler) listHashGroupMembers(namespace, group string) ([]podController, error) {
+	candidates := []podController{}
+	for _, list := range h.getWorkloadLists() {
+		err := h.List(context.TODO(), list, client.InNamespace(namespace))
+		if err != nil {
+			return []podController{}, fmt.Errorf("error listing workloads: %v", err)
+		}
+		candidates = append(candidates, podControllersFromList(list)...)
+	}
+
+	members := []podController{}
+	for _, candidate := range candidates {
+		if getHashGroup(candidate) == group && h.isEnabled(candidate) && !toBeDeleted(candidate) {
+			members = append(members, candidate)
+		}
+	}
+	return members, nil
+}
+
+// mergeChildren merges two lists of children, combining the metadata of any
+// child present in both lists so that each child appears only once
+func mergeChildren(a, b []configObject) []configObject {
+	merged := []configObject{}
+	index := make(map[string]int)
+	for _, child := range append(append([]configObject{}, a...), b...) {
+		key := kindOf(child.object) + "/" + child.object.GetNamespace() + "/" + child.object.GetName()
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, child)
+			continue
+		}
+		merged[i] = mergeConfigObjects(merged[i], child)
+	}
+	return merged
+}
+
+// mergeConfigObjects combines the metadata of two references to the same child
+func mergeConfigObjects(a, b configObject) configObject {
+	out := configObject{
+		object:    a.object,
+		required:  a.required || b.required,
+		allKeys:   a.allKeys || b.allKeys,
+		extracted: a.extracted,
+		typeKeys:  a.typeKeys,
+
+		jsonPaths:  mergeJSONPaths(a.jsonPaths, b.jsonPaths),
+		thresholds: mergeThresholds(a.thresholds, b.thresholds),
+	}
+	for prefix := range a.prefixes {
+		if out.prefixes == nil {
+			out.prefixes = make(map[string]struct{})
+		}
+		out.prefixes[prefix] = struct{}{}
+	}
+	for prefix := range b.prefixes {
+		if out.prefixes == nil {
+			out.prefixes = make(map[string]struct{})
+		}
+		out.prefixes[prefix] = struct{}{}
+	}
+	if out.allKeys {
+		return out
+	}
+	out.keys = make(map[string]struct{})
+	for key := range a.keys {
+		out.keys[key] = struct{}{}
+	}
+	for key := range b.keys {
+		out.keys[key] = struct{}{}
+	}
+	return out
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// newHashGroupMember creates a Deployment in the hash group that only
+// references the given ConfigMap
+func newHashGroupMember(name string, cm *corev1.ConfigMap) *appsv1.Deployment {
+	d := utils.ExampleDeployment.DeepCopy()
+	d.SetName(name)
+	d.SetAnnotations(map[string]string{
+		RequiredAnnotation:  requiredAnnotationValue,
+		HashGroupAnnotation: "release-unit-a",
+	})
+	d.Spec.Template.Spec.Volumes = []corev1.Volume{}
+	d.Spec.Template.Spec.Containers = []corev1.Container{
+		{
+			Name:  "container",
+			Image: "container",
+			EnvFrom: []corev1.EnvFromSource{
+				{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: cm.GetName(),
+						},
+					},
+				},
+			},
+		},
+	}
+	return d
+}
+
+var _ = Describe("Wave hash group Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var cm3 *corev1.ConfigMap
+	var members []*appsv1.Deployment
+
+	var reconcileMembers = func() {
+		for _, member := range members {
+			m.Get(member, timeout).Should(Succeed())
+			_, err := h.HandleDeployment(member)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		h = NewHandler(c, mgr.GetEventRecorderFor("wave"), Options{})
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		cm3 = utils.ExampleConfigMap3.DeepCopy()
+		for _, cm := range []*corev1.ConfigMap{cm1, cm2, cm3} {
+			m.Create(cm).Should(Succeed())
+			m.Get(cm, timeout).Should(Succeed())
+		}
+
+		members = []*appsv1.Deployment{
+			newHashGroupMember("member-a", cm1),
+			newHashGroupMember("member-b", cm2),
+			newHashGroupMember("member-c", cm3),
+		}
+		for _, member := range members {
+			m.Create(member).Should(Succeed())
+		}
+		reconcileMembers()
+	})
+
+	AfterEach(func() {
+		for _, member := range members {
+			m.Update(member, func(obj utils.Object) utils.Object {
+				obj.SetFinalizers([]string{})
+				return obj
+			}, timeout).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Adds OwnerReferences from every member to every member's children", func() {
+		for _, member := range members {
+			ownerRef := utils.GetOwnerRefDeployment(member)
+			for _, cm := range []*corev1.ConfigMap{cm1, cm2, cm3} {
+				m.Eventually(cm, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		}
+	})
+
+	It("Sets the same config hash on every member", func() {
+		hash := members[0].Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		Expect(hash).NotTo(BeEmpty())
+		for _, member := range members {
+			m.Eventually(member, timeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, hash)))
+		}
+	})
+
+	Context("When one member's ConfigMap is updated", func() {
+		var originalHashes map[string]string
+
+		BeforeEach(func() {
+			originalHashes = make(map[string]string)
+			for _, member := range members {
+				originalHashes[member.GetName()] = member.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			}
+
+			m.Update(cm1, func(obj utils.Object) utils.Object {
+				cm := obj.(*corev1.ConfigMap)
+				cm.Data["key1"] = "modified"
+				return cm
+			}, timeout).Should(Succeed())
+			m.Eventually(cm1, timeout).Should(WithTransform(func(obj utils.Object) string {
+				return obj.(*corev1.ConfigMap).Data["key1"]
+			}, Equal("modified")))
+
+			reconcileMembers()
+		})
+
+		It("Updates the config hash of every member", func() {
+			for _, member := range members {
+				m.Eventually(member, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHashes[member.GetName()])))
+			}
+		})
+	})
+
+})
+
+var _ = Describe("Wave mergeChildren Suite", func() {
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var cm3 *corev1.ConfigMap
+
+	BeforeEach(func() {
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		cm3 = utils.ExampleConfigMap3.DeepCopy()
+	})
+
+	Context("mergeChildren", func() {
+		It("merges the metadata of children present in both lists", func() {
+			merged := mergeChildren(
+				[]configObject{
+					{object: cm1, required: true, keys: map[string]struct{}{"key1": {}}},
+					{object: cm2, allKeys: true},
+				},
+				[]configObject{
+					{object: cm1, keys: map[string]struct{}{"key2": {}}},
+					{object: cm3, allKeys: true},
+				},
+			)
+
+			Expect(merged).To(HaveLen(3))
+			Expect(merged).To(ContainElement(configObject{
+				object:   cm1,
+				required: true,
+				keys:     map[string]struct{}{"key1": {}, "key2": {}},
+			}))
+		})
+
+		It("tracks all keys if either reference uses all keys", func() {
+			merged := mergeChildren(
+				[]configObject{{object: cm1, keys: map[string]struct{}{"key1": {}}}},
+				[]configObject{{object: cm1, allKeys: true}},
+			)
+
+			Expect(merged).To(ConsistOf(configObject{object: cm1, allKeys: true}))
+		})
+
+		It("does not conflate a ConfigMap and a Secret sharing a name", func() {
+			s1 := utils.ExampleSecret1.DeepCopy()
+			merged := mergeChildren(
+				[]configObject{{object: cm1, allKeys: true}},
+				[]configObject{{object: s1, allKeys: true}},
+			)
+
+			Expect(merged).To(HaveLen(2))
+		})
+	})
+})
+
+var _ = Describe("Wave hash group exclusion Suite", func() {
+	var c client.Client
+	var h *Handler
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var member *appsv1.Deployment
+	var excluded *appsv1.Deployment
+
+	// getMemberHash calculates the config hash of the given member, including
+	// the children of its hash group
+	var getMemberHash = func(d *appsv1.Deployment) string {
+		current, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		current, err = h.getHashGroupChildren(&deployment{d}, current)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := calculateConfigHash(current)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+
+		member = newHashGroupMember("member-a", cm1)
+		member.SetUID(types.UID("member-a"))
+		excluded = newHashGroupMember("member-b", cm2)
+		excluded.SetUID(types.UID("member-b"))
+		annotations := excluded.GetAnnotations()
+		annotations[ExcludeFromAggregateAnnotation] = requiredAnnotationValue
+		excluded.SetAnnotations(annotations)
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, cm1, cm2, member, excluded)
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	It("omits the excluded member's children from the other members", func() {
+		current, err := h.getCurrentChildren(&deployment{member})
+		Expect(err).NotTo(HaveOccurred())
+		children, err := h.getHashGroupChildren(&deployment{member}, current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(children).To(Equal(current))
+	})
+
+	It("does not change the other members' hash when the excluded member's configuration changes", func() {
+		original := getMemberHash(member)
+
+		cm2.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm2)).To(Succeed())
+
+		Expect(getMemberHash(member)).To(Equal(original))
+	})
+
+	It("still includes the children of the rest of the group in the excluded member's hash", func() {
+		original := getMemberHash(excluded)
+
+		cm1.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm1)).To(Succeed())
+
+		Expect(getMemberHash(excluded)).NotTo(Equal(original))
+	})
+})
+
+var _ = Describe("Wave hash group kinds Suite", func() {
+	var h *Handler
+	var cloneSetKind = schema.GroupVersionKind{Group: "apps.kruise.io", Version: "v1alpha1", Kind: "CloneSet"}
+
+	BeforeEach(func() {
+		cm1 := utils.ExampleConfigMap1.DeepCopy()
+		cm2 := utils.ExampleConfigMap2.DeepCopy()
+		cm3 := utils.ExampleConfigMap3.DeepCopy()
+
+		d := newHashGroupMember("member-a", cm1)
+
+		template := newHashGroupMember("member-b", cm2)
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: template.ObjectMeta,
+			Spec:       appsv1.ReplicaSetSpec{Selector: template.Spec.Selector, Template: template.Spec.Template},
+		}
+
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newHashGroupMember("member-c", cm3))
+		Expect(err).NotTo(HaveOccurred())
+		cloneSet := &unstructured.Unstructured{Object: content}
+		cloneSet.SetGroupVersionKind(cloneSetKind)
+
+		kinds := &WorkloadKinds{}
+		kinds.Add(cloneSetKind)
+		c := &customResourceClient{
+			Client:  fake.NewFakeClientWithScheme(scheme.Scheme, cm1, cm2, cm3, d, rs),
+			objects: map[client.ObjectKey]*unstructured.Unstructured{{Namespace: "default", Name: "member-c"}: cloneSet},
+		}
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{EnableReplicaSets: true, WorkloadKinds: kinds})
+	})
+
+	It("lists the members of every kind Wave reconciles", func() {
+		members, err := h.listHashGroupMembers("default", "release-unit-a")
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, member := range members {
+			names = append(names, kindOf(member)+"/"+member.GetName())
+		}
+		Expect(names).To(ConsistOf("Deployment/member-a", "ReplicaSet/member-b", "CloneSet/member-c"))
+	})
+
+	It("only lists the members of the built in kinds without WorkloadKinds", func() {
+		h.opts.WorkloadKinds = nil
+		members, err := h.listHashGroupMembers("default", "release-unit-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Wave hash ordering Suite", func() {
+	var children []configObject
+
+	// hashOf returns the configuration hash of the children
+	var hashOf = func(children []configObject) string {
+		hash, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	// reversed returns the children in reverse order
+	var reversed = func(children []configObject) []configObject {
+		out := make([]configObject, 0, len(children))
+		for i := len(children) - 1; i >= 0; i-- {
+			out = append(out, children[i])
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		s := utils.ExampleSecret1.DeepCopy()
+		s.Data = map[string][]byte{"b": []byte("2"), "a": []byte("1"), "c": []byte("3")}
+		children = []configObject{
+			{object: utils.ExampleConfigMap1.DeepCopy(), allKeys: true},
+			{object: utils.ExampleConfigMap2.DeepCopy(), keys: map[string]struct{}{"key1": {}, "key3": {}}},
+			{object: s, allKeys: true},
+			{object: utils.ExampleConfigMap3.DeepCopy(), allKeys: true, prefixes: map[string]struct{}{"app=B_": {}, "app=A_": {}}},
+		}
+	})
+
+	It("returns the same hash for children in different orders", func() {
+		Expect(hashOf(reversed(children))).To(Equal(hashOf(children)))
+		Expect(hashOf([]configObject{children[2], children[0], children[3], children[1]})).To(Equal(hashOf(children)))
+	})
+
+	It("returns the same hash when a child is listed more than once", func() {
+		duplicated := append([]configObject{children[1]}, children...)
+		Expect(hashOf(duplicated)).To(Equal(hashOf(children)))
+		Expect(hashOf(reversed(duplicated))).To(Equal(hashOf(children)))
+	})
+
+	It("returns the same hash regardless of the insertion order of data keys", func() {
+		s := children[2].object.(*corev1.Secret)
+		reordered := s.DeepCopy()
+		reordered.Data = map[string][]byte{}
+		for _, key := range []string{"c", "a", "b"} {
+			reordered.Data[key] = s.Data[key]
+		}
+		other := append([]configObject{}, children...)
+		other[2] = configObject{object: reordered, allKeys: true}
+		Expect(hashOf(other)).To(Equal(hashOf(children)))
+	})
+
+	It("returns a different hash when only the data changes", func() {
+		original := hashOf(children)
+		cm := children[0].object.(*corev1.ConfigMap)
+		cm.Data["key1"] = "modified"
+		Expect(hashOf(children)).NotTo(Equal(original))
+	})
+
+	It("sorts children by kind, namespace and name", func() {
+		sorted := sortChildren(reversed(children))
+		names := []string{}
+		for _, child := range sorted {
+			names = append(names, kindOf(child.object)+"/"+child.object.GetName())
+		}
+		Expect(names).To(Equal([]string{"ConfigMap/example1", "ConfigMap/example2", "ConfigMap/example3", "Secret/example1"}))
+	})
+})
@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// addHashSalt folds the hash salt of the podController into the configuration
+// hash, so that podControllers with different salts have different hashes
+// for the same children, and changing the salt rolls the podController out.
+// The hash is returned unchanged if no salt is set.
+func addHashSalt(obj podController, hash string) string {
+	salt := obj.GetAnnotations()[HashSaltAnnotation]
+	if salt == "" {
+		return hash
+	}
+
+	combined := sha256.New()
+	fmt.Fprintf(combined, "%s\n", hash)
+	fmt.Fprintf(combined, "%s=%s\n", HashSaltAnnotation, salt)
+	return fmt.Sprintf("%x", combined.Sum(nil))
+}
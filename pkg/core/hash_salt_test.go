@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave hash salt Suite", func() {
+	var c client.Client
+	var h *Handler
+	var blue, green *appsv1.Deployment
+
+	BeforeEach(func() {
+		blue = newDeployment("blue", map[string]string{HashSaltAnnotation: "blue"})
+		green = newDeployment("green", map[string]string{HashSaltAnnotation: "green"})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, blue, green,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("computes different hashes from identical children with different salts", func() {
+		Expect(reconcileHash(c, h, blue)).NotTo(Equal(reconcileHash(c, h, green)))
+	})
+
+	It("computes the same hashes from identical children with the same salt", func() {
+		green.Annotations[HashSaltAnnotation] = "blue"
+		Expect(c.Update(context.TODO(), green)).To(Succeed())
+		Expect(reconcileHash(c, h, blue)).To(Equal(reconcileHash(c, h, green)))
+	})
+
+	It("does not change the hash when no salt is set", func() {
+		delete(blue.Annotations, HashSaltAnnotation)
+		Expect(c.Update(context.TODO(), blue)).To(Succeed())
+
+		children, err := h.getCurrentChildren(&deployment{blue})
+		Expect(err).NotTo(HaveOccurred())
+		expected, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconcileHash(c, h, blue)).To(Equal(expected))
+	})
+})
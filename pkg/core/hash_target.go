@@ -0,0 +1,186 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hashTargets holds the locations on the PodTemplate that the configuration
+// hash is written to
+type hashTargets struct {
+	annotation bool
+	env        []string
+}
+
+// getHashTargets parses the HashTargetAnnotation of the given podController.
+// Duplicate targets are only applied once and unknown targets are ignored.
+// If no valid target is listed, the hash is written to the annotation.
+func getHashTargets(obj metav1.Object) hashTargets {
+	targets := hashTargets{}
+	seen := make(map[string]struct{})
+	for _, target := range strings.Split(obj.GetAnnotations()[HashTargetAnnotation], ",") {
+		target = strings.TrimSpace(target)
+		if _, ok := seen[target]; ok {
+			continue
+		}
+		seen[target] = struct{}{}
+
+		switch {
+		case target == annotationHashTarget:
+			targets.annotation = true
+		case strings.HasPrefix(target, envHashTargetPrefix):
+			name := strings.TrimSpace(strings.TrimPrefix(target, envHashTargetPrefix))
+			if name != "" {
+				targets.env = append(targets.env, name)
+			}
+		}
+	}
+
+	if !targets.annotation && len(targets.env) == 0 {
+		targets.annotation = true
+	}
+	return targets
+}
+
+// getAppliedHashEnv returns the names of the environment variables that the
+// configuration hash was last written to
+func getAppliedHashEnv(obj metav1.Object) []string {
+	applied, ok := obj.GetAnnotations()[AppliedHashEnvAnnotation]
+	if !ok || applied == "" {
+		return nil
+	}
+	return strings.Split(applied, ",")
+}
+
+// setConfigHash writes the configuration hash of the given podController to
+// each of its hash targets, removing it from any target that is no longer
+// listed. All targets are updated together so that a change of configuration
+// only triggers a single rollout. The annotation target is written under the
+// given annotation key.
+func setConfigHash(obj podController, hash string, key string) {
+	targets := getHashTargets(obj)
+	podTemplate := obj.GetPodTemplate()
+
+	// Update the annotations
+	annotations := podTemplate.GetAnnotations()
+	if targets.annotation {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[key] = hash
+		podTemplate.SetAnnotations(annotations)
+	} else if _, ok := annotations[key]; ok {
+		delete(annotations, key)
+		podTemplate.SetAnnotations(annotations)
+	}
+
+	// Update the environment variables of every container, removing those
+	// that are no longer targets
+	stale := make(map[string]struct{})
+	for _, name := range getAppliedHashEnv(obj) {
+		stale[name] = struct{}{}
+	}
+	for _, name := range targets.env {
+		delete(stale, name)
+	}
+	for i := range podTemplate.Spec.InitContainers {
+		setEnvConfigHash(&podTemplate.Spec.InitContainers[i], targets.env, stale, hash)
+	}
+	for i := range podTemplate.Spec.Containers {
+		setEnvConfigHash(&podTemplate.Spec.Containers[i], targets.env, stale, hash)
+	}
+	obj.SetPodTemplate(podTemplate)
+
+	// Record the environment variables so that they can be cleaned up once
+	// they are no longer targets
+	metaAnnotations := obj.GetAnnotations()
+	if len(targets.env) > 0 {
+		if metaAnnotations == nil {
+			metaAnnotations = make(map[string]string)
+		}
+		metaAnnotations[AppliedHashEnvAnnotation] = strings.Join(targets.env, ",")
+		obj.SetAnnotations(metaAnnotations)
+	} else if _, ok := metaAnnotations[AppliedHashEnvAnnotation]; ok {
+		delete(metaAnnotations, AppliedHashEnvAnnotation)
+		obj.SetAnnotations(metaAnnotations)
+	}
+}
+
+// removeConfigHash removes the configuration hash of the given podController
+// from the annotation with the given key and from every environment variable
+// it was last written to, along with the time it was last updated
+func removeConfigHash(obj podController, key string) {
+	podTemplate := obj.GetPodTemplate()
+	annotations := podTemplate.GetAnnotations()
+	for _, k := range []string{key, LastUpdateTimeAnnotation} {
+		if _, ok := annotations[k]; ok {
+			delete(annotations, k)
+			podTemplate.SetAnnotations(annotations)
+		}
+	}
+
+	stale := make(map[string]struct{})
+	for _, name := range getAppliedHashEnv(obj) {
+		stale[name] = struct{}{}
+	}
+	for i := range podTemplate.Spec.InitContainers {
+		setEnvConfigHash(&podTemplate.Spec.InitContainers[i], nil, stale, "")
+	}
+	for i := range podTemplate.Spec.Containers {
+		setEnvConfigHash(&podTemplate.Spec.Containers[i], nil, stale, "")
+	}
+	obj.SetPodTemplate(podTemplate)
+
+	metaAnnotations := obj.GetAnnotations()
+	if _, ok := metaAnnotations[AppliedHashEnvAnnotation]; ok {
+		delete(metaAnnotations, AppliedHashEnvAnnotation)
+		obj.SetAnnotations(metaAnnotations)
+	}
+}
+
+// setEnvConfigHash sets each of the named environment variables of the
+// container to the hash and removes the stale environment variables.
+// Any existing environment variable sharing a name with a target is
+// overwritten.
+func setEnvConfigHash(container *corev1.Container, names []string, stale map[string]struct{}, hash string) {
+	if len(stale) > 0 {
+		var env []corev1.EnvVar
+		for _, envVar := range container.Env {
+			if _, ok := stale[envVar.Name]; !ok {
+				env = append(env, envVar)
+			}
+		}
+		container.Env = env
+	}
+
+	for _, name := range names {
+		found := false
+		for i := range container.Env {
+			if container.Env[i].Name == name {
+				container.Env[i] = corev1.EnvVar{Name: name, Value: hash}
+				found = true
+			}
+		}
+		if !found {
+			container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: hash})
+		}
+	}
+}
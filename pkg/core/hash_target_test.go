@@ -0,0 +1,217 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// getEnvValue returns the value of the named environment variable of the
+// container and whether it was found
+func getEnvValue(container corev1.Container, name string) (string, bool) {
+	for _, envVar := range container.Env {
+		if envVar.Name == name {
+			return envVar.Value, true
+		}
+	}
+	return "", false
+}
+
+var _ = Describe("Wave hash target Suite", func() {
+	var deploymentObject *appsv1.Deployment
+	var podControllerDeployment podController
+
+	setHashTarget := func(target string) {
+		annotations := deploymentObject.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[HashTargetAnnotation] = target
+		deploymentObject.SetAnnotations(annotations)
+	}
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		podControllerDeployment = &deployment{deploymentObject}
+	})
+
+	Context("getHashTargets", func() {
+		It("defaults to the annotation when no target is set", func() {
+			Expect(getHashTargets(deploymentObject)).To(Equal(hashTargets{annotation: true}))
+		})
+
+		It("parses a list of targets", func() {
+			setHashTarget("annotation, env:CONFIG_HASH")
+			Expect(getHashTargets(deploymentObject)).To(Equal(hashTargets{annotation: true, env: []string{"CONFIG_HASH"}}))
+		})
+
+		It("only applies duplicate targets once", func() {
+			setHashTarget("env:CONFIG_HASH,annotation,env:CONFIG_HASH,annotation")
+			Expect(getHashTargets(deploymentObject)).To(Equal(hashTargets{annotation: true, env: []string{"CONFIG_HASH"}}))
+		})
+
+		It("ignores unknown targets", func() {
+			setHashTarget("label,env:,env:CONFIG_HASH")
+			Expect(getHashTargets(deploymentObject)).To(Equal(hashTargets{env: []string{"CONFIG_HASH"}}))
+		})
+
+		It("defaults to the annotation when no valid target is set", func() {
+			setHashTarget("label")
+			Expect(getHashTargets(deploymentObject)).To(Equal(hashTargets{annotation: true}))
+		})
+	})
+
+	Context("setConfigHash", func() {
+		It("writes the same hash to every target", func() {
+			setHashTarget("annotation,env:CONFIG_HASH")
+			setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
+
+			Expect(deploymentObject.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "1234"))
+			containers := append(deploymentObject.Spec.Template.Spec.InitContainers, deploymentObject.Spec.Template.Spec.Containers...)
+			Expect(containers).NotTo(BeEmpty())
+			for _, container := range containers {
+				value, ok := getEnvValue(container, "CONFIG_HASH")
+				Expect(ok).To(BeTrue())
+				Expect(value).To(Equal("1234"))
+			}
+		})
+
+		It("does not set the annotation when it is not a target", func() {
+			setHashTarget("env:CONFIG_HASH")
+			setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
+
+			Expect(deploymentObject.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("overwrites an existing environment variable sharing a target's name", func() {
+			deploymentObject.Spec.Template.Spec.Containers[0].Env = append(deploymentObject.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "CONFIG_HASH", Value: "user"})
+			setHashTarget("env:CONFIG_HASH")
+			setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
+
+			value, _ := getEnvValue(deploymentObject.Spec.Template.Spec.Containers[0], "CONFIG_HASH")
+			Expect(value).To(Equal("1234"))
+		})
+
+		Context("when a target is removed", func() {
+			BeforeEach(func() {
+				setHashTarget("annotation,env:CONFIG_HASH,env:OTHER_HASH")
+				setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
+			})
+
+			It("removes a stale environment variable", func() {
+				setHashTarget("annotation,env:CONFIG_HASH")
+				setConfigHash(podControllerDeployment, "5678", ConfigHashAnnotation)
+
+				for _, container := range deploymentObject.Spec.Template.Spec.Containers {
+					_, ok := getEnvValue(container, "OTHER_HASH")
+					Expect(ok).To(BeFalse())
+					value, _ := getEnvValue(container, "CONFIG_HASH")
+					Expect(value).To(Equal("5678"))
+				}
+				Expect(deploymentObject.GetAnnotations()).To(HaveKeyWithValue(AppliedHashEnvAnnotation, "CONFIG_HASH"))
+			})
+
+			It("removes a stale annotation", func() {
+				setHashTarget("env:CONFIG_HASH")
+				setConfigHash(podControllerDeployment, "5678", ConfigHashAnnotation)
+
+				Expect(deploymentObject.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			})
+
+			It("reverts to the annotation when the hash target annotation is removed", func() {
+				annotations := deploymentObject.GetAnnotations()
+				delete(annotations, HashTargetAnnotation)
+				deploymentObject.SetAnnotations(annotations)
+				setConfigHash(podControllerDeployment, "5678", ConfigHashAnnotation)
+
+				Expect(deploymentObject.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "5678"))
+				for _, container := range deploymentObject.Spec.Template.Spec.Containers {
+					_, ok := getEnvValue(container, "CONFIG_HASH")
+					Expect(ok).To(BeFalse())
+				}
+				Expect(deploymentObject.GetAnnotations()).NotTo(HaveKey(AppliedHashEnvAnnotation))
+			})
+		})
+	})
+
+	Context("When reconciling a Deployment with multiple hash targets", func() {
+		It("writes the same hash to the annotation and the environment variable", func() {
+			deploymentObject.SetAnnotations(map[string]string{
+				RequiredAnnotation:   requiredAnnotationValue,
+				HashTargetAnnotation: "annotation,env:CONFIG_HASH",
+			})
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, deploymentObject,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h := NewHandler(c, record.NewFakeRecorder(10), Options{})
+
+			_, err := h.HandleDeployment(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &appsv1.Deployment{}
+			key := types.NamespacedName{Namespace: deploymentObject.GetNamespace(), Name: deploymentObject.GetName()}
+			Expect(c.Get(context.TODO(), key, updated)).To(Succeed())
+
+			hash := updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			Expect(hash).NotTo(BeEmpty())
+			for _, container := range updated.Spec.Template.Spec.Containers {
+				value, ok := getEnvValue(container, "CONFIG_HASH")
+				Expect(ok).To(BeTrue())
+				Expect(value).To(Equal(hash))
+			}
+		})
+	})
+
+	Context("with a custom hash annotation", func() {
+		const customKey = "example.com/wave-hash"
+
+		It("never writes the default annotation and does not change on the next reconcile", func() {
+			deploymentObject.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, deploymentObject,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h := NewHandler(c, record.NewFakeRecorder(10), Options{HashAnnotation: customKey})
+			key := types.NamespacedName{Namespace: deploymentObject.GetNamespace(), Name: deploymentObject.GetName()}
+
+			_, err := h.HandleDeployment(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), key, updated)).To(Succeed())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(customKey))
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+
+			_, err = h.HandleDeployment(updated.DeepCopy())
+			Expect(err).NotTo(HaveOccurred())
+			again := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), key, again)).To(Succeed())
+			Expect(again.GetResourceVersion()).To(Equal(updated.GetResourceVersion()))
+			Expect(again.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+		})
+	})
+})
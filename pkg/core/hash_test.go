@@ -235,6 +235,63 @@ var _ = Describe("Wave hash Suite", func() {
 			Expect(h2).To(Equal(h1))
 		})
 
+		It("returns a different hash when only a Secret sharing its name with a ConfigMap is updated", func() {
+			// cm1 and s1 are both named example1
+			Expect(cm1.GetName()).To(Equal(s1.GetName()))
+			c := []configObject{
+				{object: cm1, allKeys: true},
+				{object: s1, allKeys: true},
+			}
+
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Update(s1, func(obj utils.Object) utils.Object {
+				s := obj.(*corev1.Secret)
+				s.Data["key1"] = []byte(modified)
+
+				return s
+			}, timeout).Should(Succeed())
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("returns a different hash for a ConfigMap and a Secret sharing a name", func() {
+			// cm1 and s1 share a name and hold the same data
+			hcm, err := calculateConfigHash([]configObject{{object: cm1, allKeys: true}})
+			Expect(err).NotTo(HaveOccurred())
+			hs, err := calculateConfigHash([]configObject{{object: s1, allKeys: true}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hs).NotTo(Equal(hcm))
+		})
+
+		It("returns a different hash when an EnvFrom prefix is changed", func() {
+			c := []configObject{
+				{object: cm1, allKeys: true, prefixes: map[string]struct{}{"init=INIT_": {}}},
+			}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			c[0].prefixes = map[string]struct{}{"init=SETUP_": {}}
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("returns the same hash when no EnvFrom prefixes are set", func() {
+			h1, err := calculateConfigHash([]configObject{{object: cm1, allKeys: true}})
+			Expect(err).NotTo(HaveOccurred())
+
+			h2, err := calculateConfigHash([]configObject{{object: cm1, allKeys: true, prefixes: map[string]struct{}{}}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
 		It("returns the same hash independent of child ordering", func() {
 			c1 := []configObject{
 				{object: cm1, allKeys: true},
@@ -288,7 +345,7 @@ var _ = Describe("Wave hash Suite", func() {
 		})
 
 		It("sets the hash annotation to the provided value", func() {
-			setConfigHash(podControllerDeployment, "1234")
+			setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
 
 			podAnnotations := deploymentObject.Spec.Template.GetAnnotations()
 			Expect(podAnnotations).NotTo(BeNil())
@@ -308,7 +365,7 @@ var _ = Describe("Wave hash Suite", func() {
 			deploymentObject.Spec.Template.SetAnnotations(podAnnotations)
 
 			// Set the config hash
-			setConfigHash(podControllerDeployment, "1234")
+			setConfigHash(podControllerDeployment, "1234", ConfigHashAnnotation)
 
 			// Check the existing annotation is still in place
 			podAnnotations = deploymentObject.Spec.Template.GetAnnotations()
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InjectConfigHash writes the configuration hash of a workload that is being
+// created or updated to it, as the Handler would once the workload had been
+// applied, so that the workload is first applied with the hash and Wave does
+// not roll it out a second time.
+//
+// It returns false, leaving the workload untouched, if the hash was not
+// injected because the workload is not managed by Wave, is observe-only or
+// is restarted by deleting its Pods, or because a required child does not
+// exist yet. Missing children are left for the Handler to report.
+// The hash already on a workload is kept too if one of the Handler's rollout
+// gates could defer the rollout of the new hash, so that an unrelated change
+// to its PodTemplate never rolls out configuration that is being held back.
+func (h *Handler) InjectConfigHash(obj runtime.Object) (bool, error) {
+	instance := toPodController(obj)
+	if instance == nil || !h.isManaged(instance) {
+		return false, nil
+	}
+	if isObserveOnly(instance) || deletesPods(instance) {
+		return false, nil
+	}
+
+	hash, err := h.computeCurrentConfigHash(instance)
+	if err != nil {
+		if isMissingChildError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if hasConfigHash(instance, h.getHashAnnotation()) && instance.GetPodTemplate().GetAnnotations()[h.getHashAnnotation()] != hash {
+		held, err := h.holdsRollout(instance)
+		if err != nil {
+			return false, err
+		}
+		if held {
+			return false, nil
+		}
+	}
+
+	updateConfigHash(instance, hash, h.getHashAnnotation())
+	h.setComputedBy(instance)
+	return true, nil
+}
+
+// holdsRollout returns true if any of the rollout gates that the Handler
+// checks before rolling out a new hash could defer the rollout of the
+// instance. Gates whose state is only known to the controller, such as the
+// batch window, pre-roll validation and the rollout limit, are assumed to
+// defer it whenever they apply to the instance.
+func (h *Handler) holdsRollout(instance podController) (bool, error) {
+	if h.deferWhilePaused(instance) || getBatchWindow(instance) > 0 || h.rolloutWindowRemaining() > 0 {
+		return true, nil
+	}
+	if instance.GetAnnotations()[PreRollValidateAnnotation] != "" {
+		return true, nil
+	}
+	if _, ok := instance.(*deployment); ok && h.opts.MaxRolloutsPerNamespace > 0 {
+		return true, nil
+	}
+	if _, ok := instance.(*cronjob); !ok && h.opts.PDBAware && h.opts.PDBDefer {
+		pdb, err := h.getBlockingPodDisruptionBudget(instance)
+		if err != nil || pdb != nil {
+			return pdb != nil, err
+		}
+	}
+	blocker, err := h.getRolloutOrderBlocker(instance)
+	if err != nil {
+		return false, fmt.Errorf("error checking rollout order: %v", err)
+	}
+	return blocker != "", nil
+}
+
+// ComputeConfigHash returns the configuration hash that the Handler would
+// currently write to the workload, whether or not the workload is managed by
+// Wave. Neither the workload nor its children are modified.
+func (h *Handler) ComputeConfigHash(obj runtime.Object) (string, error) {
+	instance := toPodController(obj)
+	if instance == nil {
+		return "", fmt.Errorf("unsupported workload %T", obj)
+	}
+	return h.computeCurrentConfigHash(instance)
+}
+
+// computeCurrentConfigHash calculates the configuration hash of the instance
+// from its current children as the Handler does when reconciling it.
+// A missingChildError is returned if a required child does not exist.
+func (h *Handler) computeCurrentConfigHash(instance podController) (string, error) {
+	current, err := h.getCurrentChildren(instance)
+	var missingChildren []string
+	if missing, ok := err.(*missingChildError); ok && rollsOnMissing(instance) {
+		current, missingChildren, err = missing.children, missing.missing, nil
+	}
+	if err != nil {
+		if missing, ok := err.(*missingChildError); ok {
+			return "", &missingChildError{err: fmt.Errorf("error fetching current children: %v", err), missing: missing.missing}
+		}
+		return "", fmt.Errorf("error fetching current children: %v", err)
+	}
+	current, err = h.getHashGroupChildren(instance, current)
+	if err != nil {
+		return "", fmt.Errorf("error fetching hash group children: %v", err)
+	}
+	hash, _, err := h.computeConfigHash(instance, current, missingChildren)
+	return hash, err
+}
+
+// computeConfigHash calculates the configuration hash of the instance from
+// its current children, including those of its hash group, and the required
+// children missing from them. It returns the hash along with the normalized
+// children it was calculated from.
+// Both the Handler and the webhook calculate hashes through it so that they
+// always agree on the hash of a workload.
+func (h *Handler) computeConfigHash(instance podController, current []configObject, missingChildren []string) (string, []configObject, error) {
+	// Handle any keys that cannot be normalized
+	current, err := h.applyPartialHashPolicy(instance, current)
+	if err != nil {
+		return "", nil, fmt.Errorf("error normalizing children: %v", err)
+	}
+
+	hash, err := h.hashConfig(instance, current, missingChildren, h.getHashFormat())
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Prefix the hash with its format, keeping a hash of another format while
+	// the configuration it was computed from is unchanged
+	hash, err = h.formatConfigHash(instance, current, missingChildren, hash)
+	if err != nil {
+		return "", nil, fmt.Errorf("error formatting configuration hash: %v", err)
+	}
+	return hash, current, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave inject hash Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("injects the hash the Handler writes, so the Handler does not roll out again", func() {
+		injected, err := h.InjectConfigHash(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(injected).To(BeTrue())
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		Expect(c.Create(context.TODO(), d)).To(Succeed())
+
+		_, err = h.HandleDeployment(d.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		Expect(updated.Spec.Template).To(Equal(d.Spec.Template))
+	})
+
+	It("does not inject the hash into workloads Wave is not enabled for", func() {
+		d.SetAnnotations(nil)
+		injected, err := h.InjectConfigHash(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(injected).To(BeFalse())
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("does not inject the hash into observe-only workloads", func() {
+		d.GetAnnotations()[ObserveOnlyAnnotation] = requiredAnnotationValue
+		injected, err := h.InjectConfigHash(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(injected).To(BeFalse())
+	})
+
+	It("leaves workloads with a missing required child to the Handler", func() {
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap2.DeepCopy())).To(Succeed())
+		injected, err := h.InjectConfigHash(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(injected).To(BeFalse())
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	Context("When the workload already has a hash", func() {
+		BeforeEach(func() {
+			d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "previous"})
+		})
+
+		It("injects the new hash", func() {
+			injected, err := h.InjectConfigHash(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(injected).To(BeTrue())
+			Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(Equal("previous"))
+		})
+
+		It("keeps the hash of a paused Deployment", func() {
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{SkipPaused: true})
+			d.Spec.Paused = true
+			injected, err := h.InjectConfigHash(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(injected).To(BeFalse())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "previous"))
+		})
+
+		It("keeps the hash outside the rollout window", func() {
+			window, err := ParseRolloutWindow("22:00-06:00")
+			Expect(err).NotTo(HaveOccurred())
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{RolloutWindow: window})
+			h.now = func() time.Time { return time.Date(2019, 6, 3, 12, 0, 0, 0, time.UTC) }
+			injected, err := h.InjectConfigHash(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(injected).To(BeFalse())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "previous"))
+		})
+
+		It("keeps the hash of a workload validated before rolling out", func() {
+			d.GetAnnotations()[PreRollValidateAnnotation] = "https://validator.example.com/validate"
+			injected, err := h.InjectConfigHash(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(injected).To(BeFalse())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "previous"))
+		})
+	})
+
+	It("computes the hash the Handler writes while rolling out on a missing child", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{HashVersionPrefix: true})
+		d.GetAnnotations()[RollOnMissingAnnotation] = requiredAnnotationValue
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap2.DeepCopy())).To(Succeed())
+		Expect(c.Create(context.TODO(), d)).To(Succeed())
+
+		_, err := h.HandleDeployment(d.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+
+		hash, err := h.ComputeConfigHash(updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+	})
+})
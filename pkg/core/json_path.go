@@ -0,0 +1,281 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// getJSONPaths parses the HashJSONPathAnnotation of the given podController
+// and returns the JSONPath of each key, keyed on the name of the ConfigMap and
+// then the key.
+// Entries are separated by `;` and take the form
+// `<configmap>/<key>:<jsonpath>`, for example
+// `app-config/settings.json:$.database.maxConnections`, or `<key>:<jsonpath>`
+// for the key in every ConfigMap, which is keyed on the empty name.
+func getJSONPaths(obj podController) map[string]map[string]string {
+	paths := make(map[string]map[string]string)
+	for _, entry := range strings.Split(obj.GetAnnotations()[HashJSONPathAnnotation], ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			continue
+		}
+		ref := strings.SplitN(parts[0], "/", 2)
+		if len(ref) == 1 {
+			ref = []string{"", ref[0]}
+		} else if ref[0] == "" {
+			continue
+		}
+		if ref[1] == "" {
+			continue
+		}
+
+		if paths[ref[0]] == nil {
+			paths[ref[0]] = make(map[string]string)
+		}
+		paths[ref[0]][ref[1]] = strings.TrimSpace(parts[1])
+	}
+	return paths
+}
+
+// setJSONPaths records the JSONPaths configured on the podController against
+// each of the ConfigMaps it references. The JSONPath of a key in a named
+// ConfigMap takes precedence over that of the key in every ConfigMap.
+func setJSONPaths(obj podController, children []configObject) {
+	paths := getJSONPaths(obj)
+	if len(paths) == 0 {
+		return
+	}
+	for i, child := range children {
+		if _, ok := child.object.(*corev1.ConfigMap); !ok {
+			continue
+		}
+		var childPaths map[string]string
+		for _, name := range []string{"", child.object.GetName()} {
+			for key, path := range paths[name] {
+				if childPaths == nil {
+					childPaths = make(map[string]string)
+				}
+				childPaths[key] = path
+			}
+		}
+		children[i].jsonPaths = childPaths
+	}
+}
+
+// mergeJSONPaths combines the JSONPaths of two references to the same child.
+// A key is only filtered by a JSONPath if both references use the same
+// JSONPath for it, so that a reference without a JSONPath still sees every
+// change.
+func mergeJSONPaths(a, b map[string]string) map[string]string {
+	var merged map[string]string
+	for key, path := range a {
+		if path != b[key] {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]string)
+		}
+		merged[key] = path
+	}
+	return merged
+}
+
+// extractJSONPath parses the value as a JSON, or failing that YAML, document
+// and returns the JSON encoding of the subvalues selected by the JSONPath.
+// A JSONPath not wrapped in braces may list several paths separated by commas,
+// such as `$.server,$.db`, every one of which must be present.
+func extractJSONPath(value string, path string) (string, error) {
+	var document interface{}
+	err := json.Unmarshal([]byte(value), &document)
+	if err != nil {
+		if yamlErr := yaml.Unmarshal([]byte(value), &document); yamlErr != nil {
+			return "", fmt.Errorf("error parsing JSON: %v", err)
+		}
+	}
+
+	if !strings.HasPrefix(path, "{") {
+		templates := []string{}
+		for _, p := range splitJSONPaths(path) {
+			templates = append(templates, "{"+p+"}")
+		}
+		path = strings.Join(templates, "")
+	}
+	parser := jsonpath.New("hash")
+	err = parser.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("error parsing JSONPath: %v", err)
+	}
+	results, err := parser.FindResults(document)
+	if err != nil {
+		return "", fmt.Errorf("error finding JSONPath: %v", err)
+	}
+
+	subvalues := []interface{}{}
+	for _, result := range results {
+		for _, subvalue := range result {
+			subvalues = append(subvalues, subvalue.Interface())
+		}
+	}
+
+	// Wildcards and recursive descent visit the keys of objects in a random
+	// order, so the subvalues they select are sorted to keep the hash stable
+	if hasUnorderedNodes(path) {
+		subvalues, err = sortSubvalues(subvalues)
+		if err != nil {
+			return "", err
+		}
+	}
+	extracted, err := json.Marshal(subvalues)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal JSON: %v", err)
+	}
+	return fmt.Sprintf("jsonpath:%s", extracted), nil
+}
+
+// hasUnorderedNodes returns true if the JSONPath template holds a
+// wildcard or recursive descent, whose results have no stable order
+func hasUnorderedNodes(path string) bool {
+	parsed, err := jsonpath.Parse("hash", path)
+	if err != nil {
+		return false
+	}
+	return containsUnorderedNode(parsed.Root.Nodes)
+}
+
+// containsUnorderedNode returns true if any of the nodes, or the nodes within
+// them, is a wildcard or recursive descent
+func containsUnorderedNode(nodes []jsonpath.Node) bool {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *jsonpath.WildcardNode, *jsonpath.RecursiveNode:
+			return true
+		case *jsonpath.ListNode:
+			if containsUnorderedNode(n.Nodes) {
+				return true
+			}
+		case *jsonpath.UnionNode:
+			for _, list := range n.Nodes {
+				if containsUnorderedNode(list.Nodes) {
+					return true
+				}
+			}
+		case *jsonpath.FilterNode:
+			if containsUnorderedNode(n.Left.Nodes) || containsUnorderedNode(n.Right.Nodes) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortSubvalues returns the subvalues sorted by their JSON encoding
+func sortSubvalues(subvalues []interface{}) ([]interface{}, error) {
+	encoded := make([]json.RawMessage, 0, len(subvalues))
+	for _, subvalue := range subvalues {
+		data, err := json.Marshal(subvalue)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal JSON: %v", err)
+		}
+		encoded = append(encoded, data)
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return string(encoded[i]) < string(encoded[j])
+	})
+
+	sorted := make([]interface{}, 0, len(encoded))
+	for _, data := range encoded {
+		sorted = append(sorted, data)
+	}
+	return sorted, nil
+}
+
+// splitJSONPaths splits a comma separated list of JSONPaths, ignoring commas
+// within brackets such as those of `$.items[0,1]`
+func splitJSONPaths(path string) []string {
+	paths := []string{}
+	depth, start := 0, 0
+	for i, r := range path {
+		switch r {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				paths = append(paths, strings.TrimSpace(path[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(paths, strings.TrimSpace(path[start:]))
+}
+
+// applyJSONPath replaces a JSON value with the subvalues selected by the
+// JSONPath, so that the hash only changes when they change. Values that cannot
+// be parsed, or do not contain the JSONPath, are returned unmodified.
+func applyJSONPath(value string, path string) string {
+	extracted, err := extractJSONPath(value, path)
+	if err != nil {
+		return value
+	}
+	return extracted
+}
+
+// warnJSONPathFallbacks records a Warning event on the instance for each key
+// of the children that is hashed in full because its JSONPath could not be
+// applied
+func (h *Handler) warnJSONPathFallbacks(obj podController, children []configObject) {
+	for _, child := range children {
+		cm, ok := child.object.(*corev1.ConfigMap)
+		if !ok {
+			continue
+		}
+		for key, path := range child.jsonPaths {
+			value, exists := cm.Data[key]
+			if !exists {
+				continue
+			}
+			_, err := extractJSONPath(value, path)
+			if err != nil {
+				h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "JSONPathFallback", "Hashing key %s of ConfigMap %s in full: %v", key, cm.GetName(), err)
+			}
+		}
+	}
+}
+
+// getJSONPathsKey returns a stable representation of the child's JSONPaths
+func getJSONPathsKey(child configObject) string {
+	keys := make([]string, 0, len(child.jsonPaths))
+	for key := range child.jsonPaths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, fmt.Sprintf("%s:%s", key, child.jsonPaths[key]))
+	}
+	return strings.Join(entries, ";")
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave JSONPath Suite", func() {
+	Context("getJSONPaths", func() {
+		It("parses the JSONPath of each key and ignores invalid entries", func() {
+			d := &deployment{utils.ExampleDeployment.DeepCopy()}
+			d.SetAnnotations(map[string]string{
+				HashJSONPathAnnotation: "app-config/settings.json:$.database.maxConnections; other/key:{.a}; app-config:$.b;/key:$.c;app-config/empty:",
+			})
+
+			Expect(getJSONPaths(d)).To(Equal(map[string]map[string]string{
+				"app-config": {
+					"settings.json": "$.database.maxConnections",
+				},
+				"other": {
+					"key": "{.a}",
+				},
+				"": {
+					"app-config": "$.b",
+				},
+			}))
+		})
+	})
+
+	Context("setJSONPaths", func() {
+		It("applies entries without a ConfigMap to the key in every ConfigMap", func() {
+			name := utils.ExampleConfigMap1.GetName()
+			d := &deployment{utils.ExampleDeployment.DeepCopy()}
+			d.SetAnnotations(map[string]string{
+				HashJSONPathAnnotation: "app.conf:$.server,$.db;" + name + "/app.conf:$.cache;" + name + "/other:$.a",
+			})
+			children := []configObject{{object: utils.ExampleConfigMap1.DeepCopy()}, {object: utils.ExampleConfigMap2.DeepCopy()}}
+
+			setJSONPaths(d, children)
+			Expect(children[0].jsonPaths).To(Equal(map[string]string{"app.conf": "$.cache", "other": "$.a"}))
+			Expect(children[1].jsonPaths).To(Equal(map[string]string{"app.conf": "$.server,$.db"}))
+		})
+	})
+
+	Context("applyJSONPath", func() {
+		It("only depends on the selected subvalue", func() {
+			a := applyJSONPath(`{"database":{"maxConnections":10,"host":"a"}}`, "$.database.maxConnections")
+			b := applyJSONPath(`{"database":{"maxConnections":10,"host":"b"}}`, "$.database.maxConnections")
+			Expect(a).To(Equal(b))
+			Expect(applyJSONPath(`{"database":{"maxConnections":20,"host":"a"}}`, "$.database.maxConnections")).NotTo(Equal(a))
+		})
+
+		It("only depends on the subvalues selected by each of several paths", func() {
+			paths := "$.server,$.db"
+			a := applyJSONPath(`{"server":{"port":80},"db":{"host":"a"},"logLevel":"info"}`, paths)
+			Expect(applyJSONPath(`{"server":{"port":80},"db":{"host":"a"},"logLevel":"debug"}`, paths)).To(Equal(a))
+			Expect(applyJSONPath(`{"server":{"port":81},"db":{"host":"a"},"logLevel":"info"}`, paths)).NotTo(Equal(a))
+			Expect(applyJSONPath(`{"server":{"port":80},"db":{"host":"b"},"logLevel":"info"}`, paths)).NotTo(Equal(a))
+		})
+
+		It("does not split paths on commas within brackets", func() {
+			Expect(splitJSONPaths("$.items[0,1].name, $.db")).To(Equal([]string{"$.items[0,1].name", "$.db"}))
+		})
+
+		It("parses YAML values", func() {
+			a := applyJSONPath("server:\n  port: 80\nlogLevel: info\n", "$.server")
+			Expect(a).To(Equal(`jsonpath:[{"port":80}]`))
+			Expect(applyJSONPath("server:\n  port: 80\nlogLevel: debug\n", "$.server")).To(Equal(a))
+		})
+
+		It("returns values that cannot be parsed or do not contain the path unmodified", func() {
+			Expect(applyJSONPath("not json", "$.database")).To(Equal("not json"))
+			Expect(applyJSONPath(`{"other":1}`, "$.database")).To(Equal(`{"other":1}`))
+		})
+	})
+
+	Context("When reconciling a Deployment with a JSONPath", func() {
+		var c client.Client
+		var h *Handler
+		var d *appsv1.Deployment
+		var cm *corev1.ConfigMap
+		var recorder *record.FakeRecorder
+
+		// setSettings updates the JSON document of the ConfigMap
+		var setSettings = func(settings string) {
+			cm.Data["settings.json"] = settings
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		}
+
+		// events returns the events recorded so far
+		var events = func() []string {
+			recorded := []string{}
+			for len(recorder.Events) > 0 {
+				recorded = append(recorded, <-recorder.Events)
+			}
+			return recorded
+		}
+
+		BeforeEach(func() {
+			cm = utils.ExampleConfigMap1.DeepCopy()
+			cm.Data["settings.json"] = `{"database":{"maxConnections":10,"host":"db-a"},"logLevel":"info"}`
+
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{
+				RequiredAnnotation:     requiredAnnotationValue,
+				HashJSONPathAnnotation: cm.GetName() + "/settings.json:$.database.maxConnections",
+			})
+			d.Spec.Template.Spec.Volumes = []corev1.Volume{
+				{
+					Name: "config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: cm.GetName(),
+							},
+						},
+					},
+				},
+			}
+			d.Spec.Template.Spec.InitContainers = nil
+			d.Spec.Template.Spec.Containers = []corev1.Container{
+				{
+					Name:  "container",
+					Image: "container",
+				},
+			}
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm)
+			recorder = record.NewFakeRecorder(100)
+			h = NewHandler(c, recorder, Options{})
+		})
+
+		It("does not update the config hash when an unrelated field changes", func() {
+			original := reconcileHash(c, h, d)
+			setSettings(`{"database":{"maxConnections":10,"host":"db-b"},"logLevel":"debug"}`)
+			Expect(reconcileHash(c, h, d)).To(Equal(original))
+		})
+
+		It("updates the config hash when the targeted field changes", func() {
+			original := reconcileHash(c, h, d)
+			setSettings(`{"database":{"maxConnections":20,"host":"db-a"},"logLevel":"info"}`)
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("hashes the whole value with a warning when the JSON cannot be parsed", func() {
+			setSettings("maxConnections: 10")
+			original := reconcileHash(c, h, d)
+			Expect(events()).To(ContainElement(ContainSubstring("JSONPathFallback")))
+
+			setSettings("maxConnections: 10\nlogLevel: debug")
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("only updates the config hash when a field selected by one of several paths changes", func() {
+			d.GetAnnotations()[HashJSONPathAnnotation] = "settings.json:$.database.maxConnections,$.logLevel"
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+			original := reconcileHash(c, h, d)
+
+			setSettings(`{"database":{"maxConnections":10,"host":"db-b"},"logLevel":"info"}`)
+			Expect(reconcileHash(c, h, d)).To(Equal(original))
+
+			setSettings(`{"database":{"maxConnections":10,"host":"db-b"},"logLevel":"debug"}`)
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("only updates the config hash when a selected field of a YAML document changes", func() {
+			setSettings("database:\n  maxConnections: 10\n  host: db-a\n")
+			original := reconcileHash(c, h, d)
+			Expect(events()).NotTo(ContainElement(ContainSubstring("JSONPathFallback")))
+
+			setSettings("database:\n  maxConnections: 10\n  host: db-b\n")
+			Expect(reconcileHash(c, h, d)).To(Equal(original))
+
+			setSettings("database:\n  maxConnections: 20\n  host: db-b\n")
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("hashes the whole value with a warning when the path is missing", func() {
+			setSettings(`{"logLevel":"info"}`)
+			original := reconcileHash(c, h, d)
+			Expect(events()).To(ContainElement(ContainSubstring("JSONPathFallback")))
+
+			setSettings(`{"logLevel":"debug"}`)
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+	})
+})
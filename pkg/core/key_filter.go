@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// keyFilter selects the data keys of a ConfigMap or Secret that take part in
+// the configuration hash
+type keyFilter struct {
+	required map[string]struct{}
+	ignored  map[string]struct{}
+}
+
+// getKeyFilter returns the keyFilter configured by the RequiredKeysAnnotation
+// and IgnoreKeysAnnotation of the given ConfigMap or Secret, or nil if
+// neither is set.
+// Both annotations hold a comma separated list of keys. When any required
+// keys are listed, the ignored keys have no effect.
+func getKeyFilter(obj metav1.Object) *keyFilter {
+	annotations := obj.GetAnnotations()
+	f := &keyFilter{
+		required: parseKeyList(annotations[RequiredKeysAnnotation]),
+		ignored:  parseKeyList(annotations[IgnoreKeysAnnotation]),
+	}
+	if len(f.required) == 0 && len(f.ignored) == 0 {
+		return nil
+	}
+	return f
+}
+
+// getChildKeyFilter returns the keyFilter of the child's annotations or, if
+// neither annotation is set on a Secret, one including only the keys
+// relevant to the Secret's type. Children without type keys of their own
+// use those of the DefaultSecretTypeKeys.
+func getChildKeyFilter(child configObject) *keyFilter {
+	if f := getKeyFilter(child.object); f != nil {
+		return f
+	}
+	s, ok := child.object.(*corev1.Secret)
+	if !ok {
+		return nil
+	}
+	keys := child.typeKeys
+	if keys == nil {
+		keys = secretTypeKeys(DefaultSecretTypeKeys, s)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return &keyFilter{required: keys}
+}
+
+// parseKeyList returns the set of keys in the comma separated list
+func parseKeyList(list string) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// excludes returns true if the key should not take part in the configuration
+// hash
+func (f *keyFilter) excludes(key string) bool {
+	if f == nil {
+		return false
+	}
+	if len(f.required) > 0 {
+		_, ok := f.required[key]
+		return !ok
+	}
+	_, ok := f.ignored[key]
+	return ok
+}
+
+// isIgnoredKey returns true if the given key of the child is being ignored,
+// either because it is excluded by the key filter of the child or because it
+// could not be normalized and was skipped
+func isIgnoredKey(child configObject, filter *keyFilter, key string) bool {
+	if filter.excludes(key) {
+		return true
+	}
+	_, skipped := child.skippedKeys[key]
+	return skipped
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Wave key filter Suite", func() {
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetAnnotations(map[string]string{
+			IgnoreKeysAnnotation: "timestamp, cache-token",
+		})
+		cm.Data = map[string]string{
+			"config":      "key = value",
+			"timestamp":   "10:00",
+			"cache-token": "abc",
+		}
+
+		s = utils.ExampleSecret1.DeepCopy()
+		s.SetAnnotations(map[string]string{
+			IgnoreKeysAnnotation: "timestamp",
+		})
+		s.Data = map[string][]byte{
+			"password":  []byte("hunter2"),
+			"timestamp": []byte("10:00"),
+		}
+	})
+
+	Context("calculateConfigHash", func() {
+		It("returns the same hash when only an ignored key is changed", func() {
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["timestamp"] = "11:00"
+			cm.Data["cache-token"] = "def"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when a key that is not ignored is changed", func() {
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["config"] = "key = other"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("returns the same hash when only an ignored key of a Secret is changed", func() {
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["timestamp"] = []byte("11:00")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("ignores keys that are referenced individually", func() {
+			c := []configObject{{object: cm, keys: map[string]struct{}{"config": {}, "timestamp": {}}}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["timestamp"] = "11:00"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns the same merkle hash when only an ignored key is changed", func() {
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateLeafHash(c[0])
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["timestamp"] = "11:00"
+			h2, err := calculateLeafHash(c[0])
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+	})
+
+	Context("with required keys", func() {
+		// requiredKeysCases lists the RequiredKeysAnnotation values under test
+		// along with a key that takes part in the hash and a key that does not
+		requiredKeysCases := []struct {
+			description string
+			required    string
+			listed      string
+			unlisted    string
+		}{
+			{description: "an empty list", required: "", listed: "timestamp", unlisted: ""},
+			{description: "a single key", required: "config", listed: "config", unlisted: "cache-token"},
+			{description: "multiple keys", required: "config, cache-token", listed: "cache-token", unlisted: "other"},
+		}
+
+		for _, tc := range requiredKeysCases {
+			tc := tc
+
+			Context("listing "+tc.description, func() {
+				BeforeEach(func() {
+					cm.SetAnnotations(map[string]string{
+						RequiredKeysAnnotation: tc.required,
+					})
+					cm.Data["other"] = "unchanged"
+				})
+
+				It("returns a different hash when a listed key is changed", func() {
+					c := []configObject{{object: cm, allKeys: true}}
+					h1, err := calculateConfigHash(c)
+					Expect(err).NotTo(HaveOccurred())
+
+					cm.Data[tc.listed] = "modified"
+					h2, err := calculateConfigHash(c)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(h2).NotTo(Equal(h1))
+				})
+
+				if tc.unlisted == "" {
+					return
+				}
+
+				It("returns the same hash when only an unlisted key is changed", func() {
+					c := []configObject{{object: cm, allKeys: true}}
+					h1, err := calculateConfigHash(c)
+					Expect(err).NotTo(HaveOccurred())
+
+					cm.Data[tc.unlisted] = "modified"
+					h2, err := calculateConfigHash(c)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(h2).To(Equal(h1))
+				})
+			})
+		}
+
+		It("takes precedence over the ignored keys", func() {
+			cm.SetAnnotations(map[string]string{
+				RequiredKeysAnnotation: "timestamp",
+				IgnoreKeysAnnotation:   "timestamp",
+			})
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["timestamp"] = "11:00"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).NotTo(Equal(h1))
+
+			cm.Data["config"] = "key = other"
+			h3, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h3).To(Equal(h2))
+		})
+
+		It("only hashes the listed keys of a Secret", func() {
+			s.SetAnnotations(map[string]string{
+				RequiredKeysAnnotation: "password",
+			})
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["timestamp"] = []byte("11:00")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+	})
+
+	Context("with a TLS Secret", func() {
+		BeforeEach(func() {
+			s.SetAnnotations(map[string]string{})
+			s.Type = corev1.SecretTypeTLS
+			s.Data = map[string][]byte{
+				corev1.TLSCertKey:       []byte("cert"),
+				corev1.TLSPrivateKeyKey: []byte("key"),
+				"ca.crt":                []byte("ca"),
+			}
+		})
+
+		It("returns the same hash when only the CA bundle is changed", func() {
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["ca.crt"] = []byte("refreshed")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when the certificate is changed", func() {
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data[corev1.TLSCertKey] = []byte("renewed")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("hashes the keys listed in the required keys annotation instead", func() {
+			s.SetAnnotations(map[string]string{
+				RequiredKeysAnnotation: "ca.crt",
+			})
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["ca.crt"] = []byte("refreshed")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).NotTo(Equal(h1))
+
+			s.Data[corev1.TLSCertKey] = []byte("renewed")
+			h3, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h3).To(Equal(h2))
+		})
+
+		It("hashes every key of a Secret of another type", func() {
+			s.Type = corev1.SecretTypeOpaque
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["ca.crt"] = []byte("refreshed")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+	})
+
+	Context("getKeyFilter", func() {
+		It("returns the trimmed keys listed in the annotation", func() {
+			Expect(getKeyFilter(cm).ignored).To(Equal(map[string]struct{}{"timestamp": {}, "cache-token": {}}))
+		})
+
+		It("returns nil when no annotation is set", func() {
+			cm.SetAnnotations(map[string]string{})
+			Expect(getKeyFilter(cm)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,36 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import "time"
+
+// setLastUpdateTime records the time of a rollout on the PodTemplate of the
+// given podController.
+// This must only be called once a rollout has been decided on, so that
+// reconciles that do not change the configuration leave the PodTemplate
+// untouched.
+func setLastUpdateTime(obj podController, now time.Time) {
+	podTemplate := obj.GetPodTemplate()
+	annotations := podTemplate.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[LastUpdateTimeAnnotation] = now.UTC().Format(time.RFC3339)
+	podTemplate.SetAnnotations(annotations)
+	obj.SetPodTemplate(podTemplate)
+}
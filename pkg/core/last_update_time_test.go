@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave last update time Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var now time.Time
+
+	// handle advances the fake clock, reconciles the Deployment and returns
+	// its last update time
+	var handle = func(advance time.Duration) string {
+		now = now.Add(advance)
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return d.Spec.Template.GetAnnotations()[LastUpdateTimeAnnotation]
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		now = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		h.now = func() time.Time { return now }
+	})
+
+	It("records the time the hash was first set", func() {
+		Expect(handle(0)).To(Equal("2018-01-01T00:00:00Z"))
+	})
+
+	It("updates the time when the configuration changes", func() {
+		handle(0)
+
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(handle(time.Hour)).To(Equal("2018-01-01T01:00:00Z"))
+	})
+
+	It("leaves the time unchanged when nothing has changed", func() {
+		handle(0)
+		original := d.DeepCopy()
+
+		Expect(handle(time.Hour)).To(Equal("2018-01-01T00:00:00Z"))
+		Expect(d.Spec.Template).To(Equal(original.Spec.Template))
+	})
+
+	It("is removed along with the configuration hash", func() {
+		handle(0)
+
+		obj := &deployment{d.DeepCopy()}
+		removeConfigHash(obj, ConfigHashAnnotation)
+		Expect(obj.GetPodTemplate().GetAnnotations()).NotTo(HaveKey(LastUpdateTimeAnnotation))
+	})
+})
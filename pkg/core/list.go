@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ListWorkloads writes each workload Wave is enabled for, with the hash
+// currently stored on it, followed by the ConfigMaps and Secrets it
+// references, one per line. Workloads are listed by kind, namespace and name.
+//
+// Nothing is updated, so ListWorkloads can be run against any cluster the
+// Handler's client can read.
+func (h *Handler) ListWorkloads(w io.Writer) error {
+	for _, list := range h.getWorkloadLists() {
+		err := h.List(context.TODO(), list)
+		if err != nil {
+			return fmt.Errorf("error listing workloads: %v", err)
+		}
+
+		instances := podControllersFromList(list)
+		sort.Slice(instances, func(i, j int) bool {
+			if instances[i].GetNamespace() != instances[j].GetNamespace() {
+				return instances[i].GetNamespace() < instances[j].GetNamespace()
+			}
+			return instances[i].GetName() < instances[j].GetName()
+		})
+		for _, instance := range instances {
+			if h.isExcludedNamespace(instance.GetNamespace()) || !h.isEnabled(instance) {
+				continue
+			}
+			err := h.writeWorkload(w, instance)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getWorkloadLists returns an empty list of each kind of workload Wave
+// reconciles
+func (h *Handler) getWorkloadLists() []runtime.Object {
+	lists := []runtime.Object{&appsv1.DeploymentList{}, &appsv1.StatefulSetList{}, &appsv1.DaemonSetList{}, &batchv1beta1.CronJobList{}}
+	if h.opts.EnableReplicaSets {
+		lists = append(lists, &appsv1.ReplicaSetList{})
+	}
+	return append(lists, h.opts.WorkloadKinds.lists()...)
+}
+
+// getStoredHash returns the configuration hash currently stored on the
+// podController, or an empty string if none is stored
+func (h *Handler) getStoredHash(obj podController) string {
+	if isObserveOnly(obj) {
+		return obj.GetAnnotations()[ObservedConfigHashAnnotation]
+	}
+	return obj.GetPodTemplate().GetAnnotations()[h.getHashAnnotation()]
+}
+
+// writeWorkload writes the stored hash and the children of the podController
+func (h *Handler) writeWorkload(w io.Writer, obj podController) error {
+	hash := h.getStoredHash(obj)
+	if hash == "" {
+		hash = "<none>"
+	}
+	_, err := fmt.Fprintf(w, "%s %s/%s hash=%s\n", kindOf(obj), obj.GetNamespace(), obj.GetName(), hash)
+	if err != nil {
+		return err
+	}
+
+	configMaps, secrets := getChildNamesByType(obj)
+	_ = addExtraChildren(obj, h.opts.SharedConfigNamespace, configMaps, secrets)
+	var children []string
+	for name := range configMaps {
+		children = append(children, "ConfigMap/"+name)
+	}
+	for name := range secrets {
+		children = append(children, "Secret/"+name)
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		_, err := fmt.Fprintf(w, "  %s\n", child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave list Suite", func() {
+	It("lists the enabled workloads with their hash and children", func() {
+		d := utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "1a2b3c"})
+
+		disabled := utils.ExampleDeployment.DeepCopy()
+		disabled.SetName("disabled")
+
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, disabled)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		out := &bytes.Buffer{}
+		Expect(h.ListWorkloads(out)).To(Succeed())
+		Expect(out.String()).To(HavePrefix("Deployment " + d.GetNamespace() + "/" + d.GetName() + " hash=1a2b3c\n"))
+		Expect(out.String()).To(ContainSubstring("  ConfigMap/example1\n"))
+		Expect(out.String()).To(ContainSubstring("  ConfigMap/example2\n"))
+		Expect(out.String()).To(ContainSubstring("  Secret/example1\n"))
+		Expect(out.String()).To(ContainSubstring("  Secret/example3\n"))
+		Expect(out.String()).NotTo(ContainSubstring("disabled"))
+	})
+})
@@ -0,0 +1,54 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-logr/glogr"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	// LogFormatText logs through glog in its plain text format
+	LogFormatText = "text"
+
+	// LogFormatJSON logs one JSON object per line, with the values of each
+	// log entry as fields of the object
+	LogFormatJSON = "json"
+)
+
+// NewLogger returns a logger writing to stderr in the given format, which must
+// be one of the LogFormat constants
+func NewLogger(format string) (logr.Logger, error) {
+	switch format {
+	case LogFormatText:
+		return glogr.New(), nil
+	case LogFormatJSON:
+		return newJSONLogger(os.Stderr), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, must be one of %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// newJSONLogger returns a logger writing JSON log entries to the given writer
+func newJSONLogger(w io.Writer) logr.Logger {
+	return zap.LoggerTo(w, false)
+}
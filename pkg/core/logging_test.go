@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave logging Suite", func() {
+	It("accepts the text and json log formats", func() {
+		for _, format := range []string{LogFormatText, LogFormatJSON} {
+			_, err := NewLogger(format)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err := NewLogger("xml")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("logs rollouts as JSON with stable field names", func() {
+		d := utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		out := &bytes.Buffer{}
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{Logger: newJSONLogger(out)})
+
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		out.Reset()
+		_, err = h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+
+		var entry map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			fields := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(line), &fields)).To(Succeed())
+			if fields["msg"] == "Updating instance hash" {
+				entry = fields
+			}
+		}
+		Expect(entry).To(HaveKeyWithValue("msg", "Updating instance hash"))
+		Expect(entry).To(HaveKeyWithValue("kind", "Deployment"))
+		Expect(entry).To(HaveKeyWithValue("namespace", d.GetNamespace()))
+		Expect(entry).To(HaveKeyWithValue("name", d.GetName()))
+		Expect(entry).To(HaveKeyWithValue("hash", updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+		Expect(entry).To(HaveKeyWithValue("changed", "ConfigMap/example1"))
+	})
+})
@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// withMaxReconcileInterval requeues a managed instance that was reconciled
+// successfully once the maximum reconcile interval has elapsed, so that it is
+// reconciled again even without any events and drift of its hash, such as a
+// manually edited hash annotation, is corrected.
+// Results requeueing the instance sooner, and failed reconciles, which are
+// requeued with a backoff, are returned unchanged.
+func (h *Handler) withMaxReconcileInterval(instance podController, result reconcile.Result, err error) reconcile.Result {
+	interval := h.opts.MaxReconcileInterval
+	if interval <= 0 || err != nil || result.Requeue || !h.isManaged(instance) {
+		return result
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > interval {
+		result.RequeueAfter = interval
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave max reconcile interval Suite", func() {
+	var d *appsv1.Deployment
+	var c client.Client
+	var h *Handler
+
+	// getDeployment returns the Deployment as currently stored
+	getDeployment := func() *appsv1.Deployment {
+		stored := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, stored)).To(Succeed())
+		return stored
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{MaxReconcileInterval: time.Hour})
+	})
+
+	It("requeues a managed Deployment after the interval", func() {
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+	})
+
+	It("does not requeue a Deployment without an interval", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+	})
+
+	It("does not requeue a Deployment that Wave does not manage", func() {
+		d.SetAnnotations(map[string]string{})
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+	})
+
+	It("corrects a tampered hash on the next interval driven reconcile", func() {
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+		hash := getDeployment().Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		Expect(hash).NotTo(BeEmpty())
+
+		tampered := getDeployment()
+		tampered.Spec.Template.Annotations[ConfigHashAnnotation] = "tampered"
+		Expect(c.Update(context.TODO(), tampered)).To(Succeed())
+
+		result, err = h.HandleDeployment(getDeployment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+		Expect(getDeployment().Spec.Template.GetAnnotations()[ConfigHashAnnotation]).To(Equal(hash))
+	})
+
+	Context("withMaxReconcileInterval", func() {
+		var instance podController
+
+		BeforeEach(func() {
+			instance = &deployment{d}
+		})
+
+		It("keeps a sooner requeue", func() {
+			result := h.withMaxReconcileInterval(instance, reconcile.Result{RequeueAfter: time.Minute}, nil)
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+		})
+
+		It("shortens a later requeue to the interval", func() {
+			result := h.withMaxReconcileInterval(instance, reconcile.Result{RequeueAfter: 2 * time.Hour}, nil)
+			Expect(result.RequeueAfter).To(Equal(time.Hour))
+		})
+
+		It("leaves an immediate requeue unchanged", func() {
+			result := h.withMaxReconcileInterval(instance, reconcile.Result{Requeue: true}, nil)
+			Expect(result).To(Equal(reconcile.Result{Requeue: true}))
+		})
+
+		It("leaves the result of a failed reconcile unchanged", func() {
+			result := h.withMaxReconcileInterval(instance, reconcile.Result{}, fmt.Errorf("failed"))
+			Expect(result).To(Equal(reconcile.Result{}))
+		})
+	})
+})
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// calculateConfigHash hashes the children of the instance in the given hash
+// format, reusing the cached hashes of children that have not changed
+func (h *Handler) calculateConfigHash(instance podController, children []configObject, format string) (string, error) {
+	timer := prometheus.NewTimer(hashDurationSeconds)
+	defer timer.ObserveDuration()
+
+	stats := &cacheStats{}
+	hash, err := h.calculateConfigHashWithFormat(children, format, stats)
+	if err != nil {
+		return "", err
+	}
+	h.log.V(1).Info("Calculated configuration hash", "kind", kindOf(instance), "namespace", instance.GetNamespace(), "name", instance.GetName(), "format", format, "cacheHits", stats.hits, "cacheMisses", stats.misses)
+	return hash, nil
+}
+
+// leafHashCache caches the leaf hash of each child so that the Merkle root
+// only needs to rehash children that have changed since they were last seen
+type leafHashCache struct {
+	childCache
+}
+
+// leaf is the leaf hash of a child along with the name it is sorted by when
+// combining the leaves into the root
+type leaf struct {
+	name string
+	hash string
+}
+
+// calculateMerkleConfigHash hashes each child into a leaf, reusing cached
+// leaves for children whose resourceVersion has not changed, and combines the
+// sorted leaves into a root hash.
+// The root hash is always identical to that of combineLeaves over freshly
+// computed leaves, with or without a cache.
+func (c *leafHashCache) calculateMerkleConfigHash(children []configObject, stats *cacheStats) (string, error) {
+	leaves := make([]leaf, 0, len(children))
+	for _, child := range children {
+		if child.object == nil {
+			continue
+		}
+		hash, err := c.getLeafHash(child, stats)
+		if err != nil {
+			return "", err
+		}
+		leaves = append(leaves, leaf{name: kindOf(child.object) + "/" + child.object.GetNamespace() + "/" + child.object.GetName(), hash: hash})
+	}
+	return combineLeaves(leaves), nil
+}
+
+// getLeafHash returns the leaf hash of the child from the cache if the child
+// has not changed since it was cached, otherwise it hashes the child and
+// updates the cache.
+// Children without a resourceVersion are never cached.
+func (c *leafHashCache) getLeafHash(child configObject, stats *cacheStats) (string, error) {
+	if child.object.GetResourceVersion() == "" {
+		return calculateLeafHash(child)
+	}
+
+	if cached, ok := c.get(child); ok {
+		stats.record(true)
+		return cached.(string), nil
+	}
+	stats.record(false)
+
+	hash, err := calculateLeafHash(child)
+	if err != nil {
+		return "", err
+	}
+	c.set(child, hash)
+	return hash, nil
+}
+
+// leafCacheKey identifies a child, by its UID so that a recreated child is
+// never mistaken for the original, along with the parts of it that are being
+// hashed, so that different references to the same child are cached
+// separately
+func leafCacheKey(child configObject) string {
+	keys := make([]string, 0, len(child.keys))
+	for key := range child.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("%s/%s/%s|%s|%t|%s|%s|%s|%s", kindOf(child.object), child.object.GetNamespace(), child.object.GetName(), child.object.GetUID(),
+		child.allKeys, strings.Join(keys, ","), strings.Join(getPrefixes(child), ","), getJSONPathsKey(child), getThresholdsKey(child))
+}
+
+// calculateLeafHash uses sha256 to hash the configuration within a single
+// child
+func calculateLeafHash(child configObject) (string, error) {
+	leafSource := struct {
+		Data     interface{} `json:"data"`
+		Prefixes []string    `json:"prefixes,omitempty"`
+	}{
+		Prefixes: getPrefixes(child),
+	}
+
+	switch child.object.(type) {
+	case *corev1.ConfigMap:
+		leafSource.Data = getConfigMapData(child)
+	case *corev1.Secret:
+		leafSource.Data = getSecretData(child)
+	case *unstructured.Unstructured:
+		leafSource.Data = child.extracted
+	default:
+		return "", fmt.Errorf("passed unknown type: %v", reflect.TypeOf(child))
+	}
+
+	leafSourceBytes, err := json.Marshal(leafSource)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal JSON: %v", err)
+	}
+
+	hashBytes := sha256.Sum256(leafSourceBytes)
+	return fmt.Sprintf("%x", hashBytes), nil
+}
+
+// combineLeaves uses sha256 to hash the leaves, sorted by name, into a root
+// hash
+func combineLeaves(leaves []leaf) string {
+	sorted := make([]leaf, len(leaves))
+	copy(sorted, leaves)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	root := sha256.New()
+	for _, l := range sorted {
+		fmt.Fprintf(root, "%s=%s\n", l.name, l.hash)
+	}
+	return fmt.Sprintf("%x", root.Sum(nil))
+}
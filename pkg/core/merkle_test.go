@@ -0,0 +1,235 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// newMerkleChildren returns n ConfigMap children, each holding size bytes of
+// data, at resourceVersion 1
+func newMerkleChildren(n, size int) []configObject {
+	children := make([]configObject, 0, n)
+	for i := 0; i < n; i++ {
+		children = append(children, configObject{
+			object: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            fmt.Sprintf("example%d", i),
+					Namespace:       "default",
+					ResourceVersion: "1",
+				},
+				Data: map[string]string{
+					"key": strings.Repeat("a", size),
+				},
+			},
+			allKeys: true,
+		})
+	}
+	return children
+}
+
+// updateMerkleChild modifies the data of the child and bumps its
+// resourceVersion, as the API server would
+func updateMerkleChild(child configObject, value string) {
+	cm := child.object.(*corev1.ConfigMap)
+	cm.Data["key"] = value
+	rv, _ := strconv.Atoi(cm.GetResourceVersion())
+	cm.SetResourceVersion(strconv.Itoa(rv + 1))
+}
+
+var _ = Describe("Wave merkle Suite", func() {
+	var children []configObject
+	var cache *leafHashCache
+
+	// freshRoot computes the root without reusing any cached leaves
+	var freshRoot = func(children []configObject) string {
+		root, err := (&leafHashCache{}).calculateMerkleConfigHash(children, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return root
+	}
+
+	BeforeEach(func() {
+		children = newMerkleChildren(5, 16)
+		cache = &leafHashCache{}
+	})
+
+	Context("calculateMerkleConfigHash", func() {
+		It("returns a different hash when a child's data is updated", func() {
+			h1, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			updateMerkleChild(children[2], "modified")
+			h2, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("matches the hash computed without a cache after a child is updated", func() {
+			_, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			updateMerkleChild(children[2], "modified")
+			h, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h).To(Equal(freshRoot(children)))
+		})
+
+		It("only rehashes the child that was updated", func() {
+			_, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			before := make(map[string]cachedEntry)
+			for key, leaf := range cache.entries {
+				before[key] = leaf
+			}
+
+			updateMerkleChild(children[2], "modified")
+			_, err = cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			changed := 0
+			for key, leaf := range cache.entries {
+				if before[key] != leaf {
+					changed++
+				}
+			}
+			Expect(changed).To(Equal(1))
+		})
+
+		It("returns the same hash independent of child ordering", func() {
+			h1, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			reversed := make([]configObject, 0, len(children))
+			for i := len(children) - 1; i >= 0; i-- {
+				reversed = append(reversed, children[i])
+			}
+			h2, err := cache.calculateMerkleConfigHash(reversed, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("caches different references to the same child separately", func() {
+			children[0].object.(*corev1.ConfigMap).Data["other"] = "other"
+			allKeys, err := cache.calculateMerkleConfigHash(children[:1], nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			single := []configObject{{object: children[0].object, keys: map[string]struct{}{"key": {}}}}
+			singleKey, err := cache.calculateMerkleConfigHash(single, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(singleKey).NotTo(Equal(allKeys))
+			Expect(singleKey).To(Equal(freshRoot(single)))
+		})
+
+		It("does not cache children without a resourceVersion", func() {
+			children[0].object.SetResourceVersion("")
+			_, err := cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.entries).To(HaveLen(len(children) - 1))
+		})
+
+		It("evicts the leaves of previous versions of a child", func() {
+			single := []configObject{{object: children[0].object, keys: map[string]struct{}{"key": {}}}}
+			_, err := cache.calculateMerkleConfigHash(single, nil)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.entries).To(HaveLen(len(children) + 1))
+
+			updateMerkleChild(children[0], "modified")
+			_, err = cache.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cache.entries).To(HaveLen(len(children)))
+		})
+
+		It("evicts the leaves of a deleted child", func() {
+			hashCache := &HashCache{}
+			_, err := hashCache.leaves.calculateMerkleConfigHash(children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			deleted := children[0].object
+			Expect(newHashCachePredicate(hashCache).Delete(event.DeleteEvent{Meta: deleted, Object: deleted})).To(BeTrue())
+			Expect(hashCache.leaves.entries).To(HaveLen(len(children) - 1))
+			Expect(hashCache.leaves.keys).NotTo(HaveKey(childCacheName(deleted)))
+		})
+	})
+
+	Context("Handler.calculateConfigHash", func() {
+		It("uses the Merkle root when Merkle hashing is enabled", func() {
+			h := NewHandler(nil, nil, Options{MerkleHash: true})
+			hash, err := h.calculateConfigHash(&deployment{utils.ExampleDeployment.DeepCopy()}, children, h.getHashFormat())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(freshRoot(children)))
+		})
+
+		It("uses the flat hash by default", func() {
+			h := NewHandler(nil, nil, Options{})
+			hash, err := h.calculateConfigHash(&deployment{utils.ExampleDeployment.DeepCopy()}, children, h.getHashFormat())
+			Expect(err).NotTo(HaveOccurred())
+
+			flat, err := calculateConfigHash(children)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(flat))
+		})
+	})
+})
+
+// benchmarkChildren and benchmarkSize configure the benchmarks below to hash
+// many children where only one changes between each hash
+const (
+	benchmarkChildren = 100
+	benchmarkSize     = 4096
+)
+
+func BenchmarkFlatHashOneChildChanged(b *testing.B) {
+	children := newMerkleChildren(benchmarkChildren, benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		updateMerkleChild(children[0], strconv.Itoa(i))
+		if _, err := calculateConfigHash(children); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMerkleHashOneChildChanged(b *testing.B) {
+	children := newMerkleChildren(benchmarkChildren, benchmarkSize)
+	cache := &leafHashCache{}
+	if _, err := cache.calculateMerkleConfigHash(children, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		updateMerkleChild(children[0], strconv.Itoa(i))
+		if _, err := cache.calculateMerkleConfigHash(children, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
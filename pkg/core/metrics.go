@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// reconcilesTotal counts the workloads reconciled by Wave
+	reconcilesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "wave_reconciles_total",
+		Help: "Total number of workload reconciliations performed by Wave",
+	})
+
+	// reconcileResultsTotal counts the workloads reconciled by Wave, by the
+	// reason for the outcome of the reconcile
+	reconcileResultsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_reconcile_results_total",
+		Help: "Total number of workload reconciliations performed by Wave, by the reason for their outcome",
+	}, []string{"reason"})
+
+	// rolloutsTotal counts the rollouts triggered by a change of
+	// configuration hash, by namespace
+	rolloutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_rollouts_total",
+		Help: "Total number of rollouts triggered by a change of configuration hash",
+	}, []string{"namespace"})
+
+	// rolloutsCompletedTotal counts the rollouts triggered by Wave that
+	// progressed as far as the update strategy of their workload allows, by
+	// namespace and whether the strategy limits them to a subset of the Pods
+	rolloutsCompletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_rollouts_completed_total",
+		Help: "Total number of rollouts triggered by Wave that completed",
+	}, []string{"namespace", "partial"})
+
+	// childrenErrorsTotal counts the errors reported while fetching the
+	// children of a workload
+	childrenErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "wave_children_errors_total",
+		Help: "Total number of errors fetching the ConfigMaps and Secrets referenced by a workload",
+	})
+
+	// hashDurationSeconds observes how long calculating the configuration
+	// hash of a workload takes
+	hashDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wave_hash_duration_seconds",
+		Help:    "Time taken to calculate the configuration hash of a workload",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+
+	// hashCacheHitsTotal counts the children whose cached hashes were reused
+	// while calculating configuration hashes
+	hashCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "wave_hash_cache_hits_total",
+		Help: "Total number of unchanged ConfigMaps and Secrets whose cached hashes were reused",
+	})
+
+	// hashCacheMissesTotal counts the children that were hashed again while
+	// calculating configuration hashes, as they were not cached or had changed
+	hashCacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "wave_hash_cache_misses_total",
+		Help: "Total number of ConfigMaps and Secrets hashed because they were not cached or had changed",
+	})
+
+	// trackedChildren reports the number of children referenced by the
+	// workloads managed by Wave, by namespace and workload kind
+	trackedChildren = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_tracked_children",
+		Help: "Number of ConfigMaps and Secrets referenced by the workloads managed by Wave",
+	}, []string{"namespace", "kind"})
+
+	// configDrift reports the number of workloads managed by Wave whose
+	// PodTemplate has drifted from their configuration hash, by namespace and
+	// workload kind
+	configDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_config_drift",
+		Help: "Number of workloads managed by Wave whose PodTemplate differs from the configuration hash of their children",
+	}, []string{"namespace", "kind"})
+
+	// childCounts records the number of children of each managed workload so
+	// that wave_tracked_children can be kept up to date as workloads change
+	childCounts = &childCounter{gauge: trackedChildren, counts: make(map[childCountKey]map[string]int)}
+
+	// configDrifts records whether each managed workload has drifted so that
+	// wave_config_drift can be kept up to date as workloads change
+	configDrifts = &childCounter{gauge: configDrift, counts: make(map[childCountKey]map[string]int)}
+)
+
+// childCountKey identifies a series of a gauge kept by a childCounter
+type childCountKey struct {
+	namespace string
+	kind      string
+}
+
+// childCounter tracks a count for each managed workload, keyed by namespace
+// and kind and then by workload name, and reports their total in the gauge
+type childCounter struct {
+	mutex  sync.Mutex
+	gauge  *prometheus.GaugeVec
+	counts map[childCountKey]map[string]int
+}
+
+// set records the count of the workload and updates the gauge for its
+// namespace and kind
+func (c *childCounter) set(obj podController, count int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := childCountKey{namespace: obj.GetNamespace(), kind: kindOf(obj)}
+	if c.counts[key] == nil {
+		c.counts[key] = make(map[string]int)
+	}
+	c.counts[key][obj.GetName()] = count
+	c.update(key)
+}
+
+// remove forgets the count of the workload and updates the gauge for its
+// namespace and kind, removing the series once no workloads remain
+func (c *childCounter) remove(obj podController) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := childCountKey{namespace: obj.GetNamespace(), kind: kindOf(obj)}
+	if _, ok := c.counts[key][obj.GetName()]; !ok {
+		return
+	}
+	delete(c.counts[key], obj.GetName())
+	c.update(key)
+}
+
+// update sets the gauge for the key to the total count of its workloads.
+// The mutex must be held by the caller.
+func (c *childCounter) update(key childCountKey) {
+	if len(c.counts[key]) == 0 {
+		delete(c.counts, key)
+		c.gauge.DeleteLabelValues(key.namespace, key.kind)
+		return
+	}
+
+	total := 0
+	for _, count := range c.counts[key] {
+		total += count
+	}
+	c.gauge.WithLabelValues(key.namespace, key.kind).Set(float64(total))
+}
+
+func init() {
+	metrics.Registry.MustRegister(reconcilesTotal, reconcileResultsTotal, rolloutsTotal, rolloutsCompletedTotal, childrenErrorsTotal, hashDurationSeconds, hashCacheHitsTotal, hashCacheMissesTotal, trackedChildren, configDrift)
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// scrapeMetrics gathers the metrics registered with the controller-runtime
+// registry and returns the metric families keyed by name
+func scrapeMetrics() map[string]*dto.MetricFamily {
+	families, err := metrics.Registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// getRolloutsTotal returns the value of wave_rollouts_total for the given
+// namespace
+func getRolloutsTotal(namespace string) float64 {
+	family, ok := scrapeMetrics()["wave_rollouts_total"]
+	if !ok {
+		return 0
+	}
+	for _, m := range family.GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "namespace" && label.GetValue() == namespace {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// getCounterTotal returns the value of the named unlabelled counter
+func getCounterTotal(name string) float64 {
+	family, ok := scrapeMetrics()[name]
+	Expect(ok).To(BeTrue())
+	return family.GetMetric()[0].GetCounter().GetValue()
+}
+
+// getHashSampleCount returns the number of observations of
+// wave_hash_duration_seconds
+func getHashSampleCount() uint64 {
+	family, ok := scrapeMetrics()["wave_hash_duration_seconds"]
+	Expect(ok).To(BeTrue())
+	return family.GetMetric()[0].GetHistogram().GetSampleCount()
+}
+
+// getTrackedChildren returns the value of wave_tracked_children for the
+// given namespace and kind, and whether the series exists
+func getTrackedChildren(namespace, kind string) (float64, bool) {
+	family, ok := scrapeMetrics()["wave_tracked_children"]
+	if !ok {
+		return 0, false
+	}
+	for _, m := range family.GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["namespace"] == namespace && labels["kind"] == kind {
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+var _ = Describe("Wave metrics Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("counts reconciles and hash computations", func() {
+		reconciles := getCounterTotal("wave_reconciles_total")
+		hashes := getHashSampleCount()
+
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getCounterTotal("wave_reconciles_total")).To(Equal(reconciles + 1))
+		Expect(getHashSampleCount()).To(Equal(hashes + 1))
+	})
+
+	It("counts rollouts by namespace", func() {
+		rollouts := getRolloutsTotal(d.GetNamespace())
+
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRolloutsTotal(d.GetNamespace())).To(Equal(rollouts + 1))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		_, err = h.HandleDeployment(updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRolloutsTotal(d.GetNamespace())).To(Equal(rollouts + 1))
+	})
+
+	It("counts errors fetching children", func() {
+		errors := getCounterTotal("wave_children_errors_total")
+
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+		_, err := h.HandleDeployment(d)
+		Expect(err).To(HaveOccurred())
+
+		Expect(getCounterTotal("wave_children_errors_total")).To(Equal(errors + 1))
+	})
+	Context("wave_tracked_children", func() {
+		const namespace = "tracked-children"
+
+		BeforeEach(func() {
+			// A Deployment referencing exactly four children in its own
+			// namespace so that other tests don't affect the gauge
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetNamespace(namespace)
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			d.Spec.Template.Spec.Volumes = nil
+			d.Spec.Template.Spec.InitContainers = nil
+			d.Spec.Template.Spec.Containers = []corev1.Container{
+				{
+					Name:  "container",
+					Image: "container",
+					EnvFrom: []corev1.EnvFromSource{
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap1.GetName()}}},
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap2.GetName()}}},
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleSecret1.GetName()}}},
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleSecret2.GetName()}}},
+					},
+				},
+			}
+
+			cm1 := utils.ExampleConfigMap1.DeepCopy()
+			cm1.SetNamespace(namespace)
+			cm2 := utils.ExampleConfigMap2.DeepCopy()
+			cm2.SetNamespace(namespace)
+			s1 := utils.ExampleSecret1.DeepCopy()
+			s1.SetNamespace(namespace)
+			s2 := utils.ExampleSecret2.DeepCopy()
+			s2.SetNamespace(namespace)
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm1, cm2, s1, s2)
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: d.GetName()}, d)).To(Succeed())
+		})
+
+		It("reports the number of children of the Deployment", func() {
+			value, ok := getTrackedChildren(namespace, "Deployment")
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(4.0))
+		})
+
+		It("removes the children of a Deployment that opts out", func() {
+			d.SetAnnotations(map[string]string{})
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, ok := getTrackedChildren(namespace, "Deployment")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("removes the children of a Deployment that is deleted", func() {
+			now := metav1.Now()
+			d.SetDeletionTimestamp(&now)
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, ok := getTrackedChildren(namespace, "Deployment")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// missingChildRequeueBase is the time to wait before first checking again
+	// whether a missing child has reappeared
+	missingChildRequeueBase = time.Second
+
+	// missingChildRequeueMax is the maximum time to wait before checking
+	// again whether a missing child has reappeared
+	missingChildRequeueMax = 30 * time.Second
+)
+
+// missingChildError is returned by getCurrentChildren when the only errors
+// encountered were caused by required children not existing
+type missingChildError struct {
+	err error
+
+	// missing names the kind and name of each missing child
+	missing []string
+
+	// children holds the children that do exist, so that workloads rolling
+	// out when a child goes missing can still be hashed
+	children []configObject
+}
+
+func (e *missingChildError) Error() string {
+	return e.err.Error()
+}
+
+// isMissingChildError returns true if the error was caused only by required
+// children not existing
+func isMissingChildError(err error) bool {
+	_, ok := err.(*missingChildError)
+	return ok
+}
+
+// missingChildGraceRemaining records that the instance has a missing child
+// and returns how long remains of the grace period before the missing child
+// should be reported.
+// A remaining time of zero means the grace period has elapsed.
+func (h *Handler) missingChildGraceRemaining(obj podController) time.Duration {
+	if h.opts.MissingChildGrace <= 0 {
+		return 0
+	}
+
+	h.missingMutex.Lock()
+	defer h.missingMutex.Unlock()
+
+	if h.missingSince == nil {
+		h.missingSince = make(map[string]time.Time)
+	}
+	key := missingChildKey(obj)
+	since, ok := h.missingSince[key]
+	if !ok {
+		since = time.Now()
+		h.missingSince[key] = since
+	}
+
+	remaining := h.opts.MissingChildGrace - time.Since(since)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// missingChildBackoff records another check of the instance's missing child
+// and returns how long to wait before checking again. The delay doubles with
+// each consecutive check, from missingChildRequeueBase up to
+// missingChildRequeueMax, unless the instance overrides it with the
+// requeue-after annotation.
+func (h *Handler) missingChildBackoff(obj podController) time.Duration {
+	h.missingMutex.Lock()
+	defer h.missingMutex.Unlock()
+
+	if h.missingAttempts == nil {
+		h.missingAttempts = make(map[string]int)
+	}
+	key := missingChildKey(obj)
+	attempts := h.missingAttempts[key]
+	h.missingAttempts[key] = attempts + 1
+
+	backoff := missingChildRequeueBase
+	for i := 0; i < attempts && backoff < missingChildRequeueMax; i++ {
+		backoff *= 2
+	}
+	if backoff > missingChildRequeueMax {
+		backoff = missingChildRequeueMax
+	}
+	return getRequeueAfter(obj, backoff)
+}
+
+// clearMissingChild forgets that the instance had a missing child so that
+// the full grace period and backoff apply the next time a child goes missing
+func (h *Handler) clearMissingChild(obj podController) {
+	h.missingMutex.Lock()
+	defer h.missingMutex.Unlock()
+	delete(h.missingSince, missingChildKey(obj))
+	delete(h.missingAttempts, missingChildKey(obj))
+}
+
+// missingChildKey returns a key uniquely identifying the instance
+func missingChildKey(obj podController) string {
+	return fmt.Sprintf("%s/%s/%s", kindOf(obj), obj.GetNamespace(), obj.GetName())
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave missing child Suite", func() {
+	var podControllerDeployment podController
+
+	BeforeEach(func() {
+		podControllerDeployment = &deployment{utils.ExampleDeployment.DeepCopy()}
+	})
+
+	Context("missingChildGraceRemaining", func() {
+		It("returns zero when no grace period is configured", func() {
+			h := &Handler{handlerState: &handlerState{}}
+			Expect(h.missingChildGraceRemaining(podControllerDeployment)).To(BeZero())
+		})
+
+		It("returns the remaining grace period while within the grace period", func() {
+			h := &Handler{opts: Options{MissingChildGrace: time.Minute}, handlerState: &handlerState{}}
+			remaining := h.missingChildGraceRemaining(podControllerDeployment)
+			Expect(remaining).To(BeNumerically(">", 0))
+			Expect(remaining).To(BeNumerically("<=", time.Minute))
+			Expect(h.missingChildGraceRemaining(podControllerDeployment)).To(BeNumerically("<=", remaining))
+		})
+
+		It("returns zero once the grace period has elapsed", func() {
+			h := &Handler{opts: Options{MissingChildGrace: 10 * time.Millisecond}, handlerState: &handlerState{}}
+			Expect(h.missingChildGraceRemaining(podControllerDeployment)).To(BeNumerically(">", 0))
+			time.Sleep(20 * time.Millisecond)
+			Expect(h.missingChildGraceRemaining(podControllerDeployment)).To(BeZero())
+		})
+
+		It("restarts the grace period once the missing child is cleared", func() {
+			h := &Handler{opts: Options{MissingChildGrace: 10 * time.Millisecond}, handlerState: &handlerState{}}
+			h.missingChildGraceRemaining(podControllerDeployment)
+			time.Sleep(20 * time.Millisecond)
+			h.clearMissingChild(podControllerDeployment)
+			Expect(h.missingChildGraceRemaining(podControllerDeployment)).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("missingChildBackoff", func() {
+		It("doubles the backoff with each check", func() {
+			h := &Handler{handlerState: &handlerState{}}
+			Expect(h.missingChildBackoff(podControllerDeployment)).To(Equal(missingChildRequeueBase))
+			Expect(h.missingChildBackoff(podControllerDeployment)).To(Equal(2 * missingChildRequeueBase))
+			Expect(h.missingChildBackoff(podControllerDeployment)).To(Equal(4 * missingChildRequeueBase))
+		})
+
+		It("caps the backoff", func() {
+			h := &Handler{handlerState: &handlerState{}}
+			for i := 0; i < 10; i++ {
+				h.missingChildBackoff(podControllerDeployment)
+			}
+			Expect(h.missingChildBackoff(podControllerDeployment)).To(Equal(missingChildRequeueMax))
+		})
+
+		It("restarts the backoff once the missing child is cleared", func() {
+			h := &Handler{handlerState: &handlerState{}}
+			h.missingChildBackoff(podControllerDeployment)
+			h.missingChildBackoff(podControllerDeployment)
+			h.clearMissingChild(podControllerDeployment)
+			Expect(h.missingChildBackoff(podControllerDeployment)).To(Equal(missingChildRequeueBase))
+		})
+	})
+
+	Context("when a required child is missing and then reappears", func() {
+		It("requeues with a backoff and then reconciles without an error", func() {
+			d := utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			recorder := record.NewFakeRecorder(100)
+			h := NewHandler(c, recorder, Options{MissingChildGrace: time.Minute})
+
+			for _, expected := range []time.Duration{missingChildRequeueBase, 2 * missingChildRequeueBase, 4 * missingChildRequeueBase} {
+				result, err := h.HandleDeployment(d)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(expected))
+			}
+
+			Expect(c.Create(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			for len(recorder.Events) > 0 {
+				Expect(strings.HasPrefix(<-recorder.Events, "Warning")).To(BeFalse())
+			}
+		})
+	})
+
+	Context("isMissingChildError", func() {
+		It("returns true for a missingChildError", func() {
+			Expect(isMissingChildError(&missingChildError{err: fmt.Errorf("not found")})).To(BeTrue())
+		})
+
+		It("returns false for other errors", func() {
+			Expect(isMissingChildError(fmt.Errorf("forbidden"))).To(BeFalse())
+		})
+	})
+})
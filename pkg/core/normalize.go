@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// commentStripper removes comment lines from configuration values so that
+// changes to comments alone do not change the configuration hash
+type commentStripper struct {
+	defaultPrefix string
+	keyPrefixes   map[string]string
+}
+
+// getCommentStripper returns a commentStripper configured from the annotations
+// of the given object, or nil if the strip-comments normalizer is not enabled.
+//
+// The CommentPrefixAnnotation holds a comma separated list of entries. An entry
+// of the form `<key>=<prefix>` sets the comment prefix for a single key, while
+// an entry without `=` sets the prefix for all other keys. Keys without a
+// configured prefix fall back to "#".
+func getCommentStripper(obj metav1.Object) *commentStripper {
+	annotations := obj.GetAnnotations()
+	if !hasNormalizer(annotations[NormalizeAnnotation], stripCommentsNormalizer) {
+		return nil
+	}
+
+	c := &commentStripper{
+		defaultPrefix: defaultCommentPrefix,
+		keyPrefixes:   make(map[string]string),
+	}
+	for _, entry := range strings.Split(annotations[CommentPrefixAnnotation], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 1 {
+			c.defaultPrefix = parts[0]
+			continue
+		}
+		key, prefix := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if key != "" && prefix != "" {
+			c.keyPrefixes[key] = prefix
+		}
+	}
+	return c
+}
+
+// hasNormalizer returns true if the comma separated list of normalizers
+// contains the given normalizer
+func hasNormalizer(normalizers string, normalizer string) bool {
+	for _, n := range strings.Split(normalizers, ",") {
+		if strings.TrimSpace(n) == normalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// strip removes all lines from the value that begin with the comment prefix
+// for the given key, ignoring leading whitespace.
+// Values that are not valid UTF-8 are returned unchanged.
+func (c *commentStripper) strip(key string, value []byte) []byte {
+	stripped, err := c.normalize(key, value)
+	if err != nil {
+		return value
+	}
+	return stripped
+}
+
+// normalize removes all lines from the value that begin with the comment
+// prefix for the given key, ignoring leading whitespace.
+// Values that are not valid UTF-8 cannot be normalized and return an error.
+func (c *commentStripper) normalize(key string, value []byte) ([]byte, error) {
+	if !utf8.Valid(value) {
+		return nil, fmt.Errorf("value is not valid UTF-8")
+	}
+	prefix, ok := c.keyPrefixes[key]
+	if !ok {
+		prefix = c.defaultPrefix
+	}
+
+	lines := strings.SplitAfter(string(value), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimLeft(line, " \t"), prefix) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return []byte(strings.Join(kept, "")), nil
+}
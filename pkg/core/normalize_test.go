@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Wave normalize Suite", func() {
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+
+	BeforeEach(func() {
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetAnnotations(map[string]string{
+			NormalizeAnnotation: stripCommentsNormalizer,
+		})
+		cm.Data = map[string]string{
+			"run.sh":       "# Generated at 10:00\necho hello\n",
+			"settings.ini": "; Generated at 10:00\n[main]\nkey = value\n",
+		}
+
+		s = utils.ExampleSecret1.DeepCopy()
+		s.SetAnnotations(map[string]string{
+			NormalizeAnnotation: stripCommentsNormalizer,
+		})
+		s.Data = map[string][]byte{
+			"credentials": []byte("# Generated at 10:00\nuser=wave\n"),
+		}
+	})
+
+	Context("calculateConfigHash", func() {
+		It("returns the same hash when only a comment line is changed", func() {
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["run.sh"] = "# Generated at 11:00\necho hello\n"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when a non-comment line is changed", func() {
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["run.sh"] = "# Generated at 10:00\necho goodbye\n"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("returns the same hash when only a comment line in a Secret is changed", func() {
+			c := []configObject{{object: s, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			s.Data["credentials"] = []byte("# Generated at 11:00\nuser=wave\n")
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when a comment line is changed without the normalizer", func() {
+			cm.SetAnnotations(map[string]string{})
+			c := []configObject{{object: cm, allKeys: true}}
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm.Data["run.sh"] = "# Generated at 11:00\necho hello\n"
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("only strips comments from keys that are referenced", func() {
+			c := []configObject{{object: cm, keys: map[string]struct{}{"run.sh": {}}}}
+			Expect(getConfigMapData(c[0])).To(Equal(map[string]string{
+				"run.sh": "echo hello\n",
+			}))
+		})
+	})
+
+	Context("getCommentStripper", func() {
+		It("returns nil when the normalizer is not enabled", func() {
+			cm.SetAnnotations(map[string]string{NormalizeAnnotation: "something-else"})
+			Expect(getCommentStripper(cm)).To(BeNil())
+		})
+
+		It("uses # as the default comment prefix", func() {
+			stripper := getCommentStripper(cm)
+			Expect(stripper).NotTo(BeNil())
+			Expect(string(stripper.strip("settings.ini", []byte(cm.Data["settings.ini"])))).To(Equal(cm.Data["settings.ini"]))
+			Expect(string(stripper.strip("run.sh", []byte(cm.Data["run.sh"])))).To(Equal("echo hello\n"))
+		})
+
+		It("uses per-key comment prefixes and falls back to the default", func() {
+			cm.Annotations[CommentPrefixAnnotation] = "settings.ini=;"
+			stripper := getCommentStripper(cm)
+			Expect(string(stripper.strip("settings.ini", []byte(cm.Data["settings.ini"])))).To(Equal("[main]\nkey = value\n"))
+			Expect(string(stripper.strip("run.sh", []byte(cm.Data["run.sh"])))).To(Equal("echo hello\n"))
+		})
+
+		It("allows the default comment prefix to be overridden", func() {
+			cm.Annotations[CommentPrefixAnnotation] = "--, run.sh=#"
+			stripper := getCommentStripper(cm)
+			Expect(string(stripper.strip("init.sql", []byte("-- header\nSELECT 1;\n")))).To(Equal("SELECT 1;\n"))
+			Expect(string(stripper.strip("run.sh", []byte(cm.Data["run.sh"])))).To(Equal("echo hello\n"))
+		})
+
+		It("strips indented comment lines", func() {
+			stripper := getCommentStripper(cm)
+			Expect(string(stripper.strip("config.yaml", []byte("a:\n  # comment\n  b: c\n")))).To(Equal("a:\n  b: c\n"))
+		})
+
+		It("leaves values that are not valid UTF-8 untouched", func() {
+			stripper := getCommentStripper(cm)
+			binary := []byte{'#', 0xff, 0xfe, '\n', 0x00}
+			Expect(stripper.strip("blob", binary)).To(Equal(binary))
+		})
+	})
+})
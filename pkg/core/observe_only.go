@@ -0,0 +1,43 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// isObserveOnly returns true if the given podController has the observe-only
+// annotation, or its track-only alias, set to true
+func isObserveOnly(obj podController) bool {
+	annotations := obj.GetAnnotations()
+	for _, annotation := range []string{ObserveOnlyAnnotation, TrackOnlyAnnotation} {
+		if value, ok := annotations[annotation]; ok {
+			if value == requiredAnnotationValue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setObservedConfigHash updates the observed configuration hash stored on the
+// metadata of the given podController, leaving the PodTemplate untouched
+func setObservedConfigHash(obj podController, hash string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[ObservedConfigHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+}
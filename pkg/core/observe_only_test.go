@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave observe-only Suite", func() {
+	var deploymentObject *appsv1.Deployment
+	var podControllerDeployment podController
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		podControllerDeployment = &deployment{deploymentObject}
+	})
+
+	Context("isObserveOnly", func() {
+		It("returns true when the annotation has value true", func() {
+			deploymentObject.SetAnnotations(map[string]string{ObserveOnlyAnnotation: "true"})
+
+			Expect(isObserveOnly(podControllerDeployment)).To(BeTrue())
+		})
+
+		It("returns false when the annotation has value other than true", func() {
+			deploymentObject.SetAnnotations(map[string]string{ObserveOnlyAnnotation: "false"})
+
+			Expect(isObserveOnly(podControllerDeployment)).To(BeFalse())
+		})
+
+		It("returns false when the annotation is not set", func() {
+			Expect(isObserveOnly(podControllerDeployment)).To(BeFalse())
+		})
+
+		It("returns true when the track-only annotation has value true", func() {
+			deploymentObject.SetAnnotations(map[string]string{TrackOnlyAnnotation: "true"})
+
+			Expect(isObserveOnly(podControllerDeployment)).To(BeTrue())
+		})
+	})
+
+	Context("setObservedConfigHash", func() {
+		It("sets the observed hash annotation on the metadata", func() {
+			setObservedConfigHash(podControllerDeployment, "1234")
+
+			Expect(deploymentObject.GetAnnotations()).To(HaveKeyWithValue(ObservedConfigHashAnnotation, "1234"))
+		})
+
+		It("does not modify the Pod Template", func() {
+			setObservedConfigHash(podControllerDeployment, "1234")
+
+			Expect(deploymentObject.Spec.Template).To(Equal(utils.ExampleDeployment.Spec.Template))
+		})
+
+		It("leaves existing annotations in place", func() {
+			deploymentObject.SetAnnotations(map[string]string{"existing": "annotation"})
+			setObservedConfigHash(podControllerDeployment, "1234")
+
+			Expect(deploymentObject.GetAnnotations()).To(HaveKeyWithValue("existing", "annotation"))
+		})
+	})
+
+	Context("when the track-only annotation is set", func() {
+		var c client.Client
+		var h *Handler
+
+		// handle reconciles the Deployment and returns it as updated
+		handle := func() *appsv1.Deployment {
+			_, err := h.HandleDeployment(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: deploymentObject.GetNamespace(), Name: deploymentObject.GetName()}, updated)).To(Succeed())
+			deploymentObject = updated
+			return updated
+		}
+
+		BeforeEach(func() {
+			deploymentObject.SetAnnotations(map[string]string{
+				RequiredAnnotation:  requiredAnnotationValue,
+				TrackOnlyAnnotation: "true",
+			})
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, deploymentObject,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		})
+
+		It("updates the recorded hash without ever modifying the Pod Template", func() {
+			original := handle()
+			hash := original.GetAnnotations()[ObservedConfigHashAnnotation]
+			Expect(hash).NotTo(BeEmpty())
+			Expect(original.Spec.Template).To(Equal(utils.ExampleDeployment.Spec.Template))
+
+			cm := &corev1.ConfigMap{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: utils.ExampleConfigMap1.GetNamespace(), Name: utils.ExampleConfigMap1.GetName()}, cm)).To(Succeed())
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+			updated := handle()
+			Expect(updated.GetAnnotations()[ObservedConfigHashAnnotation]).NotTo(Equal(hash))
+			Expect(updated.Spec.Template).To(Equal(utils.ExampleDeployment.Spec.Template))
+		})
+	})
+})
@@ -0,0 +1,334 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Options configures the behaviour of the Handler and the controllers that
+// use it
+type Options struct {
+	// OwnNamespace is the namespace the Wave controller is running in.
+	// If empty, no namespace is excluded from reconciliation.
+	OwnNamespace string
+
+	// IncludeOwnNamespace enables reconciliation of workloads within
+	// OwnNamespace
+	IncludeOwnNamespace bool
+
+	// NamespaceAllowlist restricts reconciliation to workloads within the
+	// listed namespaces. All namespaces are allowed if it is empty.
+	NamespaceAllowlist []string
+
+	// NamespaceDenylist excludes workloads within the listed namespaces from
+	// reconciliation, even if they are also in NamespaceAllowlist
+	NamespaceDenylist []string
+
+	// WatchLabelSelector enables Wave for every workload whose labels match
+	// it, in place of the required annotation. Only matching workloads are
+	// reconciled. If nil, workloads opt in with the required annotation.
+	WatchLabelSelector labels.Selector
+
+	// DefaultEnabled enables Wave for every workload without a required or
+	// enabled annotation. An annotation with value "false" opts a workload
+	// out. Ignored if WatchLabelSelector is set.
+	DefaultEnabled bool
+
+	// ReverseWatchCoalesce is the window within which repeated updates to
+	// the same ConfigMap or Secret only enqueue the owning workloads once.
+	// Coalescing is disabled if the window is not positive.
+	ReverseWatchCoalesce time.Duration
+
+	// DebounceInterval delays the reconciliation of a workload after a change
+	// to one of its children, so that every change within the interval is
+	// rolled out at once. Workloads are reconciled immediately if it is not
+	// positive.
+	DebounceInterval time.Duration
+
+	// MissingChildGrace is how long a required child may be missing before
+	// the Handler reports an error.
+	// Missing children are reported immediately if the grace is not positive.
+	MissingChildGrace time.Duration
+
+	// MerkleHash enables incremental hashing, where each child is hashed into
+	// a cached leaf and the configuration hash is the root over all leaves.
+	// This produces different hashes to the default hashing mode.
+	MerkleHash bool
+
+	// HashAlgorithm is the algorithm configuration is hashed with when
+	// MerkleHash is not set, and must be one of the HashAlgorithm constants.
+	// If empty, HashAlgorithmSHA256 is used.
+	HashAlgorithm string
+
+	// HashVersionPrefix prefixes configuration hashes with their format, such
+	// as "v1:<hash>", so that a workload whose hash was computed in another
+	// format only rolls out once its configuration changes
+	HashVersionPrefix bool
+
+	// ExtraChildKinds tracks children of kinds other than ConfigMap or Secret,
+	// finding and hashing them with the ChildExtractor of their kind.
+	// Only ConfigMaps and Secrets are tracked if it is empty.
+	ExtraChildKinds map[schema.GroupVersionKind]ChildExtractor
+
+	// EnableKruise enables reconciliation of OpenKruise workloads
+	EnableKruise bool
+
+	// EnableArgoRollouts enables reconciliation of Argo Rollouts
+	EnableArgoRollouts bool
+
+	// EnableDeploymentConfigs enables reconciliation of OpenShift
+	// DeploymentConfigs
+	EnableDeploymentConfigs bool
+
+	// EnableReplicaSets enables reconciliation of ReplicaSets that are not
+	// controlled by a Deployment
+	EnableReplicaSets bool
+
+	// AnnotationWebhook serves a validating webhook rejecting invalid values
+	// of the required annotation
+	AnnotationWebhook bool
+
+	// HashWebhook serves a mutating webhook injecting the configuration hash
+	// into workloads as they are created or updated
+	HashWebhook bool
+
+	// PreRollValidateTimeout is the timeout of requests to pre-roll
+	// validation endpoints. A default timeout is used if it is not positive.
+	PreRollValidateTimeout time.Duration
+
+	// PreRollValidateFailOpen rolls out configuration when its pre-roll
+	// validation endpoint cannot be reached, rather than deferring the rollout
+	PreRollValidateFailOpen bool
+
+	// PreRollAllowlist lists the hosts, or URL prefixes including
+	// their scheme, of the only endpoints that pre-roll validation may call.
+	// Workloads whose endpoint is not allowed are never rolled out, so no
+	// workload can use pre-roll validation if it is empty.
+	PreRollAllowlist []string
+
+	// PDBAware records a Warning event and metric whenever a rollout would be
+	// blocked by a PodDisruptionBudget that currently allows no disruptions
+	PDBAware bool
+
+	// PDBDefer defers such rollouts until the PodDisruptionBudget allows
+	// disruptions again. It has no effect unless PDBAware is set.
+	PDBDefer bool
+
+	// PartialHashPolicy decides how keys that cannot be normalized are
+	// hashed, and must be one of the PartialHashPolicy constants.
+	// PartialHashPolicyRawFallback is used if it is empty.
+	PartialHashPolicy string
+
+	// ChildBundles is the ConfigMap defining the child bundles that workloads
+	// may reference. Child bundles cannot be used if its name is empty.
+	ChildBundles types.NamespacedName
+
+	// SharedConfigNamespace is the namespace whose ConfigMaps and Secrets the
+	// extra children annotations of workloads in any namespace may reference.
+	// Extra children must be in the namespace of their workload if it is
+	// empty.
+	SharedConfigNamespace string
+
+	// RESTMapper resolves the kinds of objects referenced by external digests.
+	// External digests cannot be read if it is nil.
+	RESTMapper meta.RESTMapper
+
+	// Logger is the logger the Handler logs its reconciliation decisions to.
+	// If nil, the controller-runtime logger is used.
+	Logger logr.Logger
+
+	// Version is the version of Wave recorded on workloads alongside the
+	// format of the hash it computed. It is not recorded if empty.
+	Version string
+
+	// HashAnnotation is the key of the annotation on the PodTemplate that the
+	// configuration hash is written to. If empty, ConfigHashAnnotation is used.
+	HashAnnotation string
+
+	// FieldManager is the field manager that every write made by the Handler
+	// is attributed to. If empty, DefaultFieldManager is used.
+	FieldManager string
+
+	// FinalizerName is the finalizer the Handler adds to, and removes from,
+	// each workload it manages. If empty, FinalizerString is used.
+	FinalizerName string
+
+	// IndexChildren watches children through the child index, rather than
+	// through OwnerReferences added to every child
+	IndexChildren bool
+
+	// DisableOwnerReferences stops the Handler from updating children at all,
+	// neither adding OwnerReferences to them nor removing existing ones.
+	// Children are watched through the child index, as with IndexChildren.
+	DisableOwnerReferences bool
+
+	// OwnerController makes the OwnerReferences added to children their
+	// controlling references, unless another owner already controls them
+	OwnerController bool
+
+	// SecretTypeAllowlist restricts the Secrets tracked by the Handler to
+	// those of the listed types. All types are tracked if it is empty.
+	SecretTypeAllowlist []string
+
+	// SecretTypeKeys lists the only data keys of Secrets of each type that
+	// take part in the configuration hash. Every key of Secrets of types that
+	// are not listed is hashed. The DefaultSecretTypeKeys are used if it is
+	// nil.
+	SecretTypeKeys map[string][]string
+
+	// ConcurrentReconciles is the number of workloads of each kind that may
+	// be reconciled at once. Workloads are reconciled one at a time if it is
+	// not positive.
+	ConcurrentReconciles int
+
+	// RateLimiterBaseDelay and RateLimiterMaxDelay configure the backoff of
+	// the controllers when requeueing workloads whose reconciliation failed.
+	// The delay doubles with each consecutive failure from the base delay up
+	// to the max delay. The controller-runtime defaults are used if neither
+	// is positive.
+	RateLimiterBaseDelay time.Duration
+	RateLimiterMaxDelay  time.Duration
+
+	// RequeueJitter is the maximum fraction by which the delay of each
+	// delayed request is extended at random, so that workloads requeued,
+	// debounced or backed off together are not reconciled at the same
+	// instant. Delays are not jittered if it is not positive.
+	RequeueJitter float64
+
+	// MaxRolloutsPerNamespace is the number of Deployments in each namespace
+	// that may have a rollout triggered by the Handler in progress at once.
+	// Further rollouts are deferred until one completes. Rollouts are not
+	// limited if it is not positive.
+	MaxRolloutsPerNamespace int
+
+	// SkipPaused defers the rollouts of paused Deployments until they are
+	// resumed, rather than updating their PodTemplate while paused
+	SkipPaused bool
+
+	// ConfigSummary records a summary of the number of children of each kind
+	// on the metadata of each instance whenever it rolls out
+	ConfigSummary bool
+
+	// MaxDetailsSize is the size in bytes that each of the details
+	// annotations listing children, namely the last changed children, the
+	// status message and the configuration summary, is truncated to.
+	// The configuration hash is never truncated. DefaultMaxDetailsSize is
+	// used if it is not positive.
+	MaxDetailsSize int
+
+	// DryRun logs the rollouts the Handler would perform without updating
+	// workloads or adding OwnerReferences to their children
+	DryRun bool
+
+	// ReconcileTimeout bounds the time each reconcile may spend on requests to
+	// the API server. Requests still in flight once it has elapsed are
+	// cancelled and the instance is requeued. Reconciles are not bounded if
+	// it is not positive.
+	ReconcileTimeout time.Duration
+
+	// MaxReconcileInterval is the longest time a managed instance that was
+	// reconciled successfully waits before it is reconciled again, whether or
+	// not anything changed. Instances are only reconciled again on events and
+	// resyncs if it is not positive.
+	MaxReconcileInterval time.Duration
+
+	// RolloutWindow is the daily window of time within which configuration
+	// changes are rolled out. Changes detected outside it are recorded on the
+	// instance and rolled out when it next opens. Changes are rolled out
+	// immediately if it is nil.
+	RolloutWindow *RolloutWindow
+
+	// Shutdown tracks the reconciles in progress so that Wave can wait for
+	// them to complete when shutting down
+	Shutdown *Shutdown
+
+	// HashCache caches what the Handlers compute from each child, and is
+	// shared by the Handlers of every controller so that the children deleted
+	// from the cluster are evicted from it. Each Handler caches children
+	// itself, evicting only outdated versions of them, if it is nil.
+	HashCache *HashCache
+
+	// WorkloadKinds records the kinds of workload, other than the built in
+	// types, that have a Controller, and is shared by the Handlers of every
+	// controller so that each lists the workloads of every kind. Only the
+	// built in types are listed if it is nil.
+	WorkloadKinds *WorkloadKinds
+}
+
+// UsesChildIndex returns true if children are watched through the child
+// index rather than through their OwnerReferences
+func (o Options) UsesChildIndex() bool {
+	return o.IndexChildren || o.DisableOwnerReferences
+}
+
+// isExcludedNamespace returns true if workloads in the given namespace should
+// not be reconciled by the Handler.
+// Denied namespaces are always excluded, followed by namespaces missing from a
+// non-empty allowlist and finally the controller's own namespace.
+func (h *Handler) isExcludedNamespace(namespace string) bool {
+	if containsNamespace(h.opts.NamespaceDenylist, namespace) {
+		return true
+	}
+	if len(h.opts.NamespaceAllowlist) > 0 && !containsNamespace(h.opts.NamespaceAllowlist, namespace) {
+		return true
+	}
+	if h.opts.IncludeOwnNamespace || h.opts.OwnNamespace == "" {
+		return false
+	}
+	return namespace == h.opts.OwnNamespace
+}
+
+// containsNamespace returns true if the namespace is in the list
+func containsNamespace(namespaces []string, namespace string) bool {
+	for _, n := range namespaces {
+		if n == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// getHashAnnotation returns the key of the annotation on the PodTemplate that
+// the Handler writes the configuration hash to
+func (h *Handler) getHashAnnotation() string {
+	if h.opts.HashAnnotation == "" {
+		return ConfigHashAnnotation
+	}
+	return h.opts.HashAnnotation
+}
+
+// getFinalizerName returns the finalizer that the Handler adds to the
+// workloads it manages
+func (h *Handler) getFinalizerName() string {
+	return h.opts.finalizerName()
+}
+
+// finalizerName returns the finalizer added to the workloads managed with the
+// options
+func (o Options) finalizerName() string {
+	if o.FinalizerName == "" {
+		return FinalizerString
+	}
+	return o.FinalizerName
+}
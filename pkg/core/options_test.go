@@ -0,0 +1,74 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wave options Suite", func() {
+	Context("isExcludedNamespace", func() {
+		It("excludes the controller's own namespace by default", func() {
+			h := &Handler{opts: Options{OwnNamespace: "wave-system"}}
+			Expect(h.isExcludedNamespace("wave-system")).To(BeTrue())
+			Expect(h.isExcludedNamespace("default")).To(BeFalse())
+		})
+
+		It("does not exclude the controller's own namespace when it is included", func() {
+			h := &Handler{opts: Options{OwnNamespace: "wave-system", IncludeOwnNamespace: true}}
+			Expect(h.isExcludedNamespace("wave-system")).To(BeFalse())
+		})
+
+		It("does not exclude any namespace when the own namespace is unknown", func() {
+			h := &Handler{opts: Options{}}
+			Expect(h.isExcludedNamespace("")).To(BeFalse())
+			Expect(h.isExcludedNamespace("default")).To(BeFalse())
+		})
+
+		It("only includes allowed namespaces when there is an allowlist", func() {
+			h := &Handler{opts: Options{NamespaceAllowlist: []string{"team-a", "team-b"}}}
+			Expect(h.isExcludedNamespace("team-a")).To(BeFalse())
+			Expect(h.isExcludedNamespace("team-b")).To(BeFalse())
+			Expect(h.isExcludedNamespace("default")).To(BeTrue())
+		})
+
+		It("excludes denied namespaces when there is a denylist", func() {
+			h := &Handler{opts: Options{NamespaceDenylist: []string{"kube-system"}}}
+			Expect(h.isExcludedNamespace("kube-system")).To(BeTrue())
+			Expect(h.isExcludedNamespace("default")).To(BeFalse())
+		})
+
+		It("lets the denylist win over the allowlist", func() {
+			h := &Handler{opts: Options{
+				NamespaceAllowlist: []string{"team-a", "kube-system"},
+				NamespaceDenylist:  []string{"kube-system"},
+			}}
+			Expect(h.isExcludedNamespace("team-a")).To(BeFalse())
+			Expect(h.isExcludedNamespace("kube-system")).To(BeTrue())
+			Expect(h.isExcludedNamespace("default")).To(BeTrue())
+		})
+
+		It("still excludes the controller's own namespace when it is allowed", func() {
+			h := &Handler{opts: Options{OwnNamespace: "wave-system", NamespaceAllowlist: []string{"wave-system"}}}
+			Expect(h.isExcludedNamespace("wave-system")).To(BeTrue())
+
+			h.opts.IncludeOwnNamespace = true
+			Expect(h.isExcludedNamespace("wave-system")).To(BeFalse())
+		})
+	})
+})
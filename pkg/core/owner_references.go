@@ -22,26 +22,45 @@ import (
 	"reflect"
 	"strings"
 
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 )
 
+// managesOwnerReferences returns true if the Handler adds OwnerReferences to
+// the children of each instance, which it does unless it is in dry-run mode or
+// children are watched through the child index
+func (h *Handler) managesOwnerReferences() bool {
+	return !h.opts.DryRun && !h.opts.UsesChildIndex()
+}
+
 // removeOwnerReferences iterates over a list of children and removes the owner
-// reference from the child before updating it
+// reference from the child before updating it.
+// Only the OwnerReference and owned-by label of the given owner are removed,
+// so children shared with other owners keep theirs. Children are never
+// deleted, and children the owner does not own are left untouched.
 func (h *Handler) removeOwnerReferences(obj podController, children []Object) error {
 	for _, child := range children {
+		labelled := hasOwnedByLabel(child, obj)
+		if !isOwnedBy(child, obj) && !labelled {
+			continue
+		}
+
 		// Filter the existing ownerReferences
 		ownerRefs := []metav1.OwnerReference{}
-		for _, ref := range child.GetOwnerReferences() {
-			if ref.UID != obj.GetUID() {
+		for _, ref := range dedupeOwnerReferences(child.GetOwnerReferences()) {
+			if !refersTo(ref, obj) {
 				ownerRefs = append(ownerRefs, ref)
 			}
 		}
 
-		// Compare the ownerRefs and update if they have changed
-		if !reflect.DeepEqual(ownerRefs, child.GetOwnerReferences()) {
+		// Compare the ownerRefs and update if they, or the label, have changed
+		if !reflect.DeepEqual(ownerRefs, child.GetOwnerReferences()) || labelled {
 			h.recorder.Eventf(child, corev1.EventTypeNormal, "RemoveWatch", "Removing watch for %s %s", kindOf(child), child.GetName())
 			child.SetOwnerReferences(ownerRefs)
+			removeOwnedByLabel(child, obj)
 			err := h.Update(context.TODO(), child)
 			if err != nil {
 				return fmt.Errorf("error updating child %s/%s: %v", child.GetNamespace(), child.GetName(), err)
@@ -55,17 +74,24 @@ func (h *Handler) removeOwnerReferences(obj podController, children []Object) er
 // OwnerReferences added/updated and which need to have their OwnerReferences
 // removed and then performs all updates
 func (h *Handler) updateOwnerReferences(owner podController, existing []Object, current []configObject) error {
-	// Add an owner reference to each child object
-	errChan := make(chan error)
+	// Add an owner reference to each child object in the owner's namespace,
+	// as OwnerReferences cannot point to another namespace
+	var owned []Object
 	for _, obj := range current {
+		if obj.object.GetNamespace() == owner.GetNamespace() {
+			owned = append(owned, obj.object)
+		}
+	}
+	errChan := make(chan error)
+	for _, obj := range owned {
 		go func(child Object) {
 			errChan <- h.updateOwnerReference(owner, child)
-		}(obj.object)
+		}(obj)
 	}
 
 	// Return any errors encountered updating the child objects
 	errs := []string{}
-	for range current {
+	for range owned {
 		err := <-errChan
 		if err != nil {
 			errs = append(errs, err.Error())
@@ -85,21 +111,24 @@ func (h *Handler) updateOwnerReferences(owner podController, existing []Object,
 	return nil
 }
 
-// updateOwnerReference ensures that the child object has an OwnerReference
-// pointing to the owner
+// updateOwnerReference ensures that the child object has exactly one
+// OwnerReference pointing to the owner, and the owned-by label of the owner
 func (h *Handler) updateOwnerReference(owner podController, child Object) error {
-	ownerRef := getOwnerReference(owner)
-	for _, ref := range child.GetOwnerReferences() {
-		// Owner Reference already exists, do nothing
-		if reflect.DeepEqual(ref, ownerRef) {
-			return nil
-		}
+	ownerRef := h.getChildOwnerReference(owner, child)
+	ownerRefs, found := collapseOwnerReferences(dedupeOwnerReferences(child.GetOwnerReferences()), ownerRef)
+
+	// Owner Reference already exists exactly once, do nothing
+	if found && reflect.DeepEqual(ownerRefs, child.GetOwnerReferences()) && hasOwnedByLabel(child, owner) {
+		return nil
 	}
 
-	// Append the new OwnerReference and update the child
-	h.recorder.Eventf(child, corev1.EventTypeNormal, "AddWatch", "Adding watch for %s %s", kindOf(child), child.GetName())
-	ownerRefs := append(child.GetOwnerReferences(), ownerRef)
+	// Append the new OwnerReference if not present and update the child
+	if !found {
+		h.recorder.Eventf(child, corev1.EventTypeNormal, "AddWatch", "Adding watch for %s %s", kindOf(child), child.GetName())
+		ownerRefs = append(ownerRefs, ownerRef)
+	}
 	child.SetOwnerReferences(ownerRefs)
+	setOwnedByLabel(child, owner)
 	err := h.Update(context.TODO(), child)
 	if err != nil {
 		return fmt.Errorf("error updating child: %v", err)
@@ -107,6 +136,103 @@ func (h *Handler) updateOwnerReference(owner podController, child Object) error
 	return nil
 }
 
+// ownedByLabel returns the key of the owned-by label of the owner
+func ownedByLabel(owner metav1.Object) string {
+	return OwnedByLabelPrefix + string(owner.GetUID())
+}
+
+// hasOwnedByLabel returns true if the child carries the owned-by label of the
+// owner
+func hasOwnedByLabel(child, owner metav1.Object) bool {
+	return child.GetLabels()[ownedByLabel(owner)] == ownedByLabelValue
+}
+
+// setOwnedByLabel sets the owned-by label of the owner on the child
+func setOwnedByLabel(child, owner metav1.Object) {
+	labels := child.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[ownedByLabel(owner)] = ownedByLabelValue
+	child.SetLabels(labels)
+}
+
+// setOwnedByLabelled records that every child owned by the instance carries
+// its owned-by label, once its OwnerReferences have been updated from all of
+// its existing children
+func (h *Handler) setOwnedByLabelled(owner podController) {
+	h.labelledMutex.Lock()
+	defer h.labelledMutex.Unlock()
+	if h.labelledOwners == nil {
+		h.labelledOwners = make(map[types.UID]struct{})
+	}
+	h.labelledOwners[owner.GetUID()] = struct{}{}
+}
+
+// isOwnedByLabelled returns true if every child owned by the instance is
+// known to carry its owned-by label
+func (h *Handler) isOwnedByLabelled(owner podController) bool {
+	h.labelledMutex.Lock()
+	defer h.labelledMutex.Unlock()
+	_, ok := h.labelledOwners[owner.GetUID()]
+	return ok
+}
+
+// clearOwnedByLabelled forgets that the children owned by the instance are
+// labelled once Wave no longer manages it
+func (h *Handler) clearOwnedByLabelled(owner podController) {
+	h.labelledMutex.Lock()
+	defer h.labelledMutex.Unlock()
+	delete(h.labelledOwners, owner.GetUID())
+}
+
+// removeOwnedByLabel removes the owned-by label of the owner from the child
+func removeOwnedByLabel(child, owner metav1.Object) {
+	labels := child.GetLabels()
+	if _, ok := labels[ownedByLabel(owner)]; !ok {
+		return
+	}
+	delete(labels, ownedByLabel(owner))
+	child.SetLabels(labels)
+}
+
+// collapseOwnerReferences replaces every OwnerReference sharing a UID with the
+// given OwnerReference with a single copy of it, in the position of the first,
+// and returns whether any such OwnerReference was found.
+// OwnerReferences pointing to other owners are left untouched.
+func collapseOwnerReferences(refs []metav1.OwnerReference, ownerRef metav1.OwnerReference) ([]metav1.OwnerReference, bool) {
+	collapsed := []metav1.OwnerReference{}
+	found := false
+	for _, ref := range refs {
+		if ref.UID != ownerRef.UID {
+			collapsed = append(collapsed, ref)
+			continue
+		}
+		if !found {
+			collapsed = append(collapsed, ownerRef)
+			found = true
+		}
+	}
+	return collapsed, found
+}
+
+// dedupeOwnerReferences drops every OwnerReference sharing a UID with an
+// earlier one, so that the children Wave writes never carry duplicates.
+// References to owners that no longer exist are left for the garbage
+// collector to remove.
+func dedupeOwnerReferences(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	deduped := []metav1.OwnerReference{}
+	seen := make(map[types.UID]bool)
+	for _, ref := range refs {
+		if seen[ref.UID] {
+			continue
+		}
+		seen[ref.UID] = true
+		deduped = append(deduped, ref)
+	}
+	return deduped
+}
+
 // getOrphans creates a slice of orphaned child objects that need their
 // OwnerReferences removing
 func getOrphans(existing []Object, current []configObject) []Object {
@@ -124,7 +250,7 @@ func getOwnerReference(obj podController) metav1.OwnerReference {
 	t := true
 	f := false
 	return metav1.OwnerReference{
-		APIVersion:         "apps/v1",
+		APIVersion:         apiVersionOf(obj),
 		Kind:               kindOf(obj),
 		Name:               obj.GetName(),
 		UID:                obj.GetUID(),
@@ -133,6 +259,25 @@ func getOwnerReference(obj podController) metav1.OwnerReference {
 	}
 }
 
+// getChildOwnerReference constructs the OwnerReference pointing to the owner
+// that is added to the child. It is the controlling reference if the Handler
+// is configured with OwnerController, unless another owner already controls
+// the child, as an object may only have one controller.
+func (h *Handler) getChildOwnerReference(owner podController, child Object) metav1.OwnerReference {
+	ownerRef := getOwnerReference(owner)
+	if !h.opts.OwnerController {
+		return ownerRef
+	}
+	for _, ref := range child.GetOwnerReferences() {
+		if !refersTo(ref, owner) && ref.Controller != nil && *ref.Controller {
+			return ownerRef
+		}
+	}
+	t := true
+	ownerRef.Controller = &t
+	return ownerRef
+}
+
 // isIn checks whether a child object exists within a slice of objects
 func isIn(list []configObject, child Object) bool {
 	for _, obj := range list {
@@ -156,7 +301,28 @@ func kindOf(obj Object) string {
 		return "StatefulSet"
 	case *daemonset:
 		return "DaemonSet"
+	case *replicaset:
+		return "ReplicaSet"
+	case *cronjob:
+		return "CronJob"
+	case *podtemplate:
+		return "PodTemplate"
+	case *unstructuredPodController, *unstructured.Unstructured:
+		return obj.GetObjectKind().GroupVersionKind().Kind
 	default:
 		return "Unknown"
 	}
 }
+
+// apiVersionOf returns the APIVersion of the given podController as a string
+func apiVersionOf(obj podController) string {
+	switch o := obj.(type) {
+	case *unstructuredPodController:
+		return o.GetAPIVersion()
+	case *cronjob:
+		return batchv1beta1.SchemeGroupVersion.String()
+	case *podtemplate:
+		return corev1.SchemeGroupVersion.String()
+	}
+	return "apps/v1"
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package core
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -26,8 +28,12 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -59,7 +65,7 @@ var _ = Describe("Wave owner references Suite", func() {
 		var cerr error
 		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 		Expect(cerr).NotTo(HaveOccurred())
-		h = NewHandler(c, mgr.GetEventRecorderFor("wave"))
+		h = NewHandler(c, mgr.GetEventRecorderFor("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -220,10 +226,11 @@ var _ = Describe("Wave owner references Suite", func() {
 		})
 
 		It("doesn't update the child object if there is already and OwnerReference present", func() {
-			// Add an OwnerReference to cm2
+			// Add an OwnerReference and the owned-by label to cm2
 			m.Update(cm2, func(obj utils.Object) utils.Object {
 				cm2 := obj.(*corev1.ConfigMap)
 				cm2.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+				setOwnedByLabel(cm2, podControllerDeployment)
 
 				return cm2
 			}, timeout).Should(Succeed())
@@ -239,6 +246,29 @@ var _ = Describe("Wave owner references Suite", func() {
 			Expect(cm2.GetResourceVersion()).To(Equal(originalVersion))
 		})
 
+		It("collapses duplicate OwnerReferences pointing to the owner", func() {
+			otherRef := ownerRef
+			otherRef.UID = cm1.GetUID()
+			m.Update(cm2, func(obj utils.Object) utils.Object {
+				cm2 := obj.(*corev1.ConfigMap)
+				cm2.SetOwnerReferences([]metav1.OwnerReference{ownerRef, otherRef, ownerRef})
+
+				return cm2
+			}, timeout).Should(Succeed())
+			m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(HaveLen(3)))
+
+			m.Get(cm2, timeout).Should(Succeed())
+			Expect(h.updateOwnerReference(podControllerDeployment, cm2)).NotTo(HaveOccurred())
+			m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(Equal([]metav1.OwnerReference{ownerRef, otherRef})))
+
+			// Collapsing is idempotent
+			m.Get(cm2, timeout).Should(Succeed())
+			originalVersion := cm2.GetResourceVersion()
+			Expect(h.updateOwnerReference(podControllerDeployment, cm2)).NotTo(HaveOccurred())
+			m.Get(cm2, timeout).Should(Succeed())
+			Expect(cm2.GetResourceVersion()).To(Equal(originalVersion))
+		})
+
 		It("sends events for adding each owner reference", func() {
 			m.Get(cm1, timeout).Should(Succeed())
 			Expect(h.updateOwnerReference(podControllerDeployment, cm1)).NotTo(HaveOccurred())
@@ -369,3 +399,661 @@ var _ = Describe("Wave owner references Suite", func() {
 		})
 	})
 })
+
+var _ = Describe("Wave duplicate owner references Suite", func() {
+	It("collapses duplicate OwnerReferences on children when reconciling", func() {
+		d := utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		ownerRef := getOwnerReference(&deployment{d})
+		otherRef := ownerRef
+		otherRef.UID = types.UID("other")
+
+		cm1 := utils.ExampleConfigMap1.DeepCopy()
+		cm1.SetOwnerReferences([]metav1.OwnerReference{ownerRef, ownerRef, otherRef, ownerRef})
+
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, cm1,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		key := client.ObjectKey{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}
+		Expect(c.Get(context.TODO(), key, cm1)).To(Succeed())
+		Expect(cm1.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{ownerRef, otherRef}))
+	})
+})
+
+var _ = Describe("Wave owner reference cycles Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var ownerRef, otherRef, staleRef metav1.OwnerReference
+
+	// getOwnerReferences fetches the current OwnerReferences of the ConfigMap
+	getOwnerReferences := func(cm *corev1.ConfigMap) []metav1.OwnerReference {
+		fetched := &corev1.ConfigMap{}
+		key := client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}
+		Expect(c.Get(context.TODO(), key, fetched)).To(Succeed())
+		return fetched.GetOwnerReferences()
+	}
+
+	// setup creates the Deployment and its children, with cm1 carrying the
+	// given OwnerReferences
+	setup := func(refs ...metav1.OwnerReference) *corev1.ConfigMap {
+		cm1 := utils.ExampleConfigMap1.DeepCopy()
+		cm1.SetUID(types.UID("cm1"))
+		cm1.SetOwnerReferences(refs)
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm1,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		return cm1
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		ownerRef = getOwnerReference(&deployment{d})
+
+		otherRef = ownerRef
+		otherRef.Name = "other"
+		otherRef.UID = types.UID("other")
+
+		// The Deployment this points to has been deleted
+		staleRef = ownerRef
+		staleRef.Name = "deleted"
+		staleRef.UID = types.UID("deleted")
+	})
+
+	It("deduplicates identical OwnerReferences pointing to other owners", func() {
+		cm1 := setup(otherRef, otherRef)
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getOwnerReferences(cm1)).To(Equal([]metav1.OwnerReference{otherRef, ownerRef}))
+	})
+
+	It("leaves a stale OwnerReference to a deleted Deployment in place", func() {
+		cm1 := setup(staleRef)
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getOwnerReferences(cm1)).To(Equal([]metav1.OwnerReference{staleRef, ownerRef}))
+
+		// Reconciling again does not update the child
+		fetched := &corev1.ConfigMap{}
+		key := client.ObjectKey{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}
+		Expect(c.Get(context.TODO(), key, fetched)).To(Succeed())
+		_, err = h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		refetched := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), key, refetched)).To(Succeed())
+		Expect(refetched.GetResourceVersion()).To(Equal(fetched.GetResourceVersion()))
+	})
+
+	It("deduplicates the OwnerReferences left when removing its own", func() {
+		cm1 := setup(ownerRef, staleRef, staleRef)
+		Expect(h.removeOwnerReferences(&deployment{d}, []Object{cm1})).To(Succeed())
+		Expect(getOwnerReferences(cm1)).To(Equal([]metav1.OwnerReference{staleRef}))
+	})
+
+	It("does not treat a child referencing itself as owned", func() {
+		cm1 := utils.ExampleConfigMap1.DeepCopy()
+		cm1.SetUID(types.UID("cm1"))
+		selfRef := ownerRef
+		selfRef.UID = cm1.GetUID()
+		cm1.SetOwnerReferences([]metav1.OwnerReference{selfRef})
+		Expect(isOwnedBy(cm1, cm1)).To(BeFalse())
+	})
+
+	It("does not treat a child as owned by an owner without a UID", func() {
+		cm1 := utils.ExampleConfigMap1.DeepCopy()
+		emptyRef := ownerRef
+		emptyRef.UID = ""
+		cm1.SetOwnerReferences([]metav1.OwnerReference{emptyRef})
+		d.SetUID("")
+		Expect(isOwnedBy(cm1, d)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Wave repointed children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var oldChild, newChild *corev1.ConfigMap
+	var ownerRef, otherRef metav1.OwnerReference
+
+	// handle reconciles the current state of the Deployment
+	var handle = func() {
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// getOwnerReferences returns the current OwnerReferences of the ConfigMap
+	var getOwnerReferences = func(cm *corev1.ConfigMap) []metav1.OwnerReference {
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		return cm.GetOwnerReferences()
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "container", Image: "container"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "old-config"},
+					},
+				},
+			},
+		}
+		ownerRef = getOwnerReference(&deployment{d})
+		otherRef = ownerRef
+		otherRef.Name = "other"
+		otherRef.UID = types.UID("other")
+
+		// The old ConfigMap is also owned by another workload
+		oldChild = utils.ExampleConfigMap1.DeepCopy()
+		oldChild.SetName("old-config")
+		oldChild.SetUID(types.UID("old-config"))
+		oldChild.SetOwnerReferences([]metav1.OwnerReference{otherRef})
+		newChild = utils.ExampleConfigMap1.DeepCopy()
+		newChild.SetName("new-config")
+		newChild.SetUID(types.UID("new-config"))
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, oldChild, newChild)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		handle()
+		Expect(getOwnerReferences(oldChild)).To(ConsistOf(otherRef, ownerRef))
+		Expect(getOwnerReferences(newChild)).To(BeEmpty())
+	})
+
+	It("migrates the OwnerReference when a volume is repointed to another ConfigMap", func() {
+		d.Spec.Template.Spec.Volumes[0].VolumeSource.ConfigMap.Name = newChild.GetName()
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		handle()
+
+		Expect(getOwnerReferences(oldChild)).To(ConsistOf(otherRef))
+		Expect(getOwnerReferences(newChild)).To(ConsistOf(ownerRef))
+	})
+})
+
+// listRecordingClient records the label selector of every List
+type listRecordingClient struct {
+	client.Client
+	selectors []string
+}
+
+func (c *listRecordingClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	selector := ""
+	if listOpts.LabelSelector != nil {
+		selector = listOpts.LabelSelector.String()
+	}
+	c.selectors = append(c.selectors, selector)
+	return c.Client.List(ctx, list, opts...)
+}
+
+var _ = Describe("Wave owned-by label Suite", func() {
+	var c *listRecordingClient
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm1 *corev1.ConfigMap
+
+	// handle reconciles the current state of the Deployment
+	var handle = func() {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		d = fetched
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// optOut removes the required annotation from the Deployment and
+	// reconciles it
+	var optOut = func() {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		delete(fetched.Annotations, RequiredAnnotation)
+		Expect(c.Update(context.TODO(), fetched)).To(Succeed())
+		handle()
+	}
+
+	// getLabels returns the current labels of the ConfigMap
+	var getLabels = func(cm *corev1.ConfigMap) map[string]string {
+		fetched := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, fetched)).To(Succeed())
+		return fetched.GetLabels()
+	}
+
+	// names returns the kinds and names of the children
+	var names = func(children []Object) []string {
+		names := []string{}
+		for _, child := range children {
+			names = append(names, kindOf(child)+"/"+child.GetName())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		c = &listRecordingClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d, cm1,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("labels the children it adds an OwnerReference to", func() {
+		handle()
+		Expect(getLabels(cm1)).To(HaveKeyWithValue(OwnedByLabelPrefix+"deployment", "true"))
+	})
+
+	It("lists existing children with a label selector", func() {
+		handle()
+
+		c.selectors = nil
+		existing, err := h.getExistingChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.selectors).To(HaveLen(2))
+		for _, selector := range c.selectors {
+			Expect(selector).To(Equal(OwnedByLabelPrefix + "deployment=true"))
+		}
+
+		all, err := h.getAllExistingChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(existing)).To(ConsistOf(names(all)))
+		Expect(names(existing)).To(HaveLen(6))
+	})
+
+	It("labels children owned before they were labelled on the next reconcile", func() {
+		cm1.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(&deployment{d})})
+		Expect(c.Update(context.TODO(), cm1)).To(Succeed())
+
+		existing, err := h.getExistingChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(existing)).To(ConsistOf("ConfigMap/" + cm1.GetName()))
+
+		handle()
+		Expect(getLabels(cm1)).To(HaveKeyWithValue(OwnedByLabelPrefix+"deployment", "true"))
+	})
+
+	It("removes the OwnerReferences of children owned before they were labelled once they are no longer referenced", func() {
+		// A child owned by the Deployment before upgrading, which the
+		// Deployment no longer references
+		stale := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "stale",
+				Namespace:       d.GetNamespace(),
+				UID:             types.UID("stale"),
+				OwnerReferences: []metav1.OwnerReference{getOwnerReference(&deployment{d})},
+			},
+		}
+		Expect(c.Create(context.TODO(), stale)).To(Succeed())
+
+		handle()
+		fetched := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: stale.GetNamespace(), Name: stale.GetName()}, fetched)).To(Succeed())
+		Expect(fetched.GetOwnerReferences()).To(BeEmpty())
+
+		// Once labelled, the children are listed by their label
+		c.selectors = nil
+		_, err := h.getExistingChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.selectors).To(ConsistOf(OwnedByLabelPrefix+"deployment=true", OwnedByLabelPrefix+"deployment=true"))
+	})
+
+	It("removes the label when the Deployment opts out", func() {
+		handle()
+
+		optOut()
+
+		Expect(getLabels(cm1)).NotTo(HaveKey(OwnedByLabelPrefix + "deployment"))
+		fetched := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}, fetched)).To(Succeed())
+		Expect(fetched.GetOwnerReferences()).To(BeEmpty())
+	})
+
+	It("leaves the labels of other owners in place", func() {
+		cm1.SetLabels(map[string]string{OwnedByLabelPrefix + "other": "true", "app": "example"})
+		Expect(c.Update(context.TODO(), cm1)).To(Succeed())
+		handle()
+
+		optOut()
+
+		Expect(getLabels(cm1)).To(Equal(map[string]string{OwnedByLabelPrefix + "other": "true", "app": "example"}))
+	})
+})
+
+var _ = Describe("Wave renamed children Suite", func() {
+	var c *childUpdateClient
+	var h *Handler
+	var d *appsv1.Deployment
+	var oldChild, newChild *corev1.ConfigMap
+
+	// handle reconciles the current state of the Deployment and returns its
+	// config hash
+	var handle = func() string {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		_, err := h.HandleDeployment(fetched)
+		Expect(err).NotTo(HaveOccurred())
+
+		d = &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: fetched.GetNamespace(), Name: fetched.GetName()}, d)).To(Succeed())
+		return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+	}
+
+	// get returns the current state of the ConfigMap
+	var get = func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+		fetched := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, fetched)).To(Succeed())
+		return fetched
+	}
+
+	// rename points the Deployment's references at the new ConfigMap, as
+	// kustomize does when it applies a ConfigMap generated with a new name
+	// together with the Deployment referencing it
+	var rename = func() {
+		Expect(c.Create(context.TODO(), newChild)).To(Succeed())
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		fetched.Spec.Template.Spec.Volumes[0].VolumeSource.ConfigMap.Name = newChild.GetName()
+		fetched.Spec.Template.Spec.Containers[0].EnvFrom[0].ConfigMapRef.Name = newChild.GetName()
+		Expect(c.Update(context.TODO(), fetched)).To(Succeed())
+	}
+
+	// setup creates the Deployment referencing the old ConfigMap and
+	// reconciles it with the given options
+	var setup = func(opts Options) {
+		c = &childUpdateClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d, oldChild)}
+		h = NewHandler(c, record.NewFakeRecorder(100), opts)
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID(types.UID("deployment"))
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name:  "container",
+				Image: "container",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "app-config-7f8c9"},
+						},
+					},
+				},
+			},
+		}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "app-config-7f8c9"},
+					},
+				},
+			},
+		}
+
+		// kustomize renames the ConfigMap even when only its options change,
+		// so the data of both is identical
+		oldChild = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: d.GetNamespace(), Name: "app-config-7f8c9", UID: types.UID("app-config-7f8c9")},
+			Data:       map[string]string{"LOG_LEVEL": "info"},
+		}
+		newChild = oldChild.DeepCopy()
+		newChild.SetName("app-config-9d2b4")
+		newChild.SetUID(types.UID("app-config-9d2b4"))
+	})
+
+	for _, merkle := range []bool{false, true} {
+		merkle := merkle
+
+		It(fmt.Sprintf("rolls out and migrates the OwnerReference in the same reconcile with MerkleHash %t", merkle), func() {
+			setup(Options{MerkleHash: merkle})
+			original := handle()
+			Expect(original).NotTo(BeEmpty())
+			Expect(get(oldChild).GetOwnerReferences()).To(ConsistOf(getOwnerReference(&deployment{d})))
+
+			rename()
+			Expect(handle()).NotTo(Equal(original))
+
+			Expect(get(oldChild).GetOwnerReferences()).To(BeEmpty())
+			Expect(get(oldChild).GetLabels()).NotTo(HaveKey(ownedByLabel(d)))
+			Expect(get(newChild).GetOwnerReferences()).To(ConsistOf(getOwnerReference(&deployment{d})))
+			Expect(get(newChild).GetLabels()).To(HaveKey(ownedByLabel(d)))
+		})
+	}
+
+	It("does not update the children again once the rename is reconciled", func() {
+		setup(Options{})
+		handle()
+		rename()
+		renamed := handle()
+
+		c.updates = 0
+		Expect(handle()).To(Equal(renamed))
+		Expect(c.updates).To(Equal(0))
+	})
+
+	It("does not fail once the old ConfigMap is pruned", func() {
+		setup(Options{})
+		original := handle()
+		rename()
+		Expect(c.Delete(context.TODO(), get(oldChild))).To(Succeed())
+
+		Expect(handle()).NotTo(Equal(original))
+		Expect(get(newChild).GetOwnerReferences()).To(ConsistOf(getOwnerReference(&deployment{d})))
+	})
+})
+
+var _ = Describe("Wave shared children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var a, b *appsv1.Deployment
+	var children []Object
+
+	// getDeployment fetches the current state of the Deployment
+	getDeployment := func(d *appsv1.Deployment) *appsv1.Deployment {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		return fetched
+	}
+
+	// expectOnlyOwnedByB asserts that every child still exists, owned only
+	// by b with its owned-by label
+	expectOnlyOwnedByB := func() {
+		for _, child := range children {
+			fetched := child.DeepCopyObject().(Object)
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, fetched)).To(Succeed())
+			Expect(fetched.GetOwnerReferences()).To(ConsistOf(getOwnerReference(&deployment{b})))
+			Expect(hasOwnedByLabel(fetched, a)).To(BeFalse())
+			Expect(hasOwnedByLabel(fetched, b)).To(BeTrue())
+		}
+	}
+
+	BeforeEach(func() {
+		a = utils.ExampleDeployment.DeepCopy()
+		a.SetUID(types.UID("a"))
+		a.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		b = a.DeepCopy()
+		b.SetName("example-b")
+		b.SetUID(types.UID("b"))
+
+		children = []Object{
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		}
+		objects := []runtime.Object{a, b}
+		for _, child := range children {
+			objects = append(objects, child.DeepCopyObject())
+		}
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		_, err := h.HandleDeployment(getDeployment(a))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = h.HandleDeployment(getDeployment(b))
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, child := range children {
+			fetched := child.DeepCopyObject().(Object)
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, fetched)).To(Succeed())
+			Expect(fetched.GetOwnerReferences()).To(ConsistOf(getOwnerReference(&deployment{a}), getOwnerReference(&deployment{b})))
+		}
+	})
+
+	It("only removes the OwnerReference of a deleted owner", func() {
+		deleted := getDeployment(a)
+		now := metav1.Now()
+		deleted.SetDeletionTimestamp(&now)
+		_, err := h.HandleDeployment(deleted)
+		Expect(err).NotTo(HaveOccurred())
+		expectOnlyOwnedByB()
+	})
+
+	It("only removes the OwnerReference of an owner opting out", func() {
+		optedOut := getDeployment(a)
+		optedOut.SetAnnotations(map[string]string{})
+		Expect(c.Update(context.TODO(), optedOut)).To(Succeed())
+		_, err := h.HandleDeployment(getDeployment(a))
+		Expect(err).NotTo(HaveOccurred())
+		expectOnlyOwnedByB()
+	})
+
+	It("leaves children the owner does not own untouched", func() {
+		removed := getDeployment(a)
+		now := metav1.Now()
+		removed.SetDeletionTimestamp(&now)
+		_, err := h.HandleDeployment(removed)
+		Expect(err).NotTo(HaveOccurred())
+
+		counting := &childUpdateClient{Client: c}
+		h = NewHandler(counting, record.NewFakeRecorder(100), Options{})
+		orphans := []Object{}
+		for _, child := range children {
+			fetched := child.DeepCopyObject().(Object)
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, fetched)).To(Succeed())
+			orphans = append(orphans, fetched)
+		}
+		Expect(h.removeOwnerReferences(&deployment{a}, orphans)).To(Succeed())
+		Expect(counting.updates).To(BeZero())
+		expectOnlyOwnedByB()
+	})
+})
+
+var _ = Describe("Wave controlling owner references Suite", func() {
+	var c client.Client
+	var a, b *appsv1.Deployment
+
+	// getChild fetches the current state of the child
+	getChild := func(child Object) Object {
+		fetched := child.DeepCopyObject().(Object)
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, fetched)).To(Succeed())
+		return fetched
+	}
+
+	// controllerOf returns the Controller field of the OwnerReference on the
+	// child pointing to the owner
+	controllerOf := func(child Object, owner metav1.Object) bool {
+		for _, ref := range child.GetOwnerReferences() {
+			if refersTo(ref, owner) {
+				Expect(ref.Controller).NotTo(BeNil())
+				return *ref.Controller
+			}
+		}
+		Fail(fmt.Sprintf("%s has no OwnerReference to %s", child.GetName(), owner.GetName()))
+		return false
+	}
+
+	// handle reconciles the current state of the Deployment with the options
+	handle := func(d *appsv1.Deployment, opts Options) {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		h := NewHandler(c, record.NewFakeRecorder(100), opts)
+		_, err := h.HandleDeployment(fetched)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		a = utils.ExampleDeployment.DeepCopy()
+		a.SetUID(types.UID("a"))
+		a.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		b = a.DeepCopy()
+		b.SetName("example-b")
+		b.SetUID(types.UID("b"))
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, a, b,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+	})
+
+	It("adds non-controlling OwnerReferences by default", func() {
+		handle(a, Options{})
+		child := getChild(utils.ExampleConfigMap1)
+		Expect(controllerOf(child, a)).To(BeFalse())
+		Expect(isOwnedBy(child, a)).To(BeTrue())
+	})
+
+	It("adds controlling OwnerReferences with OwnerController", func() {
+		handle(a, Options{OwnerController: true})
+		for _, child := range []Object{utils.ExampleConfigMap1, utils.ExampleSecret1} {
+			fetched := getChild(child)
+			Expect(controllerOf(fetched, a)).To(BeTrue())
+			Expect(isOwnedBy(fetched, a)).To(BeTrue())
+		}
+	})
+
+	It("adds a non-controlling OwnerReference when another owner controls the child", func() {
+		handle(a, Options{OwnerController: true})
+		handle(b, Options{OwnerController: true})
+		child := getChild(utils.ExampleConfigMap1)
+		Expect(controllerOf(child, a)).To(BeTrue())
+		Expect(controllerOf(child, b)).To(BeFalse())
+		Expect(isOwnedBy(child, a)).To(BeTrue())
+		Expect(isOwnedBy(child, b)).To(BeTrue())
+	})
+
+	It("updates existing OwnerReferences when OwnerController changes", func() {
+		handle(a, Options{})
+		handle(a, Options{OwnerController: true})
+		child := getChild(utils.ExampleConfigMap1)
+		Expect(controllerOf(child, a)).To(BeTrue())
+		Expect(child.GetOwnerReferences()).To(HaveLen(1))
+
+		handle(a, Options{})
+		child = getChild(utils.ExampleConfigMap1)
+		Expect(controllerOf(child, a)).To(BeFalse())
+		Expect(child.GetOwnerReferences()).To(HaveLen(1))
+	})
+
+	It("cleans up controlling OwnerReferences", func() {
+		handle(a, Options{OwnerController: true})
+		deleted := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: a.GetNamespace(), Name: a.GetName()}, deleted)).To(Succeed())
+		now := metav1.Now()
+		deleted.SetDeletionTimestamp(&now)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{OwnerController: true})
+		_, err := h.HandleDeployment(deleted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getChild(utils.ExampleConfigMap1).GetOwnerReferences()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PartialHashPolicyFail aborts the hash when any key cannot be normalized
+	PartialHashPolicyFail = "fail"
+
+	// PartialHashPolicySkipKey excludes keys that cannot be normalized from
+	// the hash
+	PartialHashPolicySkipKey = "skip-key"
+
+	// PartialHashPolicyRawFallback hashes the raw value of keys that cannot be
+	// normalized
+	PartialHashPolicyRawFallback = "raw-fallback"
+)
+
+// ValidatePartialHashPolicy returns an error if the given policy is not one of
+// the known partial hash policies
+func ValidatePartialHashPolicy(policy string) error {
+	switch policy {
+	case PartialHashPolicyFail, PartialHashPolicySkipKey, PartialHashPolicyRawFallback:
+		return nil
+	}
+	return fmt.Errorf("unknown partial hash policy %q", policy)
+}
+
+// applyPartialHashPolicy checks that every hashed key of the children can be
+// normalized and handles those that cannot according to the Handler's
+// partial hash policy, recording a Warning event on the instance for each key
+// that is skipped or hashed raw. Keys are hashed raw if no policy is set, as
+// they were before the policy was introduced.
+func (h *Handler) applyPartialHashPolicy(obj podController, children []configObject) ([]configObject, error) {
+	for i, child := range children {
+		if child.object == nil {
+			continue
+		}
+		stripper := getCommentStripper(child.object)
+		if stripper == nil {
+			continue
+		}
+
+		filter := getChildKeyFilter(child)
+		for key, value := range getRawData(child) {
+			if _, exists := child.keys[key]; !exists && !child.allKeys {
+				continue
+			}
+			if filter.excludes(key) {
+				continue
+			}
+			_, err := stripper.normalize(key, value)
+			if err == nil {
+				continue
+			}
+
+			name := fmt.Sprintf("%s %s", kindOf(child.object), child.object.GetName())
+			switch h.opts.PartialHashPolicy {
+			case PartialHashPolicySkipKey:
+				if children[i].skippedKeys == nil {
+					children[i].skippedKeys = make(map[string]struct{})
+				}
+				children[i].skippedKeys[key] = struct{}{}
+				h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "PartialHash", "Excluded key %s of %s from the configuration hash: %v", key, name, err)
+			case PartialHashPolicyFail:
+				return []configObject{}, fmt.Errorf("error normalizing key %s of %s: %v", key, name, err)
+			default:
+				h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "PartialHash", "Hashed raw value of key %s of %s: %v", key, name, err)
+			}
+		}
+	}
+	return children, nil
+}
+
+// getRawData returns the data of the child's ConfigMap or Secret as bytes
+func getRawData(child configObject) map[string][]byte {
+	switch object := child.object.(type) {
+	case *corev1.ConfigMap:
+		data := make(map[string][]byte, len(object.Data))
+		for key, value := range object.Data {
+			data[key] = []byte(value)
+		}
+		return data
+	case *corev1.Secret:
+		return getSecretValues(object)
+	}
+	return nil
+}
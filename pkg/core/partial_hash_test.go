@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave partial hash policy Suite", func() {
+	var d *appsv1.Deployment
+	var s *corev1.Secret
+	var recorder *record.FakeRecorder
+
+	// handle reconciles the Deployment under the given policy and returns the
+	// resulting configuration hash
+	var handle = func(policy string) (string, error) {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d.DeepCopy(), s.DeepCopy(),
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h := NewHandler(c, recorder, Options{PartialHashPolicy: policy})
+		_, err := h.HandleDeployment(d.DeepCopy())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation], err
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		s = utils.ExampleSecret1.DeepCopy()
+		s.SetAnnotations(map[string]string{NormalizeAnnotation: stripCommentsNormalizer})
+		s.Data = map[string][]byte{"key1": []byte("example1:key1"), "blob": {'#', 0xff, 0xfe, '\n'}}
+		recorder = record.NewFakeRecorder(100)
+	})
+
+	It("aborts the hash under the fail policy", func() {
+		hash, err := handle(PartialHashPolicyFail)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("key blob of Secret example1"))
+		Expect(hash).To(BeEmpty())
+	})
+
+	It("hashes the raw value of the key when no policy is set", func() {
+		expected, err := handle(PartialHashPolicyRawFallback)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash, err := handle("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(expected))
+	})
+
+	It("excludes the key under the skip-key policy", func() {
+		hash, err := handle(PartialHashPolicySkipKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events()).To(ContainElement(ContainSubstring("Excluded key blob of Secret example1")))
+
+		delete(s.Data, "blob")
+		expected, err := handle(PartialHashPolicySkipKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(expected))
+	})
+
+	It("hashes the raw value of the key under the raw-fallback policy", func() {
+		hash, err := handle(PartialHashPolicyRawFallback)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).NotTo(BeEmpty())
+		Expect(events()).To(ContainElement(ContainSubstring("Hashed raw value of key blob of Secret example1")))
+
+		skipped, err := handle(PartialHashPolicySkipKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).NotTo(Equal(skipped))
+
+		s.Data["blob"] = []byte{'#', 0xff, 0xfd, '\n'}
+		Expect(handle(PartialHashPolicyRawFallback)).NotTo(Equal(hash))
+	})
+
+	It("rejects unknown policies", func() {
+		Expect(ValidatePartialHashPolicy(PartialHashPolicyFail)).To(Succeed())
+		Expect(ValidatePartialHashPolicy(PartialHashPolicySkipKey)).To(Succeed())
+		Expect(ValidatePartialHashPolicy(PartialHashPolicyRawFallback)).To(Succeed())
+		Expect(ValidatePartialHashPolicy("ignore")).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import "time"
+
+// pausedRequeue is how long to wait before checking again whether a paused
+// workload with a pending rollout has been resumed
+const pausedRequeue = 30 * time.Second
+
+// isPaused returns true if the podController is a Deployment whose rollouts
+// are paused
+func isPaused(obj podController) bool {
+	d, ok := obj.(*deployment)
+	return ok && d.Spec.Paused
+}
+
+// deferWhilePaused returns true if the rollout of the podController should be
+// deferred until it is resumed.
+// Nothing is written to a paused workload, so the new configuration hash is
+// applied, and the rollout triggered, once it has been resumed.
+func (h *Handler) deferWhilePaused(obj podController) bool {
+	return h.opts.SkipPaused && isPaused(obj)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave paused Deployments Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+
+	// reconcile reconciles the Deployment and fetches its updated state
+	var reconcile = func() {
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		if d.Spec.Paused && h.opts.SkipPaused {
+			Expect(result.RequeueAfter).To(Equal(pausedRequeue))
+		}
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Paused = true
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{SkipPaused: true})
+	})
+
+	It("does not write the hash while the Deployment is paused", func() {
+		reconcile()
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("writes the hash once the Deployment is resumed", func() {
+		reconcile()
+
+		d.Spec.Paused = false
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		reconcile()
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("does not update a previously written hash while the Deployment is paused", func() {
+		d.Spec.Paused = false
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		reconcile()
+		original := d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+		d.Spec.Paused = true
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+		reconcile()
+		Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).To(Equal(original))
+
+		d.Spec.Paused = false
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		reconcile()
+		Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(Equal(original))
+	})
+
+	It("writes the hash while the Deployment is paused if disabled", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		reconcile()
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+})
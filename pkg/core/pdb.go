@@ -0,0 +1,130 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// pdbBlockedRequeue is how long to wait before trying to roll out a workload
+// again after its rollout was deferred because of a PodDisruptionBudget
+const pdbBlockedRequeue = 30 * time.Second
+
+// rolloutsBlockedByPDBTotal counts the rollouts that were found to be blocked
+// by a PodDisruptionBudget allowing no disruptions
+var rolloutsBlockedByPDBTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "wave_rollouts_blocked_by_pdb_total",
+	Help: "Total number of rollouts blocked by a PodDisruptionBudget that allowed no disruptions",
+})
+
+func init() {
+	metrics.Registry.MustRegister(rolloutsBlockedByPDBTotal)
+}
+
+// getBlockingPodDisruptionBudget returns a PodDisruptionBudget selecting the
+// Pods of the podController that currently allows no disruptions, or nil if
+// there is no such PodDisruptionBudget
+func (h *Handler) getBlockingPodDisruptionBudget(obj podController) (*policyv1beta1.PodDisruptionBudget, error) {
+	pdbs := &policyv1beta1.PodDisruptionBudgetList{}
+	err := h.List(context.TODO(), pdbs, client.InNamespace(obj.GetNamespace()))
+	if err != nil {
+		return nil, fmt.Errorf("error listing PodDisruptionBudgets: %v", err)
+	}
+
+	podLabels := labels.Set(obj.GetPodTemplate().GetLabels())
+	for i := range pdbs.Items {
+		pdb := &pdbs.Items[i]
+		// A PodDisruptionBudget without a selector selects no Pods
+		if pdb.Spec.Selector == nil || len(pdb.Spec.Selector.MatchLabels)+len(pdb.Spec.Selector.MatchExpressions) == 0 {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(podLabels) && pdb.Status.PodDisruptionsAllowed <= 0 {
+			return pdb, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkPodDisruptionBudgets records a Warning event, and counts the rollout as
+// blocked, if a PodDisruptionBudget currently allows no disruptions of the
+// podController's Pods. It returns true if the rollout should be deferred.
+func (h *Handler) checkPodDisruptionBudgets(obj podController, hash string) (bool, error) {
+	if !h.opts.PDBAware {
+		return false, nil
+	}
+
+	// Updating a CronJob does not replace any running Pods
+	if _, ok := obj.(*cronjob); ok {
+		return false, nil
+	}
+
+	pdb, err := h.getBlockingPodDisruptionBudget(obj)
+	if err != nil {
+		return false, err
+	}
+	if pdb == nil {
+		h.clearBlockedByPDB(obj)
+		return false, nil
+	}
+
+	h.countBlockedByPDB(obj, hash)
+	if h.opts.PDBDefer {
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "RolloutBlockedByPDB", "Deferring rollout of configuration hash %s, PodDisruptionBudget %s allows no disruptions", hash, pdb.GetName())
+		return true, nil
+	}
+	h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "RolloutBlockedByPDB", "Rollout of configuration hash %s will be blocked, PodDisruptionBudget %s allows no disruptions", hash, pdb.GetName())
+	return false, nil
+}
+
+// countBlockedByPDB increments the blocked rollouts metric the first time the
+// rollout of the configuration hash is found to be blocked, so that a deferred
+// rollout that is checked again is only counted once
+func (h *Handler) countBlockedByPDB(obj podController, hash string) {
+	h.pdbMutex.Lock()
+	defer h.pdbMutex.Unlock()
+	if h.pdbBlocked == nil {
+		h.pdbBlocked = make(map[string]string)
+	}
+	key := missingChildKey(obj)
+	if h.pdbBlocked[key] == hash {
+		return
+	}
+	h.pdbBlocked[key] = hash
+	rolloutsBlockedByPDBTotal.Inc()
+}
+
+// clearBlockedByPDB forgets the rollout of the instance that was counted as
+// blocked, once no PodDisruptionBudget blocks it or Wave no longer manages it
+func (h *Handler) clearBlockedByPDB(obj podController) {
+	h.pdbMutex.Lock()
+	defer h.pdbMutex.Unlock()
+	delete(h.pdbBlocked, missingChildKey(obj))
+}
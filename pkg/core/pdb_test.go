@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// getBlockedByPDBTotal returns the current value of
+// wave_rollouts_blocked_by_pdb_total
+func getBlockedByPDBTotal() float64 {
+	m := &dto.Metric{}
+	Expect(rolloutsBlockedByPDBTotal.Write(m)).To(Succeed())
+	return m.GetCounter().GetValue()
+}
+
+var _ = Describe("Wave PodDisruptionBudget Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+	var pdb *policyv1beta1.PodDisruptionBudget
+	var recorder *record.FakeRecorder
+
+	// handle reconciles the Deployment with the given options and returns
+	// the resulting Deployment along with the requested requeue delay
+	var handle = func(opts Options) (*appsv1.Deployment, time.Duration) {
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, pdb,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h := NewHandler(c, recorder, opts)
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated, result.RequeueAfter
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		minAvailable := intstr.FromString("100%")
+		pdb = &policyv1beta1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example",
+				Namespace: d.GetNamespace(),
+			},
+			Spec: policyv1beta1.PodDisruptionBudgetSpec{
+				MinAvailable: &minAvailable,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: d.Spec.Template.GetLabels(),
+				},
+			},
+			Status: policyv1beta1.PodDisruptionBudgetStatus{
+				PodDisruptionsAllowed: 0,
+			},
+		}
+		recorder = record.NewFakeRecorder(100)
+	})
+
+	Context("With a PodDisruptionBudget allowing no disruptions", func() {
+		It("records a distinct blocked signal and rolls out", func() {
+			before := getBlockedByPDBTotal()
+			updated, _ := handle(Options{PDBAware: true})
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(events()).To(ContainElement(ContainSubstring("RolloutBlockedByPDB")))
+			Expect(getBlockedByPDBTotal()).To(Equal(before + 1))
+		})
+
+		It("defers the rollout when deferring is enabled", func() {
+			before := getBlockedByPDBTotal()
+			updated, requeueAfter := handle(Options{PDBAware: true, PDBDefer: true})
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(requeueAfter).To(Equal(pdbBlockedRequeue))
+			Expect(events()).To(ContainElement(ContainSubstring("RolloutBlockedByPDB")))
+			Expect(getBlockedByPDBTotal()).To(Equal(before + 1))
+		})
+
+		It("counts a deferred rollout once however often it is checked", func() {
+			before := getBlockedByPDBTotal()
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, pdb,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h := NewHandler(c, recorder, Options{PDBAware: true, PDBDefer: true})
+			for i := 0; i < 3; i++ {
+				_, err := h.HandleDeployment(d.DeepCopy())
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(getBlockedByPDBTotal()).To(Equal(before + 1))
+		})
+
+		It("does nothing when PodDisruptionBudget awareness is disabled", func() {
+			before := getBlockedByPDBTotal()
+			updated, _ := handle(Options{PDBDefer: true})
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(events()).NotTo(ContainElement(ContainSubstring("RolloutBlockedByPDB")))
+			Expect(getBlockedByPDBTotal()).To(Equal(before))
+		})
+	})
+
+	Context("With a PodDisruptionBudget allowing disruptions", func() {
+		BeforeEach(func() {
+			pdb.Status.PodDisruptionsAllowed = 1
+		})
+
+		It("rolls out without a blocked signal", func() {
+			before := getBlockedByPDBTotal()
+			updated, _ := handle(Options{PDBAware: true, PDBDefer: true})
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(events()).NotTo(ContainElement(ContainSubstring("RolloutBlockedByPDB")))
+			Expect(getBlockedByPDBTotal()).To(Equal(before))
+		})
+	})
+
+	Context("With a PodDisruptionBudget selecting other Pods", func() {
+		BeforeEach(func() {
+			pdb.Spec.Selector.MatchLabels = map[string]string{"app": "other"}
+		})
+
+		It("rolls out without a blocked signal", func() {
+			updated, _ := handle(Options{PDBAware: true, PDBDefer: true})
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(events()).NotTo(ContainElement(ContainSubstring("RolloutBlockedByPDB")))
+		})
+	})
+})
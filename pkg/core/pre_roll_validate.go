@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultPreRollValidateTimeout is the timeout of requests to pre-roll
+	// validation endpoints when none is configured
+	defaultPreRollValidateTimeout = 10 * time.Second
+
+	// preRollValidateRequeue is how long to wait before validating the
+	// configuration of a workload again after it was rejected
+	preRollValidateRequeue = time.Minute
+)
+
+// preRollValidationRequest is the body POSTed to a pre-roll validation
+// endpoint. Only the names and hashes of children are sent, never their data.
+type preRollValidationRequest struct {
+	Namespace string                   `json:"namespace"`
+	Name      string                   `json:"name"`
+	Kind      string                   `json:"kind"`
+	Hash      string                   `json:"hash"`
+	Children  []preRollValidationChild `json:"children"`
+}
+
+// preRollValidationChild identifies a child of the workload being validated
+type preRollValidationChild struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// validatePreRoll asks the pre-roll validation endpoint of the podController,
+// if it has one, whether the configuration may be rolled out and returns true
+// if it may. A rejection is recorded as a Warning event, as is an endpoint
+// that the Handler's allowlist does not allow, which is never called.
+//
+// If the endpoint cannot be reached or does not respond in time the
+// configuration is accepted when the Handler fails open, otherwise an error
+// is returned.
+func (h *Handler) validatePreRoll(obj podController, hash string, children []configObject) (bool, error) {
+	endpoint := obj.GetAnnotations()[PreRollValidateAnnotation]
+	if endpoint == "" {
+		return true, nil
+	}
+	if !h.isPreRollEndpointAllowed(endpoint) {
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "ConfigValidationFailed", "Pre-roll validation endpoint %s is not allowed by --pre-roll-validate-allowlist", endpoint)
+		return false, nil
+	}
+
+	status, err := h.callPreRollValidation(endpoint, obj, hash, children)
+	if err != nil {
+		if h.opts.PreRollValidateFailOpen {
+			h.log.Error(err, "Pre-roll validation failed, rolling out anyway", "kind", kindOf(obj), "namespace", obj.GetNamespace(), "name", obj.GetName(), "endpoint", endpoint)
+			return true, nil
+		}
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "ConfigValidationFailed", "Unable to validate configuration hash %s: %v", hash, err)
+		return false, err
+	}
+	if status != http.StatusOK {
+		h.recorder.Eventf(obj.GetObject(), corev1.EventTypeWarning, "ConfigRejected", "Configuration hash %s rejected by %s with status %d", hash, endpoint, status)
+		return false, nil
+	}
+	return true, nil
+}
+
+// isPreRollEndpointAllowed returns true if the endpoint is an http or https URL
+// whose host, or the URL itself, is allowed by an entry of the Handler's
+// pre-roll validation allowlist. Entries including a scheme are URL prefixes,
+// any other entry must match the host, and port if any, of the URL exactly.
+func (h *Handler) isPreRollEndpointAllowed(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	for _, allowed := range h.opts.PreRollAllowlist {
+		if !strings.Contains(allowed, "://") {
+			if strings.EqualFold(u.Host, allowed) {
+				return true
+			}
+			continue
+		}
+		prefix, err := url.Parse(allowed)
+		if err != nil || prefix.User != nil {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, prefix.Scheme) && strings.EqualFold(u.Host, prefix.Host) && hasPathPrefix(u.Path, prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix returns true if the path is the prefix itself or lies below
+// it, only matching the prefix on a "/" boundary
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// callPreRollValidation POSTs the workload's children and hashes to the
+// endpoint and returns the status code of the response
+func (h *Handler) callPreRollValidation(endpoint string, obj podController, hash string, children []configObject) (int, error) {
+	body := preRollValidationRequest{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Kind:      kindOf(obj),
+		Hash:      hash,
+		Children:  []preRollValidationChild{},
+	}
+	for _, child := range children {
+		if child.object == nil {
+			continue
+		}
+		childHash, err := calculateLeafHash(child)
+		if err != nil {
+			return 0, fmt.Errorf("error calculating hash of %s %s: %v", kindOf(child.object), child.object.GetName(), err)
+		}
+		body.Children = append(body.Children, preRollValidationChild{
+			Kind: kindOf(child.object),
+			Name: child.object.GetName(),
+			Hash: childHash,
+		})
+	}
+	sort.Slice(body.Children, func(i, j int) bool {
+		if body.Children[i].Kind != body.Children[j].Kind {
+			return body.Children[i].Kind < body.Children[j].Kind
+		}
+		return body.Children[i].Name < body.Children[j].Name
+	})
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("unable to marshal JSON: %v", err)
+	}
+
+	timeout := h.opts.PreRollValidateTimeout
+	if timeout <= 0 {
+		timeout = defaultPreRollValidateTimeout
+	}
+	// Redirects are never followed, so that an allowed endpoint cannot send
+	// the request on to a URL that is not allowed
+	httpClient := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := httpClient.Post(endpoint, "application/json", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return 0, fmt.Errorf("error calling %s: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
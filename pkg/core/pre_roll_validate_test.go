@@ -0,0 +1,258 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave pre-roll validation Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+	var recorder *record.FakeRecorder
+	var server *httptest.Server
+	var status int
+	var requests [][]byte
+	var allowlist []string
+
+	// handle reconciles the Deployment with the given options, allowing the
+	// endpoints of the allowlist, and returns the resulting Deployment along
+	// with the requested requeue delay
+	var handle = func(opts Options) (*appsv1.Deployment, time.Duration, error) {
+		opts.PreRollAllowlist = allowlist
+		h := NewHandler(c, recorder, opts)
+		result, err := h.HandleDeployment(d)
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated, result.RequeueAfter, err
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		requests = [][]byte{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			requests = append(requests, body)
+			w.WriteHeader(status)
+		}))
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		allowlist = []string{u.Host}
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			PreRollValidateAnnotation: server.URL,
+		})
+		recorder = record.NewFakeRecorder(100)
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("When the endpoint accepts the configuration", func() {
+		It("rolls out the configuration", func() {
+			updated, _, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+
+		It("sends the names and hashes of the children but not their data", func() {
+			updated, _, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(HaveLen(1))
+
+			request := preRollValidationRequest{}
+			Expect(json.Unmarshal(requests[0], &request)).To(Succeed())
+			Expect(request.Name).To(Equal(d.GetName()))
+			Expect(request.Kind).To(Equal("Deployment"))
+			Expect(request.Hash).To(Equal(updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+			Expect(request.Children).To(ContainElement(WithTransform(func(child preRollValidationChild) string {
+				return child.Kind + "/" + child.Name
+			}, Equal("Secret/"+utils.ExampleSecret1.GetName()))))
+			for _, value := range utils.ExampleSecret1.Data {
+				Expect(string(requests[0])).NotTo(ContainSubstring(string(value)))
+			}
+		})
+
+		It("does not call the endpoint when the configuration is unchanged", func() {
+			_, _, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, d)).To(Succeed())
+			_, _, err = handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(HaveLen(1))
+		})
+	})
+
+	Context("When the endpoint rejects the configuration", func() {
+		BeforeEach(func() {
+			status = http.StatusUnprocessableEntity
+		})
+
+		It("defers the rollout and records a Warning event", func() {
+			updated, requeueAfter, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(preRollValidateRequeue))
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(events()).To(ContainElement(ContainSubstring("ConfigRejected")))
+		})
+	})
+
+	Context("When the endpoint cannot be reached", func() {
+		BeforeEach(func() {
+			server.Close()
+		})
+
+		It("defers the rollout with an error when failing closed", func() {
+			updated, _, err := handle(Options{})
+			Expect(err).To(HaveOccurred())
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(events()).To(ContainElement(ContainSubstring("ConfigValidationFailed")))
+		})
+
+		It("rolls out the configuration when failing open", func() {
+			updated, _, err := handle(Options{PreRollValidateFailOpen: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+	})
+
+	Context("When the endpoint redirects the request", func() {
+		var target *httptest.Server
+		var redirected int
+
+		BeforeEach(func() {
+			redirected = 0
+			target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				redirected++
+				w.WriteHeader(http.StatusOK)
+			}))
+			status = http.StatusTemporaryRedirect
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, target.URL, status)
+			})
+		})
+
+		AfterEach(func() {
+			target.Close()
+		})
+
+		It("does not follow the redirect and rejects the configuration", func() {
+			updated, requeueAfter, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(preRollValidateRequeue))
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(redirected).To(BeZero())
+			Expect(events()).To(ContainElement(ContainSubstring("rejected by " + server.URL + " with status 307")))
+		})
+	})
+
+	Context("When the endpoint is not allowed", func() {
+		BeforeEach(func() {
+			allowlist = []string{"validator.example.com"}
+		})
+
+		It("defers the rollout without calling the endpoint", func() {
+			updated, requeueAfter, err := handle(Options{PreRollValidateFailOpen: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(preRollValidateRequeue))
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(requests).To(BeEmpty())
+			Expect(events()).To(ContainElement(ContainSubstring("is not allowed by --pre-roll-validate-allowlist")))
+		})
+
+		It("defers the rollout when no endpoint is allowed", func() {
+			allowlist = nil
+			updated, _, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(requests).To(BeEmpty())
+		})
+
+		It("rolls out the configuration when the endpoint matches a URL prefix", func() {
+			allowlist = []string{server.URL}
+			updated, _, err := handle(Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(requests).To(HaveLen(1))
+		})
+	})
+
+	Context("isPreRollEndpointAllowed", func() {
+		It("only allows the endpoints of the allowlist", func() {
+			h := NewHandler(c, recorder, Options{PreRollAllowlist: []string{"validator.example.com", "https://hooks.example.com/wave/", "https://checks.example.com/wave", "https://linter.example.com"}})
+			allowed := []string{
+				"https://validator.example.com/validate",
+				"http://VALIDATOR.example.com/validate",
+				"https://hooks.example.com/wave/validate",
+				"https://checks.example.com/wave",
+				"https://checks.example.com/wave/validate",
+				"https://linter.example.com/validate",
+			}
+			for _, endpoint := range allowed {
+				Expect(h.isPreRollEndpointAllowed(endpoint)).To(BeTrue(), endpoint)
+			}
+			rejected := []string{
+				"https://validator.example.com.evil.com/validate",
+				"https://validator.example.com:8443/validate",
+				"https://user@validator.example.com/validate",
+				"ftp://validator.example.com/validate",
+				"validator.example.com/validate",
+				"https://hooks.example.com/other/validate",
+				"http://hooks.example.com/wave/validate",
+				"https://checks.example.com/waveform",
+				"https://linter.example.com.evil.com/validate",
+				"https://linter.example.com@evil.com/validate",
+				"http://169.254.169.254/latest/meta-data",
+			}
+			for _, endpoint := range rejected {
+				Expect(h.isPreRollEndpointAllowed(endpoint)).To(BeFalse(), endpoint)
+			}
+		})
+	})
+})
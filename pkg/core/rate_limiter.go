@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+const (
+	// defaultRateLimiterBaseDelay is the base delay of the controller-runtime
+	// rate limiter, used when only the max delay is configured
+	defaultRateLimiterBaseDelay = 5 * time.Millisecond
+
+	// defaultRateLimiterMaxDelay is the max delay of the controller-runtime
+	// rate limiter, used when only the base delay is configured
+	defaultRateLimiterMaxDelay = 1000 * time.Second
+)
+
+// ValidateRateLimiter checks that the base delay of the rate limiter
+// configured by the options does not exceed its max delay
+func ValidateRateLimiter(opts Options) error {
+	if !opts.usesRateLimiter() {
+		return nil
+	}
+	base, max := opts.rateLimiterDelays()
+	if base > max {
+		return fmt.Errorf("rate limiter base delay %s exceeds max delay %s", base, max)
+	}
+	return nil
+}
+
+// usesRateLimiter returns true if the options configure the rate limiter of
+// the controllers
+func (o Options) usesRateLimiter() bool {
+	return o.RateLimiterBaseDelay > 0 || o.RateLimiterMaxDelay > 0
+}
+
+// rateLimiterDelays returns the configured base and max delays of the rate
+// limiter, defaulting those that are not set to the controller-runtime values
+func (o Options) rateLimiterDelays() (time.Duration, time.Duration) {
+	base, max := o.RateLimiterBaseDelay, o.RateLimiterMaxDelay
+	if base <= 0 {
+		base = defaultRateLimiterBaseDelay
+	}
+	if max <= 0 {
+		max = defaultRateLimiterMaxDelay
+	}
+	return base, max
+}
+
+// ApplyRateLimiter configures the controller to requeue requests whose
+// reconciliation failed with the backoff configured by the options, and to
+// jitter every delayed request by the configured RequeueJitter. The
+// controller is left unchanged if neither is configured.
+// It must be called before the controller watches any sources.
+//
+// The controller-runtime version in use creates the work queue of each
+// controller itself, so the queue is wrapped in place, keeping its metrics.
+// An error is returned if the controller no longer exposes its queue.
+func ApplyRateLimiter(c controller.Controller, opts Options) error {
+	if !opts.usesRateLimiter() && opts.RequeueJitter <= 0 {
+		return nil
+	}
+
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unable to configure rate limiter of controller %T", c)
+	}
+	field := v.Elem().FieldByName("Queue")
+	if !field.IsValid() || !field.CanSet() || field.Type() != reflect.TypeOf((*workqueue.RateLimitingInterface)(nil)).Elem() {
+		return fmt.Errorf("unable to configure rate limiter of controller %T: no work queue", c)
+	}
+	queue, ok := field.Interface().(workqueue.RateLimitingInterface)
+	if !ok || queue == nil {
+		return fmt.Errorf("unable to configure rate limiter of controller %T: no work queue", c)
+	}
+
+	// The queue's own backoff bypasses the jitter, so failed requests are
+	// always requeued through a rate limiter wrapping the jittered queue,
+	// which is the controller-runtime default unless a backoff is configured
+	limiter := workqueue.DefaultControllerRateLimiter()
+	if opts.usesRateLimiter() {
+		limiter = workqueue.NewItemExponentialFailureRateLimiter(opts.rateLimiterDelays())
+	}
+	if opts.RequeueJitter > 0 {
+		queue = &jitteredQueue{RateLimitingInterface: queue, jitter: opts.RequeueJitter}
+	}
+	var wrapped workqueue.RateLimitingInterface = &rateLimitedQueue{
+		RateLimitingInterface: queue,
+		limiter:               limiter,
+	}
+	field.Set(reflect.ValueOf(&wrapped).Elem())
+	return nil
+}
+
+// jitteredQueue wraps a work queue, extending the delay of each delayed
+// request by a random fraction of up to jitter, so that requests delayed
+// together are spread out
+type jitteredQueue struct {
+	workqueue.RateLimitingInterface
+	jitter float64
+}
+
+// AddAfter adds the item to the queue once the jittered delay has elapsed
+func (q *jitteredQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration > 0 {
+		duration = wait.Jitter(duration, q.jitter)
+	}
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+// rateLimitedQueue wraps a work queue, requeueing failed requests with its
+// own rate limiter in place of the one the queue was created with
+type rateLimitedQueue struct {
+	workqueue.RateLimitingInterface
+	limiter workqueue.RateLimiter
+}
+
+// AddRateLimited adds the item to the queue once the rate limiter allows it
+func (q *rateLimitedQueue) AddRateLimited(item interface{}) {
+	q.RateLimitingInterface.AddAfter(item, q.limiter.When(item))
+}
+
+// Forget resets the backoff of the item
+func (q *rateLimitedQueue) Forget(item interface{}) {
+	q.limiter.Forget(item)
+	q.RateLimitingInterface.Forget(item)
+}
+
+// NumRequeues returns the number of times the item has been requeued since
+// it was last forgotten
+func (q *rateLimitedQueue) NumRequeues(item interface{}) int {
+	return q.limiter.NumRequeues(item)
+}
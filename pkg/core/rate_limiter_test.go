@@ -0,0 +1,262 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// updateErroringClient returns the configured error, if set, from every
+// Update of a Deployment
+type updateErroringClient struct {
+	client.Client
+	err error
+}
+
+func (c *updateErroringClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	if _, ok := obj.(*appsv1.Deployment); ok && c.err != nil {
+		return c.err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// delayRecordingQueue records the delays with which items are added
+type delayRecordingQueue struct {
+	workqueue.RateLimitingInterface
+	delays []time.Duration
+}
+
+func (q *delayRecordingQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.delays = append(q.delays, duration)
+}
+
+// queuelessController is a controller that does not expose a work queue
+type queuelessController struct{}
+
+func (c *queuelessController) Reconcile(reconcile.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func (c *queuelessController) Watch(source.Source, handler.EventHandler, ...predicate.Predicate) error {
+	return nil
+}
+
+func (c *queuelessController) Start(<-chan struct{}) error {
+	return nil
+}
+
+var _ = Describe("Wave rate limiter Suite", func() {
+	// newController returns a controller created by controller-runtime with
+	// a manager that never contacts an API server
+	var newController = func() controller.Controller {
+		mgr, err := manager.New(&rest.Config{Host: "http://127.0.0.1:1"}, manager.Options{
+			MapperProvider: func(*rest.Config) (meta.RESTMapper, error) {
+				return meta.NewDefaultRESTMapper(nil), nil
+			},
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		c, err := controller.New("rate-limiter-test", mgr, controller.Options{Reconciler: &queuelessController{}})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	// getQueue returns the work queue of the controller
+	var getQueue = func(c controller.Controller) workqueue.RateLimitingInterface {
+		return reflect.ValueOf(c).Elem().FieldByName("Queue").Interface().(workqueue.RateLimitingInterface)
+	}
+
+	Context("ApplyRateLimiter", func() {
+		It("requeues failed requests with the configured backoff", func() {
+			c := newController()
+			Expect(ApplyRateLimiter(c, Options{RateLimiterBaseDelay: time.Hour, RateLimiterMaxDelay: 2 * time.Hour})).To(Succeed())
+
+			queue := getQueue(c)
+			Expect(queue).To(BeAssignableToTypeOf(&rateLimitedQueue{}))
+			limiter := queue.(*rateLimitedQueue).limiter
+			request := reconcile.Request{}
+			Expect(limiter.When(request)).To(Equal(time.Hour))
+			Expect(limiter.When(request)).To(Equal(2 * time.Hour))
+			Expect(limiter.When(request)).To(Equal(2 * time.Hour))
+
+			// The default backoff would requeue the request within milliseconds
+			queue.Forget(request)
+			queue.AddRateLimited(request)
+			Consistently(queue.Len, 100*time.Millisecond).Should(Equal(0))
+			Expect(queue.NumRequeues(request)).To(Equal(1))
+
+			queue.Forget(request)
+			Expect(queue.NumRequeues(request)).To(Equal(0))
+			queue.ShutDown()
+		})
+
+		It("defaults the delay that is not configured", func() {
+			c := newController()
+			Expect(ApplyRateLimiter(c, Options{RateLimiterMaxDelay: time.Second})).To(Succeed())
+
+			limiter := getQueue(c).(*rateLimitedQueue).limiter
+			Expect(limiter.When(reconcile.Request{})).To(Equal(defaultRateLimiterBaseDelay))
+			getQueue(c).ShutDown()
+		})
+
+		It("leaves the controller unchanged when no backoff is configured", func() {
+			c := newController()
+			queue := getQueue(c)
+			Expect(ApplyRateLimiter(c, Options{})).To(Succeed())
+			Expect(getQueue(c)).To(BeIdenticalTo(queue))
+			queue.ShutDown()
+		})
+
+		It("jitters delayed requests when only jitter is configured", func() {
+			c := newController()
+			queue := getQueue(c)
+			Expect(ApplyRateLimiter(c, Options{RequeueJitter: 0.5})).To(Succeed())
+
+			wrapped := getQueue(c)
+			Expect(wrapped).To(BeAssignableToTypeOf(&rateLimitedQueue{}))
+			jittered := wrapped.(*rateLimitedQueue).RateLimitingInterface
+			Expect(jittered).To(BeAssignableToTypeOf(&jitteredQueue{}))
+			Expect(jittered.(*jitteredQueue).RateLimitingInterface).To(BeIdenticalTo(queue))
+			Expect(jittered.(*jitteredQueue).jitter).To(Equal(0.5))
+			queue.ShutDown()
+		})
+
+		It("returns an error for controllers without a work queue", func() {
+			Expect(ApplyRateLimiter(&queuelessController{}, Options{RateLimiterBaseDelay: time.Second})).NotTo(Succeed())
+		})
+	})
+
+	Context("jitteredQueue", func() {
+		var recorder *delayRecordingQueue
+		var queue *jitteredQueue
+
+		BeforeEach(func() {
+			recorder = &delayRecordingQueue{}
+			queue = &jitteredQueue{RateLimitingInterface: recorder, jitter: 0.2}
+		})
+
+		It("extends delays by up to the jitter", func() {
+			for i := 0; i < 100; i++ {
+				queue.AddAfter(reconcile.Request{}, 10*time.Second)
+			}
+			Expect(recorder.delays).To(HaveLen(100))
+			for _, d := range recorder.delays {
+				Expect(d).To(BeNumerically(">=", 10*time.Second))
+				Expect(d).To(BeNumerically("<=", 12*time.Second))
+			}
+			Expect(recorder.delays).To(ContainElement(Not(Equal(recorder.delays[0]))))
+		})
+
+		It("does not delay requests added immediately", func() {
+			queue.AddAfter(reconcile.Request{}, 0)
+			Expect(recorder.delays).To(Equal([]time.Duration{0}))
+		})
+
+		It("jitters the backoff of failed requests", func() {
+			limited := &rateLimitedQueue{
+				RateLimitingInterface: queue,
+				limiter:               workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Second),
+			}
+			for i := 0; i < 20; i++ {
+				limited.AddRateLimited(reconcile.Request{})
+			}
+			for _, d := range recorder.delays {
+				Expect(d).To(BeNumerically(">=", time.Second))
+				Expect(d).To(BeNumerically("<=", 1200*time.Millisecond))
+			}
+		})
+	})
+
+	Context("ValidateRateLimiter", func() {
+		It("accepts a base delay up to the max delay", func() {
+			Expect(ValidateRateLimiter(Options{})).To(Succeed())
+			Expect(ValidateRateLimiter(Options{RateLimiterBaseDelay: time.Second, RateLimiterMaxDelay: time.Second})).To(Succeed())
+			Expect(ValidateRateLimiter(Options{RateLimiterBaseDelay: time.Minute})).To(Succeed())
+		})
+
+		It("rejects a base delay exceeding the max delay", func() {
+			Expect(ValidateRateLimiter(Options{RateLimiterBaseDelay: time.Minute, RateLimiterMaxDelay: time.Second})).NotTo(Succeed())
+			Expect(ValidateRateLimiter(Options{RateLimiterMaxDelay: time.Millisecond})).NotTo(Succeed())
+		})
+	})
+
+	Context("When updating the instance fails", func() {
+		var d *appsv1.Deployment
+		var c *updateErroringClient
+		var h *Handler
+
+		BeforeEach(func() {
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+			c = &updateErroringClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)}
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		})
+
+		It("returns transient errors so that the instance is requeued", func() {
+			c.err = errors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, d.GetName(), nil)
+			_, err := h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+
+			c.err = errors.NewServiceUnavailable("unavailable")
+			_, err = h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("does not requeue an instance deleted while updating it", func() {
+			c.err = errors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments"}, d.GetName())
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+		})
+
+		It("does not requeue an update rejected as invalid", func() {
+			c.err = errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, d.GetName(), field.ErrorList{})
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcileResult is the result of reconciling a podController along with
+// the reason for its outcome
+type reconcileResult struct {
+	reconcile.Result
+
+	// reason is one of the Reason constants. The reason for a failed
+	// reconcile is taken from its error instead.
+	reason string
+}
+
+// withReason returns a function wrapping the result of a reconcile with the
+// given reason
+func withReason(reason string) func(reconcile.Result, error) (reconcileResult, error) {
+	return func(result reconcile.Result, err error) (reconcileResult, error) {
+		return reconcileResult{Result: result, reason: reason}, err
+	}
+}
+
+// getReconcileReason returns the reason for the outcome of a reconcile,
+// which is ReasonMissingChild or ReasonError if it failed
+func getReconcileReason(result reconcileResult, err error) string {
+	if err == nil {
+		return result.reason
+	}
+	if _, ok := err.(*missingChildError); ok {
+		return ReasonMissingChild
+	}
+	return ReasonError
+}
+
+// recordReconcileReason counts the reconcile of the podController in
+// wave_reconcile_results_total by the reason for its outcome, and logs it
+func (h *Handler) recordReconcileReason(instance podController, result reconcileResult, err error) {
+	reason := getReconcileReason(result, err)
+	reconcileResultsTotal.WithLabelValues(reason).Inc()
+	h.log.V(1).Info("Reconciled instance", "kind", kindOf(instance), "namespace", instance.GetNamespace(), "name", instance.GetName(), "reason", reason)
+}
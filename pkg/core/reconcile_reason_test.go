@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// getReconcileResultsTotal returns the value of wave_reconcile_results_total
+// for the given reason
+func getReconcileResultsTotal(reason string) float64 {
+	family, ok := scrapeMetrics()["wave_reconcile_results_total"]
+	if !ok {
+		return 0
+	}
+	for _, m := range family.GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "reason" && label.GetValue() == reason {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+var _ = Describe("Wave reconcile reason Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+
+	// handle reconciles the current state of the Deployment, checks that the
+	// reconcile was counted with the given reason and returns the reason
+	// recorded on the Deployment
+	var handle = func(reason string) string {
+		before := getReconcileResultsTotal(reason)
+		current := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, current)).To(Succeed())
+		_, _ = h.HandleDeployment(current)
+		Expect(getReconcileResultsTotal(reason)).To(Equal(before + 1))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+		return updated.GetAnnotations()[StatusReasonAnnotation]
+	}
+
+	// modifyConfigMap changes the data of a child of the Deployment
+	var modifyConfigMap = func() {
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: utils.ExampleConfigMap1.GetNamespace(), Name: utils.ExampleConfigMap1.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	Context("getReconcileReason", func() {
+		It("returns the reason of a successful reconcile", func() {
+			Expect(getReconcileReason(reconcileResult{reason: ReasonNoChange}, nil)).To(Equal(ReasonNoChange))
+		})
+
+		It("returns MissingChild for a missing child error", func() {
+			err := &missingChildError{err: errors.New("missing"), missing: []string{"ConfigMap/example1"}}
+			Expect(getReconcileReason(reconcileResult{}, err)).To(Equal(ReasonMissingChild))
+		})
+
+		It("returns Error for any other error", func() {
+			Expect(getReconcileReason(reconcileResult{reason: ReasonNoChange}, errors.New("failed"))).To(Equal(ReasonError))
+		})
+	})
+
+	It("reports RolloutTriggered when the hash is first written", func() {
+		Expect(handle(ReasonRolloutTriggered)).To(Equal(ReasonRolloutTriggered))
+	})
+
+	It("reports NoChange for a no-op reconcile without updating the Deployment", func() {
+		handle(ReasonRolloutTriggered)
+		before := d.DeepCopy()
+
+		// The reason is only recorded alongside other updates
+		Expect(handle(ReasonNoChange)).To(Equal(ReasonRolloutTriggered))
+		Expect(d).To(Equal(before))
+	})
+
+	It("reports RolloutTriggered when the configuration changes", func() {
+		handle(ReasonRolloutTriggered)
+		handle(ReasonNoChange)
+		modifyConfigMap()
+
+		Expect(handle(ReasonRolloutTriggered)).To(Equal(ReasonRolloutTriggered))
+	})
+
+	It("records NoChange when only the metadata is updated", func() {
+		d.GetAnnotations()[TrackOnlyAnnotation] = "true"
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		Expect(handle(ReasonNoChange)).To(Equal(ReasonNoChange))
+	})
+
+	It("reports MissingChild when a required child is missing", func() {
+		handle(ReasonRolloutTriggered)
+		Expect(c.Delete(context.TODO(), utils.ExampleConfigMap2.DeepCopy())).To(Succeed())
+
+		Expect(handle(ReasonMissingChild)).To(Equal(ReasonMissingChild))
+	})
+
+	It("reports RolloutDeferred while the rollout is deferred", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{SkipPaused: true})
+		handle(ReasonRolloutTriggered)
+		d.Spec.Paused = true
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		modifyConfigMap()
+
+		Expect(handle(ReasonRolloutDeferred)).To(Equal(ReasonRolloutDeferred))
+	})
+
+	It("reports Skipped and removes the reason when the Deployment opts out", func() {
+		handle(ReasonRolloutTriggered)
+		d.SetAnnotations(map[string]string{})
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		Expect(handle(ReasonSkipped)).To(BeEmpty())
+	})
+
+	It("reports Skipped for a Deployment Wave is not enabled for", func() {
+		d.SetAnnotations(map[string]string{})
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		Expect(handle(ReasonSkipped)).To(BeEmpty())
+	})
+
+	It("reports DryRun without recording a reason in dry-run mode", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{DryRun: true})
+
+		Expect(handle(ReasonDryRun)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// withReconcileTimeout calls reconcile with a copy of the Handler whose
+// requests are cancelled once the reconcile timeout has elapsed, returning an
+// error so that the instance is requeued if the timeout was exceeded.
+// The Handler is passed unchanged if no timeout is configured.
+func (h *Handler) withReconcileTimeout(reconcile func(*Handler) (reconcile.Result, error)) (reconcile.Result, error) {
+	if h.opts.ReconcileTimeout <= 0 {
+		return reconcile(h)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.ReconcileTimeout)
+	defer cancel()
+
+	scoped := *h
+	scoped.Client = &contextClient{Client: h.Client, ctx: ctx}
+	result, err := reconcile(&scoped)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return result, fmt.Errorf("reconcile timed out after %v: %v", h.opts.ReconcileTimeout, err)
+	}
+	return result, err
+}
+
+// contextClient wraps a client.Client and makes every request with its
+// context in place of the one given, which the Handler always leaves as
+// context.TODO(), so that the requests of a reconcile share its deadline
+type contextClient struct {
+	client.Client
+	ctx context.Context
+}
+
+// Get wraps client.Client.Get
+func (c *contextClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return c.Client.Get(c.ctx, key, obj)
+}
+
+// List wraps client.Client.List
+func (c *contextClient) List(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return c.Client.List(c.ctx, list, opts...)
+}
+
+// Create wraps client.Client.Create
+func (c *contextClient) Create(_ context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return c.Client.Create(c.ctx, obj, opts...)
+}
+
+// Update wraps client.Client.Update
+func (c *contextClient) Update(_ context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.Client.Update(c.ctx, obj, opts...)
+}
+
+// Patch wraps client.Client.Patch
+func (c *contextClient) Patch(_ context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.Client.Patch(c.ctx, obj, patch, opts...)
+}
+
+// Delete wraps client.Client.Delete
+func (c *contextClient) Delete(_ context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return c.Client.Delete(c.ctx, obj, opts...)
+}
+
+// DeleteAllOf wraps client.Client.DeleteAllOf
+func (c *contextClient) DeleteAllOf(_ context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	return c.Client.DeleteAllOf(c.ctx, obj, opts...)
+}
+
+// Status wraps client.Client.Status
+func (c *contextClient) Status() client.StatusWriter {
+	return &contextStatusWriter{StatusWriter: c.Client.Status(), ctx: c.ctx}
+}
+
+// contextStatusWriter wraps a client.StatusWriter and makes every request
+// with its context in place of the one given
+type contextStatusWriter struct {
+	client.StatusWriter
+	ctx context.Context
+}
+
+// Update wraps client.StatusWriter.Update
+func (w *contextStatusWriter) Update(_ context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return w.StatusWriter.Update(w.ctx, obj, opts...)
+}
+
+// Patch wraps client.StatusWriter.Patch
+func (w *contextStatusWriter) Patch(_ context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.StatusWriter.Patch(w.ctx, obj, patch, opts...)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// slowClient delays every Get of a ConfigMap, while block is set, until
+// the context of the request is done and records the error of the context
+type slowClient struct {
+	client.Client
+	block     bool
+	cancelled chan error
+}
+
+func (c *slowClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok && c.block {
+		select {
+		case <-ctx.Done():
+			c.cancelled <- ctx.Err()
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+var _ = Describe("Wave reconcile timeout Suite", func() {
+	var c *slowClient
+	var h *Handler
+	var d *appsv1.Deployment
+
+	// getDeployment returns the current state of the Deployment
+	var getDeployment = func() *appsv1.Deployment {
+		fetched := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+		return fetched
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = &slowClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			),
+			cancelled: make(chan error, 10),
+		}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{ReconcileTimeout: 100 * time.Millisecond})
+	})
+
+	It("returns a timeout error once a request blocks for longer than the timeout", func() {
+		c.block = true
+		start := time.Now()
+		_, err := h.HandleDeployment(d)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("reconcile timed out after 100ms"))
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("cancels the requests in flight", func() {
+		c.block = true
+		_, err := h.HandleDeployment(d)
+		Expect(err).To(HaveOccurred())
+		Expect(c.cancelled).To(Receive(Equal(context.DeadlineExceeded)))
+	})
+
+	It("records the timeout on the status of the Deployment", func() {
+		c.block = true
+		_, err := h.HandleDeployment(d)
+		Expect(err).To(HaveOccurred())
+
+		updated := getDeployment()
+		Expect(updated.GetAnnotations()).To(HaveKeyWithValue(StatusAnnotation, StatusError))
+		Expect(updated.GetAnnotations()[StatusMessageAnnotation]).To(ContainSubstring("reconcile timed out"))
+	})
+
+	It("completes reconciles within the timeout", func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getDeployment().Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("does not bound reconciles when no timeout is configured", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		Expect(h.withReconcileTimeout(func(scoped *Handler) (reconcile.Result, error) {
+			Expect(scoped).To(BeIdenticalTo(h))
+			return reconcile.Result{}, nil
+		})).To(Equal(reconcile.Result{}))
+	})
+})
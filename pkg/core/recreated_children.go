@@ -0,0 +1,133 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// NewRecreatedChildHandler returns an EventHandler for ConfigMaps and Secrets
+// that, when a child is created, enqueues every workload of the given list
+// type that references the child by name but is not yet one of its owners.
+//
+// When a child is deleted and recreated with the same name, the OwnerReferences
+// on the old child are lost, so no owner based watch fires for the new child.
+// This handler closes that window by enqueueing the referencing workloads
+// straight away, so that their OwnerReferences and hashes are updated.
+//
+// Workloads are enabled as described by isEnabled with the given selector and
+// default.
+func NewRecreatedChildHandler(c client.Reader, list runtime.Object, selector labels.Selector, defaultEnabled bool) handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+			for _, req := range getRecreatedChildRequests(c, list.DeepCopyObject(), selector, defaultEnabled, evt.Object, evt.Meta) {
+				q.Add(req)
+			}
+		},
+	}
+}
+
+// getRecreatedChildRequests lists the workloads in the child's namespace and
+// returns a request for each that references the child without owning it
+func getRecreatedChildRequests(c client.Reader, list runtime.Object, selector labels.Selector, defaultEnabled bool, obj runtime.Object, child metav1.Object) []reconcile.Request {
+	if child == nil {
+		return nil
+	}
+
+	err := c.List(context.TODO(), list, client.InNamespace(child.GetNamespace()))
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "error listing workloads for created child", "namespace", child.GetNamespace(), "name", child.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, instance := range podControllersFromList(list) {
+		if !isEnabled(instance, selector, defaultEnabled) || toBeDeleted(instance) || isOwnedBy(child, instance) {
+			continue
+		}
+		if referencesChild(instance, obj, child.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()},
+			})
+		}
+	}
+	return requests
+}
+
+// referencesChild returns true if the PodTemplate of the podController
+// references a ConfigMap or Secret of the given object's type and name
+func referencesChild(instance podController, obj runtime.Object, name string) bool {
+	configMaps, secrets := getChildNamesByType(instance)
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		_, ok := configMaps[name]
+		return ok
+	case *corev1.Secret:
+		_, ok := secrets[name]
+		return ok
+	default:
+		return false
+	}
+}
+
+// podControllersFromList wraps each item of a list of workloads in a
+// podController
+func podControllersFromList(list runtime.Object) []podController {
+	instances := []podController{}
+	switch l := list.(type) {
+	case *appsv1.DeploymentList:
+		for i := range l.Items {
+			instances = append(instances, &deployment{&l.Items[i]})
+		}
+	case *appsv1.StatefulSetList:
+		for i := range l.Items {
+			instances = append(instances, &statefulset{&l.Items[i]})
+		}
+	case *appsv1.DaemonSetList:
+		for i := range l.Items {
+			instances = append(instances, &daemonset{&l.Items[i]})
+		}
+	case *appsv1.ReplicaSetList:
+		for i := range l.Items {
+			instances = append(instances, &replicaset{&l.Items[i]})
+		}
+	case *batchv1beta1.CronJobList:
+		for i := range l.Items {
+			instances = append(instances, &cronjob{&l.Items[i]})
+		}
+	case *unstructured.UnstructuredList:
+		for i := range l.Items {
+			instances = append(instances, &unstructuredPodController{&l.Items[i]})
+		}
+	}
+	return instances
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave recreated children Suite", func() {
+	var c client.Client
+	var d *appsv1.Deployment
+	var cm2 *corev1.ConfigMap
+	var s2 *corev1.Secret
+
+	var request reconcile.Request
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID("deployment-uid")
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: d.GetNamespace(), Name: d.GetName()}}
+
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+	})
+
+	JustBeforeEach(func() {
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d)
+	})
+
+	Context("getRecreatedChildRequests", func() {
+		It("returns a request for a workload referencing a new ConfigMap", func() {
+			Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, cm2, cm2)).To(ConsistOf(request))
+		})
+
+		It("returns a request for a workload referencing a new Secret", func() {
+			Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, s2, s2)).To(ConsistOf(request))
+		})
+
+		It("does not return a request when the child is already owned by the workload", func() {
+			cm2.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(&deployment{d})})
+			Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, cm2, cm2)).To(BeEmpty())
+		})
+
+		It("does not return a request when the child is not referenced", func() {
+			cm2.SetName("unreferenced")
+			Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, cm2, cm2)).To(BeEmpty())
+		})
+
+		It("does not return a request for workloads in other namespaces", func() {
+			cm2.SetNamespace("other")
+			Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, cm2, cm2)).To(BeEmpty())
+		})
+
+		Context("when the workload does not have the required annotation", func() {
+			BeforeEach(func() {
+				d.SetAnnotations(map[string]string{})
+			})
+
+			It("does not return a request", func() {
+				Expect(getRecreatedChildRequests(c, &appsv1.DeploymentList{}, nil, false, cm2, cm2)).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave ReplicaSet Suite", func() {
+	var c client.Client
+	var h *Handler
+	var rs *appsv1.ReplicaSet
+	var cm *corev1.ConfigMap
+
+	// handle reconciles the ReplicaSet and refreshes it from the client
+	var handle = func() {
+		_, err := h.HandleReplicaSet(rs)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.ReplicaSet{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: rs.GetNamespace(), Name: rs.GetName()}, updated)).To(Succeed())
+		rs = updated
+	}
+
+	// newPod returns a Pod in the ReplicaSet's namespace with the given name
+	// and labels
+	var newPod = func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: rs.GetNamespace(), Labels: labels},
+		}
+	}
+
+	// podNames returns the names of the Pods remaining in the namespace
+	var podNames = func() []string {
+		pods := &corev1.PodList{}
+		Expect(c.List(context.TODO(), pods, client.InNamespace(rs.GetNamespace()))).To(Succeed())
+		names := []string{}
+		for _, pod := range pods.Items {
+			names = append(names, pod.GetName())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		d := utils.ExampleDeployment.DeepCopy()
+		rs = &appsv1.ReplicaSet{
+			TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "example",
+				Namespace:   d.GetNamespace(),
+				UID:         "replicaset-uid",
+				Annotations: map[string]string{RequiredAnnotation: requiredAnnotationValue},
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Selector: d.Spec.Selector,
+				Template: d.Spec.Template,
+			},
+		}
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, rs, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			newPod("example-1", rs.Spec.Template.GetLabels()),
+			newPod("example-2", rs.Spec.Template.GetLabels()),
+			newPod("other", map[string]string{"app": "other"}),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{EnableReplicaSets: true})
+	})
+
+	Context("getCurrentChildren", func() {
+		It("finds the same children as a Deployment with the same PodTemplate", func() {
+			children, err := h.getCurrentChildren(&replicaset{rs})
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := h.getCurrentChildren(&deployment{utils.ExampleDeployment.DeepCopy()})
+			Expect(err).NotTo(HaveOccurred())
+
+			names := func(children []configObject) []string {
+				out := []string{}
+				for _, child := range children {
+					out = append(out, kindOf(child.object)+"/"+child.object.GetName())
+				}
+				return out
+			}
+			Expect(names(children)).To(ConsistOf(names(expected)))
+			Expect(names(children)).To(ContainElement("ConfigMap/example1"))
+			Expect(names(children)).To(ContainElement("Secret/example1"))
+		})
+	})
+
+	It("writes the hash to the PodTemplate without deleting Pods on first sight", func() {
+		handle()
+		Expect(rs.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		Expect(rs.GetAnnotations()).To(HaveKeyWithValue(RestartedConfigHashAnnotation, rs.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+		Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+	})
+
+	It("adds OwnerReferences of kind ReplicaSet to its children", func() {
+		handle()
+		child := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, child)).To(Succeed())
+		Expect(child.GetOwnerReferences()).To(HaveLen(1))
+		Expect(child.GetOwnerReferences()[0].Kind).To(Equal("ReplicaSet"))
+		Expect(child.GetOwnerReferences()[0].Name).To(Equal(rs.GetName()))
+	})
+
+	It("deletes its Pods and updates the PodTemplate when the configuration changes", func() {
+		handle()
+		original := rs.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		handle()
+		Expect(rs.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(Equal(original))
+		Expect(rs.GetAnnotations()[RestartedConfigHashAnnotation]).To(Equal(rs.Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+		Expect(podNames()).To(ConsistOf("other"))
+	})
+
+	It("ignores ReplicaSets controlled by a Deployment", func() {
+		controller := true
+		rs.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "example", UID: "deployment-uid", Controller: &controller}})
+		Expect(c.Update(context.TODO(), rs)).To(Succeed())
+
+		handle()
+		Expect(rs.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+		Expect(rs.GetFinalizers()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// getRequeueAfter returns the delay before retrying the podController after a
+// transient failure set by its requeue-after annotation, or the given
+// fallback if the annotation is not set or is not a positive duration.
+func getRequeueAfter(obj podController, fallback time.Duration) time.Duration {
+	value, ok := obj.GetAnnotations()[RequeueAfterAnnotation]
+	if !ok {
+		return fallback
+	}
+	requeueAfter, err := time.ParseDuration(value)
+	if err != nil || requeueAfter <= 0 {
+		return fallback
+	}
+	return requeueAfter
+}
+
+// withRequeueAfter retries an instance with the requeue-after annotation
+// whose reconcile failed because a required child is missing after the
+// annotated delay, rather than with the global backoff of the rate limiter.
+// The failure has already been reported on the instance, so it is only
+// logged. Other results are returned unchanged.
+func (h *Handler) withRequeueAfter(instance podController, result reconcile.Result, err error) (reconcile.Result, error) {
+	if !isMissingChildError(err) {
+		return result, err
+	}
+	requeueAfter := getRequeueAfter(instance, 0)
+	if requeueAfter <= 0 {
+		return result, err
+	}
+	h.log.Error(err, "Required child missing, retrying", "kind", kindOf(instance), "namespace", instance.GetNamespace(), "name", instance.GetName(), "requeueAfter", requeueAfter.String())
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave requeue after Suite", func() {
+	var c client.Client
+	var h *Handler
+	var annotated, other *appsv1.Deployment
+
+	// handle reconciles the current state of the Deployment
+	var handle = func(d *appsv1.Deployment) (time.Duration, error) {
+		current := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, current)).To(Succeed())
+		result, err := h.HandleDeployment(current)
+		return result.RequeueAfter, err
+	}
+
+	Context("getRequeueAfter", func() {
+		It("returns the annotated duration", func() {
+			d := newDeployment("example", map[string]string{RequeueAfterAnnotation: "2s"})
+			Expect(getRequeueAfter(&deployment{d}, time.Minute)).To(Equal(2 * time.Second))
+		})
+
+		It("falls back without the annotation", func() {
+			d := newDeployment("example", nil)
+			Expect(getRequeueAfter(&deployment{d}, time.Minute)).To(Equal(time.Minute))
+		})
+
+		for _, value := range []string{"soon", "2", "0s", "-2s", ""} {
+			value := value
+			It("falls back for the invalid duration \""+value+"\"", func() {
+				d := newDeployment("example", map[string]string{RequeueAfterAnnotation: value})
+				Expect(getRequeueAfter(&deployment{d}, time.Minute)).To(Equal(time.Minute))
+			})
+		}
+	})
+
+	Context("with a missing child", func() {
+		BeforeEach(func() {
+			annotated = newDeployment("annotated", map[string]string{RequeueAfterAnnotation: "2s"})
+			other = newDeployment("other", nil)
+
+			// ExampleConfigMap1 is required by both Deployments but does not
+			// exist
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, annotated, other,
+				utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		})
+
+		It("requeues the annotated Deployment on the annotated interval", func() {
+			for i := 0; i < 3; i++ {
+				requeueAfter, err := handle(annotated)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requeueAfter).To(Equal(2 * time.Second))
+			}
+
+			current := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: annotated.GetNamespace(), Name: annotated.GetName()}, current)).To(Succeed())
+			Expect(current.GetAnnotations()).To(HaveKeyWithValue(StatusAnnotation, StatusMissingChildren))
+		})
+
+		It("leaves other Deployments to the global backoff", func() {
+			requeueAfter, err := handle(other)
+			Expect(err).To(HaveOccurred())
+			Expect(isMissingChildError(err)).To(BeTrue())
+			Expect(requeueAfter).To(BeZero())
+		})
+
+		It("leaves Deployments with an invalid interval to the global backoff", func() {
+			invalid := newDeployment("invalid", map[string]string{RequeueAfterAnnotation: "soon"})
+			Expect(c.Create(context.TODO(), invalid)).To(Succeed())
+			_, err := handle(invalid)
+			Expect(isMissingChildError(err)).To(BeTrue())
+		})
+
+		It("replaces the missing child backoff of Deployments requiring all children", func() {
+			for _, d := range []*appsv1.Deployment{annotated, other} {
+				current := &appsv1.Deployment{}
+				Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, current)).To(Succeed())
+				current.GetAnnotations()[RequireAllChildrenAnnotation] = requiredAnnotationValue
+				Expect(c.Update(context.TODO(), current)).To(Succeed())
+			}
+
+			for _, expected := range []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second} {
+				requeueAfter, err := handle(annotated)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requeueAfter).To(Equal(expected))
+			}
+			for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+				requeueAfter, err := handle(other)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requeueAfter).To(Equal(expected))
+			}
+		})
+
+		It("replaces the backoff within the missing child grace period", func() {
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{MissingChildGrace: time.Minute})
+			requeueAfter, err := handle(annotated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(2 * time.Second))
+
+			requeueAfter, err = handle(other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(missingChildRequeueBase))
+		})
+	})
+
+	Context("with a throttled rollout", func() {
+		var first *appsv1.Deployment
+
+		BeforeEach(func() {
+			first = newDeployment("first", nil)
+			annotated = newDeployment("annotated", map[string]string{RequeueAfterAnnotation: "2s"})
+			other = newDeployment("other", nil)
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, first, annotated, other,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{MaxRolloutsPerNamespace: 1})
+
+			requeueAfter, err := handle(first)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+		})
+
+		It("requeues the annotated Deployment on the annotated interval", func() {
+			requeueAfter, err := handle(annotated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(2 * time.Second))
+		})
+
+		It("requeues other Deployments on the default interval", func() {
+			requeueAfter, err := handle(other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(rolloutLimitRequeue))
+		})
+	})
+})
@@ -0,0 +1,32 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// requiresAllChildren returns true if the given podController has the
+// require-all-children annotation set to true
+func requiresAllChildren(obj podController) bool {
+	return obj.GetAnnotations()[RequireAllChildrenAnnotation] == requiredAnnotationValue
+}
+
+// requireAll marks every child in the map as required, so that a missing
+// child blocks the rollout even if it is only referenced optionally
+func requireAll(children map[string]configMetadata) {
+	for name, metadata := range children {
+		metadata.required = true
+		children[name] = metadata
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave require all children Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var recorder *record.FakeRecorder
+
+	// handle reconciles the Deployment and returns the updated Deployment
+	var handle = func() (reconcile.Result, *appsv1.Deployment) {
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return result, updated
+	}
+
+	// events returns the events recorded so far
+	var events = func() []string {
+		recorded := []string{}
+		for len(recorder.Events) > 0 {
+			recorded = append(recorded, <-recorder.Events)
+		}
+		return recorded
+	}
+
+	BeforeEach(func() {
+		optional := true
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: utils.ExampleConfigMap1.GetName()},
+						Optional:             &optional,
+					},
+				},
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{})
+	})
+
+	It("skips a missing optional child without the annotation", func() {
+		_, updated := handle()
+		Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+
+	Context("with the require-all-children annotation", func() {
+		BeforeEach(func() {
+			d.GetAnnotations()[RequireAllChildrenAnnotation] = requiredAnnotationValue
+		})
+
+		It("blocks the rollout and requeues while a child is missing", func() {
+			for _, expected := range []time.Duration{missingChildRequeueBase, 2 * missingChildRequeueBase} {
+				result, updated := handle()
+				Expect(result.RequeueAfter).To(Equal(expected))
+				Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				Expect(updated.GetFinalizers()).To(BeEmpty())
+			}
+			Expect(events()).To(ContainElement(HavePrefix("Warning MissingChild")))
+		})
+
+		It("proceeds once every child exists", func() {
+			handle()
+			Expect(c.Create(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+
+			result, updated := handle()
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		})
+	})
+})
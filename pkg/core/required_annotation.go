@@ -16,14 +16,33 @@ limitations under the License.
 
 package core
 
-// hasRequiredAnnotation returns true if the given PodController has the wave
-// annotation present
-func hasRequiredAnnotation(obj podController) bool {
+import "fmt"
+
+// isAnnotationEnabled returns true if Wave is enabled for the given
+// PodController by its annotations.
+// An explicit required or enabled annotation decides in either direction,
+// with the required annotation taking precedence; otherwise Wave is enabled
+// only if it is enabled by default.
+func isAnnotationEnabled(obj podController, defaultEnabled bool) bool {
 	annotations := obj.GetAnnotations()
-	if value, ok := annotations[RequiredAnnotation]; ok {
-		if value == requiredAnnotationValue {
-			return true
+	for _, key := range []string{RequiredAnnotation, EnabledAnnotation} {
+		if value, ok := annotations[key]; ok {
+			return value == requiredAnnotationValue
+		}
+	}
+	return defaultEnabled
+}
+
+// ValidateRequiredAnnotation returns an error if the given annotations set
+// the wave or enabled annotation to a value other than true or false, as Wave
+// only processes objects whose annotation is exactly true
+func ValidateRequiredAnnotation(annotations map[string]string) error {
+	for _, key := range []string{RequiredAnnotation, EnabledAnnotation} {
+		value, ok := annotations[key]
+		if !ok || value == requiredAnnotationValue || value == "false" {
+			continue
 		}
+		return fmt.Errorf("invalid value %q for annotation %s, must be %q or \"false\"", value, key, requiredAnnotationValue)
 	}
-	return false
+	return nil
 }
@@ -32,32 +32,68 @@ var _ = Describe("Wave required annotation Suite", func() {
 		podControllerDeployment = &deployment{deploymentObject}
 	})
 
-	Context("hasRequiredAnnotation", func() {
-		It("returns true when the annotation has value true", func() {
+	Context("isAnnotationEnabled", func() {
+		setAnnotation := func(key, value string) {
 			annotations := deploymentObject.GetAnnotations()
 			if annotations == nil {
 				annotations = make(map[string]string)
 			}
-			annotations[RequiredAnnotation] = requiredAnnotationValue
+			annotations[key] = value
 			deploymentObject.SetAnnotations(annotations)
+		}
 
-			Expect(hasRequiredAnnotation(podControllerDeployment)).To(BeTrue())
+		It("returns true when the annotation has value true", func() {
+			setAnnotation(RequiredAnnotation, requiredAnnotationValue)
+			Expect(isAnnotationEnabled(podControllerDeployment, false)).To(BeTrue())
 		})
 
 		It("returns false when the annotation has value other than true", func() {
-			annotations := deploymentObject.GetAnnotations()
-			if annotations == nil {
-				annotations = make(map[string]string)
-			}
-			annotations[RequiredAnnotation] = "false"
-			deploymentObject.SetAnnotations(annotations)
-
-			Expect(hasRequiredAnnotation(podControllerDeployment)).To(BeFalse())
+			setAnnotation(RequiredAnnotation, "false")
+			Expect(isAnnotationEnabled(podControllerDeployment, false)).To(BeFalse())
 		})
 
 		It("returns false when the annotation is not set", func() {
-			Expect(hasRequiredAnnotation(podControllerDeployment)).To(BeFalse())
+			Expect(isAnnotationEnabled(podControllerDeployment, false)).To(BeFalse())
+		})
+
+		It("returns true when the annotation is not set and Wave is enabled by default", func() {
+			Expect(isAnnotationEnabled(podControllerDeployment, true)).To(BeTrue())
+		})
+
+		It("returns false when enabled by default and opted out", func() {
+			setAnnotation(EnabledAnnotation, "false")
+			Expect(isAnnotationEnabled(podControllerDeployment, true)).To(BeFalse())
 		})
 
+		It("returns false when enabled by default and opted out with the required annotation", func() {
+			setAnnotation(RequiredAnnotation, "false")
+			Expect(isAnnotationEnabled(podControllerDeployment, true)).To(BeFalse())
+		})
+
+		It("returns true when disabled by default and opted in", func() {
+			setAnnotation(EnabledAnnotation, requiredAnnotationValue)
+			Expect(isAnnotationEnabled(podControllerDeployment, false)).To(BeTrue())
+		})
+
+		It("gives the required annotation precedence over the enabled annotation", func() {
+			setAnnotation(RequiredAnnotation, requiredAnnotationValue)
+			setAnnotation(EnabledAnnotation, "false")
+			Expect(isAnnotationEnabled(podControllerDeployment, false)).To(BeTrue())
+		})
+	})
+
+	Context("ValidateRequiredAnnotation", func() {
+		It("accepts true, false and a missing annotation", func() {
+			Expect(ValidateRequiredAnnotation(map[string]string{RequiredAnnotation: "true"})).To(Succeed())
+			Expect(ValidateRequiredAnnotation(map[string]string{RequiredAnnotation: "false"})).To(Succeed())
+			Expect(ValidateRequiredAnnotation(nil)).To(Succeed())
+		})
+
+		It("rejects values that Wave would ignore", func() {
+			for _, value := range []string{"True", "yes", "1", ""} {
+				Expect(ValidateRequiredAnnotation(map[string]string{RequiredAnnotation: value})).NotTo(Succeed())
+				Expect(ValidateRequiredAnnotation(map[string]string{EnabledAnnotation: value})).NotTo(Succeed())
+			}
+		})
 	})
 })
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// getPodSelector returns the selector of the Pods managed by the
+// podController, or nil for podControllers whose Pods cannot be deleted to
+// restart them
+func getPodSelector(obj podController) *metav1.LabelSelector {
+	switch o := obj.(type) {
+	case *deployment:
+		return o.Spec.Selector
+	case *statefulset:
+		return o.Spec.Selector
+	case *daemonset:
+		return o.Spec.Selector
+	case *replicaset:
+		return o.Spec.Selector
+	default:
+		return nil
+	}
+}
+
+// deletesPods returns true if the given podController has the delete-pods
+// restart strategy and a selector for its Pods.
+// ReplicaSets never replace their Pods when their PodTemplate changes, so
+// they always have the delete-pods restart strategy.
+func deletesPods(obj podController) bool {
+	if _, ok := obj.(*replicaset); ok {
+		return getPodSelector(obj) != nil
+	}
+	return obj.GetAnnotations()[RestartStrategyAnnotation] == RestartStrategyDeletePods && getPodSelector(obj) != nil
+}
+
+// setsPodTemplateOnRestart returns true if the configuration hash is also
+// written to the PodTemplate of the given podController when its Pods are
+// restarted by deleting them, as changing it does not replace its Pods
+func setsPodTemplateOnRestart(obj podController) bool {
+	_, ok := obj.(*replicaset)
+	return ok
+}
+
+// setRestartedConfigHash records the configuration hash on the metadata of
+// the given podController, leaving the PodTemplate untouched.
+// It returns true if the podController's Pods must be restarted, which is
+// the case when a different hash was previously recorded.
+func setRestartedConfigHash(obj podController, hash string) bool {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	previous, ok := annotations[RestartedConfigHashAnnotation]
+	annotations[RestartedConfigHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	return ok && previous != hash
+}
+
+// checkPodSelector returns an error if the selector of the podController
+// could select Pods it does not manage, because it is empty or does not match
+// the labels of its own PodTemplate. Deleting the Pods it selects could then
+// delete the Pods of other workloads.
+func checkPodSelector(obj podController) error {
+	selector, err := metav1.LabelSelectorAsSelector(getPodSelector(obj))
+	if err != nil {
+		return fmt.Errorf("error parsing selector: %v", err)
+	}
+	if selector.Empty() {
+		return fmt.Errorf("selector of %s %s/%s selects every Pod", kindOf(obj), obj.GetNamespace(), obj.GetName())
+	}
+	if !selector.Matches(labels.Set(obj.GetPodTemplate().GetLabels())) {
+		return fmt.Errorf("selector %q of %s %s/%s does not match the labels of its PodTemplate", selector.String(), kindOf(obj), obj.GetNamespace(), obj.GetName())
+	}
+	return nil
+}
+
+// deletePods deletes the Pods selected by the podController's selector so that
+// they are recreated with the current configuration.
+// Pods that are already terminating are left alone. No Pods are deleted if
+// the selector does not match the podController's own PodTemplate.
+func (h *Handler) deletePods(obj podController) (int, error) {
+	err := checkPodSelector(obj)
+	if err != nil {
+		return 0, fmt.Errorf("refusing to delete pods: %v", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(getPodSelector(obj))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing selector: %v", err)
+	}
+
+	pods := &corev1.PodList{}
+	err = h.List(context.TODO(), pods, client.InNamespace(obj.GetNamespace()), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return 0, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	deleted := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+		err = h.Delete(context.TODO(), pod)
+		if err != nil && !errors.IsNotFound(err) {
+			return deleted, fmt.Errorf("error deleting pod %s: %v", pod.GetName(), err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// selectOtherPods sets the selector of the Deployment to select the Pods of
+// another workload rather than those of its own PodTemplate
+func selectOtherPods(d *appsv1.Deployment) {
+	d.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+}
+
+var _ = Describe("Wave restart strategy Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var cm *corev1.ConfigMap
+
+	// handle reconciles the Deployment and refreshes it from the client
+	var handle = func() {
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		d = updated
+	}
+
+	// newPod returns a Pod in the Deployment's namespace with the given name
+	// and labels
+	var newPod = func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: d.GetNamespace(), Labels: labels},
+		}
+	}
+
+	// podNames returns the names of the Pods remaining in the namespace
+	var podNames = func() []string {
+		pods := &corev1.PodList{}
+		Expect(c.List(context.TODO(), pods, client.InNamespace(d.GetNamespace()))).To(Succeed())
+		names := []string{}
+		for _, pod := range pods.Items {
+			names = append(names, pod.GetName())
+		}
+		return names
+	}
+
+	// updateConfigMap changes the data of the ConfigMap used by the Deployment
+	var updateConfigMap = func() {
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			RestartStrategyAnnotation: RestartStrategyDeletePods,
+		})
+		cm = utils.ExampleConfigMap1.DeepCopy()
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+			utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			newPod("example-1", d.Spec.Template.GetLabels()),
+			newPod("example-2", d.Spec.Template.GetLabels()),
+			newPod("other", map[string]string{"app": "other"}),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("records the hash on the metadata without deleting Pods or updating the PodTemplate", func() {
+		handle()
+		Expect(d.GetAnnotations()).To(HaveKey(RestartedConfigHashAnnotation))
+		Expect(d.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+		Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+	})
+
+	It("deletes the Deployment's Pods when the configuration changes", func() {
+		handle()
+		original := d.GetAnnotations()[RestartedConfigHashAnnotation]
+
+		updateConfigMap()
+		handle()
+		Expect(d.GetAnnotations()[RestartedConfigHashAnnotation]).NotTo(Equal(original))
+		Expect(d.Spec.Template.GetAnnotations()).To(BeEmpty())
+		Expect(podNames()).To(ConsistOf("other"))
+	})
+
+	It("does not delete Pods when the configuration is unchanged", func() {
+		handle()
+		handle()
+		Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+	})
+
+	It("bumps the PodTemplate hash without deleting Pods by default", func() {
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		handle()
+		updateConfigMap()
+		handle()
+		Expect(d.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+		Expect(d.GetAnnotations()).NotTo(HaveKey(RestartedConfigHashAnnotation))
+		Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+	})
+
+	Context("with a selector that does not match the PodTemplate", func() {
+		var out *bytes.Buffer
+		var recorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			handle()
+			selectOtherPods(d)
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+			out = &bytes.Buffer{}
+			recorder = record.NewFakeRecorder(100)
+			h = NewHandler(c, recorder, Options{Logger: newJSONLogger(out)})
+		})
+
+		It("refuses to delete Pods when the configuration changes", func() {
+			original := d.GetAnnotations()[RestartedConfigHashAnnotation]
+			updateConfigMap()
+			_, err := h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not match the labels of its PodTemplate"))
+			Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			Expect(updated.GetAnnotations()).To(HaveKeyWithValue(RestartedConfigHashAnnotation, original))
+			Expect(updated.GetAnnotations()).To(HaveKeyWithValue(StatusAnnotation, StatusError))
+		})
+
+		It("logs and records an event with the reason", func() {
+			updateConfigMap()
+			_, err := h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+			Expect(out.String()).To(ContainSubstring("Refusing to restart instance by deleting its pods"))
+			Expect(out.String()).To(ContainSubstring("does not match the labels of its PodTemplate"))
+			events := []string{}
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			Expect(events).To(ContainElement(ContainSubstring("PodSelectorMismatch")))
+		})
+
+		It("still reconciles when the configuration is unchanged", func() {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(podNames()).To(ConsistOf("example-1", "example-2", "other"))
+		})
+	})
+})
+
+var _ = Describe("Wave pod selector checks Suite", func() {
+	var d *appsv1.Deployment
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RestartStrategyAnnotation: RestartStrategyDeletePods})
+	})
+
+	It("accepts a selector matching the PodTemplate", func() {
+		Expect(checkPodSelector(&deployment{d})).To(Succeed())
+	})
+
+	It("rejects a selector that does not match the PodTemplate", func() {
+		selectOtherPods(d)
+		Expect(checkPodSelector(&deployment{d})).NotTo(Succeed())
+	})
+
+	It("rejects an empty selector", func() {
+		d.Spec.Selector = &metav1.LabelSelector{}
+		Expect(checkPodSelector(&deployment{d})).NotTo(Succeed())
+	})
+
+	It("never deletes Pods through a selector that does not match the PodTemplate", func() {
+		selectOtherPods(d)
+		other := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: d.GetNamespace(), Labels: map[string]string{"app": "other"}}}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, other)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		deleted, err := h.deletePods(&deployment{d})
+		Expect(err).To(HaveOccurred())
+		Expect(deleted).To(BeZero())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: other.GetNamespace(), Name: other.GetName()}, &corev1.Pod{})).To(Succeed())
+	})
+})
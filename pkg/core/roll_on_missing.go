@@ -0,0 +1,45 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// rollsOnMissing returns true if the given podController has the
+// roll-on-missing annotation set to true
+func rollsOnMissing(obj podController) bool {
+	return obj.GetAnnotations()[RollOnMissingAnnotation] == requiredAnnotationValue
+}
+
+// addMissingChildren folds a marker for each missing child into the
+// configuration hash, so that deleting a required child rolls the
+// podController out and restoring it rolls the podController out again.
+// The hash is returned unchanged if no children are missing.
+func addMissingChildren(hash string, missing []string) string {
+	if len(missing) == 0 {
+		return hash
+	}
+
+	combined := sha256.New()
+	fmt.Fprintf(combined, "%s\n", hash)
+	for _, name := range missing {
+		fmt.Fprintf(combined, "missing=%s\n", name)
+	}
+	return fmt.Sprintf("%x", combined.Sum(nil))
+}
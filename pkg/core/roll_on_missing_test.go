@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave roll on missing Suite", func() {
+	var d *appsv1.Deployment
+	var c client.Client
+	var recorder *record.FakeRecorder
+	var h *Handler
+
+	getHash := func() string {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:      requiredAnnotationValue,
+			RollOnMissingAnnotation: requiredAnnotationValue,
+		})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{})
+
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getHash()).NotTo(BeEmpty())
+	})
+
+	Context("addMissingChildren", func() {
+		It("leaves the hash unchanged when no children are missing", func() {
+			Expect(addMissingChildren("abc", nil)).To(Equal("abc"))
+		})
+
+		It("changes the hash for each set of missing children", func() {
+			one := addMissingChildren("abc", []string{"ConfigMap/example1"})
+			two := addMissingChildren("abc", []string{"ConfigMap/example1", "Secret/example1"})
+			Expect(one).NotTo(Equal("abc"))
+			Expect(two).NotTo(Equal("abc"))
+			Expect(one).NotTo(Equal(two))
+		})
+	})
+
+	Context("when a required child is deleted", func() {
+		var before string
+
+		BeforeEach(func() {
+			before = getHash()
+			Expect(c.Delete(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+			for len(recorder.Events) > 0 {
+				<-recorder.Events
+			}
+		})
+
+		It("rolls the Deployment out without an error", func() {
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(getHash()).NotTo(Equal(before))
+			Expect(recorder.Events).To(Receive(ContainSubstring("MissingChild")))
+		})
+
+		It("computes the hash that is written to the Deployment", func() {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := h.ComputeConfigHash(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(getHash()))
+		})
+
+		It("rolls the Deployment out again when the child is restored", func() {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			missing := getHash()
+
+			Expect(c.Create(context.TODO(), utils.ExampleConfigMap1.DeepCopy())).To(Succeed())
+			_, err = h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getHash()).NotTo(Equal(missing))
+			Expect(getHash()).To(Equal(before))
+		})
+
+		It("returns an error without the annotation", func() {
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			updated.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			_, err := h.HandleDeployment(updated)
+			Expect(isMissingChildError(err)).To(BeTrue())
+			Expect(getHash()).To(Equal(before))
+		})
+	})
+})
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// rolloutProgress describes how far the rollout of a podController has
+// progressed, taking its update strategy into account
+type rolloutProgress struct {
+	// complete is true once the rollout has progressed as far as the update
+	// strategy of the podController allows it to
+	complete bool
+
+	// partial is true when the update strategy deliberately limits the
+	// rollout to a subset of the Pods (eg. a StatefulSet partition)
+	partial bool
+
+	// message is a human readable description of the progress
+	message string
+}
+
+// setRolloutInProgress records that the Handler rolled out the podController,
+// updating it to its current generation, so that the completion of the
+// rollout is reported.
+// Only Deployments, StatefulSets and DaemonSets are tracked, as the progress
+// of other workloads cannot be evaluated.
+func (h *Handler) setRolloutInProgress(obj podController) {
+	switch obj.(type) {
+	case *deployment, *statefulset, *daemonset:
+	default:
+		return
+	}
+
+	h.progressMutex.Lock()
+	defer h.progressMutex.Unlock()
+	if h.progressing == nil {
+		h.progressing = make(map[string]int64)
+	}
+	h.progressing[missingChildKey(obj)] = obj.GetGeneration()
+}
+
+// checkRolloutProgress records a RolloutComplete event on the podController,
+// and counts the rollout as completed, once the rollout triggered by the
+// Handler has progressed as far as the update strategy of the podController
+// allows. The update completing a rollout is admitted by
+// NewWorkloadUpdatePredicate so that the podController is reconciled then.
+func (h *Handler) checkRolloutProgress(obj podController) {
+	h.progressMutex.Lock()
+	generation, ok := h.progressing[missingChildKey(obj)]
+	if !ok {
+		h.progressMutex.Unlock()
+		return
+	}
+	// A podController read from a cache that has not yet seen the update is
+	// still rolling out
+	progress := getRolloutProgress(obj)
+	if obj.GetGeneration() < generation || !progress.complete {
+		h.progressMutex.Unlock()
+		return
+	}
+	delete(h.progressing, missingChildKey(obj))
+	h.progressMutex.Unlock()
+
+	h.log.V(0).Info("Rollout complete", "kind", kindOf(obj), "namespace", obj.GetNamespace(), "name", obj.GetName(), "partial", progress.partial, "progress", progress.message)
+	h.recorder.Eventf(obj.GetObject(), corev1.EventTypeNormal, "RolloutComplete", "Rollout of the configuration finished: %s", progress.message)
+	rolloutsCompletedTotal.WithLabelValues(obj.GetNamespace(), strconv.FormatBool(progress.partial)).Inc()
+}
+
+// clearRolloutInProgress forgets the rollout of the podController once Wave
+// no longer manages it
+func (h *Handler) clearRolloutInProgress(obj podController) {
+	h.progressMutex.Lock()
+	defer h.progressMutex.Unlock()
+	delete(h.progressing, missingChildKey(obj))
+}
+
+// getRolloutProgress evaluates the rollout progress of the given podController
+func getRolloutProgress(obj podController) rolloutProgress {
+	switch o := obj.(type) {
+	case *deployment:
+		return getDeploymentRolloutProgress(o.Deployment)
+	case *statefulset:
+		return getStatefulSetRolloutProgress(o.StatefulSet)
+	case *daemonset:
+		return getDaemonSetRolloutProgress(o.DaemonSet)
+	case *cronjob:
+		// CronJobs pick up the new PodTemplate with their next Job
+		return rolloutProgress{complete: true, message: "applied to the next scheduled Job"}
+	default:
+		// Unknown types can't be evaluated so never report them as stuck
+		return rolloutProgress{complete: true, message: "rollout progress unknown"}
+	}
+}
+
+// getDeploymentRolloutProgress evaluates the rollout progress of a Deployment
+func getDeploymentRolloutProgress(d *appsv1.Deployment) rolloutProgress {
+	if d.Status.ObservedGeneration < d.GetGeneration() {
+		return rolloutProgress{message: "waiting for rollout to be observed"}
+	}
+
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	if d.Status.UpdatedReplicas < replicas {
+		return rolloutProgress{message: fmt.Sprintf("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas)}
+	}
+	if d.Status.Replicas > d.Status.UpdatedReplicas {
+		return rolloutProgress{message: fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)}
+	}
+	if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		return rolloutProgress{message: fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)}
+	}
+	return rolloutProgress{complete: true, message: "rollout complete"}
+}
+
+// getStatefulSetRolloutProgress evaluates the rollout progress of a
+// StatefulSet. A partitioned rollout is complete once all Pods above the
+// partition have been updated.
+func getStatefulSetRolloutProgress(s *appsv1.StatefulSet) rolloutProgress {
+	if s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		// Pods are only updated when deleted so the rollout never progresses
+		// on its own
+		return rolloutProgress{complete: true, partial: true, message: "OnDelete update strategy, pods are updated when deleted"}
+	}
+	if s.Status.ObservedGeneration < s.GetGeneration() {
+		return rolloutProgress{message: "waiting for rollout to be observed"}
+	}
+
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return rolloutProgress{message: fmt.Sprintf("%d of %d replicas are ready", s.Status.ReadyReplicas, replicas)}
+	}
+
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+		expected := replicas - *ru.Partition
+		if expected < 0 {
+			expected = 0
+		}
+		if s.Status.UpdatedReplicas < expected {
+			return rolloutProgress{partial: true, message: fmt.Sprintf("%d out of %d new replicas above partition %d have been updated", s.Status.UpdatedReplicas, expected, *ru.Partition)}
+		}
+		return rolloutProgress{complete: true, partial: true, message: fmt.Sprintf("partitioned rollout complete, %d new replicas have been updated", s.Status.UpdatedReplicas)}
+	}
+
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return rolloutProgress{message: fmt.Sprintf("%d out of %d new replicas have been updated", s.Status.UpdatedReplicas, replicas)}
+	}
+	return rolloutProgress{complete: true, message: "rollout complete"}
+}
+
+// getDaemonSetRolloutProgress evaluates the rollout progress of a DaemonSet.
+// Up to maxUnavailable Pods may be unavailable once all Pods have been
+// updated without the rollout being considered incomplete.
+func getDaemonSetRolloutProgress(d *appsv1.DaemonSet) rolloutProgress {
+	if d.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		// Pods are only updated when deleted so the rollout never progresses
+		// on its own
+		return rolloutProgress{complete: true, partial: true, message: "OnDelete update strategy, pods are updated when deleted"}
+	}
+	if d.Status.ObservedGeneration < d.GetGeneration() {
+		return rolloutProgress{message: "waiting for rollout to be observed"}
+	}
+
+	desired := d.Status.DesiredNumberScheduled
+	if d.Status.UpdatedNumberScheduled < desired {
+		return rolloutProgress{message: fmt.Sprintf("%d out of %d new pods have been updated", d.Status.UpdatedNumberScheduled, desired)}
+	}
+
+	maxUnavailable := 1
+	if ru := d.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.MaxUnavailable != nil {
+		value, err := intstr.GetValueFromIntOrPercent(ru.MaxUnavailable, int(desired), true)
+		if err == nil {
+			maxUnavailable = value
+		}
+	}
+	if int(d.Status.NumberAvailable) < int(desired)-maxUnavailable {
+		return rolloutProgress{message: fmt.Sprintf("%d of %d updated pods are available", d.Status.NumberAvailable, desired)}
+	}
+	return rolloutProgress{complete: true, message: "rollout complete"}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutLimitRequeue is how long to wait before checking again whether a
+// Deployment deferred by the rollout limit can roll out
+const rolloutLimitRequeue = 10 * time.Second
+
+// rolloutRecord records a rollout triggered by the Handler
+type rolloutRecord struct {
+	// pending is true between reserving the rollout and updating the
+	// Deployment, while its new generation is not yet known
+	pending bool
+
+	// generation is the generation of the Deployment once updated
+	generation int64
+}
+
+// rolloutLimiter tracks the Deployments in each namespace with a rollout
+// triggered by the Handler that has not yet completed
+type rolloutLimiter struct {
+	mutex      sync.Mutex
+	inProgress map[string]map[string]rolloutRecord
+}
+
+// reserveRollout returns true if the podController may roll out without
+// exceeding the maximum number of rollouts in progress in its namespace, and
+// if so records its rollout as in progress.
+// Only Deployments are limited, and only the rollouts triggered since Wave
+// started are counted.
+func (h *Handler) reserveRollout(obj podController) (bool, error) {
+	if _, ok := obj.(*deployment); !ok || h.opts.MaxRolloutsPerNamespace <= 0 {
+		return true, nil
+	}
+
+	h.rollouts.mutex.Lock()
+	defer h.rollouts.mutex.Unlock()
+
+	namespace := obj.GetNamespace()
+	if h.rollouts.inProgress == nil {
+		h.rollouts.inProgress = make(map[string]map[string]rolloutRecord)
+	}
+	inProgress := h.rollouts.inProgress[namespace]
+	if inProgress == nil {
+		inProgress = make(map[string]rolloutRecord)
+		h.rollouts.inProgress[namespace] = inProgress
+	}
+
+	count := 0
+	for name, record := range inProgress {
+		if name == obj.GetName() {
+			continue
+		}
+		if !record.pending {
+			complete, err := h.isRolloutComplete(namespace, name, record.generation)
+			if err != nil {
+				return false, err
+			}
+			if complete {
+				delete(inProgress, name)
+				continue
+			}
+		}
+		count++
+	}
+	if count >= h.opts.MaxRolloutsPerNamespace {
+		return false, nil
+	}
+	inProgress[obj.GetName()] = rolloutRecord{pending: true}
+	return true, nil
+}
+
+// recordRollout records the generation of a podController once it has been
+// updated to roll out, so that its rollout is complete once that generation
+// has been observed and rolled out
+func (h *Handler) recordRollout(obj podController) {
+	h.setRolloutRecord(obj, func(inProgress map[string]rolloutRecord) {
+		inProgress[obj.GetName()] = rolloutRecord{generation: obj.GetGeneration()}
+	})
+}
+
+// releaseRollout forgets a reserved rollout that was not performed
+func (h *Handler) releaseRollout(obj podController) {
+	h.setRolloutRecord(obj, func(inProgress map[string]rolloutRecord) {
+		delete(inProgress, obj.GetName())
+	})
+}
+
+// setRolloutRecord updates the rollouts in progress in the namespace of a
+// podController whose rollout has been reserved
+func (h *Handler) setRolloutRecord(obj podController, update func(map[string]rolloutRecord)) {
+	h.rollouts.mutex.Lock()
+	defer h.rollouts.mutex.Unlock()
+
+	inProgress := h.rollouts.inProgress[obj.GetNamespace()]
+	if _, ok := inProgress[obj.GetName()]; ok {
+		update(inProgress)
+	}
+}
+
+// isRolloutComplete returns true if the Deployment no longer exists, or if
+// its controller has observed the given generation and finished rolling it
+// out. A Deployment read from a cache that has not yet seen the generation is
+// never complete.
+func (h *Handler) isRolloutComplete(namespace, name string, generation int64) (bool, error) {
+	d := &appsv1.Deployment{}
+	err := h.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, d)
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if d.GetGeneration() < generation || d.Status.ObservedGeneration < generation {
+		return false, nil
+	}
+	return getDeploymentRolloutProgress(d).complete, nil
+}
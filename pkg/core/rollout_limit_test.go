@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave rollout limit Suite", func() {
+	var c client.Client
+	var h *Handler
+	var first, second *appsv1.Deployment
+
+	// get fetches the current state of the Deployment
+	var get = func(d *appsv1.Deployment) *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	// rollsOut reconciles the Deployment and returns true if its hash was
+	// written
+	var rollsOut = func(d *appsv1.Deployment) bool {
+		current := get(d)
+		before := current.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		result, err := h.HandleDeployment(current)
+		Expect(err).NotTo(HaveOccurred())
+		after := get(d).Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		if after == before {
+			Expect(result.RequeueAfter).To(Equal(rolloutLimitRequeue))
+			return false
+		}
+		return true
+	}
+
+	// complete marks the rollout of the Deployment's single replica as
+	// complete
+	var complete = func(d *appsv1.Deployment) {
+		current := get(d)
+		current.Status.ObservedGeneration = current.GetGeneration()
+		current.Status.Replicas = 1
+		current.Status.UpdatedReplicas = 1
+		current.Status.AvailableReplicas = 1
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		first = newDeployment("first", nil)
+		second = newDeployment("second", nil)
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, first, second,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{MaxRolloutsPerNamespace: 1})
+	})
+
+	It("rolls out Deployments changed at once one after another", func() {
+		Expect(rollsOut(first)).To(BeTrue())
+		Expect(rollsOut(second)).To(BeFalse())
+		Expect(rollsOut(second)).To(BeFalse())
+
+		complete(first)
+		Expect(rollsOut(second)).To(BeTrue())
+		Expect(get(second).Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("does not count a Deployment against its own rollout", func() {
+		Expect(rollsOut(first)).To(BeTrue())
+
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		Expect(rollsOut(first)).To(BeTrue())
+	})
+
+	It("does not count rollouts that have not observed the updated generation", func() {
+		Expect(rollsOut(first)).To(BeTrue())
+		h.rollouts.inProgress[first.GetNamespace()][first.GetName()] = rolloutRecord{generation: 2}
+
+		complete(first)
+		Expect(rollsOut(second)).To(BeFalse())
+	})
+
+	It("frees capacity when a Deployment with a rollout in progress is deleted", func() {
+		Expect(rollsOut(first)).To(BeTrue())
+		Expect(c.Delete(context.TODO(), get(first))).To(Succeed())
+		Expect(rollsOut(second)).To(BeTrue())
+	})
+
+	It("does not limit rollouts in other namespaces", func() {
+		Expect(rollsOut(first)).To(BeTrue())
+		Expect(h.rollouts.inProgress).NotTo(HaveKey("other"))
+		other := newDeployment("other", nil)
+		other.SetNamespace("other")
+		reserved, err := h.reserveRollout(&deployment{other})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(BeTrue())
+	})
+
+	It("does not limit rollouts if disabled", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		Expect(rollsOut(first)).To(BeTrue())
+		Expect(rollsOut(second)).To(BeTrue())
+	})
+})
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutOrderRequeue is how long to wait before checking again whether a
+// Deployment deferred by its rollout order can roll out
+const rolloutOrderRequeue = 10 * time.Second
+
+// getRolloutOrder returns the rollout order of the podController and true, or
+// false if the rollout order annotation is not set to an integer
+func getRolloutOrder(obj podController) (int64, bool) {
+	value, ok := obj.GetAnnotations()[RolloutOrderAnnotation]
+	if !ok {
+		return 0, false
+	}
+	order, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return order, true
+}
+
+// getRolloutOrderBlocker returns the name of a Deployment that must roll out
+// before the given podController may, or an empty string if there is none.
+//
+// A Deployment with a rollout order waits for every enabled Deployment in its
+// namespace with a lower rollout order that references one of the same
+// ConfigMaps or Secrets, until that Deployment's PodTemplate carries its
+// current configuration hash and its rollout is complete. Deployments whose
+// hash cannot be calculated because a child is missing never block others.
+func (h *Handler) getRolloutOrderBlocker(obj podController) (string, error) {
+	if _, ok := obj.(*deployment); !ok {
+		return "", nil
+	}
+	order, ok := getRolloutOrder(obj)
+	if !ok {
+		return "", nil
+	}
+
+	list := &appsv1.DeploymentList{}
+	err := h.List(context.TODO(), list, client.InNamespace(obj.GetNamespace()))
+	if err != nil {
+		return "", err
+	}
+
+	children := getChildKeys(obj)
+	for _, other := range podControllersFromList(list) {
+		if other.GetName() == obj.GetName() || !h.isEnabled(other) || toBeDeleted(other) || isObserveOnly(other) || deletesPods(other) {
+			continue
+		}
+		if otherOrder, ok := getRolloutOrder(other); !ok || otherOrder >= order || !sharesChild(children, getChildKeys(other)) {
+			continue
+		}
+
+		hash, err := h.computeCurrentConfigHash(other)
+		if _, ok := err.(*missingChildError); ok {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// The Deployment has yet to roll out if the Handler would update its
+		// PodTemplate with the current hash
+		copy := other.DeepCopy()
+		adopted := updateConfigHash(copy, hash, h.getHashAnnotation())
+		if !adopted && !reflect.DeepEqual(other.GetPodTemplate(), copy.GetPodTemplate()) {
+			return other.GetName(), nil
+		}
+		if !getRolloutProgress(other).complete {
+			return other.GetName(), nil
+		}
+	}
+	return "", nil
+}
+
+// getChildKeys returns the kind and name of each ConfigMap and Secret
+// referenced by the podController
+func getChildKeys(obj podController) map[string]struct{} {
+	return toChildKeys(getChildNamesByType(obj))
+}
+
+// toChildKeys returns the kind and name of each of the ConfigMaps and Secrets
+func toChildKeys(configMaps, secrets map[string]configMetadata) map[string]struct{} {
+	keys := make(map[string]struct{}, len(configMaps)+len(secrets))
+	for name := range configMaps {
+		keys["ConfigMap/"+name] = struct{}{}
+	}
+	for name := range secrets {
+		keys["Secret/"+name] = struct{}{}
+	}
+	return keys
+}
+
+// sharesChild returns true if the two sets of child keys share any member
+func sharesChild(a, b map[string]struct{}) bool {
+	for key := range a {
+		if _, ok := b[key]; ok {
+			return true
+		}
+	}
+	return false
+}
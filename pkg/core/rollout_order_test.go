@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave rollout order Suite", func() {
+	var c client.Client
+	var h *Handler
+	var app, worker *appsv1.Deployment
+
+	// get fetches the current state of the Deployment
+	var get = func(d *appsv1.Deployment) *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated
+	}
+
+	// rollsOut reconciles the Deployment and returns true if its hash was
+	// written
+	var rollsOut = func(d *appsv1.Deployment) bool {
+		current := get(d)
+		before := current.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		result, err := h.HandleDeployment(current)
+		Expect(err).NotTo(HaveOccurred())
+		after := get(d).Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		if after == before {
+			Expect(result.RequeueAfter).To(Equal(rolloutOrderRequeue))
+			return false
+		}
+		return true
+	}
+
+	// complete marks the rollout of the Deployment's single replica as
+	// complete
+	var complete = func(d *appsv1.Deployment) {
+		current := get(d)
+		current.Status.ObservedGeneration = current.GetGeneration()
+		current.Status.Replicas = 1
+		current.Status.UpdatedReplicas = 1
+		current.Status.AvailableReplicas = 1
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+	}
+
+	// start marks the rollout of the Deployment as started, as the fake
+	// client never updates the generation of Deployments
+	var start = func(d *appsv1.Deployment) {
+		current := get(d)
+		current.Status.UpdatedReplicas = 0
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+	}
+
+	// modifyConfigMap changes the ConfigMap shared by the Deployments
+	var modifyConfigMap = func() {
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: cm.GetNamespace(), Name: cm.GetName()}, cm)).To(Succeed())
+		cm.Data["key1"] = "modified"
+		Expect(c.Update(context.TODO(), cm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		app = newDeployment("app", map[string]string{RolloutOrderAnnotation: "10"})
+		worker = newDeployment("worker", map[string]string{RolloutOrderAnnotation: "20"})
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, app, worker,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		Expect(rollsOut(app)).To(BeTrue())
+		complete(app)
+		Expect(rollsOut(worker)).To(BeTrue())
+		complete(worker)
+		modifyConfigMap()
+	})
+
+	It("updates the Deployment with the lower rollout order first", func() {
+		Expect(rollsOut(worker)).To(BeFalse())
+		Expect(rollsOut(app)).To(BeTrue())
+		start(app)
+
+		// The worker waits until the app has rolled out
+		Expect(rollsOut(worker)).To(BeFalse())
+		complete(app)
+		Expect(rollsOut(worker)).To(BeTrue())
+	})
+
+	It("does not wait for a Deployment with a higher rollout order", func() {
+		Expect(rollsOut(app)).To(BeTrue())
+	})
+
+	It("does not wait for Deployments without a rollout order", func() {
+		current := get(app)
+		delete(current.Annotations, RolloutOrderAnnotation)
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+
+		Expect(rollsOut(worker)).To(BeTrue())
+	})
+
+	It("does not wait for Deployments that share no children", func() {
+		current := get(app)
+		current.Spec.Template.Spec.Volumes = nil
+		current.Spec.Template.Spec.InitContainers = nil
+		for i := range current.Spec.Template.Spec.Containers {
+			current.Spec.Template.Spec.Containers[i].Env = nil
+			current.Spec.Template.Spec.Containers[i].EnvFrom = nil
+		}
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+
+		Expect(rollsOut(worker)).To(BeTrue())
+	})
+})
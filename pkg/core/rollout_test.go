@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave rollout Suite", func() {
+	Context("getRolloutProgress", func() {
+		var replicas int32 = 4
+
+		Context("with a Deployment", func() {
+			var deploymentObject *appsv1.Deployment
+
+			BeforeEach(func() {
+				deploymentObject = utils.ExampleDeployment.DeepCopy()
+				deploymentObject.Spec.Replicas = &replicas
+				deploymentObject.SetGeneration(2)
+				deploymentObject.Status.ObservedGeneration = 2
+			})
+
+			It("reports an unobserved rollout as incomplete", func() {
+				deploymentObject.Status.ObservedGeneration = 1
+				Expect(getRolloutProgress(&deployment{deploymentObject}).complete).To(BeFalse())
+			})
+
+			It("reports a rollout with outdated replicas as incomplete", func() {
+				deploymentObject.Status.Replicas = 4
+				deploymentObject.Status.UpdatedReplicas = 2
+				Expect(getRolloutProgress(&deployment{deploymentObject}).complete).To(BeFalse())
+			})
+
+			It("reports a rollout with all replicas updated and available as complete", func() {
+				deploymentObject.Status.Replicas = 4
+				deploymentObject.Status.UpdatedReplicas = 4
+				deploymentObject.Status.AvailableReplicas = 4
+				Expect(getRolloutProgress(&deployment{deploymentObject}).complete).To(BeTrue())
+			})
+		})
+
+		Context("with a StatefulSet", func() {
+			var statefulSetObject *appsv1.StatefulSet
+
+			BeforeEach(func() {
+				statefulSetObject = utils.ExampleStatefulSet.DeepCopy()
+				statefulSetObject.Spec.Replicas = &replicas
+				statefulSetObject.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+					Type: appsv1.RollingUpdateStatefulSetStrategyType,
+				}
+				statefulSetObject.SetGeneration(2)
+				statefulSetObject.Status.ObservedGeneration = 2
+				statefulSetObject.Status.ReadyReplicas = 4
+				statefulSetObject.Status.CurrentRevision = "old"
+				statefulSetObject.Status.UpdateRevision = "new"
+			})
+
+			It("reports a rollout with outdated replicas as incomplete", func() {
+				statefulSetObject.Status.UpdatedReplicas = 2
+				Expect(getRolloutProgress(&statefulset{statefulSetObject}).complete).To(BeFalse())
+			})
+
+			Context("with a partition", func() {
+				BeforeEach(func() {
+					partition := int32(2)
+					statefulSetObject.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{
+						Partition: &partition,
+					}
+				})
+
+				It("reports a rollout with replicas above the partition pending as incomplete", func() {
+					statefulSetObject.Status.UpdatedReplicas = 1
+					progress := getRolloutProgress(&statefulset{statefulSetObject})
+					Expect(progress.complete).To(BeFalse())
+					Expect(progress.partial).To(BeTrue())
+				})
+
+				It("reports a rollout with all replicas above the partition updated as complete", func() {
+					statefulSetObject.Status.UpdatedReplicas = 2
+					progress := getRolloutProgress(&statefulset{statefulSetObject})
+					Expect(progress.complete).To(BeTrue())
+					Expect(progress.partial).To(BeTrue())
+				})
+			})
+
+			It("reports a rollout using the OnDelete strategy as complete", func() {
+				statefulSetObject.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+				Expect(getRolloutProgress(&statefulset{statefulSetObject}).complete).To(BeTrue())
+			})
+		})
+
+		Context("with a DaemonSet", func() {
+			var daemonSetObject *appsv1.DaemonSet
+
+			BeforeEach(func() {
+				maxUnavailable := intstr.FromInt(2)
+				daemonSetObject = utils.ExampleDaemonSet.DeepCopy()
+				daemonSetObject.Spec.UpdateStrategy = appsv1.DaemonSetUpdateStrategy{
+					Type: appsv1.RollingUpdateDaemonSetStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateDaemonSet{
+						MaxUnavailable: &maxUnavailable,
+					},
+				}
+				daemonSetObject.SetGeneration(2)
+				daemonSetObject.Status.ObservedGeneration = 2
+				daemonSetObject.Status.DesiredNumberScheduled = 4
+			})
+
+			It("reports a rollout with outdated pods as incomplete", func() {
+				daemonSetObject.Status.UpdatedNumberScheduled = 2
+				Expect(getRolloutProgress(&daemonset{daemonSetObject}).complete).To(BeFalse())
+			})
+
+			It("reports a rollout with up to maxUnavailable pods unavailable as complete", func() {
+				daemonSetObject.Status.UpdatedNumberScheduled = 4
+				daemonSetObject.Status.NumberAvailable = 2
+				Expect(getRolloutProgress(&daemonset{daemonSetObject}).complete).To(BeTrue())
+			})
+
+			It("reports a rollout with more than maxUnavailable pods unavailable as incomplete", func() {
+				daemonSetObject.Status.UpdatedNumberScheduled = 4
+				daemonSetObject.Status.NumberAvailable = 1
+				Expect(getRolloutProgress(&daemonset{daemonSetObject}).complete).To(BeFalse())
+			})
+		})
+	})
+})
+
+var _ = Describe("Wave rollout completion Suite", func() {
+	var c client.Client
+	var h *Handler
+	var recorder *record.FakeRecorder
+	var s *appsv1.StatefulSet
+
+	// reconcileStatefulSet reconciles the StatefulSet and returns the reasons
+	// of the events it records
+	var reconcileStatefulSet = func() []string {
+		_, err := h.HandleStatefulSet(s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: s.GetNamespace(), Name: s.GetName()}, s)).To(Succeed())
+
+		reasons := []string{}
+		for len(recorder.Events) > 0 {
+			reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+		}
+		return reasons
+	}
+
+	// setUpdatedReplicas records that the StatefulSet controller has updated
+	// the given number of replicas
+	var setUpdatedReplicas = func(updated int32) {
+		s.Status.ObservedGeneration = s.GetGeneration()
+		s.Status.ReadyReplicas = 4
+		s.Status.UpdatedReplicas = updated
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		replicas := int32(4)
+		partition := int32(2)
+		s = utils.ExampleStatefulSet.DeepCopy()
+		s.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		s.Spec.Replicas = &replicas
+		s.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+				Partition: &partition,
+			},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, s,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		recorder = record.NewFakeRecorder(100)
+		h = NewHandler(c, recorder, Options{})
+
+		reasons := reconcileStatefulSet()
+		Expect(reasons).To(ContainElement("ConfigChanged"))
+		Expect(reasons).NotTo(ContainElement("RolloutComplete"))
+	})
+
+	It("does not report a partitioned rollout with replicas above the partition pending", func() {
+		setUpdatedReplicas(1)
+		Expect(reconcileStatefulSet()).To(BeEmpty())
+	})
+
+	It("reports a partitioned rollout once every replica above the partition is updated", func() {
+		setUpdatedReplicas(1)
+		reconcileStatefulSet()
+
+		// The replicas below the partition are deliberately left on the old
+		// revision
+		setUpdatedReplicas(2)
+		Expect(reconcileStatefulSet()).To(ConsistOf("RolloutComplete"))
+		Expect(reconcileStatefulSet()).To(BeEmpty())
+	})
+
+	It("does not report the rollout of a workload Wave did not roll out", func() {
+		h = NewHandler(c, recorder, Options{})
+		setUpdatedReplicas(2)
+		Expect(reconcileStatefulSet()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,209 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// weekdays maps the abbreviated names of the days of the week accepted in a
+// rollout window to their time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// RolloutWindow is the daily window of time within which Wave rolls out
+// configuration changes
+type RolloutWindow struct {
+	value string
+
+	// start and end are the times of day the window opens and closes, as
+	// offsets from midnight. A window ending before it starts closes the
+	// next day, and one ending when it starts lasts the whole day.
+	start time.Duration
+	end   time.Duration
+
+	// days are the days of the week the window opens on, or every day if
+	// empty
+	days map[time.Weekday]bool
+}
+
+// ParseRolloutWindow parses a rollout window given in the form
+// `HH:MM-HH:MM [<days>]`, where the optional days are a comma separated list
+// of days or ranges of days, such as `Mon-Fri` or `Sat,Sun`.
+func ParseRolloutWindow(value string) (*RolloutWindow, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid rollout window %q", value)
+	}
+
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid rollout window %q: expected HH:MM-HH:MM", value)
+	}
+	start, err := parseTimeOfDay(times[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rollout window %q: %v", value, err)
+	}
+	end, err := parseTimeOfDay(times[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rollout window %q: %v", value, err)
+	}
+
+	w := &RolloutWindow{value: value, start: start, end: end}
+	if len(fields) == 2 {
+		w.days, err = parseWeekdays(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rollout window %q: %v", value, err)
+		}
+	}
+	return w, nil
+}
+
+// parseTimeOfDay parses a time of day in the form HH:MM into its offset from
+// midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWeekdays parses a comma separated list of days or ranges of days of
+// the week
+func parseWeekdays(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid days %q", part)
+		}
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[strings.ToLower(bounds[1])]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// String returns the rollout window as it was given
+func (w *RolloutWindow) String() string {
+	return w.value
+}
+
+// untilOpen returns how long remains at the given time until the rollout
+// window next opens, or zero if it is open.
+func (w *RolloutWindow) untilOpen(now time.Time) time.Duration {
+	length := w.end - w.start
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+
+	// Windows that opened the day before may still be open, and the next
+	// window opens within a week
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var next time.Duration
+	for i := -1; i <= 7; i++ {
+		day := midnight.AddDate(0, 0, i)
+		if len(w.days) > 0 && !w.days[day.Weekday()] {
+			continue
+		}
+		opens := day.Add(w.start)
+		if !now.Before(opens) && now.Before(opens.Add(length)) {
+			return 0
+		}
+		if opens.After(now) && (next == 0 || opens.Sub(now) < next) {
+			next = opens.Sub(now)
+		}
+	}
+	return next
+}
+
+// rolloutWindowRemaining returns how long rollouts must be deferred until the
+// rollout window opens, or zero if they may roll out now.
+func (h *Handler) rolloutWindowRemaining() time.Duration {
+	if h.opts.RolloutWindow == nil {
+		return 0
+	}
+	return h.opts.RolloutWindow.untilOpen(h.now())
+}
+
+// recordPendingConfigHash records the configuration hash held back until the
+// rollout window opens on the instance, leaving its PodTemplate untouched, and
+// reports that its rollout has been deferred
+func (h *Handler) recordPendingConfigHash(obj podController, hash string, remaining time.Duration) error {
+	if obj.GetAnnotations()[PendingConfigHashAnnotation] == hash {
+		h.reportDeferred(obj, hash, "Rollout deferred until the rollout window opens")
+		return nil
+	}
+
+	drift := h.getConfigDrift(obj, hash)
+	copy := obj.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[PendingConfigHashAnnotation] = hash
+	copy.SetAnnotations(annotations)
+	setConfigDrift(copy, drift)
+	setStatus(copy, StatusSynced, "Rollout deferred until the rollout window opens")
+	setStatusReason(copy, ReasonRolloutDeferred)
+
+	h.recorder.Eventf(copy.GetObject(), corev1.EventTypeNormal, "RolloutDeferred", "Holding rollout of configuration hash %s for %s until the rollout window %s opens", hash, remaining, h.opts.RolloutWindow)
+	err := h.Update(context.TODO(), copy.GetObject())
+	if err != nil {
+		return fmt.Errorf("error updating instance %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	reportConfigDrift(obj, drift)
+	return nil
+}
+
+// clearPendingConfigHash removes the configuration hash held back until the
+// rollout window opens from the metadata of the instance
+func clearPendingConfigHash(obj podController) {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[PendingConfigHashAnnotation]; !ok {
+		return
+	}
+	delete(annotations, PendingConfigHashAnnotation)
+	obj.SetAnnotations(annotations)
+}
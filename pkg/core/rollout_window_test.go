@@ -0,0 +1,238 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave rollout window Suite", func() {
+	// Monday 1st January 2018
+	monday := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	Context("ParseRolloutWindow", func() {
+		It("parses a daily window", func() {
+			w, err := ParseRolloutWindow("22:00-06:30")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.start).To(Equal(22 * time.Hour))
+			Expect(w.end).To(Equal(6*time.Hour + 30*time.Minute))
+			Expect(w.days).To(BeEmpty())
+			Expect(w.String()).To(Equal("22:00-06:30"))
+		})
+
+		It("parses days and ranges of days", func() {
+			w, err := ParseRolloutWindow("09:00-17:00 Mon-Wed,sat")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.days).To(Equal(map[time.Weekday]bool{
+				time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Saturday: true,
+			}))
+		})
+
+		It("parses ranges of days wrapping around the week", func() {
+			w, err := ParseRolloutWindow("09:00-17:00 Fri-Mon")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.days).To(Equal(map[time.Weekday]bool{
+				time.Friday: true, time.Saturday: true, time.Sunday: true, time.Monday: true,
+			}))
+		})
+
+		for _, value := range []string{
+			"",
+			"22:00",
+			"25:00-06:00",
+			"22:00-06:00 Mon-Funday",
+			"22:00-06:00 Mon-Tue-Wed",
+			"22:00-06:00 Mon Tue",
+		} {
+			value := value
+			It("rejects the invalid window "+strconv.Quote(value), func() {
+				_, err := ParseRolloutWindow(value)
+				Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+
+	Context("untilOpen", func() {
+		friday := monday.AddDate(0, 0, 4)
+		saturday := monday.AddDate(0, 0, 5)
+		cases := []struct {
+			description string
+			window      string
+			now         time.Time
+			expected    time.Duration
+		}{
+			{"inside a daily window", "09:00-17:00", monday.Add(12 * time.Hour), 0},
+			{"when a daily window opens", "09:00-17:00", monday.Add(9 * time.Hour), 0},
+			{"before a daily window", "09:00-17:00", monday.Add(8 * time.Hour), time.Hour},
+			{"when a daily window closes", "09:00-17:00", monday.Add(17 * time.Hour), 16 * time.Hour},
+			{"inside an overnight window before midnight", "22:00-06:00", monday.Add(23 * time.Hour), 0},
+			{"inside an overnight window after midnight", "22:00-06:00", monday.Add(5 * time.Hour), 0},
+			{"outside an overnight window", "22:00-06:00", monday.Add(12 * time.Hour), 10 * time.Hour},
+			{"inside a whole day window", "00:00-00:00 Mon", monday.Add(23 * time.Hour), 0},
+			{"after the last day of a window", "09:00-17:00 Mon-Fri", saturday.Add(12 * time.Hour), 45 * time.Hour},
+			{"inside an overnight window opened the day before", "22:00-06:00 Fri", saturday.Add(2 * time.Hour), 0},
+			{"after an overnight window of a day not listed", "22:00-06:00 Fri", friday.Add(2 * time.Hour), 20 * time.Hour},
+		}
+		for _, tc := range cases {
+			tc := tc
+			It("returns "+tc.expected.String()+" "+tc.description, func() {
+				w, err := ParseRolloutWindow(tc.window)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(w.untilOpen(tc.now)).To(Equal(tc.expected))
+			})
+		}
+	})
+
+	Context("HandleDeployment", func() {
+		var c client.Client
+		var h *Handler
+		var d *appsv1.Deployment
+		var cm *corev1.ConfigMap
+		var recorder *record.FakeRecorder
+		var now time.Time
+
+		// handle reconciles the current state of the Deployment at the given
+		// time and returns the requested requeue delay
+		var handle = func(at time.Time) time.Duration {
+			now = at
+			fetched := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, fetched)).To(Succeed())
+			result, err := h.HandleDeployment(fetched)
+			Expect(err).NotTo(HaveOccurred())
+
+			d = &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: fetched.GetNamespace(), Name: fetched.GetName()}, d)).To(Succeed())
+			return result.RequeueAfter
+		}
+
+		// expectedHash returns the configuration hash of the current state of
+		// the Deployment's children
+		var expectedHash = func() string {
+			current, err := h.getCurrentChildren(&deployment{d})
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := calculateConfigHash(current)
+			Expect(err).NotTo(HaveOccurred())
+			return hash
+		}
+
+		// events counts the events recorded so far with the given reason
+		var events = func(reason string) int {
+			count := 0
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, reason) {
+					count++
+				}
+			}
+			return count
+		}
+
+		BeforeEach(func() {
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			cm = utils.ExampleConfigMap1.DeepCopy()
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm,
+				utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			window, err := ParseRolloutWindow("22:00-06:00")
+			Expect(err).NotTo(HaveOccurred())
+			recorder = record.NewFakeRecorder(100)
+			h = NewHandler(c, recorder, Options{RolloutWindow: window})
+			h.now = func() time.Time { return now }
+
+			// Roll out the initial configuration within the window
+			Expect(handle(monday.Add(23 * time.Hour))).To(BeZero())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+			Expect(events("ConfigChanged")).To(Equal(1))
+		})
+
+		It("rolls out changes inside the window immediately", func() {
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+			Expect(handle(monday.Add(25 * time.Hour))).To(BeZero())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+			Expect(d.GetAnnotations()).NotTo(HaveKey(PendingConfigHashAnnotation))
+			Expect(events("ConfigChanged")).To(Equal(1))
+		})
+
+		It("defers changes outside the window until it opens", func() {
+			applied := d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+
+			// Tuesday at noon, ten hours before the window opens
+			Expect(handle(monday.Add(36 * time.Hour))).To(Equal(10 * time.Hour))
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, applied))
+			Expect(d.GetAnnotations()).To(HaveKeyWithValue(PendingConfigHashAnnotation, expectedHash()))
+			Expect(d.GetAnnotations()).To(HaveKeyWithValue(StatusMessageAnnotation, "Rollout deferred until the rollout window opens"))
+			Expect(events("RolloutDeferred")).To(Equal(1))
+
+			Expect(handle(monday.Add(40 * time.Hour))).To(Equal(6 * time.Hour))
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, applied))
+			Expect(events("RolloutDeferred")).To(BeZero())
+
+			Expect(handle(monday.Add(46 * time.Hour))).To(BeZero())
+			Expect(d.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expectedHash()))
+			Expect(d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]).NotTo(Equal(applied))
+			Expect(d.GetAnnotations()).NotTo(HaveKey(PendingConfigHashAnnotation))
+			Expect(d.GetAnnotations()).NotTo(HaveKey(StatusMessageAnnotation))
+			Expect(events("ConfigChanged")).To(Equal(1))
+		})
+
+		It("updates the pending hash with further changes outside the window", func() {
+			cm.Data["key1"] = "first"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			handle(monday.Add(36 * time.Hour))
+			first := d.GetAnnotations()[PendingConfigHashAnnotation]
+
+			cm.Data["key1"] = "second"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			Expect(handle(monday.Add(37 * time.Hour))).To(Equal(9 * time.Hour))
+			Expect(d.GetAnnotations()).To(HaveKeyWithValue(PendingConfigHashAnnotation, expectedHash()))
+			Expect(d.GetAnnotations()[PendingConfigHashAnnotation]).NotTo(Equal(first))
+		})
+
+		It("removes the pending hash when the configuration is reverted", func() {
+			original := cm.Data["key1"]
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			handle(monday.Add(36 * time.Hour))
+			Expect(d.GetAnnotations()).To(HaveKey(PendingConfigHashAnnotation))
+
+			cm.Data["key1"] = original
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			Expect(handle(monday.Add(37 * time.Hour))).To(BeZero())
+			Expect(d.GetAnnotations()).NotTo(HaveKey(PendingConfigHashAnnotation))
+			Expect(events("ConfigChanged")).To(BeZero())
+		})
+	})
+})
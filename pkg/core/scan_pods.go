@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// serviceAccountMountPath is where the credentials of a Pod's service
+	// account are mounted. The volumes mounted there are injected into every
+	// Pod by the API server and are never tracked.
+	serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// deploymentRevisionAnnotation is the annotation on Deployments and their
+	// ReplicaSets recording the revision of the Deployment each ReplicaSet
+	// runs
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+	// daemonSetTemplateGenerationLabel is the label on the Pods of a
+	// DaemonSet recording the generation of the DaemonSet's PodTemplate
+	// they were created from
+	daemonSetTemplateGenerationLabel = "pod-template-generation"
+)
+
+// renderedPodController wraps a podController, replacing its PodTemplate with
+// the template rendered from its Pods
+type renderedPodController struct {
+	podController
+	template *corev1.PodTemplateSpec
+}
+
+// GetPodTemplate returns the rendered PodTemplate
+func (r *renderedPodController) GetPodTemplate() *corev1.PodTemplateSpec {
+	return r.template
+}
+
+// scansPods returns true if the ScanPodsAnnotation is set on the given
+// podController and it has a selector for its Pods
+func scansPods(obj podController) bool {
+	return obj.GetAnnotations()[ScanPodsAnnotation] == requiredAnnotationValue && getPodSelector(obj) != nil
+}
+
+// getRenderedPodController returns the podController with its PodTemplate
+// rendered as its Pods effectively run it, if it scans its Pods, or the
+// podController itself otherwise.
+// Only the Pods of the current revision of the podController that are not
+// being deleted are scanned, so that containers injected into the Pods of an
+// earlier revision are not tracked once they have been replaced.
+func (h *Handler) getRenderedPodController(obj podController) (podController, error) {
+	if !scansPods(obj) {
+		return obj, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(getPodSelector(obj))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing selector: %v", err)
+	}
+	pods := &corev1.PodList{}
+	err = h.List(context.TODO(), pods, client.InNamespace(obj.GetNamespace()), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+	revisionKey, revision, err := h.getCurrentRevisionLabel(obj, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	current := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if revision != "" && pod.GetLabels()[revisionKey] != revision {
+			continue
+		}
+		current = append(current, pod)
+	}
+	return &renderedPodController{podController: obj, template: renderPodTemplate(obj.GetPodTemplate(), current)}, nil
+}
+
+// getCurrentRevisionLabel returns the key and value of the label carried by
+// the Pods of the current revision of the podController, or an empty value if
+// its current revision is not known, such as for a Deployment whose
+// ReplicaSets have not yet been created.
+// The current revision of a Deployment is found from the ReplicaSet of its
+// current revision, of a StatefulSet from its update revision and of a
+// DaemonSet from the generation of its PodTemplate.
+func (h *Handler) getCurrentRevisionLabel(obj podController, selector labels.Selector) (string, string, error) {
+	switch o := obj.(type) {
+	case *deployment:
+		hash, err := h.getCurrentPodTemplateHash(o, selector)
+		return appsv1.DefaultDeploymentUniqueLabelKey, hash, err
+	case *statefulset:
+		return appsv1.ControllerRevisionHashLabelKey, o.Status.UpdateRevision, nil
+	case *daemonset:
+		return daemonSetTemplateGenerationLabel, o.GetAnnotations()[appsv1.DeprecatedTemplateGeneration], nil
+	default:
+		return "", "", nil
+	}
+}
+
+// getCurrentPodTemplateHash returns the pod-template-hash of the ReplicaSet
+// controlled by the Deployment that runs its current revision, or if the
+// Deployment does not record its revision, of its latest revision
+func (h *Handler) getCurrentPodTemplateHash(d *deployment, selector labels.Selector) (string, error) {
+	replicaSets := &appsv1.ReplicaSetList{}
+	err := h.List(context.TODO(), replicaSets, client.InNamespace(d.GetNamespace()), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", fmt.Errorf("error listing replicasets: %v", err)
+	}
+
+	revision, hasRevision := d.GetAnnotations()[deploymentRevisionAnnotation]
+	hash := ""
+	latest := int64(-1)
+	for _, rs := range replicaSets.Items {
+		if owner := metav1.GetControllerOf(&rs); owner == nil || owner.UID != d.GetUID() {
+			continue
+		}
+		rsRevision := rs.GetAnnotations()[deploymentRevisionAnnotation]
+		if hasRevision {
+			if rsRevision == revision {
+				return rs.GetLabels()[appsv1.DefaultDeploymentUniqueLabelKey], nil
+			}
+			continue
+		}
+		if n, err := strconv.ParseInt(rsRevision, 10, 64); err == nil && n > latest {
+			latest = n
+			hash = rs.GetLabels()[appsv1.DefaultDeploymentUniqueLabelKey]
+		}
+	}
+	return hash, nil
+}
+
+// renderPodTemplate returns a copy of the PodTemplate with the containers,
+// init containers and volumes of the Pods that the template does not define
+// added to it, such as sidecars injected by mutating webhooks when the Pods
+// were created. Containers and volumes defined by the template are kept as
+// they are, so that only injected references are added. The service account
+// volumes the API server adds to every Pod are not added.
+func renderPodTemplate(template *corev1.PodTemplateSpec, pods []corev1.Pod) *corev1.PodTemplateSpec {
+	rendered := template.DeepCopy()
+	containers := make(map[string]struct{})
+	for _, container := range rendered.Spec.Containers {
+		containers[container.Name] = struct{}{}
+	}
+	initContainers := make(map[string]struct{})
+	for _, container := range rendered.Spec.InitContainers {
+		initContainers[container.Name] = struct{}{}
+	}
+	volumes := make(map[string]struct{})
+	for _, vol := range rendered.Spec.Volumes {
+		volumes[vol.Name] = struct{}{}
+	}
+
+	for _, pod := range pods {
+		serviceAccountVolumes := getServiceAccountVolumes(pod)
+		for _, container := range pod.Spec.Containers {
+			if _, ok := containers[container.Name]; !ok {
+				containers[container.Name] = struct{}{}
+				rendered.Spec.Containers = append(rendered.Spec.Containers, container)
+			}
+		}
+		for _, container := range pod.Spec.InitContainers {
+			if _, ok := initContainers[container.Name]; !ok {
+				initContainers[container.Name] = struct{}{}
+				rendered.Spec.InitContainers = append(rendered.Spec.InitContainers, container)
+			}
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if _, ok := serviceAccountVolumes[vol.Name]; ok {
+				continue
+			}
+			if _, ok := volumes[vol.Name]; !ok {
+				volumes[vol.Name] = struct{}{}
+				rendered.Spec.Volumes = append(rendered.Spec.Volumes, vol)
+			}
+		}
+	}
+	return rendered
+}
+
+// getServiceAccountVolumes returns the names of the volumes mounted at the
+// service account mount path by any container of the Pod
+func getServiceAccountVolumes(pod corev1.Pod) map[string]struct{} {
+	names := make(map[string]struct{})
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath == serviceAccountMountPath {
+				names[mount.Name] = struct{}{}
+			}
+		}
+	}
+	return names
+}
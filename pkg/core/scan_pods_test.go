@@ -0,0 +1,210 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave scan pods Suite", func() {
+	var d *appsv1.Deployment
+	var pod *corev1.Pod
+	var sidecarConfig *corev1.ConfigMap
+	var c client.Client
+	var h *Handler
+
+	// getChildNames returns the kind and name of each current child of the
+	// Deployment
+	var getChildNames = func() []string {
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, child := range children {
+			names = append(names, kindOf(child.object)+"/"+child.object.GetName())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetUID("example-deployment")
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation: requiredAnnotationValue,
+			ScanPodsAnnotation: requiredAnnotationValue,
+		})
+
+		sidecarConfig = utils.ExampleConfigMap1.DeepCopy()
+		sidecarConfig.SetName("sidecar-config")
+
+		// A Pod of the Deployment with a sidecar injected by a webhook
+		// alongside the service account volume injected by the API server
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-pod",
+				Namespace: d.GetNamespace(),
+				Labels:    map[string]string{},
+			},
+			Spec: *d.Spec.Template.Spec.DeepCopy(),
+		}
+		for key, value := range d.Spec.Selector.MatchLabels {
+			pod.Labels[key] = value
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+			Name:  "sidecar",
+			Image: "sidecar",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: sidecarConfig.GetName()}}},
+			},
+		})
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "default-token",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "default-token"},
+			},
+		})
+		for i := range pod.Spec.Containers {
+			pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts, corev1.VolumeMount{
+				Name:      "default-token",
+				MountPath: serviceAccountMountPath,
+			})
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, pod, sidecarConfig,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("tracks the children referenced by containers injected into the Pods", func() {
+		Expect(getChildNames()).To(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+	})
+
+	It("does not track the service account volume of the Pods", func() {
+		Expect(getChildNames()).NotTo(ContainElement("Secret/default-token"))
+	})
+
+	It("only tracks the children of the PodTemplate without the annotation", func() {
+		delete(d.GetAnnotations(), ScanPodsAnnotation)
+		Expect(getChildNames()).NotTo(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+	})
+
+	It("ignores Pods that the Deployment does not select", func() {
+		d.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+		Expect(getChildNames()).NotTo(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+	})
+
+	It("ignores Pods that are being deleted", func() {
+		now := metav1.Now()
+		pod.SetDeletionTimestamp(&now)
+		Expect(c.Update(context.TODO(), pod)).To(Succeed())
+		Expect(getChildNames()).NotTo(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+	})
+
+	Context("with ReplicaSets of several revisions", func() {
+		// createReplicaSet creates a ReplicaSet controlled by the Deployment
+		// running the given revision with the given pod-template-hash
+		var createReplicaSet = func(revision, hash string) {
+			rs := &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        d.GetName() + "-" + hash,
+					Namespace:   d.GetNamespace(),
+					Labels:      map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: hash},
+					Annotations: map[string]string{deploymentRevisionAnnotation: revision},
+				},
+			}
+			for key, value := range d.Spec.Selector.MatchLabels {
+				rs.Labels[key] = value
+			}
+			controller := true
+			rs.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: d.GetName(), UID: d.GetUID(), Controller: &controller}})
+			Expect(c.Create(context.TODO(), rs)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			createReplicaSet("1", "old")
+			createReplicaSet("2", "new")
+		})
+
+		It("tracks the children of the Pods of the current revision", func() {
+			d.GetAnnotations()[deploymentRevisionAnnotation] = "2"
+			pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = "new"
+			Expect(c.Update(context.TODO(), pod)).To(Succeed())
+			Expect(getChildNames()).To(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+		})
+
+		It("ignores the Pods of earlier revisions", func() {
+			d.GetAnnotations()[deploymentRevisionAnnotation] = "2"
+			pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = "old"
+			Expect(c.Update(context.TODO(), pod)).To(Succeed())
+			Expect(getChildNames()).NotTo(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+		})
+
+		It("uses the latest revision when the Deployment does not record its revision", func() {
+			pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = "old"
+			Expect(c.Update(context.TODO(), pod)).To(Succeed())
+			Expect(getChildNames()).NotTo(ContainElement("ConfigMap/" + sidecarConfig.GetName()))
+		})
+	})
+
+	Context("getCurrentRevisionLabel", func() {
+		It("uses the update revision of a StatefulSet", func() {
+			s := utils.ExampleStatefulSet.DeepCopy()
+			s.Status.UpdateRevision = "example-2"
+			key, value, err := h.getCurrentRevisionLabel(&statefulset{s}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal(appsv1.ControllerRevisionHashLabelKey))
+			Expect(value).To(Equal("example-2"))
+		})
+
+		It("uses the PodTemplate generation of a DaemonSet", func() {
+			ds := utils.ExampleDaemonSet.DeepCopy()
+			ds.SetAnnotations(map[string]string{appsv1.DeprecatedTemplateGeneration: "3"})
+			key, value, err := h.getCurrentRevisionLabel(&daemonset{ds}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal(daemonSetTemplateGenerationLabel))
+			Expect(value).To(Equal("3"))
+		})
+	})
+
+	Context("renderPodTemplate", func() {
+		It("keeps the containers and volumes defined by the template", func() {
+			pod.Spec.Containers[0].Image = "changed"
+			rendered := renderPodTemplate(&d.Spec.Template, []corev1.Pod{*pod})
+			Expect(rendered.Spec.Containers[0]).To(Equal(d.Spec.Template.Spec.Containers[0]))
+			Expect(rendered.Spec.Containers).To(HaveLen(len(d.Spec.Template.Spec.Containers) + 1))
+			Expect(rendered.Spec.Volumes).To(Equal(d.Spec.Template.Spec.Volumes))
+		})
+
+		It("does not modify the template", func() {
+			original := d.Spec.Template.DeepCopy()
+			renderPodTemplate(&d.Spec.Template, []corev1.Pod{*pod})
+			Expect(d.Spec.Template).To(Equal(*original))
+		})
+	})
+})
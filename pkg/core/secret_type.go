@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultSecretTypeAllowlist is the default list of the types of Secrets
+// tracked by the controller. Other types, such as service account tokens,
+// rotate on their own schedule and would otherwise cause unexpected rollouts.
+// Image pull Secrets are included so that rotated registry credentials are
+// picked up by new Pods.
+var DefaultSecretTypeAllowlist = []string{
+	string(corev1.SecretTypeOpaque),
+	string(corev1.SecretTypeTLS),
+	string(corev1.SecretTypeDockerConfigJson),
+}
+
+// DefaultSecretTypeKeys is the default list of the only data keys of Secrets
+// of each type that take part in the configuration hash. Other keys are often
+// added or refreshed alongside them, such as a CA bundle stored next to a
+// certificate, and would otherwise cause unexpected rollouts.
+var DefaultSecretTypeKeys = map[string][]string{
+	string(corev1.SecretTypeTLS):              {corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+	string(corev1.SecretTypeDockerConfigJson): {corev1.DockerConfigJsonKey},
+	string(corev1.SecretTypeDockercfg):        {corev1.DockerConfigKey},
+	string(corev1.SecretTypeBasicAuth):        {corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey},
+	string(corev1.SecretTypeSSHAuth):          {corev1.SSHAuthPrivateKey},
+}
+
+// isTrackedChild returns false if the child is a Secret whose type is not in
+// the SecretTypeAllowlist. Secrets without a type are treated as Opaque, as
+// they are by the API server.
+func (h *Handler) isTrackedChild(obj Object) bool {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || len(h.opts.SecretTypeAllowlist) == 0 {
+		return true
+	}
+
+	secretType := secret.Type
+	if secretType == "" {
+		secretType = corev1.SecretTypeOpaque
+	}
+	for _, allowed := range h.opts.SecretTypeAllowlist {
+		if corev1.SecretType(allowed) == secretType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSecretTypeKeys parses the keys of Secret types, each given in the form
+// `<type>=<key>[:<key>...]`, into the Options.SecretTypeKeys. A type given
+// with no keys has every key hashed.
+func ParseSecretTypeKeys(values []string) (map[string][]string, error) {
+	typeKeys := make(map[string][]string)
+	for _, value := range values {
+		parts := strings.SplitN(strings.TrimSpace(value), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid secret type keys %q", value)
+		}
+		keys := []string{}
+		for _, key := range strings.Split(parts[1], ":") {
+			key = strings.TrimSpace(key)
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+		typeKeys[parts[0]] = keys
+	}
+	return typeKeys, nil
+}
+
+// getSecretTypeKeys returns the set of keys hashed for the child because of
+// its type, which is empty if every key is hashed. It returns nil, using the
+// DefaultSecretTypeKeys, if the child is not a Secret or the SecretTypeKeys
+// are not configured.
+func (h *Handler) getSecretTypeKeys(obj Object) map[string]struct{} {
+	s, ok := obj.(*corev1.Secret)
+	if !ok || h.opts.SecretTypeKeys == nil {
+		return nil
+	}
+	return secretTypeKeys(h.opts.SecretTypeKeys, s)
+}
+
+// secretTypeKeys returns the set of keys listed for the type of the Secret.
+// Secrets without a type are treated as Opaque.
+func secretTypeKeys(typeKeys map[string][]string, s *corev1.Secret) map[string]struct{} {
+	secretType := s.Type
+	if secretType == "" {
+		secretType = corev1.SecretTypeOpaque
+	}
+	keys := make(map[string]struct{})
+	for _, key := range typeKeys[string(secretType)] {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave secret type keys Suite", func() {
+	var s *corev1.Secret
+
+	// hashSecret returns the configuration hash of the Secret with the
+	// default keys of its type
+	var hashSecret = func() string {
+		hash, err := calculateConfigHash([]configObject{{object: s, allKeys: true}})
+		Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+
+	BeforeEach(func() {
+		s = utils.ExampleSecret1.DeepCopy()
+		s.SetAnnotations(map[string]string{})
+	})
+
+	for _, tc := range []struct {
+		secretType corev1.SecretType
+		keys       []string
+	}{
+		{corev1.SecretTypeTLS, []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}},
+		{corev1.SecretTypeDockerConfigJson, []string{corev1.DockerConfigJsonKey}},
+		{corev1.SecretTypeDockercfg, []string{corev1.DockerConfigKey}},
+		{corev1.SecretTypeBasicAuth, []string{corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey}},
+		{corev1.SecretTypeSSHAuth, []string{corev1.SSHAuthPrivateKey}},
+	} {
+		tc := tc
+
+		Context("with a "+string(tc.secretType)+" Secret", func() {
+			BeforeEach(func() {
+				s.Type = tc.secretType
+				s.Data = map[string][]byte{"added": []byte("added")}
+				for _, key := range tc.keys {
+					s.Data[key] = []byte(key)
+				}
+			})
+
+			It("returns the same hash when an unrelated key is changed", func() {
+				h1 := hashSecret()
+				s.Data["added"] = []byte("rotated")
+				Expect(hashSecret()).To(Equal(h1))
+			})
+
+			It("returns the same hash when an unrelated key is added", func() {
+				h1 := hashSecret()
+				s.Data["other"] = []byte("other")
+				Expect(hashSecret()).To(Equal(h1))
+			})
+
+			for _, key := range tc.keys {
+				key := key
+
+				It("returns a different hash when "+key+" is changed", func() {
+					h1 := hashSecret()
+					s.Data[key] = []byte("rotated")
+					Expect(hashSecret()).NotTo(Equal(h1))
+				})
+			}
+		})
+	}
+
+	It("returns a different hash when any key of an Opaque Secret is changed", func() {
+		s.Type = corev1.SecretTypeOpaque
+		s.Data = map[string][]byte{"added": []byte("added")}
+		h1 := hashSecret()
+		s.Data["added"] = []byte("rotated")
+		Expect(hashSecret()).NotTo(Equal(h1))
+	})
+
+	Context("with SecretTypeKeys configured", func() {
+		var d *appsv1.Deployment
+
+		// hashWith returns the configuration hash of the Deployment's
+		// children for a Handler with the given Secret type keys
+		var hashWith = func(typeKeys map[string][]string) string {
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, d, s)
+			h := NewHandler(c, record.NewFakeRecorder(100), Options{SecretTypeKeys: typeKeys})
+			children, err := h.getCurrentChildren(&deployment{d})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).To(HaveLen(1))
+			hash, err := calculateConfigHash(children)
+			Expect(err).NotTo(HaveOccurred())
+			return hash
+		}
+
+		BeforeEach(func() {
+			s.Type = corev1.SecretTypeBasicAuth
+			s.Data = map[string][]byte{
+				corev1.BasicAuthUsernameKey: []byte("user"),
+				corev1.BasicAuthPasswordKey: []byte("secret"),
+			}
+
+			d = utils.ExampleDeployment.DeepCopy()
+			d.Spec.Template.Spec.InitContainers = nil
+			d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+			d.Spec.Template.Spec.Volumes = []corev1.Volume{{
+				Name: s.GetName(),
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: s.GetName()},
+				},
+			}}
+		})
+
+		It("uses the default keys when unset", func() {
+			h1 := hashWith(nil)
+			s.Data["added"] = []byte("added")
+			Expect(hashWith(nil)).To(Equal(h1))
+		})
+
+		It("only hashes the configured keys of the type", func() {
+			typeKeys := map[string][]string{string(corev1.SecretTypeBasicAuth): {corev1.BasicAuthPasswordKey}}
+			h1 := hashWith(typeKeys)
+			s.Data[corev1.BasicAuthUsernameKey] = []byte("renamed")
+			Expect(hashWith(typeKeys)).To(Equal(h1))
+			s.Data[corev1.BasicAuthPasswordKey] = []byte("rotated")
+			Expect(hashWith(typeKeys)).NotTo(Equal(h1))
+		})
+
+		It("hashes every key of types that are not listed", func() {
+			typeKeys := map[string][]string{}
+			h1 := hashWith(typeKeys)
+			s.Data["added"] = []byte("added")
+			Expect(hashWith(typeKeys)).NotTo(Equal(h1))
+		})
+
+		It("lets the required keys annotation take precedence", func() {
+			s.SetAnnotations(map[string]string{RequiredKeysAnnotation: "added"})
+			s.Data["added"] = []byte("added")
+			h1 := hashWith(nil)
+			s.Data["added"] = []byte("rotated")
+			Expect(hashWith(nil)).NotTo(Equal(h1))
+		})
+	})
+
+	Context("ParseSecretTypeKeys", func() {
+		It("parses the keys of each type", func() {
+			typeKeys, err := ParseSecretTypeKeys([]string{"kubernetes.io/tls=tls.crt:tls.key", "kubernetes.io/basic-auth=password"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(typeKeys).To(Equal(map[string][]string{
+				"kubernetes.io/tls":        {"tls.crt", "tls.key"},
+				"kubernetes.io/basic-auth": {"password"},
+			}))
+		})
+
+		It("parses a type without keys", func() {
+			typeKeys, err := ParseSecretTypeKeys([]string{"kubernetes.io/tls="})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(typeKeys).To(Equal(map[string][]string{"kubernetes.io/tls": {}}))
+		})
+
+		It("rejects an entry without a type", func() {
+			_, err := ParseSecretTypeKeys([]string{"tls.crt:tls.key"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave secret type allowlist Suite", func() {
+	var d *appsv1.Deployment
+	var opaque *corev1.Secret
+	var token *corev1.Secret
+
+	// getChildNames returns the kind and name of each current child of the
+	// Deployment for a Handler with the given allowlist
+	var getChildNames = func(allowlist []string) []string {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, d, opaque, token)
+		h := NewHandler(c, record.NewFakeRecorder(100), Options{SecretTypeAllowlist: allowlist})
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, child := range children {
+			names = append(names, kindOf(child.object)+"/"+child.object.GetName())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		opaque = utils.ExampleSecret1.DeepCopy()
+		opaque.Type = corev1.SecretTypeOpaque
+		token = utils.ExampleSecret2.DeepCopy()
+		token.Type = corev1.SecretTypeServiceAccountToken
+
+		d = utils.ExampleDeployment.DeepCopy()
+		d.Spec.Template.Spec.InitContainers = nil
+		d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+		d.Spec.Template.Spec.Volumes = nil
+		for _, s := range []*corev1.Secret{opaque, token} {
+			d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: s.GetName(),
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: s.GetName()},
+				},
+			})
+		}
+	})
+
+	It("includes Opaque Secrets and excludes service account tokens with the default allowlist", func() {
+		Expect(getChildNames(DefaultSecretTypeAllowlist)).To(ConsistOf("Secret/" + opaque.GetName()))
+	})
+
+	It("includes image pull Secrets with the default allowlist", func() {
+		opaque.Type = corev1.SecretTypeDockerConfigJson
+		Expect(getChildNames(DefaultSecretTypeAllowlist)).To(ConsistOf("Secret/" + opaque.GetName()))
+	})
+
+	It("treats Secrets without a type as Opaque", func() {
+		opaque.Type = ""
+		Expect(getChildNames(DefaultSecretTypeAllowlist)).To(ConsistOf("Secret/" + opaque.GetName()))
+	})
+
+	It("includes Secrets of every type without an allowlist", func() {
+		Expect(getChildNames(nil)).To(ConsistOf("Secret/"+opaque.GetName(), "Secret/"+token.GetName()))
+	})
+})
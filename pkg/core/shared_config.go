@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// sharedChildKey returns the key that a child in the shared config namespace
+// is tracked under by the workloads listing it as an extra child
+func sharedChildKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// splitChildKey returns the namespace and name of the child tracked under the
+// given key by the podController
+func splitChildKey(obj podController, key string) (string, string) {
+	if parts := strings.SplitN(key, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return obj.GetNamespace(), key
+}
+
+// NewSharedChildHandler returns an EventHandler for ConfigMaps and Secrets
+// that, when a child in the given shared config namespace changes, enqueues
+// every workload of the given list type in another namespace that lists it in
+// its extra children annotations. Workloads in other namespaces never own the
+// child, so no owner based or indexed watch fires for it.
+// Workloads are enabled as described by isEnabled with the given selector and
+// default.
+func NewSharedChildHandler(c client.Reader, list runtime.Object, shared string, selector labels.Selector, defaultEnabled bool) handler.EventHandler {
+	enqueue := func(obj runtime.Object, child metav1.Object, q workqueue.RateLimitingInterface) {
+		for _, req := range getSharedChildRequests(c, list.DeepCopyObject(), shared, selector, defaultEnabled, obj, child) {
+			q.Add(req)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+		UpdateFunc: func(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.ObjectNew, evt.MetaNew, q)
+		},
+		DeleteFunc: func(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+		GenericFunc: func(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+			enqueue(evt.Object, evt.Meta, q)
+		},
+	}
+}
+
+// getSharedChildRequests returns a request for each workload of the list type
+// outside the shared config namespace that lists the child as an extra child,
+// if the child is in the shared config namespace
+func getSharedChildRequests(c client.Reader, list runtime.Object, shared string, selector labels.Selector, defaultEnabled bool, obj runtime.Object, child metav1.Object) []reconcile.Request {
+	if child == nil || shared == "" || child.GetNamespace() != shared {
+		return nil
+	}
+
+	err := c.List(context.TODO(), list)
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "error listing workloads for shared child", "namespace", child.GetNamespace(), "name", child.GetName())
+		return nil
+	}
+
+	key := sharedChildKey(shared, child.GetName())
+	requests := []reconcile.Request{}
+	for _, instance := range podControllersFromList(list) {
+		if instance.GetNamespace() == shared || !isEnabled(instance, selector, defaultEnabled) || toBeDeleted(instance) {
+			continue
+		}
+		configMaps := make(map[string]configMetadata)
+		secrets := make(map[string]configMetadata)
+		_ = addExtraChildren(instance, shared, configMaps, secrets)
+
+		var ok bool
+		switch obj.(type) {
+		case *corev1.ConfigMap:
+			_, ok = configMaps[key]
+		case *corev1.Secret:
+			_, ok = secrets[key]
+		}
+		if ok {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()},
+			})
+		}
+	}
+	return requests
+}
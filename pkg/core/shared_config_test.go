@@ -0,0 +1,194 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave shared config namespace Suite", func() {
+	const namespace = "config"
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+	var shared *corev1.ConfigMap
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{
+			RequiredAnnotation:        requiredAnnotationValue,
+			ExtraConfigMapsAnnotation: namespace + "/shared-settings",
+		})
+
+		shared = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "shared-settings"},
+			Data:       map[string]string{"region": "eu-west-1"},
+		}
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d, shared,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{SharedConfigNamespace: namespace})
+	})
+
+	It("adds children in the shared config namespace under their namespaced key", func() {
+		configMaps := make(map[string]configMetadata)
+		secrets := make(map[string]configMetadata)
+		Expect(addExtraChildren(&deployment{d}, namespace, configMaps, secrets)).To(Succeed())
+		Expect(configMaps).To(HaveKey(namespace + "/shared-settings"))
+		Expect(configMaps).NotTo(HaveKey("shared-settings"))
+	})
+
+	It("still rejects references to other namespaces", func() {
+		d.GetAnnotations()[ExtraConfigMapsAnnotation] = "kube-system/runtime-config"
+		configMaps := make(map[string]configMetadata)
+		secrets := make(map[string]configMetadata)
+		Expect(addExtraChildren(&deployment{d}, namespace, configMaps, secrets)).NotTo(Succeed())
+
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects references to the shared config namespace when it is not configured", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+		_, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rolls the Deployment when a ConfigMap in the shared config namespace changes", func() {
+		original := reconcileHash(c, h, d)
+		Expect(original).NotTo(BeEmpty())
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: shared.GetName()}, shared)).To(Succeed())
+		shared.Data["region"] = "us-east-1"
+		Expect(c.Update(context.TODO(), shared)).To(Succeed())
+
+		Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+	})
+
+	It("does not add an OwnerReference to the shared child", func() {
+		reconcileHash(c, h, d)
+
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: shared.GetName()}, shared)).To(Succeed())
+		Expect(shared.GetOwnerReferences()).To(BeEmpty())
+		Expect(shared.GetLabels()).To(BeEmpty())
+	})
+
+	It("tracks a shared child with the same name as a child in the workload's namespace", func() {
+		d.GetAnnotations()[ExtraConfigMapsAnnotation] = namespace + "/" + utils.ExampleConfigMap1.GetName()
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		cm.SetNamespace(namespace)
+		Expect(c.Create(context.TODO(), cm)).To(Succeed())
+
+		children, err := h.getCurrentChildren(&deployment{d})
+		Expect(err).NotTo(HaveOccurred())
+
+		namespaces := []string{}
+		for _, child := range children {
+			if child.object.GetName() == utils.ExampleConfigMap1.GetName() {
+				namespaces = append(namespaces, child.object.GetNamespace())
+			}
+		}
+		Expect(namespaces).To(ContainElement(namespace))
+		Expect(namespaces).To(ContainElement(d.GetNamespace()))
+	})
+
+	Context("with a shared child and a local child of the same name", func() {
+		var local *corev1.ConfigMap
+		var children []configObject
+
+		BeforeEach(func() {
+			local = shared.DeepCopy()
+			local.SetNamespace(d.GetNamespace())
+			local.Data = map[string]string{"region": "us-east-1"}
+			children = []configObject{
+				{object: shared, allKeys: true},
+				{object: local, allKeys: true},
+			}
+		})
+
+		It("keeps both children when merging", func() {
+			Expect(mergeChildren(children[:1], children[1:])).To(HaveLen(2))
+		})
+
+		It("hashes both children", func() {
+			original, err := calculateConfigHash(children)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, cm := range []*corev1.ConfigMap{shared, local} {
+				cm.Data["region"] = "ap-south-1"
+				updated, err := calculateConfigHash(children)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updated).NotTo(Equal(original))
+				original = updated
+			}
+		})
+	})
+
+	It("keeps the local extra children in the child index", func() {
+		d.GetAnnotations()[ExtraConfigMapsAnnotation] = namespace + "/shared-settings,runtime-config"
+		values := getChildIndexValues(d)
+		Expect(values).To(ContainElement("ConfigMap/runtime-config"))
+		Expect(values).NotTo(ContainElement("ConfigMap/shared-settings"))
+	})
+
+	Context("getSharedChildRequests", func() {
+		BeforeEach(func() {
+			unrelated := utils.ExampleDeployment.DeepCopy()
+			unrelated.SetName("unrelated")
+			unrelated.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+			disabled := d.DeepCopy()
+			disabled.SetName("disabled")
+			disabled.SetAnnotations(map[string]string{ExtraConfigMapsAnnotation: namespace + "/shared-settings"})
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, unrelated, disabled, shared)
+		})
+
+		It("enqueues the Deployments listing a changed shared child", func() {
+			requests := getSharedChildRequests(c, &appsv1.DeploymentList{}, namespace, nil, false, shared, shared)
+			Expect(requests).To(ConsistOf(reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: d.GetNamespace(), Name: d.GetName()},
+			}))
+		})
+
+		It("ignores children outside the shared config namespace", func() {
+			local := shared.DeepCopy()
+			local.SetNamespace(d.GetNamespace())
+			Expect(getSharedChildRequests(c, &appsv1.DeploymentList{}, namespace, nil, false, local, local)).To(BeEmpty())
+		})
+
+		It("ignores a Secret sharing the ConfigMap's name", func() {
+			s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: shared.GetName()}}
+			Expect(getSharedChildRequests(c, &appsv1.DeploymentList{}, namespace, nil, false, s, s)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Shutdown tracks the reconciles in progress so that they can complete when
+// Wave is shutting down. A nil Shutdown tracks nothing.
+type Shutdown struct {
+	mutex    sync.Mutex
+	draining bool
+	active   sync.WaitGroup
+}
+
+// begin records the start of a reconcile, returning false if Wave is shutting
+// down and no new reconciles should be started
+func (s *Shutdown) begin() bool {
+	if s == nil {
+		return true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.draining {
+		return false
+	}
+	s.active.Add(1)
+	return true
+}
+
+// done records the end of a reconcile started with begin
+func (s *Shutdown) done() {
+	if s == nil {
+		return
+	}
+	s.active.Done()
+}
+
+// Wait stops any new reconciles from starting and waits up to the timeout for
+// the reconciles in progress to complete, returning false if they did not
+// complete in time
+func (s *Shutdown) Wait(timeout time.Duration) bool {
+	if s == nil {
+		return true
+	}
+	s.mutex.Lock()
+	s.draining = true
+	s.mutex.Unlock()
+
+	completed := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(completed)
+	}()
+	select {
+	case <-completed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// blockingClient blocks each Get until released, signalling the first Get
+// that is waiting
+type blockingClient struct {
+	client.Client
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	select {
+	case c.started <- struct{}{}:
+	default:
+	}
+	<-c.release
+	return c.Client.Get(ctx, key, obj)
+}
+
+var _ = Describe("Wave shutdown Suite", func() {
+	var c *blockingClient
+	var h *Handler
+	var d *appsv1.Deployment
+	var shutdown *Shutdown
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		c = &blockingClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			),
+			started: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		shutdown = &Shutdown{}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{Shutdown: shutdown})
+	})
+
+	It("waits for a reconcile in progress to complete", func() {
+		reconciled := make(chan error)
+		go func() {
+			_, err := h.HandleDeployment(d)
+			reconciled <- err
+		}()
+		Eventually(c.started).Should(Receive())
+
+		waited := make(chan bool)
+		go func() {
+			waited <- shutdown.Wait(5 * time.Second)
+		}()
+		Consistently(waited, 100*time.Millisecond).ShouldNot(Receive())
+
+		close(c.release)
+		Eventually(reconciled).Should(Receive(BeNil()))
+		Eventually(waited).Should(Receive(BeTrue()))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("returns false if a reconcile does not complete within the timeout", func() {
+		go h.HandleDeployment(d)
+		Eventually(c.started).Should(Receive())
+
+		Expect(shutdown.Wait(10 * time.Millisecond)).To(BeFalse())
+		close(c.release)
+	})
+
+	It("requeues reconciles started once shutting down", func() {
+		close(c.release)
+		Expect(shutdown.Wait(time.Second)).To(BeTrue())
+
+		result, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Requeue).To(BeTrue())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		Expect(updated.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("tracks nothing when nil", func() {
+		var s *Shutdown
+		Expect(s.begin()).To(BeTrue())
+		s.done()
+		Expect(s.Wait(0)).To(BeTrue())
+	})
+})
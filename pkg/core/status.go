@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+)
+
+// setStatus records the outcome of a reconcile on the metadata of the given
+// podController, removing the message if it is empty
+func setStatus(obj podController, status, message string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[StatusAnnotation] = status
+	if message == "" {
+		delete(annotations, StatusMessageAnnotation)
+	} else {
+		annotations[StatusMessageAnnotation] = message
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// setStatusReason records the reason for the outcome of a reconcile, as one
+// of the Reason constants, on the metadata of the given podController
+func setStatusReason(obj podController, reason string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[StatusReasonAnnotation] = reason
+	obj.SetAnnotations(annotations)
+}
+
+// removeStatus removes the outcome of the last reconcile, and any drift it
+// found, from the metadata of the given podController
+func removeStatus(obj podController) {
+	annotations := obj.GetAnnotations()
+	for _, k := range []string{StatusAnnotation, StatusReasonAnnotation, StatusMessageAnnotation, ConfigDriftAnnotation} {
+		if _, ok := annotations[k]; ok {
+			delete(annotations, k)
+			obj.SetAnnotations(annotations)
+		}
+	}
+}
+
+// reportStatus updates the status of an instance that the reconcile did not
+// otherwise update, along with the reason for it. Failing to report the
+// status is only logged, so that it never hides the outcome being reported.
+// The message is truncated to the Handler's details size and nothing is
+// written in dry-run mode.
+func (h *Handler) reportStatus(obj podController, status, reason, message string) {
+	message = truncateDetail(message, h.getMaxDetailsSize())
+	annotations := obj.GetAnnotations()
+	if h.opts.DryRun || (annotations[StatusAnnotation] == status && annotations[StatusReasonAnnotation] == reason && annotations[StatusMessageAnnotation] == message) {
+		return
+	}
+
+	copy := obj.DeepCopy()
+	setStatus(copy, status, message)
+	setStatusReason(copy, reason)
+	err := h.Update(context.TODO(), copy.GetObject())
+	if err != nil {
+		h.log.Error(err, "error reporting instance status", "namespace", obj.GetNamespace(), "name", obj.GetName(), "status", status)
+	}
+}
+
+// reportReconcileStatus reports the status of an instance whose reconcile
+// failed, naming the missing children if they caused the failure
+func (h *Handler) reportReconcileStatus(obj podController, err error) {
+	if missing, ok := err.(*missingChildError); ok {
+		h.reportStatus(obj, StatusMissingChildren, ReasonMissingChild, h.describeMissingChildren(missing.missing))
+		return
+	}
+	h.reportStatus(obj, StatusError, ReasonError, err.Error())
+}
+
+// describeMissingChildren returns the status message naming the missing
+// children, leaving out those that do not fit within the Handler's details
+// size
+func (h *Handler) describeMissingChildren(missing []string) string {
+	const prefix = "Missing children: "
+	return prefix + truncateDetails(missing, ", ", h.getMaxDetailsSize()-len(prefix))
+}
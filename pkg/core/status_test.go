@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave status Suite", func() {
+	var c client.Client
+	var h *Handler
+	var d *appsv1.Deployment
+
+	// handle reconciles the current state of the Deployment and returns its
+	// status annotations
+	var handle = func() map[string]string {
+		current := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, current)).To(Succeed())
+		_, _ = h.HandleDeployment(current)
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		status := map[string]string{}
+		for _, k := range []string{StatusAnnotation, StatusMessageAnnotation} {
+			if v, ok := updated.GetAnnotations()[k]; ok {
+				status[k] = v
+			}
+		}
+		return status
+	}
+
+	// deleteChild deletes the child
+	var deleteChild = func(obj Object) {
+		Expect(c.Delete(context.TODO(), obj)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+	})
+
+	It("reports a synced Deployment", func() {
+		Expect(handle()).To(Equal(map[string]string{StatusAnnotation: StatusSynced}))
+	})
+
+	It("reports missing children by name", func() {
+		deleteChild(utils.ExampleConfigMap2.DeepCopy())
+		deleteChild(utils.ExampleSecret1.DeepCopy())
+		Expect(handle()).To(Equal(map[string]string{
+			StatusAnnotation:        StatusMissingChildren,
+			StatusMessageAnnotation: "Missing children: ConfigMap/example2, Secret/example1",
+		}))
+	})
+
+	It("reports missing children required by the require-all-children annotation", func() {
+		d.GetAnnotations()[RequireAllChildrenAnnotation] = requiredAnnotationValue
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		deleteChild(utils.ExampleSecret3.DeepCopy())
+		status := handle()
+		Expect(status).To(HaveKeyWithValue(StatusAnnotation, StatusMissingChildren))
+		Expect(status[StatusMessageAnnotation]).To(ContainSubstring("ConfigMap/volume-optional"))
+		Expect(status[StatusMessageAnnotation]).To(ContainSubstring("Secret/example3"))
+	})
+
+	It("reports the Deployment as synced once its children exist again", func() {
+		deleteChild(utils.ExampleConfigMap2.DeepCopy())
+		Expect(handle()).To(HaveKeyWithValue(StatusAnnotation, StatusMissingChildren))
+
+		Expect(c.Create(context.TODO(), utils.ExampleConfigMap2.DeepCopy())).To(Succeed())
+		Expect(handle()).To(Equal(map[string]string{StatusAnnotation: StatusSynced}))
+	})
+
+	It("reports errors other than missing children", func() {
+		c = &otherNamespaceClient{Client: c}
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{})
+
+		status := handle()
+		Expect(status).To(HaveKeyWithValue(StatusAnnotation, StatusError))
+		Expect(status[StatusMessageAnnotation]).To(ContainSubstring("outside namespace"))
+	})
+
+	It("removes the status when Wave is disabled", func() {
+		Expect(handle()).To(HaveKey(StatusAnnotation))
+
+		current := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, current)).To(Succeed())
+		delete(current.GetAnnotations(), RequiredAnnotation)
+		Expect(c.Update(context.TODO(), current)).To(Succeed())
+		Expect(handle()).To(BeEmpty())
+	})
+
+	It("does not report the status in dry-run mode", func() {
+		h = NewHandler(c, record.NewFakeRecorder(100), Options{DryRun: true})
+		deleteChild(utils.ExampleConfigMap2.DeepCopy())
+		Expect(handle()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getThresholds parses the ThresholdAnnotation of the given podController
+// and returns the sorted thresholds of each key, keyed on the name of the
+// ConfigMap and then the key.
+// Entries are separated by `;` and take the form
+// `<configmap>/<key>:<threshold>,<threshold>,...`. Thresholds that are not
+// numeric are ignored, as are entries without any valid threshold.
+func getThresholds(obj podController) map[string]map[string][]float64 {
+	thresholds := make(map[string]map[string][]float64)
+	for _, entry := range strings.Split(obj.GetAnnotations()[ThresholdAnnotation], ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ref := strings.SplitN(parts[0], "/", 2)
+		if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+			continue
+		}
+
+		var values []float64
+		for _, threshold := range strings.Split(parts[1], ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+			if err != nil {
+				continue
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		sort.Float64s(values)
+
+		if thresholds[ref[0]] == nil {
+			thresholds[ref[0]] = make(map[string][]float64)
+		}
+		thresholds[ref[0]][ref[1]] = values
+	}
+	return thresholds
+}
+
+// setThresholds records the thresholds configured on the podController
+// against each of the ConfigMaps it references
+func setThresholds(obj podController, children []configObject) {
+	thresholds := getThresholds(obj)
+	if len(thresholds) == 0 {
+		return
+	}
+	for i, child := range children {
+		if _, ok := child.object.(*corev1.ConfigMap); ok {
+			children[i].thresholds = thresholds[child.object.GetName()]
+		}
+	}
+}
+
+// mergeThresholds combines the thresholds of two references to the same
+// child. A key is only gated by thresholds if both references use the same
+// thresholds for it, so that a reference without thresholds still sees every
+// change.
+func mergeThresholds(a, b map[string][]float64) map[string][]float64 {
+	var merged map[string][]float64
+	for key, thresholds := range a {
+		if !reflect.DeepEqual(thresholds, b[key]) {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string][]float64)
+		}
+		merged[key] = thresholds
+	}
+	return merged
+}
+
+// applyThreshold replaces a numeric value with the number of thresholds it
+// has reached, so that the hash only changes when the value crosses one of
+// the thresholds. Values that are not numeric are returned unmodified.
+func applyThreshold(value string, thresholds []float64) string {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("threshold:%d", sort.Search(len(thresholds), func(i int) bool {
+		return thresholds[i] > number
+	}))
+}
+
+// getThresholdsKey returns a stable representation of the child's thresholds
+func getThresholdsKey(child configObject) string {
+	keys := make([]string, 0, len(child.thresholds))
+	for key := range child.thresholds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, fmt.Sprintf("%s:%v", key, child.thresholds[key]))
+	}
+	return strings.Join(entries, ";")
+}
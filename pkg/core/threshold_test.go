@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave threshold Suite", func() {
+	Context("getThresholds", func() {
+		It("parses the sorted thresholds of each key", func() {
+			d := &deployment{utils.ExampleDeployment.DeepCopy()}
+			d.SetAnnotations(map[string]string{
+				ThresholdAnnotation: "app-config/cacheSizeMB:1000,100,500; app-config/workers:4;other/key:8",
+			})
+
+			Expect(getThresholds(d)).To(Equal(map[string]map[string][]float64{
+				"app-config": {
+					"cacheSizeMB": {100, 500, 1000},
+					"workers":     {4},
+				},
+				"other": {
+					"key": {8},
+				},
+			}))
+		})
+
+		It("ignores invalid entries and thresholds", func() {
+			d := &deployment{utils.ExampleDeployment.DeepCopy()}
+			d.SetAnnotations(map[string]string{
+				ThresholdAnnotation: "app-config:100;/key:100;app-config/key:large;app-config/cacheSizeMB:large,100",
+			})
+
+			Expect(getThresholds(d)).To(Equal(map[string]map[string][]float64{
+				"app-config": {
+					"cacheSizeMB": {100},
+				},
+			}))
+		})
+	})
+
+	Context("applyThreshold", func() {
+		thresholds := []float64{100, 500, 1000}
+
+		It("returns the same value for numbers between the same thresholds", func() {
+			Expect(applyThreshold("150", thresholds)).To(Equal(applyThreshold("499.5", thresholds)))
+		})
+
+		It("returns a different value either side of a threshold", func() {
+			Expect(applyThreshold("99", thresholds)).NotTo(Equal(applyThreshold("100", thresholds)))
+			Expect(applyThreshold("999", thresholds)).NotTo(Equal(applyThreshold("1001", thresholds)))
+		})
+
+		It("returns non-numeric values unmodified", func() {
+			Expect(applyThreshold("large", thresholds)).To(Equal("large"))
+		})
+	})
+
+	Context("When reconciling a Deployment with thresholds", func() {
+		var c client.Client
+		var h *Handler
+		var d *appsv1.Deployment
+		var cm *corev1.ConfigMap
+
+		// setValue updates the thresholded key of the ConfigMap
+		var setValue = func(value string) {
+			cm.Data["cacheSizeMB"] = value
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			cm = utils.ExampleConfigMap1.DeepCopy()
+			cm.Data["cacheSizeMB"] = "150"
+
+			d = utils.ExampleDeployment.DeepCopy()
+			d.SetAnnotations(map[string]string{
+				RequiredAnnotation:  requiredAnnotationValue,
+				ThresholdAnnotation: cm.GetName() + "/cacheSizeMB:100,500,1000",
+			})
+			d.Spec.Template.Spec.Volumes = []corev1.Volume{
+				{
+					Name: "config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: cm.GetName(),
+							},
+						},
+					},
+				},
+			}
+			d.Spec.Template.Spec.InitContainers = nil
+			d.Spec.Template.Spec.Containers = []corev1.Container{
+				{
+					Name:  "container",
+					Image: "container",
+				},
+			}
+
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d, cm)
+			h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+		})
+
+		It("does not update the config hash when the value moves within a threshold", func() {
+			original := reconcileHash(c, h, d)
+			setValue("450")
+			Expect(reconcileHash(c, h, d)).To(Equal(original))
+		})
+
+		It("updates the config hash when the value crosses a threshold", func() {
+			original := reconcileHash(c, h, d)
+			setValue("600")
+			crossed := reconcileHash(c, h, d)
+			Expect(crossed).NotTo(Equal(original))
+
+			setValue("50")
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(crossed))
+		})
+
+		It("updates the config hash when another key changes", func() {
+			original := reconcileHash(c, h, d)
+			cm.Data["key1"] = "modified"
+			Expect(c.Update(context.TODO(), cm)).To(Succeed())
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+
+		It("falls back to normal change detection for non-numeric values", func() {
+			setValue("large")
+			original := reconcileHash(c, h, d)
+			setValue("larger")
+			Expect(reconcileHash(c, h, d)).NotTo(Equal(original))
+		})
+	})
+})
@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// throttledBackoffBase is the delay before retrying an instance whose
+	// reconciliation was throttled by the API server for the first time
+	throttledBackoffBase = 5 * time.Second
+
+	// throttledBackoffMax is the maximum delay before retrying an instance
+	// whose reconciliation was throttled by the API server
+	throttledBackoffMax = 5 * time.Minute
+)
+
+// apiThrottledTotal counts the requests to the API server that were throttled
+// or timed out
+var apiThrottledTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "wave_api_throttled_total",
+	Help: "Total number of API server requests made by Wave that were throttled or timed out",
+})
+
+func init() {
+	metrics.Registry.MustRegister(apiThrottledTotal)
+}
+
+// isThrottled returns true if the error shows the API server is under
+// pressure, either by throttling the request or by timing out
+func isThrottled(err error) bool {
+	return errors.IsTooManyRequests(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err)
+}
+
+// throttleClient wraps a client.Client and counts the requests made by the
+// Handler that were throttled by the API server
+type throttleClient struct {
+	client.Client
+	throttled *int64
+}
+
+// observe records the error if it shows the API server is under pressure
+func (c *throttleClient) observe(err error) error {
+	if err != nil && isThrottled(err) {
+		atomic.AddInt64(c.throttled, 1)
+		apiThrottledTotal.Inc()
+	}
+	return err
+}
+
+// Get wraps client.Client.Get
+func (c *throttleClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return c.observe(c.Client.Get(ctx, key, obj))
+}
+
+// List wraps client.Client.List
+func (c *throttleClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return c.observe(c.Client.List(ctx, list, opts...))
+}
+
+// Update wraps client.Client.Update
+func (c *throttleClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.observe(c.Client.Update(ctx, obj, opts...))
+}
+
+// throttleBackoff tracks how many consecutive reconciliations of each instance
+// were throttled by the API server
+type throttleBackoff struct {
+	mutex    sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// next records a throttled reconciliation of the instance and returns how
+// long to wait before retrying it. The delay doubles with each consecutive
+// throttled reconciliation, up to throttledBackoffMax, with up to 50% jitter
+// added so that throttled instances do not all retry at once.
+func (b *throttleBackoff) next(key types.NamespacedName) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures == nil {
+		b.failures = make(map[types.NamespacedName]int)
+	}
+	failures := b.failures[key]
+	b.failures[key] = failures + 1
+
+	backoff := throttledBackoffBase
+	for i := 0; i < failures && backoff < throttledBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > throttledBackoffMax {
+		backoff = throttledBackoffMax
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff/2)))
+}
+
+// reset forgets any throttled reconciliations of the instance
+func (b *throttleBackoff) reset(key types.NamespacedName) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.failures, key)
+}
+
+// withThrottleBackoff runs the reconciliation and, if it failed while the API
+// server was throttling requests, replaces the error with an extended,
+// jittered requeue rather than retrying at the normal rate.
+// With concurrent reconciles, a failure while another reconciliation was
+// throttled also backs off, which is harmless as the API server is under
+// pressure either way.
+func (h *Handler) withThrottleBackoff(instance podController, reconcileFn func() (reconcile.Result, error)) (reconcile.Result, error) {
+	key := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+	before := atomic.LoadInt64(&h.throttled)
+
+	result, err := reconcileFn()
+	if err == nil {
+		h.backoff.reset(key)
+		return result, nil
+	}
+	if atomic.LoadInt64(&h.throttled) == before {
+		return result, err
+	}
+
+	backoff := h.backoff.next(key)
+	h.log.Error(err, "API server throttled reconciliation, backing off", "kind", kindOf(instance), "namespace", key.Namespace, "name", key.Name, "backoff", backoff.String())
+	return reconcile.Result{RequeueAfter: backoff}, nil
+}
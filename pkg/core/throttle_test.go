@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// erroringClient returns the configured error, if set, from every List call
+type erroringClient struct {
+	client.Client
+	err error
+}
+
+func (c *erroringClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// getThrottledTotal returns the current value of wave_api_throttled_total
+func getThrottledTotal() float64 {
+	m := &dto.Metric{}
+	Expect(apiThrottledTotal.Write(m)).To(Succeed())
+	return m.GetCounter().GetValue()
+}
+
+var _ = Describe("Wave throttle Suite", func() {
+	var d *appsv1.Deployment
+	var c *erroringClient
+	var h *Handler
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+
+		c = &erroringClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)}
+		h = NewHandler(c, record.NewFakeRecorder(10), Options{})
+	})
+
+	Context("When the API server throttles requests", func() {
+		BeforeEach(func() {
+			c.err = errors.NewTooManyRequests("too many requests", 1)
+		})
+
+		It("requeues after an extended backoff without an error", func() {
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", throttledBackoffBase))
+			Expect(result.RequeueAfter).To(BeNumerically("<", throttledBackoffBase*3/2))
+		})
+
+		It("doubles the backoff on each consecutive throttled reconcile", func() {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", 2*throttledBackoffBase))
+			Expect(result.RequeueAfter).To(BeNumerically("<", 3*throttledBackoffBase))
+		})
+
+		It("never backs off for longer than the maximum plus jitter", func() {
+			for i := 0; i < 20; i++ {
+				result, err := h.HandleDeployment(d)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeNumerically("<", throttledBackoffMax*3/2))
+			}
+		})
+
+		It("increments wave_api_throttled_total", func() {
+			before := getThrottledTotal()
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getThrottledTotal()).To(Equal(before + 1))
+		})
+
+		It("resets the backoff once a reconcile succeeds", func() {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+
+			c.err = nil
+			_, err = h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+
+			c.err = errors.NewTooManyRequests("too many requests", 1)
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<", throttledBackoffBase*3/2))
+		})
+	})
+
+	Context("When the API server times out", func() {
+		BeforeEach(func() {
+			c.err = errors.NewServerTimeout(appsv1.Resource("deployments"), "list", 1)
+		})
+
+		It("requeues after an extended backoff without an error", func() {
+			result, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", throttledBackoffBase))
+		})
+	})
+
+	Context("When another error occurs", func() {
+		BeforeEach(func() {
+			c.err = fmt.Errorf("connection refused")
+		})
+
+		It("returns the error", func() {
+			result, err := h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+		})
+
+		It("does not increment wave_api_throttled_total", func() {
+			before := getThrottledTotal()
+			_, err := h.HandleDeployment(d)
+			Expect(err).To(HaveOccurred())
+			Expect(getThrottledTotal()).To(Equal(before))
+		})
+	})
+})
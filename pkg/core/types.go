@@ -18,6 +18,7 @@ package core
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -36,9 +37,315 @@ const (
 	// checks for before processing the deployment
 	RequiredAnnotation = "wave.pusher.com/update-on-config-change"
 
+	// OwnedByLabelPrefix is the prefix of the label, followed by the UID of
+	// the owner, that Wave sets on each child it adds an OwnerReference to, so
+	// that the children of an owner can be listed with a label selector
+	OwnedByLabelPrefix = "wave.pusher.com/owned-by-"
+
+	// ownedByLabelValue is the value of the owned-by label on children
+	ownedByLabelValue = "true"
+
 	// requiredAnnotationValue is the value of the annotation on the Deployment that Wave
 	// checks for before processing the deployment
 	requiredAnnotationValue = "true"
+
+	// EnabledAnnotation is the key of the annotation on the Deployment that
+	// enables Wave for it with "true" or opts it out with "false", overriding
+	// whether Wave is enabled by default
+	EnabledAnnotation = "wave.pusher.com/enabled"
+
+	// ObserveOnlyAnnotation is the key of the annotation on the Deployment that
+	// tells Wave to track the configuration hash without ever modifying the
+	// PodTemplate
+	ObserveOnlyAnnotation = "wave.pusher.com/observe-only"
+
+	// TrackOnlyAnnotation is an alias of ObserveOnlyAnnotation, for workloads
+	// that are rolled out by another process
+	TrackOnlyAnnotation = "wave.pusher.com/track-only"
+
+	// ObservedConfigHashAnnotation is the key of the annotation on the
+	// Deployment's metadata that holds the configuration hash of observe-only
+	// Deployments
+	ObservedConfigHashAnnotation = "wave.pusher.com/observed-config-hash"
+
+	// HashGroupAnnotation is the key of the annotation on the Deployment that
+	// groups it with other workloads that must roll together whenever the
+	// configuration of any member of the group changes
+	HashGroupAnnotation = "wave.pusher.com/hash-group"
+
+	// ExcludeFromAggregateAnnotation is the key of the annotation on the
+	// Deployment that omits its configuration from the hash of the other
+	// members of its hash group
+	ExcludeFromAggregateAnnotation = "wave.pusher.com/exclude-from-aggregate"
+
+	// HashEpochAnnotation is the key of the annotation on the Deployment that
+	// holds its hash epoch. Bumping the epoch makes Wave adopt the current
+	// configuration hash without triggering a rollout
+	HashEpochAnnotation = "wave.pusher.com/hash-epoch"
+
+	// AdoptedHashEpochAnnotation is the key of the annotation on the
+	// Deployment's metadata that holds the last hash epoch Wave adopted
+	AdoptedHashEpochAnnotation = "wave.pusher.com/adopted-hash-epoch"
+
+	// AdoptedConfigHashAnnotation is the key of the annotation on the
+	// Deployment's metadata that holds the configuration hash adopted at the
+	// current hash epoch, until the configuration next changes
+	AdoptedConfigHashAnnotation = "wave.pusher.com/adopted-config-hash"
+
+	// MountedOnlyAnnotation is the key of the annotation on the
+	// Deployment that limits the ConfigMaps and Secrets referenced by Volumes
+	// to those whose Volume is mounted by a container
+	MountedOnlyAnnotation = "wave.pusher.com/mounted-only"
+
+	// RolloutOrderAnnotation is the key of the annotation on the Deployment
+	// that holds its rollout order. Deployments sharing a ConfigMap or Secret
+	// roll out in ascending rollout order.
+	RolloutOrderAnnotation = "wave.pusher.com/rollout-order"
+
+	// ContainersAnnotation is the key of the annotation on the Deployment
+	// that limits the ConfigMaps and Secrets referenced by EnvFrom and Env to
+	// those of the listed containers
+	ContainersAnnotation = "wave.pusher.com/containers"
+
+	// ContainerHashesAnnotation is the key of the annotation on the
+	// Deployment that records the configuration hash of each of its
+	// containers on its metadata
+	ContainerHashesAnnotation = "wave.pusher.com/container-hashes"
+
+	// ContainerHashAnnotationPrefix is the prefix of the annotations on the
+	// Deployment's metadata that hold the configuration hash of each of its
+	// containers, followed by the name of the container
+	ContainerHashAnnotationPrefix = "container-hash.wave.pusher.com/"
+
+	// ThresholdAnnotation is the key of the annotation on the Deployment that
+	// lists thresholds for numeric ConfigMap keys. Changes to such a key only
+	// trigger a rollout when its value crosses one of the thresholds
+	ThresholdAnnotation = "wave.pusher.com/threshold"
+
+	// HashJSONPathAnnotation is the key of the annotation on the Deployment
+	// that selects the parts of JSON documents in ConfigMap keys that are
+	// hashed, so that changes to the rest of each document do not roll out
+	HashJSONPathAnnotation = "wave.pusher.com/hash-jsonpath"
+
+	// PreRollValidateAnnotation is the key of the annotation on the Deployment
+	// that holds the URL of an endpoint that must accept a new configuration
+	// before Wave rolls it out
+	PreRollValidateAnnotation = "wave.pusher.com/pre-roll-validate"
+
+	// ExternalDigestAnnotation is the key of the annotation on the Deployment
+	// that references fields of other objects, such as the status of a custom
+	// resource, holding digests that Wave folds into the configuration hash
+	ExternalDigestAnnotation = "wave.pusher.com/external-digest"
+
+	// BatchWindowAnnotation is the key of the annotation on the Deployment
+	// that sets how long Wave holds a rollout after a configuration change so
+	// that further changes within the window are rolled out together
+	BatchWindowAnnotation = "wave.pusher.com/batch-window"
+
+	// RolloutDelayAnnotation is the key of the annotation on the Deployment
+	// that delays rollouts after a configuration change, as an alias of the
+	// BatchWindowAnnotation that is ignored if both are set
+	RolloutDelayAnnotation = "wave.pusher.com/rollout-delay"
+
+	// RequeueAfterAnnotation is the key of the annotation on the Deployment
+	// that overrides the delay before retrying it after a transient failure,
+	// such as a missing child or a throttled rollout
+	RequeueAfterAnnotation = "wave.pusher.com/requeue-after"
+
+	// ForceRolloutAnnotation is the key of the annotation on the Deployment
+	// holding a token that rolls the Deployment out whenever it changes
+	ForceRolloutAnnotation = "wave.pusher.com/force-rollout"
+
+	// HashSaltAnnotation is the key of the annotation on the Deployment
+	// holding a salt that is folded into its configuration hash
+	HashSaltAnnotation = "wave.pusher.com/hash-salt"
+
+	// ChildBundlesAnnotation is the key of the annotation on the Deployment
+	// that lists the child bundles, defined in the child bundles ConfigMap,
+	// whose ConfigMaps and Secrets Wave tracks alongside those referenced by
+	// the PodTemplate
+	ChildBundlesAnnotation = "wave.pusher.com/child-bundles"
+
+	// ExtraConfigMapsAnnotation is the key of the annotation on the Deployment
+	// that lists ConfigMaps, not referenced by the PodTemplate, that Wave
+	// tracks alongside those that are
+	ExtraConfigMapsAnnotation = "wave.pusher.com/extra-configmaps"
+
+	// ExtraSecretsAnnotation is the key of the annotation on the Deployment
+	// that lists Secrets, not referenced by the PodTemplate, that Wave tracks
+	// alongside those that are
+	ExtraSecretsAnnotation = "wave.pusher.com/extra-secrets"
+
+	// WatchSecretsAnnotation is an alias of ExtraSecretsAnnotation, for
+	// tooling that refers to Secrets it materialises by name
+	WatchSecretsAnnotation = "wave.pusher.com/watch-secrets"
+
+	// ExcludeChildrenAnnotation is the key of the annotation on the
+	// Deployment that lists ConfigMaps and Secrets it references that Wave
+	// neither hashes nor takes ownership of for it
+	ExcludeChildrenAnnotation = "wave.pusher.com/exclude-children"
+
+	// RequireAllChildrenAnnotation is the key of the annotation on the
+	// Deployment that treats every ConfigMap and Secret it references as
+	// required, blocking rollouts until all of them exist
+	RequireAllChildrenAnnotation = "wave.pusher.com/require-all-children"
+
+	// RollOnMissingAnnotation is the key of the annotation on the Deployment
+	// that rolls the Deployment out when a required ConfigMap or Secret it
+	// references is deleted, instead of reporting an error
+	RollOnMissingAnnotation = "wave.pusher.com/roll-on-missing"
+
+	// HashTargetAnnotation is the key of the annotation on the Deployment that
+	// lists where Wave writes the configuration hash on the PodTemplate
+	HashTargetAnnotation = "wave.pusher.com/hash-target"
+
+	// AppliedHashEnvAnnotation is the key of the annotation on the
+	// Deployment's metadata that holds the names of the environment variables
+	// Wave last wrote the configuration hash to
+	AppliedHashEnvAnnotation = "wave.pusher.com/applied-hash-env"
+
+	// ComputedByAnnotation is the key of the annotation on the Deployment's
+	// metadata that records the version of Wave and the hash format that
+	// computed the configuration hash
+	ComputedByAnnotation = "wave.pusher.com/computed-by"
+
+	// LastChangedChildrenAnnotation is the key of the annotation on the
+	// Deployment's metadata that lists the children whose changes caused the
+	// most recent rollout
+	LastChangedChildrenAnnotation = "wave.pusher.com/last-changed-children"
+
+	// RestartStrategyAnnotation is the key of the annotation on the
+	// Deployment that selects how its Pods are restarted when its
+	// configuration changes
+	RestartStrategyAnnotation = "wave.pusher.com/restart-strategy"
+
+	// RestartedConfigHashAnnotation is the key of the annotation on the
+	// Deployment's metadata that records the configuration hash its Pods were
+	// last restarted with by the delete-pods restart strategy
+	RestartedConfigHashAnnotation = "wave.pusher.com/restarted-config-hash"
+
+	// RestartStrategyDeletePods is the value of the RestartStrategyAnnotation
+	// that restarts Pods by deleting them rather than by updating the
+	// PodTemplate
+	RestartStrategyDeletePods = "delete-pods"
+
+	// ScanPodsAnnotation is the key of the annotation on the Deployment that
+	// makes Wave also track the ConfigMaps and Secrets referenced by
+	// containers and volumes injected into its Pods, such as sidecars added
+	// by mutating webhooks
+	ScanPodsAnnotation = "wave.pusher.com/scan-pods"
+
+	// StatusAnnotation is the key of the annotation on the Deployment's
+	// metadata that reports the outcome of its most recent reconcile, as one
+	// of the Status constants
+	StatusAnnotation = "wave.pusher.com/status"
+
+	// StatusMessageAnnotation is the key of the annotation on the
+	// Deployment's metadata that describes the status reported by the
+	// StatusAnnotation, if there is anything to describe
+	StatusMessageAnnotation = "wave.pusher.com/status-message"
+
+	// StatusReasonAnnotation is the key of the annotation on the Deployment's
+	// metadata that records the reason for the outcome of the most recent
+	// reconcile that updated it, as one of the Reason constants
+	StatusReasonAnnotation = "wave.pusher.com/status-reason"
+
+	// StatusSynced is the status of a Deployment whose configuration hash is
+	// up to date
+	StatusSynced = "Synced"
+
+	// StatusMissingChildren is the status of a Deployment with required
+	// children that do not exist
+	StatusMissingChildren = "MissingChildren"
+
+	// StatusError is the status of a Deployment that could not be reconciled
+	StatusError = "Error"
+
+	// ReasonNoChange is the reason for a reconcile that found the
+	// configuration hash of a Deployment up to date, or only updated its
+	// metadata
+	ReasonNoChange = "NoChange"
+
+	// ReasonRolloutTriggered is the reason for a reconcile that rolled out a
+	// Deployment with a new configuration hash
+	ReasonRolloutTriggered = "RolloutTriggered"
+
+	// ReasonRolloutDeferred is the reason for a reconcile that deferred the
+	// rollout of a Deployment, for example while it is paused
+	ReasonRolloutDeferred = "RolloutDeferred"
+
+	// ReasonMissingChild is the reason for a reconcile of a Deployment with
+	// required children that do not exist
+	ReasonMissingChild = "MissingChild"
+
+	// ReasonSkipped is the reason for a reconcile of a Deployment that Wave
+	// does not manage, or that is being deleted
+	ReasonSkipped = "Skipped"
+
+	// ReasonDryRun is the reason for a reconcile in dry-run mode, which never
+	// updates the Deployment
+	ReasonDryRun = "DryRun"
+
+	// ReasonError is the reason for a reconcile that failed for any reason
+	// other than a missing child
+	ReasonError = "Error"
+
+	// ConfigSummaryAnnotation is the key of the annotation on the
+	// Deployment's metadata that summarises the number of children of each
+	// kind when Wave last rolled it out
+	ConfigSummaryAnnotation = "wave.pusher.com/config-summary"
+
+	// LastUpdateTimeAnnotation is the key of the annotation on the
+	// PodTemplate that records when Wave last rolled out the Deployment
+	LastUpdateTimeAnnotation = "wave.pusher.com/last-update-time"
+
+	// PendingConfigHashAnnotation is the key of the annotation on the
+	// Deployment's metadata that records the configuration hash held back
+	// until the rollout window opens
+	PendingConfigHashAnnotation = "wave.pusher.com/pending-config-hash"
+
+	// ConfigDriftAnnotation is the key of the annotation on the Deployment's
+	// metadata that records the configuration hash calculated from its
+	// children while it differs from the hash applied to its PodTemplate
+	ConfigDriftAnnotation = "wave.pusher.com/config-drift"
+
+	// initialSyncChanges is the value of the LastChangedChildrenAnnotation
+	// when the most recent rollout first set the configuration hash
+	initialSyncChanges = "initial-sync"
+
+	// annotationHashTarget is the hash target that writes the configuration
+	// hash to the hash annotation on the PodTemplate
+	annotationHashTarget = "annotation"
+
+	// envHashTargetPrefix is the prefix of hash targets that write the
+	// configuration hash to an environment variable of every container
+	envHashTargetPrefix = "env:"
+
+	// NormalizeAnnotation is the key of the annotation on a ConfigMap or Secret
+	// that lists the normalizers Wave applies to its data before hashing
+	NormalizeAnnotation = "wave.pusher.com/normalize"
+
+	// CommentPrefixAnnotation is the key of the annotation on a ConfigMap or
+	// Secret that configures the comment prefixes used by the strip-comments
+	// normalizer
+	CommentPrefixAnnotation = "wave.pusher.com/comment-prefix"
+
+	// IgnoreKeysAnnotation is the key of the annotation on a ConfigMap or
+	// Secret that lists the data keys Wave excludes from the configuration hash
+	IgnoreKeysAnnotation = "wave.pusher.com/ignore-keys"
+
+	// RequiredKeysAnnotation is the key of the annotation on a ConfigMap or
+	// Secret that lists the only data keys Wave includes in the configuration
+	// hash
+	RequiredKeysAnnotation = "wave.pusher.com/required-keys"
+
+	// stripCommentsNormalizer is the value of the NormalizeAnnotation that
+	// enables stripping of comment lines before hashing
+	stripCommentsNormalizer = "strip-comments"
+
+	// defaultCommentPrefix is the comment prefix used by the strip-comments
+	// normalizer when none is configured for a key
+	defaultCommentPrefix = "#"
 )
 
 // Object is used as a helper interface when passing Kubernetes resources
@@ -56,6 +363,28 @@ type configObject struct {
 	required bool
 	allKeys  bool
 	keys     map[string]struct{}
+	prefixes map[string]struct{}
+
+	// thresholds holds the sorted thresholds of each numeric key, which
+	// is only hashed by the number of thresholds its value has reached
+	thresholds map[string][]float64
+
+	// jsonPaths holds the JSONPath of each key holding a JSON document, of
+	// which only the selected subvalues are hashed
+	jsonPaths map[string]string
+
+	// skippedKeys holds the keys that could not be normalized and are
+	// excluded from the hash
+	skippedKeys map[string]struct{}
+
+	// extracted holds the configuration of a child of an extra child kind,
+	// as extracted by the ChildExtractor of its kind
+	extracted map[string]string
+
+	// typeKeys holds the only keys of a Secret that are hashed because of
+	// its type, where an empty set hashes every key. The keys of the
+	// DefaultSecretTypeKeys are used if it is nil.
+	typeKeys map[string]struct{}
 }
 
 type podController interface {
@@ -126,3 +455,69 @@ func (d *daemonset) SetPodTemplate(template *corev1.PodTemplateSpec) {
 func (d *daemonset) DeepCopy() podController {
 	return &daemonset{d.DaemonSet.DeepCopy()}
 }
+
+// replicaset wraps a ReplicaSet that is not controlled by a Deployment.
+// Changes to its PodTemplate only apply to Pods it creates afterwards.
+type replicaset struct {
+	*appsv1.ReplicaSet
+}
+
+func (d *replicaset) GetObject() runtime.Object {
+	return d.ReplicaSet
+}
+
+func (d *replicaset) GetPodTemplate() *corev1.PodTemplateSpec {
+	return &d.ReplicaSet.Spec.Template
+}
+
+func (d *replicaset) SetPodTemplate(template *corev1.PodTemplateSpec) {
+	d.ReplicaSet.Spec.Template = *template
+}
+
+func (d *replicaset) DeepCopy() podController {
+	return &replicaset{d.ReplicaSet.DeepCopy()}
+}
+
+// cronjob wraps a CronJob, whose PodTemplate is the template of the Jobs it
+// creates
+type cronjob struct {
+	*batchv1beta1.CronJob
+}
+
+func (d *cronjob) GetObject() runtime.Object {
+	return d.CronJob
+}
+
+func (d *cronjob) GetPodTemplate() *corev1.PodTemplateSpec {
+	return &d.CronJob.Spec.JobTemplate.Spec.Template
+}
+
+func (d *cronjob) SetPodTemplate(template *corev1.PodTemplateSpec) {
+	d.CronJob.Spec.JobTemplate.Spec.Template = *template
+}
+
+func (d *cronjob) DeepCopy() podController {
+	return &cronjob{d.CronJob.DeepCopy()}
+}
+
+// podtemplate wraps a PodTemplate standing in for a workload, so that the
+// children of a PodTemplateSpec can be found without a workload
+type podtemplate struct {
+	*corev1.PodTemplate
+}
+
+func (d *podtemplate) GetObject() runtime.Object {
+	return d.PodTemplate
+}
+
+func (d *podtemplate) GetPodTemplate() *corev1.PodTemplateSpec {
+	return &d.PodTemplate.Template
+}
+
+func (d *podtemplate) SetPodTemplate(template *corev1.PodTemplateSpec) {
+	d.PodTemplate.Template = *template
+}
+
+func (d *podtemplate) DeepCopy() podController {
+	return &podtemplate{d.PodTemplate.DeepCopy()}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// unstructuredPodController wraps workloads that are not built in apps/v1
+// types, such as OpenKruise CloneSets, and keep their PodTemplate at
+// spec.template
+type unstructuredPodController struct {
+	*unstructured.Unstructured
+}
+
+func (u *unstructuredPodController) GetObject() runtime.Object {
+	return u.Unstructured
+}
+
+func (u *unstructuredPodController) GetPodTemplate() *corev1.PodTemplateSpec {
+	template := &corev1.PodTemplateSpec{}
+	raw, found, err := unstructured.NestedMap(u.Unstructured.Object, "spec", "template")
+	if err != nil || !found {
+		return template
+	}
+	// An unparseable PodTemplate is treated as empty
+	_ = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, template)
+	return template
+}
+
+// SetPodTemplate only writes back the annotations and container environment
+// variables of the PodTemplate, as these are the only parts of the
+// PodTemplate that Wave modifies. This avoids rewriting the rest of the
+// PodTemplate through the typed representation.
+func (u *unstructuredPodController) SetPodTemplate(template *corev1.PodTemplateSpec) {
+	u.setContainerEnv("initContainers", template.Spec.InitContainers)
+	u.setContainerEnv("containers", template.Spec.Containers)
+
+	annotations := template.GetAnnotations()
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(u.Unstructured.Object, "spec", "template", "metadata", "annotations")
+		return
+	}
+	// SetNestedStringMap can only fail if an intermediate field is not a map,
+	// in which case the PodTemplate is left unchanged
+	_ = unstructured.SetNestedStringMap(u.Unstructured.Object, annotations, "spec", "template", "metadata", "annotations")
+}
+
+// setContainerEnv writes the environment variables of the given containers
+// back to the matching entries of the named container list
+func (u *unstructuredPodController) setContainerEnv(field string, containers []corev1.Container) {
+	raw, found, err := unstructured.NestedSlice(u.Unstructured.Object, "spec", "template", "spec", field)
+	if err != nil || !found || len(raw) != len(containers) {
+		return
+	}
+
+	for i, container := range containers {
+		rawContainer, ok := raw[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if len(container.Env) == 0 {
+			delete(rawContainer, "env")
+			continue
+		}
+		env := make([]interface{}, 0, len(container.Env))
+		for j := range container.Env {
+			envVar, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&container.Env[j])
+			if err != nil {
+				return
+			}
+			env = append(env, envVar)
+		}
+		rawContainer["env"] = env
+	}
+	_ = unstructured.SetNestedSlice(u.Unstructured.Object, raw, "spec", "template", "spec", field)
+}
+
+func (u *unstructuredPodController) DeepCopy() podController {
+	return &unstructuredPodController{u.Unstructured.DeepCopy()}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave unstructured Suite", func() {
+	var cloneSet *unstructuredPodController
+
+	BeforeEach(func() {
+		cloneSet = &unstructuredPodController{&unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "apps.kruise.io/v1alpha1",
+				"kind":       "CloneSet",
+				"metadata": map[string]interface{}{
+					"name":      "example",
+					"namespace": "default",
+					"uid":       "1234",
+				},
+				"spec": map[string]interface{}{
+					"updateStrategy": map[string]interface{}{
+						"type": "InPlaceIfPossible",
+					},
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"app": "example",
+							},
+						},
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{
+									"name":  "container",
+									"image": "container",
+									"envFrom": []interface{}{
+										map[string]interface{}{
+											"configMapRef": map[string]interface{}{
+												"name": "example1",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}}
+	})
+
+	It("returns the PodTemplate from spec.template", func() {
+		template := cloneSet.GetPodTemplate()
+		Expect(template.GetLabels()).To(HaveKeyWithValue("app", "example"))
+		Expect(template.Spec.Containers).To(HaveLen(1))
+		Expect(template.Spec.Containers[0].EnvFrom[0].ConfigMapRef.Name).To(Equal("example1"))
+	})
+
+	It("discovers children referenced in the PodTemplate", func() {
+		configMaps, _ := getChildNamesByType(cloneSet)
+		Expect(configMaps).To(HaveKeyWithValue("example1", configMetadata{required: true, allKeys: true}))
+	})
+
+	It("only writes the PodTemplate annotations back", func() {
+		original := cloneSet.DeepCopy().(*unstructuredPodController)
+		setConfigHash(cloneSet, "hash", ConfigHashAnnotation)
+
+		Expect(cloneSet.GetPodTemplate().GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "hash"))
+		unstructured.RemoveNestedField(cloneSet.Object, "spec", "template", "metadata", "annotations")
+		Expect(cloneSet.Object).To(Equal(original.Object))
+	})
+
+	It("writes the container environment variables back for environment variable hash targets", func() {
+		cloneSet.SetAnnotations(map[string]string{HashTargetAnnotation: "env:CONFIG_HASH"})
+		setConfigHash(cloneSet, "hash", ConfigHashAnnotation)
+
+		env, found, err := unstructured.NestedSlice(cloneSet.Object, "spec", "template", "spec", "containers")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(env[0]).To(HaveKeyWithValue("env", []interface{}{
+			map[string]interface{}{"name": "CONFIG_HASH", "value": "hash"},
+		}))
+		Expect(cloneSet.GetPodTemplate().GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("does not modify the original when modifying a DeepCopy", func() {
+		copy := cloneSet.DeepCopy()
+		setConfigHash(copy, "hash", ConfigHashAnnotation)
+		Expect(cloneSet.GetPodTemplate().GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+	})
+
+	It("builds an OwnerReference using the workload's APIVersion and Kind", func() {
+		ownerRef := getOwnerReference(cloneSet)
+		Expect(ownerRef.APIVersion).To(Equal("apps.kruise.io/v1alpha1"))
+		Expect(ownerRef.Kind).To(Equal("CloneSet"))
+		Expect(ownerRef.UID).To(Equal(types.UID("1234")))
+	})
+})
+
+var _ = Describe("Wave Argo Rollout Suite", func() {
+	var rollout *unstructuredPodController
+
+	BeforeEach(func() {
+		rollout = &unstructuredPodController{&unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata": map[string]interface{}{
+					"name":      "example",
+					"namespace": "default",
+					"uid":       "5678",
+				},
+				"spec": map[string]interface{}{
+					"strategy": map[string]interface{}{
+						"canary": map[string]interface{}{
+							"steps": []interface{}{
+								map[string]interface{}{"setWeight": int64(20)},
+							},
+						},
+					},
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{
+									"name":  "container",
+									"image": "container",
+									"env": []interface{}{
+										map[string]interface{}{
+											"name": "PASSWORD",
+											"valueFrom": map[string]interface{}{
+												"secretKeyRef": map[string]interface{}{
+													"name": "example2",
+													"key":  "key1",
+												},
+											},
+										},
+									},
+								},
+							},
+							"volumes": []interface{}{
+								map[string]interface{}{
+									"name": "config",
+									"configMap": map[string]interface{}{
+										"name": "example1",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}}
+	})
+
+	It("discovers children referenced in the Rollout's template", func() {
+		configMaps, secrets := getChildNamesByType(rollout)
+		Expect(configMaps).To(HaveKeyWithValue("example1", configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveKey("example2"))
+		Expect(secrets["example2"].keys).To(HaveKey("key1"))
+		Expect(secrets["example2"].allKeys).To(BeFalse())
+	})
+
+	It("writes the hash to the Rollout's template", func() {
+		setConfigHash(rollout, "hash", ConfigHashAnnotation)
+		annotations, found, err := unstructured.NestedStringMap(rollout.Object, "spec", "template", "metadata", "annotations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(annotations).To(HaveKeyWithValue(ConfigHashAnnotation, "hash"))
+
+		strategy, _, _ := unstructured.NestedMap(rollout.Object, "spec", "strategy")
+		Expect(strategy).To(HaveKey("canary"))
+	})
+})
+
+var _ = Describe("Wave OpenShift DeploymentConfig Suite", func() {
+	var deploymentConfig *unstructuredPodController
+
+	BeforeEach(func() {
+		deploymentConfig = &unstructuredPodController{&unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "apps.openshift.io/v1",
+				"kind":       "DeploymentConfig",
+				"metadata": map[string]interface{}{
+					"name":      "example",
+					"namespace": "default",
+					"uid":       "9012",
+				},
+				"spec": map[string]interface{}{
+					"replicas": int64(2),
+					"selector": map[string]interface{}{
+						"app": "example",
+					},
+					"triggers": []interface{}{
+						map[string]interface{}{"type": "ConfigChange"},
+					},
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"app": "example",
+							},
+						},
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{
+									"name":  "container",
+									"image": "container",
+									"envFrom": []interface{}{
+										map[string]interface{}{
+											"configMapRef": map[string]interface{}{
+												"name": "example3",
+											},
+										},
+									},
+									"env": []interface{}{
+										map[string]interface{}{
+											"name": "PASSWORD",
+											"valueFrom": map[string]interface{}{
+												"secretKeyRef": map[string]interface{}{
+													"name": "example2",
+													"key":  "key1",
+												},
+											},
+										},
+									},
+								},
+							},
+							"volumes": []interface{}{
+								map[string]interface{}{
+									"name": "config",
+									"configMap": map[string]interface{}{
+										"name": "example1",
+									},
+								},
+								map[string]interface{}{
+									"name": "credentials",
+									"secret": map[string]interface{}{
+										"secretName": "example1",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}}
+	})
+
+	It("discovers children referenced in the DeploymentConfig's template", func() {
+		configMaps, secrets := getChildNamesByType(deploymentConfig)
+		Expect(configMaps).To(HaveLen(2))
+		Expect(configMaps).To(HaveKeyWithValue("example1", configMetadata{required: true, allKeys: true}))
+		Expect(configMaps).To(HaveKeyWithValue("example3", configMetadata{required: true, allKeys: true}))
+		Expect(secrets).To(HaveLen(2))
+		Expect(secrets).To(HaveKeyWithValue("example1", configMetadata{required: true, allKeys: true}))
+		Expect(secrets["example2"].keys).To(HaveKey("key1"))
+		Expect(secrets["example2"].allKeys).To(BeFalse())
+	})
+
+	It("writes the hash to the DeploymentConfig's template", func() {
+		setConfigHash(deploymentConfig, "hash", ConfigHashAnnotation)
+		annotations, found, err := unstructured.NestedStringMap(deploymentConfig.Object, "spec", "template", "metadata", "annotations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(annotations).To(HaveKeyWithValue(ConfigHashAnnotation, "hash"))
+
+		labels, _, _ := unstructured.NestedStringMap(deploymentConfig.Object, "spec", "template", "metadata", "labels")
+		Expect(labels).To(HaveKeyWithValue("app", "example"))
+		triggers, _, _ := unstructured.NestedSlice(deploymentConfig.Object, "spec", "triggers")
+		Expect(triggers).To(HaveLen(1))
+	})
+
+	It("sets an OwnerReference to the DeploymentConfig", func() {
+		ownerRef := getOwnerReference(deploymentConfig)
+		Expect(ownerRef.APIVersion).To(Equal("apps.openshift.io/v1"))
+		Expect(ownerRef.Kind).To(Equal("DeploymentConfig"))
+		Expect(ownerRef.Name).To(Equal("example"))
+	})
+})
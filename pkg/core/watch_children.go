@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/wave-k8s/wave/pkg/coalesce"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// WatchChildren makes the controller watch the ConfigMaps, Secrets and extra
+// child kinds referenced by its workloads, and the child bundles and shared
+// config namespace the options configure, enqueueing the workloads affected
+// by each change.
+// The obj and list are empty objects of the workload type and its list type.
+// Children deleted from the cluster are evicted from the HashCache of the
+// options, if any.
+func WatchChildren(c controller.Controller, mgr manager.Manager, obj, list runtime.Object, opts Options) error {
+	// enqueue debounces, and optionally coalesces, the requests of the handler
+	enqueue := func(h handler.EventHandler, coalesced bool) handler.EventHandler {
+		if coalesced {
+			h = coalesce.NewEventHandler(h, opts.ReverseWatchCoalesce)
+		}
+		return coalesce.NewDebouncedEventHandler(h, opts.DebounceInterval)
+	}
+
+	// The watches finding the workloads referencing a child see every change
+	// to it, including its deletion
+	childPredicates := ChildPredicates()
+	if opts.HashCache != nil {
+		childPredicates = append([]predicate.Predicate{newHashCachePredicate(opts.HashCache)}, childPredicates...)
+	}
+
+	// Watch ConfigMaps and Secrets referenced by a workload through the child
+	// index, or through their OwnerReferences
+	if opts.UsesChildIndex() {
+		err := IndexChildren(mgr.GetFieldIndexer(), obj)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range []runtime.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+			err = c.Watch(&source.Kind{Type: child}, enqueue(NewIndexedChildHandler(mgr.GetClient(), list, opts.WatchLabelSelector, opts.DefaultEnabled), true), childPredicates...)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		// Watch the ConfigMaps, Secrets and children of extra kinds owned by a
+		// workload
+		children := append([]runtime.Object{&corev1.ConfigMap{}, &corev1.Secret{}}, ExtraChildObjects(opts)...)
+		for _, child := range children {
+			err := c.Watch(&source.Kind{Type: child}, enqueue(&handler.EnqueueRequestForOwner{
+				IsController: false,
+				OwnerType:    obj,
+			}, true), childPredicates...)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Watch for referenced ConfigMaps and Secrets being recreated
+		for _, child := range []runtime.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+			err := c.Watch(&source.Kind{Type: child}, enqueue(NewRecreatedChildHandler(mgr.GetClient(), list, opts.WatchLabelSelector, opts.DefaultEnabled), false))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Watch the child bundles ConfigMap for changes to bundle definitions
+	if opts.ChildBundles.Name != "" {
+		err := c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, enqueue(NewChildBundleHandler(mgr.GetClient(), list, opts.ChildBundles, opts.WatchLabelSelector, opts.DefaultEnabled), false), ChildPredicates()...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch the ConfigMaps and Secrets in the shared config namespace, which
+	// workloads in other namespaces cannot own
+	if opts.SharedConfigNamespace != "" {
+		for _, child := range []runtime.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+			err := c.Watch(&source.Kind{Type: child}, enqueue(NewSharedChildHandler(mgr.GetClient(), list, opts.SharedConfigNamespace, opts.WatchLabelSelector, opts.DefaultEnabled), true), ChildPredicates()...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// watchRecordingController records the type of each object it watches
+type watchRecordingController struct {
+	queuelessController
+	watched []string
+}
+
+func (c *watchRecordingController) Watch(src source.Source, _ handler.EventHandler, _ ...predicate.Predicate) error {
+	c.watched = append(c.watched, fmt.Sprintf("%T", src.(*source.Kind).Type))
+	return nil
+}
+
+var _ = Describe("Wave watch children Suite", func() {
+	var mgr manager.Manager
+	var c *watchRecordingController
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.New(&rest.Config{Host: "http://127.0.0.1:1"}, manager.Options{
+			MapperProvider: func(*rest.Config) (meta.RESTMapper, error) {
+				return meta.NewDefaultRESTMapper(nil), nil
+			},
+			MetricsBindAddress: "0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		c = &watchRecordingController{}
+	})
+
+	It("watches owned and recreated ConfigMaps and Secrets", func() {
+		Expect(WatchChildren(c, mgr, &appsv1.Deployment{}, &appsv1.DeploymentList{}, Options{})).To(Succeed())
+		Expect(c.watched).To(Equal([]string{"*v1.ConfigMap", "*v1.Secret", "*v1.ConfigMap", "*v1.Secret"}))
+	})
+
+	It("watches the child bundles and the shared config namespace", func() {
+		opts := Options{
+			ChildBundles:          types.NamespacedName{Namespace: "wave", Name: "bundles"},
+			SharedConfigNamespace: "shared",
+		}
+		Expect(WatchChildren(c, mgr, &appsv1.Deployment{}, &appsv1.DeploymentList{}, opts)).To(Succeed())
+		Expect(c.watched).To(Equal([]string{
+			"*v1.ConfigMap", "*v1.Secret", "*v1.ConfigMap", "*v1.Secret",
+			"*v1.ConfigMap",
+			"*v1.ConfigMap", "*v1.Secret",
+		}))
+	})
+})
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// isEnabled returns true if Wave is enabled for the given podController.
+// Without a selector, workloads are enabled by their annotations as described
+// by isAnnotationEnabled, otherwise every workload whose labels match the
+// selector is enabled.
+// Wave is never enabled for a ReplicaSet controlled by another workload, such
+// as a Deployment copying its annotations to its ReplicaSets.
+func isEnabled(obj podController, selector labels.Selector, defaultEnabled bool) bool {
+	if _, ok := obj.(*replicaset); ok && metav1.GetControllerOf(obj) != nil {
+		return false
+	}
+	if selector == nil {
+		return isAnnotationEnabled(obj, defaultEnabled)
+	}
+	return matchesSelector(obj, selector)
+}
+
+// isEnabled returns true if Wave is enabled for the given podController with
+// the Handler's watch label selector and default
+func (h *Handler) isEnabled(obj podController) bool {
+	return isEnabled(obj, h.opts.WatchLabelSelector, h.opts.DefaultEnabled)
+}
+
+// matchesSelector returns true if the labels of the object match the selector
+func matchesSelector(obj metav1.Object, selector labels.Selector) bool {
+	return obj != nil && selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// WorkloadPredicates returns the Predicates to apply to the watch on the
+// workloads reconciled by a controller with the given options
+func WorkloadPredicates(opts Options) []predicate.Predicate {
+	predicates := []predicate.Predicate{NewWorkloadUpdatePredicate()}
+	if opts.WatchLabelSelector != nil {
+		predicates = append(predicates, NewWatchPredicate(opts.WatchLabelSelector, opts.finalizerName()))
+	}
+	return predicates
+}
+
+// NewWatchPredicate returns a Predicate for workload watches that only admits
+// workloads whose labels match the selector or that carry the given finalizer.
+// Updates are admitted if the workload matches the selector either before or
+// after the update, so that removing a matching label disables Wave for the
+// workload. Workloads carrying the finalizer are always admitted so that they
+// are cleaned up and can be deleted even if they stopped matching the selector
+// while Wave was not running, or were enabled by the annotation before the
+// selector was set.
+func NewWatchPredicate(selector labels.Selector, finalizer string) predicate.Predicate {
+	watched := func(obj metav1.Object) bool {
+		return matchesSelector(obj, selector) || (obj != nil && hasFinalizer(obj, finalizer))
+	}
+	return predicate.Funcs{
+		CreateFunc: func(evt event.CreateEvent) bool {
+			return watched(evt.Meta)
+		},
+		UpdateFunc: func(evt event.UpdateEvent) bool {
+			return watched(evt.MetaOld) || watched(evt.MetaNew)
+		},
+		DeleteFunc: func(evt event.DeleteEvent) bool {
+			return watched(evt.Meta)
+		},
+		GenericFunc: func(evt event.GenericEvent) bool {
+			return watched(evt.Meta)
+		},
+	}
+}
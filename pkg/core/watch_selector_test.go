@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Wave watch label selector Suite", func() {
+	var d *appsv1.Deployment
+	var selector labels.Selector
+
+	// withLabels returns a copy of the Deployment with the given labels
+	var withLabels = func(l map[string]string) *appsv1.Deployment {
+		copy := d.DeepCopy()
+		copy.SetLabels(l)
+		return copy
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(nil)
+
+		var err error
+		selector, err = labels.Parse("wave=enabled")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("isEnabled", func() {
+		It("uses the required annotation without a selector", func() {
+			Expect(isEnabled(&deployment{d}, nil, false)).To(BeFalse())
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			Expect(isEnabled(&deployment{d}, nil, false)).To(BeTrue())
+		})
+
+		It("uses the selector in place of the required annotation", func() {
+			Expect(isEnabled(&deployment{withLabels(map[string]string{"wave": "enabled"})}, selector, false)).To(BeTrue())
+
+			d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+			Expect(isEnabled(&deployment{withLabels(map[string]string{"wave": "disabled"})}, selector, false)).To(BeFalse())
+		})
+	})
+
+	Context("NewWatchPredicate", func() {
+		var matching *appsv1.Deployment
+		var other *appsv1.Deployment
+
+		BeforeEach(func() {
+			matching = withLabels(map[string]string{"wave": "enabled"})
+			other = withLabels(map[string]string{"app": "example"})
+		})
+
+		It("only admits matching workloads", func() {
+			p := NewWatchPredicate(selector, FinalizerString)
+			Expect(p.Create(event.CreateEvent{Meta: matching, Object: matching})).To(BeTrue())
+			Expect(p.Create(event.CreateEvent{Meta: other, Object: other})).To(BeFalse())
+			Expect(p.Delete(event.DeleteEvent{Meta: other, Object: other})).To(BeFalse())
+			Expect(p.Generic(event.GenericEvent{Meta: matching, Object: matching})).To(BeTrue())
+		})
+
+		It("admits updates that add or remove a matching label", func() {
+			p := NewWatchPredicate(selector, FinalizerString)
+			Expect(p.Update(event.UpdateEvent{MetaOld: other, ObjectOld: other, MetaNew: matching, ObjectNew: matching})).To(BeTrue())
+			Expect(p.Update(event.UpdateEvent{MetaOld: matching, ObjectOld: matching, MetaNew: other, ObjectNew: other})).To(BeTrue())
+			Expect(p.Update(event.UpdateEvent{MetaOld: other, ObjectOld: other, MetaNew: other, ObjectNew: other})).To(BeFalse())
+		})
+
+		It("admits workloads carrying the finalizer that do not match", func() {
+			p := NewWatchPredicate(selector, FinalizerString)
+			finalized := other.DeepCopy()
+			finalized.SetFinalizers([]string{FinalizerString})
+			Expect(p.Create(event.CreateEvent{Meta: finalized, Object: finalized})).To(BeTrue())
+			Expect(p.Delete(event.DeleteEvent{Meta: finalized, Object: finalized})).To(BeTrue())
+			Expect(p.Generic(event.GenericEvent{Meta: finalized, Object: finalized})).To(BeTrue())
+
+			deleting := finalized.DeepCopy()
+			now := metav1.Now()
+			deleting.SetDeletionTimestamp(&now)
+			Expect(p.Update(event.UpdateEvent{MetaOld: finalized, ObjectOld: finalized, MetaNew: deleting, ObjectNew: deleting})).To(BeTrue())
+		})
+
+		It("is not applied without a selector", func() {
+			Expect(WorkloadPredicates(Options{})).To(HaveLen(1))
+			Expect(WorkloadPredicates(Options{WatchLabelSelector: selector})).To(HaveLen(2))
+		})
+	})
+
+	Context("When reconciling a Deployment enabled by the selector", func() {
+		var c client.Client
+		var h *Handler
+
+		// reconcile handles the Deployment and returns its updated state
+		var reconcile = func() *appsv1.Deployment {
+			_, err := h.HandleDeployment(d)
+			Expect(err).NotTo(HaveOccurred())
+			updated := &appsv1.Deployment{}
+			Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+			d = updated
+			return updated
+		}
+
+		BeforeEach(func() {
+			d = withLabels(map[string]string{"wave": "enabled"})
+			c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+				utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+			)
+			h = NewHandler(c, record.NewFakeRecorder(100), Options{WatchLabelSelector: selector})
+		})
+
+		It("sets the config hash without the required annotation", func() {
+			updated := reconcile()
+			Expect(updated.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+			Expect(updated.GetFinalizers()).To(ContainElement(FinalizerString))
+		})
+
+		It("cleans up when the matching label is removed", func() {
+			reconcile()
+
+			d.SetLabels(map[string]string{"app": "example"})
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+			Expect(reconcile().GetFinalizers()).NotTo(ContainElement(FinalizerString))
+		})
+
+		It("removes the finalizer of a deleted workload that no longer matches", func() {
+			reconcile()
+
+			d.SetLabels(map[string]string{"app": "example"})
+			now := metav1.Now()
+			d.SetDeletionTimestamp(&now)
+			Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+			finalized := d.DeepCopy()
+			finalized.SetDeletionTimestamp(nil)
+			Expect(NewWatchPredicate(selector, FinalizerString).Update(event.UpdateEvent{MetaOld: finalized, ObjectOld: finalized, MetaNew: d, ObjectNew: d})).To(BeTrue())
+			Expect(reconcile().GetFinalizers()).NotTo(ContainElement(FinalizerString))
+		})
+	})
+})
@@ -17,6 +17,7 @@ limitations under the License.
 package core
 
 import (
+	"context"
 	"log"
 	"path/filepath"
 	"sync"
@@ -27,8 +28,11 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/pkg/apis"
 	"github.com/wave-k8s/wave/test/reporters"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -86,3 +90,27 @@ func StartTestManager(mgr manager.Manager) (chan struct{}, *sync.WaitGroup) {
 	}()
 	return stop, wg
 }
+
+// newDeployment returns a copy of the example Deployment, enabled for Wave,
+// with the given name and any additional annotations
+func newDeployment(name string, annotations map[string]string) *appsv1.Deployment {
+	d := utils.ExampleDeployment.DeepCopy()
+	d.SetName(name)
+	d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+	for key, value := range annotations {
+		d.GetAnnotations()[key] = value
+	}
+	return d
+}
+
+// reconcileHash handles the Deployment with the Handler, replaces it with its
+// updated state and returns its configuration hash
+func reconcileHash(c client.Client, h *Handler, d *appsv1.Deployment) string {
+	_, err := h.HandleDeployment(d)
+	Expect(err).NotTo(HaveOccurred())
+
+	updated := &appsv1.Deployment{}
+	Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+	*d = *updated
+	return d.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// WorkloadKinds records the kinds of workload with a Controller that are not
+// built in types, such as OpenKruise CloneSets. A WorkloadKinds may be shared
+// by the Handlers of every controller through their Options, so that each
+// Handler lists the workloads of every kind, such as the members of a hash
+// group, and not only those of the built in types.
+type WorkloadKinds struct {
+	mutex sync.Mutex
+	kinds []schema.GroupVersionKind
+}
+
+// Add records that the given kind of workload has a Controller.
+// Nothing is recorded if the WorkloadKinds is nil.
+func (k *WorkloadKinds) Add(gvk schema.GroupVersionKind) {
+	if k == nil {
+		return
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for _, kind := range k.kinds {
+		if kind == gvk {
+			return
+		}
+	}
+	k.kinds = append(k.kinds, gvk)
+}
+
+// lists returns an empty list of each recorded kind of workload
+func (k *WorkloadKinds) lists() []runtime.Object {
+	if k == nil {
+		return nil
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	lists := []runtime.Object{}
+	for _, gvk := range k.kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		lists = append(lists, list)
+	}
+	return lists
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NewWorkloadUpdatePredicate returns a Predicate for workload watches that
+// drops updates which cannot change how Wave reconciles the workload, such as
+// status updates.
+// Updates are admitted if the generation, the PodTemplate, the labels, the
+// Wave annotations, the finalizers or the deletion timestamp of the workload
+// changed, or if they complete a rollout of the workload, and resyncs, whose old and new objects share a resourceVersion, are
+// always admitted so that the workload is reconciled every sync period.
+func NewWorkloadUpdatePredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(evt event.UpdateEvent) bool {
+			return workloadChanged(evt.ObjectOld, evt.MetaOld, evt.ObjectNew, evt.MetaNew)
+		},
+	}
+}
+
+// workloadChanged returns true if the update from the old to the new object
+// may affect its reconciliation. Objects that are not workloads and resyncs
+// are always considered changed.
+func workloadChanged(oldObj runtime.Object, oldMeta metav1.Object, newObj runtime.Object, newMeta metav1.Object) bool {
+	if oldMeta == nil || newMeta == nil {
+		return true
+	}
+	if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return true
+	}
+
+	oldInstance, newInstance := toPodController(oldObj), toPodController(newObj)
+	if oldInstance == nil || newInstance == nil {
+		return true
+	}
+	if !reflect.DeepEqual(oldInstance.GetPodTemplate(), newInstance.GetPodTemplate()) {
+		return true
+	}
+	if !getRolloutProgress(oldInstance).complete && getRolloutProgress(newInstance).complete {
+		return true
+	}
+
+	return oldMeta.GetGeneration() != newMeta.GetGeneration() ||
+		!reflect.DeepEqual(oldMeta.GetLabels(), newMeta.GetLabels()) ||
+		!reflect.DeepEqual(waveAnnotations(oldMeta), waveAnnotations(newMeta)) ||
+		!reflect.DeepEqual(oldMeta.GetFinalizers(), newMeta.GetFinalizers()) ||
+		!reflect.DeepEqual(oldMeta.GetDeletionTimestamp(), newMeta.GetDeletionTimestamp())
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Wave workload update predicate Suite", func() {
+	var d *appsv1.Deployment
+
+	// update returns whether the workload update predicate admits the update
+	// from the Deployment to the updated Deployment
+	var update = func(oldObj, newObj runtime.Object) bool {
+		return NewWorkloadUpdatePredicate().Update(event.UpdateEvent{
+			ObjectOld: oldObj,
+			MetaOld:   oldObj.(metav1.Object),
+			ObjectNew: newObj,
+			MetaNew:   newObj.(metav1.Object),
+		})
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{RequiredAnnotation: requiredAnnotationValue})
+		d.SetGeneration(1)
+		d.SetResourceVersion("1")
+	})
+
+	It("drops status-only updates", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.Status.ObservedGeneration = 1
+		updated.Status.ReadyReplicas = 3
+		updated.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}
+		Expect(update(d, updated)).To(BeFalse())
+	})
+
+	It("admits the status update completing a rollout", func() {
+		rolling := d.DeepCopy()
+		rolling.SetResourceVersion("2")
+		rolling.Status.ObservedGeneration = 1
+		rolling.Status.Replicas = 2
+		rolling.Status.UpdatedReplicas = 1
+
+		complete := rolling.DeepCopy()
+		complete.SetResourceVersion("3")
+		complete.Status.Replicas = 1
+		complete.Status.AvailableReplicas = 1
+		Expect(update(rolling, complete)).To(BeTrue())
+
+		available := complete.DeepCopy()
+		available.SetResourceVersion("4")
+		available.Status.ReadyReplicas = 1
+		Expect(update(complete, available)).To(BeFalse())
+	})
+
+	It("drops updates that only bump the resourceVersion", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		Expect(update(d, updated)).To(BeFalse())
+	})
+
+	It("admits resyncs whose old and new objects are identical", func() {
+		Expect(update(d, d.DeepCopy())).To(BeTrue())
+	})
+
+	It("drops changes to annotations that are not Wave's", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.GetAnnotations()["deployment.kubernetes.io/revision"] = "2"
+		Expect(update(d, updated)).To(BeFalse())
+	})
+
+	It("admits changes to the PodTemplate", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.Spec.Template.Spec.Containers[0].Image = "updated"
+		Expect(update(d, updated)).To(BeTrue())
+	})
+
+	It("admits changes to the generation", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.SetGeneration(2)
+		Expect(update(d, updated)).To(BeTrue())
+	})
+
+	It("admits changes to the opt-in annotation and other Wave annotations", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.SetAnnotations(map[string]string{})
+		Expect(update(d, updated)).To(BeTrue())
+
+		updated = d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.GetAnnotations()[ForceRolloutAnnotation] = "1"
+		Expect(update(d, updated)).To(BeTrue())
+	})
+
+	It("admits changes to the labels", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.SetLabels(map[string]string{"new": "label"})
+		Expect(update(d, updated)).To(BeTrue())
+	})
+
+	It("admits the deletion of the workload", func() {
+		updated := d.DeepCopy()
+		updated.SetResourceVersion("2")
+		now := metav1.Now()
+		updated.SetDeletionTimestamp(&now)
+		Expect(update(d, updated)).To(BeTrue())
+
+		updated = d.DeepCopy()
+		updated.SetResourceVersion("2")
+		updated.SetFinalizers([]string{FinalizerString})
+		Expect(update(d, updated)).To(BeTrue())
+	})
+
+	It("admits updates of objects that are not workloads", func() {
+		cm := utils.ExampleConfigMap1.DeepCopy()
+		Expect(update(cm, cm.DeepCopy())).To(BeTrue())
+	})
+})
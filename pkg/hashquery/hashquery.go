@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hashquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/wave-k8s/wave/pkg/core"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// Path is the path that the hash endpoint is served on
+const Path = "/hash"
+
+// Response is the body of a successful response from the hash endpoint
+type Response struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+}
+
+// Server serves the configuration hash that Wave currently computes for a
+// workload, so that it can be compared with the expected configuration
+// before the workload is promoted.
+// Requests never modify the workload or its children, and the warnings Wave
+// would record as Events while hashing are discarded.
+type Server struct {
+	addr    string
+	handler *core.Handler
+	log     logr.Logger
+}
+
+// NewServer returns a Server that binds to the given address and reads
+// workloads and their children through the client
+func NewServer(addr string, c client.Client, opts core.Options) *Server {
+	return &Server{
+		addr:    addr,
+		handler: core.NewHandler(c, &record.FakeRecorder{}, opts),
+		log:     logf.Log.WithName("wave-hash-query"),
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the hash endpoint until the stop channel is closed.
+// The manager only starts the Server once its caches have synced.
+func (s *Server) Start(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, s)
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-stop
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP responds with the configuration hash of the workload named by
+// the namespace, name and kind query parameters. The kind defaults to
+// Deployment.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	namespace, name, kind := query.Get("namespace"), query.Get("name"), query.Get("kind")
+	if kind == "" {
+		kind = "Deployment"
+	}
+	if namespace == "" || name == "" {
+		http.Error(w, "namespace and name are required", http.StatusBadRequest)
+		return
+	}
+	obj, err := newWorkload(kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.handler.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("%s %s/%s not found", kind, namespace, name), http.StatusNotFound)
+			return
+		}
+		s.log.Error(err, "error fetching workload", "kind", kind, "namespace", namespace, "name", name)
+		http.Error(w, fmt.Sprintf("error fetching workload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := s.handler.ComputeConfigHash(obj)
+	if err != nil {
+		s.log.Error(err, "error computing configuration hash", "kind", kind, "namespace", namespace, "name", name)
+		http.Error(w, fmt.Sprintf("error computing configuration hash: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Kind: kind, Namespace: namespace, Name: name, Hash: hash})
+}
+
+// newWorkload returns an empty workload of the given kind
+func newWorkload(kind string) (runtime.Object, error) {
+	switch kind {
+	case "Deployment":
+		return &appsv1.Deployment{}, nil
+	case "StatefulSet":
+		return &appsv1.StatefulSet{}, nil
+	case "DaemonSet":
+		return &appsv1.DaemonSet{}, nil
+	case "ReplicaSet":
+		return &appsv1.ReplicaSet{}, nil
+	case "CronJob":
+		return &batchv1beta1.CronJob{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+}
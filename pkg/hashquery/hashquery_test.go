@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hashquery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave hash query Suite", func() {
+	var c client.Client
+	var s *Server
+	var d *appsv1.Deployment
+
+	// query returns the response to a request to the hash endpoint with the
+	// given query string
+	var query = func(method, rawQuery string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, Path+"?"+rawQuery, nil))
+		return w
+	}
+
+	// getDeployment returns the Deployment as currently stored by the client
+	var getDeployment = func() *appsv1.Deployment {
+		obj := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, obj)).To(Succeed())
+		return obj
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme, d,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		s = NewServer(":0", c, core.Options{})
+	})
+
+	It("returns the hash that Wave writes to the Deployment", func() {
+		h := core.NewHandler(c, record.NewFakeRecorder(100), core.Options{})
+		_, err := h.HandleDeployment(d)
+		Expect(err).NotTo(HaveOccurred())
+		expected := getDeployment().Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+		Expect(expected).NotTo(BeEmpty())
+
+		w := query(http.MethodGet, "namespace="+d.GetNamespace()+"&name="+d.GetName()+"&kind=Deployment")
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		response := Response{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &response)).To(Succeed())
+		Expect(response).To(Equal(Response{Kind: "Deployment", Namespace: d.GetNamespace(), Name: d.GetName(), Hash: expected}))
+	})
+
+	It("does not modify the Deployment", func() {
+		before := getDeployment()
+		w := query(http.MethodGet, "namespace="+d.GetNamespace()+"&name="+d.GetName())
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(getDeployment()).To(Equal(before))
+	})
+
+	It("returns not found for a workload that does not exist", func() {
+		w := query(http.MethodGet, "namespace="+d.GetNamespace()+"&name=missing")
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects requests without a namespace and name", func() {
+		w := query(http.MethodGet, "name="+d.GetName())
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects unsupported kinds", func() {
+		w := query(http.MethodGet, "namespace="+d.GetNamespace()+"&name="+d.GetName()+"&kind=Pod")
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("only supports GET requests", func() {
+		w := query(http.MethodPost, "namespace="+d.GetNamespace()+"&name="+d.GetName())
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
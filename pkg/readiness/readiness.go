@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// Path is the path that the readiness endpoint is served on
+const Path = "/readyz"
+
+// Probe reports whether the manager it has been added to is ready to
+// reconcile workloads accurately, that is once its caches have synced and
+// it has started its controllers.
+//
+// The manager only starts a Probe, alongside its controllers, once its caches
+// have synced. A Probe does not need leader election, so that replicas
+// waiting to be elected leader report ready once their caches have synced.
+type Probe struct {
+	cache cache.Cache
+	ready int32
+}
+
+// InjectCache is called by the manager to set the cache the Probe waits for
+func (p *Probe) InjectCache(c cache.Cache) error {
+	p.cache = c
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (p *Probe) NeedLeaderElection() bool {
+	return false
+}
+
+// Start marks the Probe ready once the cache has synced, and not ready again
+// once the stop channel is closed
+func (p *Probe) Start(stop <-chan struct{}) error {
+	if p.cache == nil || p.cache.WaitForCacheSync(stop) {
+		atomic.StoreInt32(&p.ready, 1)
+	}
+	<-stop
+	atomic.StoreInt32(&p.ready, 0)
+	return nil
+}
+
+// Ready returns true if the Probe has been marked ready
+func (p *Probe) Ready() bool {
+	return atomic.LoadInt32(&p.ready) == 1
+}
+
+// ServeHTTP responds with 200 if the Probe is ready and 503 otherwise
+func (p *Probe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// ListenAndServe serves the readiness endpoint of the Probe on the given
+// address until the stop channel is closed.
+// It should be started before the manager, so that the endpoint reports the
+// manager as not ready while its caches sync.
+func ListenAndServe(addr string, p *Probe, stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, p)
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-stop
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+var _ = Describe("Wave readiness Suite", func() {
+	var probe *Probe
+	var synced bool
+	var stop chan struct{}
+	var stopped chan struct{}
+
+	// status returns the status code of a request to the readiness endpoint
+	var status = func() int {
+		w := httptest.NewRecorder()
+		probe.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+		return w.Code
+	}
+
+	// start starts the Probe with a cache that has synced if synced is true
+	var start = func() {
+		Expect(probe.InjectCache(&informertest.FakeInformers{Synced: &synced})).To(Succeed())
+		stop = make(chan struct{})
+		stopped = make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(stopped)
+			Expect(probe.Start(stop)).To(Succeed())
+		}()
+	}
+
+	BeforeEach(func() {
+		probe = &Probe{}
+		synced = true
+	})
+
+	It("is not ready before it has been started", func() {
+		Expect(probe.Ready()).To(BeFalse())
+		Expect(status()).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("is ready once the cache has synced", func() {
+		start()
+		Eventually(probe.Ready, time.Second).Should(BeTrue())
+		Expect(status()).To(Equal(http.StatusOK))
+
+		close(stop)
+		Eventually(stopped, time.Second).Should(BeClosed())
+		Expect(status()).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("is not ready if the cache did not sync", func() {
+		synced = false
+		start()
+		Consistently(probe.Ready, 100*time.Millisecond).Should(BeFalse())
+
+		close(stop)
+		Eventually(stopped, time.Second).Should(BeClosed())
+	})
+
+	It("does not need leader election", func() {
+		Expect(probe.NeedLeaderElection()).To(BeFalse())
+	})
+})
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/wave-k8s/wave/pkg/core"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Path is the path the validating webhook is served on
+const Path = "/validate-wave-annotation"
+
+// Add registers the validating webhook for the wave annotation with the
+// webhook server of the Manager, if it is enabled
+func Add(mgr manager.Manager, opts core.Options) error {
+	if !opts.AnnotationWebhook {
+		return nil
+	}
+	mgr.GetWebhookServer().Register(Path, &webhook.Admission{Handler: &validator{}})
+	return nil
+}
+
+// validator rejects workloads that set the wave annotation to a value Wave
+// does not recognise, so that typos are reported when they are applied
+// rather than silently disabling Wave
+type validator struct{}
+
+// Handle validates the wave annotation of the object in the request
+func (v *validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// Objects are only rejected as they are created or updated
+	if len(req.Object.Raw) == 0 {
+		return admission.Allowed("")
+	}
+
+	// Only the metadata is needed, whatever the kind of the object
+	obj := &struct {
+		metav1.ObjectMeta `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := core.ValidateRequiredAnnotation(obj.GetAnnotations()); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
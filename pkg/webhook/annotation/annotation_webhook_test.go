@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotation
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/test/utils"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Wave annotation webhook Suite", func() {
+	// validate returns the response of the validator to the creation of the
+	// example Deployment with the given wave annotations
+	var validate = func(annotations map[string]string) admission.Response {
+		d := utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(annotations)
+		raw, err := json.Marshal(d)
+		Expect(err).NotTo(HaveOccurred())
+
+		return (&validator{}).Handle(context.TODO(), admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+	}
+
+	It("accepts recognised values", func() {
+		for _, value := range []string{"true", "false"} {
+			Expect(validate(map[string]string{core.RequiredAnnotation: value}).Allowed).To(BeTrue())
+		}
+	})
+
+	It("accepts workloads without the annotation", func() {
+		Expect(validate(nil).Allowed).To(BeTrue())
+	})
+
+	It("rejects typos", func() {
+		for _, value := range []string{"True", "yes", "ture"} {
+			response := validate(map[string]string{core.RequiredAnnotation: value})
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(core.RequiredAnnotation))
+		}
+	})
+
+	It("accepts deletions", func() {
+		response := (&validator{}).Handle(context.TODO(), admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{Operation: admissionv1beta1.Delete},
+		})
+		Expect(response.Allowed).To(BeTrue())
+	})
+})
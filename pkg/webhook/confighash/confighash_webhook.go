@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confighash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/wave-k8s/wave/pkg/core"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Path is the path the mutating webhook is served on
+const Path = "/mutate-wave-config-hash"
+
+// Add registers the mutating webhook injecting the configuration hash with
+// the webhook server of the Manager, if it is enabled
+func Add(mgr manager.Manager, opts core.Options) error {
+	if !opts.HashWebhook {
+		return nil
+	}
+	h := core.NewHandler(mgr.GetClient(), mgr.GetEventRecorderFor("wave"), opts)
+	mgr.GetWebhookServer().Register(Path, &webhook.Admission{Handler: &mutator{handler: h, log: logf.Log.WithName("wave-webhook")}})
+	return nil
+}
+
+// mutator injects the configuration hash into workloads as they are created,
+// and as they are updated with a new PodTemplate, so that their first rollout
+// already carries the hash rather than Wave rolling them out a second time
+type mutator struct {
+	handler *core.Handler
+	log     logr.Logger
+}
+
+// Handle injects the configuration hash into the workload in the request.
+// Workloads are always allowed, leaving the controller to hash them, if the
+// hash cannot be injected.
+func (m *mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj, err := newWorkload(req.Kind.Kind)
+	if err != nil || len(req.Object.Raw) == 0 {
+		return admission.Allowed("")
+	}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(req.Namespace)
+	}
+
+	// Updates that leave the PodTemplate unchanged do not roll the workload
+	// out, so rollouts deferred by Wave are never triggered here
+	if req.Operation == admissionv1beta1.Update {
+		changed, err := changesPodTemplate(req, obj)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !changed {
+			return admission.Allowed("")
+		}
+	}
+
+	injected, err := m.handler.InjectConfigHash(obj)
+	if err != nil {
+		m.log.Error(err, "error injecting configuration hash", "kind", req.Kind.Kind, "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return admission.Allowed(fmt.Sprintf("configuration hash not injected: %v", err))
+	}
+	if !injected {
+		return admission.Allowed("")
+	}
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+}
+
+// workload is a workload that the mutator can inject the configuration hash
+// into
+type workload interface {
+	runtime.Object
+	GetNamespace() string
+	SetNamespace(string)
+	GetName() string
+}
+
+// newWorkload returns an empty workload of the given kind
+func newWorkload(kind string) (workload, error) {
+	switch kind {
+	case "Deployment":
+		return &appsv1.Deployment{}, nil
+	case "StatefulSet":
+		return &appsv1.StatefulSet{}, nil
+	case "DaemonSet":
+		return &appsv1.DaemonSet{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+}
+
+// changesPodTemplate returns true if the update in the request changes the
+// PodTemplate of the workload
+func changesPodTemplate(req admission.Request, obj workload) (bool, error) {
+	if len(req.OldObject.Raw) == 0 {
+		return true, nil
+	}
+	old, err := newWorkload(req.Kind.Kind)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(getPodTemplate(old), getPodTemplate(obj)), nil
+}
+
+// getPodTemplate returns the PodTemplate of the workload
+func getPodTemplate(obj workload) interface{} {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return o.Spec.Template
+	case *appsv1.StatefulSet:
+		return o.Spec.Template
+	case *appsv1.DaemonSet:
+		return o.Spec.Template
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confighash
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/test/utils"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Wave config hash webhook Suite", func() {
+	var c client.Client
+	var m *mutator
+	var d *appsv1.Deployment
+
+	// raw returns the JSON encoding of the object
+	var raw = func(obj runtime.Object) []byte {
+		data, err := json.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+		return data
+	}
+
+	// handle returns the response of the mutator to the request
+	var handle = func(operation admissionv1beta1.Operation, kind string, obj, old runtime.Object) admission.Response {
+		req := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: operation,
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind},
+				Namespace: d.GetNamespace(),
+				Object:    runtime.RawExtension{Raw: raw(obj)},
+			},
+		}
+		if old != nil {
+			req.OldObject = runtime.RawExtension{Raw: raw(old)}
+		}
+		return m.Handle(context.TODO(), req)
+	}
+
+	// reconciledHash returns the hash the Handler writes to the Deployment
+	var reconciledHash = func() string {
+		reconciled := d.DeepCopy()
+		Expect(c.Create(context.TODO(), reconciled)).To(Succeed())
+		_, err := core.NewHandler(c, record.NewFakeRecorder(100), core.Options{}).HandleDeployment(reconciled)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: d.GetNamespace(), Name: d.GetName()}, updated)).To(Succeed())
+		return updated.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+	}
+
+	BeforeEach(func() {
+		d = utils.ExampleDeployment.DeepCopy()
+		d.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+
+		c = fake.NewFakeClientWithScheme(scheme.Scheme,
+			utils.ExampleConfigMap1.DeepCopy(), utils.ExampleConfigMap2.DeepCopy(), utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(), utils.ExampleSecret2.DeepCopy(), utils.ExampleSecret3.DeepCopy(),
+		)
+		m = &mutator{handler: core.NewHandler(c, record.NewFakeRecorder(100), core.Options{}), log: logf.Log}
+	})
+
+	It("injects the configuration hash into the template of a new Deployment", func() {
+		response := handle(admissionv1beta1.Create, "Deployment", d, nil)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).NotTo(BeEmpty())
+
+		patches, err := json.Marshal(response.Patches)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(patches)).To(ContainSubstring("/spec/template/metadata/annotations"))
+		Expect(string(patches)).To(ContainSubstring(reconciledHash()))
+	})
+
+	It("injects the configuration hash when an update changes the template", func() {
+		updated := d.DeepCopy()
+		updated.Spec.Template.Spec.Containers[0].Image = "updated"
+		response := handle(admissionv1beta1.Update, "Deployment", updated, d)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).NotTo(BeEmpty())
+	})
+
+	It("does not mutate updates leaving the template unchanged", func() {
+		updated := d.DeepCopy()
+		replicas := int32(3)
+		updated.Spec.Replicas = &replicas
+		response := handle(admissionv1beta1.Update, "Deployment", updated, d)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(BeEmpty())
+	})
+
+	It("does not mutate Deployments Wave is not enabled for", func() {
+		d.SetAnnotations(nil)
+		response := handle(admissionv1beta1.Create, "Deployment", d, nil)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(BeEmpty())
+	})
+
+	It("allows kinds it cannot inject the hash into", func() {
+		response := handle(admissionv1beta1.Create, "ReplicaSet", d, nil)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(BeEmpty())
+	})
+})
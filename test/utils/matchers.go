@@ -22,6 +22,7 @@ import (
 	"github.com/onsi/gomega"
 	gtypes "github.com/onsi/gomega/types"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -143,6 +144,8 @@ func (m *Matcher) eventuallyObject(obj Object, intervals ...interface{}) gomega.
 			u = &appsv1.Deployment{}
 		case *appsv1.DaemonSet:
 			u = &appsv1.DaemonSet{}
+		case *batchv1beta1.CronJob:
+			u = &batchv1beta1.CronJob{}
 		default:
 			panic("Unknown Object type.")
 		}
@@ -222,6 +225,8 @@ func WithPodTemplateAnnotations(matcher gtypes.GomegaMatcher) gtypes.GomegaMatch
 			return obj.(*appsv1.StatefulSet).Spec.Template.GetAnnotations()
 		case *appsv1.DaemonSet:
 			return obj.(*appsv1.DaemonSet).Spec.Template.GetAnnotations()
+		case *batchv1beta1.CronJob:
+			return obj.(*batchv1beta1.CronJob).Spec.JobTemplate.Spec.Template.GetAnnotations()
 		default:
 			panic("Unknown pod template type.")
 		}
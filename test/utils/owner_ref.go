@@ -18,6 +18,7 @@ package utils
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -62,3 +63,17 @@ func GetOwnerRefDaemonSet(sts *appsv1.DaemonSet) metav1.OwnerReference {
 		BlockOwnerDeletion: &t,
 	}
 }
+
+// GetOwnerRefCronJob constructs an owner reference for the CronJob given
+func GetOwnerRefCronJob(cj *batchv1beta1.CronJob) metav1.OwnerReference {
+	f := false
+	t := true
+	return metav1.OwnerReference{
+		APIVersion:         "batch/v1beta1",
+		Kind:               "CronJob",
+		Name:               cj.Name,
+		UID:                cj.UID,
+		Controller:         &f,
+		BlockOwnerDeletion: &t,
+	}
+}
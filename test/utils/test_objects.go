@@ -18,6 +18,8 @@ package utils
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -724,6 +726,221 @@ var ExampleDaemonSet = &appsv1.DaemonSet{
 	},
 }
 
+// ExampleCronJob is an example CronJob object for use within test suites
+var ExampleCronJob = &batchv1beta1.CronJob{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: batchv1beta1.CronJobSpec{
+		Schedule: "0 * * * *",
+		JobTemplate: batchv1beta1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: labels,
+					},
+					Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyOnFailure,
+						Volumes: []corev1.Volume{
+							{
+								Name: "secret1",
+								VolumeSource: corev1.VolumeSource{
+									Secret: &corev1.SecretVolumeSource{
+										SecretName: "example1",
+									},
+								},
+							},
+							{
+								Name: "configmap1",
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: "example1",
+										},
+									},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name:  "container1",
+								Image: "container1",
+								Env: []corev1.EnvVar{
+									{
+										Name: "example1_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example1",
+												},
+												Key: "key1",
+											},
+										},
+									},
+									{
+										Name: "example1_key1_new_name",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example1",
+												},
+												Key: "key1",
+											},
+										},
+									},
+									{
+										Name: "example3_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key: "key1",
+											},
+										},
+									},
+									{
+										Name: "example3_key4",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key:      "key4",
+												Optional: &trueValue,
+											},
+										},
+									},
+									{
+										Name: "example4_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example4",
+												},
+												Key:      "key1",
+												Optional: &trueValue,
+											},
+										},
+									},
+									{
+										Name: "example1_secret_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example1",
+												},
+												Key: "key1",
+											},
+										},
+									},
+									{
+										Name: "example3_secret_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key: "key1",
+											},
+										},
+									},
+									{
+										Name: "example3_secret_key4",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key:      "key4",
+												Optional: &trueValue,
+											},
+										},
+									},
+									{
+										Name: "example4_secret_key1",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example4",
+												},
+												Key:      "key1",
+												Optional: &trueValue,
+											},
+										},
+									},
+								},
+								EnvFrom: []corev1.EnvFromSource{
+									{
+										ConfigMapRef: &corev1.ConfigMapEnvSource{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "example1",
+											},
+										},
+									},
+									{
+										SecretRef: &corev1.SecretEnvSource{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "example1",
+											},
+										},
+									},
+								},
+							},
+							{
+								Name:  "container2",
+								Image: "container2",
+								Env: []corev1.EnvVar{
+									{
+										Name: "example3_key2",
+										ValueFrom: &corev1.EnvVarSource{
+											ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key: "key2",
+											},
+										},
+									},
+									{
+										Name: "example3_secret_key2",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "example3",
+												},
+												Key: "key2",
+											},
+										},
+									},
+								},
+								EnvFrom: []corev1.EnvFromSource{
+									{
+										ConfigMapRef: &corev1.ConfigMapEnvSource{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "example2",
+											},
+										},
+									},
+									{
+										SecretRef: &corev1.SecretEnvSource{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "example2",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
 // ExampleConfigMap1 is an example ConfigMap object for use within test suites
 var ExampleConfigMap1 = &corev1.ConfigMap{
 	ObjectMeta: metav1.ObjectMeta{